@@ -1,12 +1,34 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
 	"github.com/EmanuelAcosta1695/ecomm/db"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/allocation"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/auth"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/email"
 	handler "github.com/EmanuelAcosta1695/ecomm/ecomm-api/handler"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/jobs"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/mail"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/notify"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/outbox"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/payment"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/ratelimit"
 	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/server"
 	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tax"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/webhook"
 	"github.com/joho/godotenv"
 )
 
@@ -15,17 +37,150 @@ func main() {
 		log.Fatal("Error loading .env file")
 	}
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	l, err := logger.New(logger.LoadConfig(), os.Stdout)
+	if err != nil {
+		log.Fatalf("Failed to configure logger: %v", err)
+	}
+	slog.SetDefault(l)
+
+	tcfg, err := tracing.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load tracing config: %v", err)
+	}
+	shutdownTracing, err := tracing.Init(context.Background(), tcfg)
+	if err != nil {
+		log.Fatalf("Failed to configure tracing: %v", err)
+	}
+	defer shutdownTracing(context.Background())
+
 	db, err := db.NewDatabase()
 
 	if err != nil {
 		log.Fatalf("Failed to connect to the database: %v", err)
 	}
 	defer db.Close()
-	log.Println("Connected to the database successfully")
+	slog.Info("Connected to the database successfully")
+
+	metrics.RegisterDB(db.GetDB().DB)
+
+	scfg, err := server.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load server config: %v", err)
+	}
+	allocator, err := allocation.New(scfg.AllocationStrategy)
+	if err != nil {
+		log.Fatalf("Failed to configure allocation: %v", err)
+	}
+
+	st := storer.NewPySQLStorer(db.GetDB(), storer.WithAllocator(allocator))
+
+	ncfg, err := notify.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load notifier config: %v", err)
+	}
+	mcfg := mail.LoadConfig()
+	sender := mail.New(mcfg)
+	notifier := &notify.MailRecipients{
+		Notifier: notify.New(ncfg, sender, mcfg.From),
+		Sender:   sender,
+		From:     mcfg.From,
+	}
+
+	mailer, err := email.NewMailer(email.LoadConfig(), sender, mcfg.From)
+	if err != nil {
+		log.Fatalf("Failed to load email templates: %v", err)
+	}
+
+	taxTable, err := tax.LoadTable(tax.LoadConfig())
+	if err != nil {
+		log.Fatalf("Failed to load tax rates: %v", err)
+	}
+
+	pcfg := payment.LoadConfig()
+	gateway, err := payment.New(pcfg)
+	if err != nil {
+		log.Fatalf("Failed to configure payments: %v", err)
+	}
+
+	acfg, err := auth.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load auth config: %v", err)
+	}
+
+	srv := server.NewServer(st,
+		server.WithNotifier(notifier),
+		server.WithTaxCalculator(taxTable),
+		server.WithPaymentGateway(gateway, pcfg.Currency),
+		server.WithMailer(mailer),
+		server.WithAuth(acfg),
+	)
+
+	ocfg, err := outbox.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load outbox config: %v", err)
+	}
+	publisher, err := outbox.New(ocfg)
+	if err != nil {
+		log.Fatalf("Failed to configure outbox publisher: %v", err)
+	}
+	// Every event also goes to the webhook subscriptions that want it, and
+	// order events email the customer.
+	publisher = outbox.Fanout{publisher, &webhook.Enqueuer{Store: st}, srv.OrderEmails()}
+	relay := &outbox.Relay{Store: st, Publisher: publisher, BatchSize: ocfg.BatchSize, Interval: ocfg.PollInterval}
+	// Background workers use the database until they return, so it is not
+	// closed before they are all done.
+	var workers sync.WaitGroup
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		relay.Run(ctx)
+	}()
 
-	st := storer.NewPySQLStorer(db.GetDB())
-	srv := server.NewServer(st)
-	hdl := handler.NewHandler(srv)
+	wcfg, err := webhook.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load webhook config: %v", err)
+	}
+	dispatcher := webhook.NewDispatcher(st, wcfg)
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		dispatcher.Run(ctx)
+	}()
+
+	jcfg, err := jobs.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load jobs config: %v", err)
+	}
+	runner := jobs.NewRunner(st, jcfg)
+	if err := srv.RegisterJobs(runner, scfg); err != nil {
+		log.Fatalf("Failed to register jobs: %v", err)
+	}
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		runner.Run(ctx)
+	}()
+
+	rlcfg, err := ratelimit.LoadConfig()
+	if err != nil {
+		log.Fatalf("Failed to load rate limit config: %v", err)
+	}
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.First(ratelimit.ByAPIKey("X-API-Key", rlcfg.APIKeys)), rlcfg)
+
+	hcfg := handler.LoadConfig()
+	hcfg.AllowPrivateWebhookHosts = wcfg.AllowPrivateHosts
+	hdl := handler.NewHandler(srv, limiter, hcfg)
 	handler.RegisterRoutes(hdl)
-	handler.Start(":8080")
+	if err := handler.Start(ctx, ":8080"); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("server stopped", "error", err)
+		stop()
+	}
+
+	// Let running jobs, relays and deliveries finish before the database is
+	// closed.
+	workers.Wait()
+	slog.Info("shut down")
 }
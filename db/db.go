@@ -4,9 +4,11 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/jackc/pgx/v5"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 type Database struct {
@@ -22,12 +24,14 @@ func NewDatabase() (*Database, error) {
 	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable",
 		cfg.DBUser, cfg.DBPass, cfg.DBHost, cfg.DBPort, cfg.DBName)
 
-	db, err := sqlx.Open("pgx", dsn)
+	sqlDB, err := otelsql.Open("pgx", dsn,
+		otelsql.WithAttributes(attribute.String("db.system", "postgresql")),
+	)
 	if err != nil {
 		return nil, fmt.Errorf("error connecting to the database: %w", err)
 	}
 
-	return &Database{db: db}, nil
+	return &Database{db: sqlx.NewDb(sqlDB, "pgx")}, nil
 }
 
 func (d *Database) Close() error {
@@ -0,0 +1,7 @@
+ALTER TABLE orders
+    ADD COLUMN status VARCHAR(32) NOT NULL DEFAULT 'pending';
+
+CREATE INDEX idx_orders_user_id ON orders (user_id);
+CREATE INDEX idx_orders_status ON orders (status);
+CREATE INDEX idx_orders_created_at ON orders (created_at);
+CREATE INDEX idx_order_items_order_id ON order_items (order_id);
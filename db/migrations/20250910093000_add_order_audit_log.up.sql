@@ -0,0 +1,11 @@
+CREATE TABLE order_audit_log (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_order FOREIGN KEY(order_id) REFERENCES orders(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_order_audit_log_order_id ON order_audit_log (order_id);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS idx_orders_deleted_at;
+DROP INDEX IF EXISTS idx_products_deleted_at;
+
+ALTER TABLE orders
+    DROP COLUMN deleted_at;
+
+ALTER TABLE products
+    DROP COLUMN deleted_at;
@@ -0,0 +1,8 @@
+ALTER TABLE products
+    ADD COLUMN deleted_at TIMESTAMP;
+
+ALTER TABLE orders
+    ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX idx_products_deleted_at ON products (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX idx_orders_deleted_at ON orders (deleted_at) WHERE deleted_at IS NOT NULL;
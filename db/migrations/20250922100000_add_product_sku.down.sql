@@ -0,0 +1,5 @@
+ALTER TABLE products
+    DROP CONSTRAINT IF EXISTS uq_products_sku;
+
+ALTER TABLE products
+    DROP COLUMN sku;
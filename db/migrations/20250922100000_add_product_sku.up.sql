@@ -0,0 +1,5 @@
+ALTER TABLE products
+    ADD COLUMN sku VARCHAR(64) NOT NULL DEFAULT ('sku-' || gen_random_uuid());
+
+ALTER TABLE products
+    ADD CONSTRAINT uq_products_sku UNIQUE (sku);
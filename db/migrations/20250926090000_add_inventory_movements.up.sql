@@ -0,0 +1,20 @@
+CREATE TABLE inventory_movements (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL,
+    delta INT NOT NULL,
+    reason VARCHAR(32) NOT NULL,
+    actor VARCHAR(255) NOT NULL,
+    reference VARCHAR(255) NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_product FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE,
+    CONSTRAINT chk_reason CHECK (reason IN ('order', 'cancellation', 'adjustment', 'import', 'return'))
+);
+
+CREATE INDEX idx_inventory_movements_product_id ON inventory_movements (product_id);
+
+-- Open the ledger with the stock each product has today, so that replaying
+-- it matches count_in_stock from the start.
+INSERT INTO inventory_movements (product_id, delta, reason, actor, reference)
+SELECT id, count_in_stock, 'adjustment', 'system', 'opening-balance'
+FROM products
+WHERE count_in_stock <> 0;
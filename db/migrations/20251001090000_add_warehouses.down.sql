@@ -0,0 +1,4 @@
+ALTER TABLE inventory_movements DROP COLUMN IF EXISTS warehouse_id;
+ALTER TABLE order_items DROP COLUMN IF EXISTS warehouse_id;
+DROP TABLE IF EXISTS warehouse_stock;
+DROP TABLE IF EXISTS warehouses;
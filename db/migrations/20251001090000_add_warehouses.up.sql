@@ -0,0 +1,45 @@
+CREATE TABLE warehouses (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(64) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    latitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    longitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    priority INT NOT NULL DEFAULT 0,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uq_warehouses_code UNIQUE (code)
+);
+
+-- Stock changes that do not name a warehouse land in the default one.
+CREATE UNIQUE INDEX uq_warehouses_default ON warehouses (is_default) WHERE is_default;
+
+CREATE TABLE warehouse_stock (
+    warehouse_id INT NOT NULL,
+    product_id INT NOT NULL,
+    quantity INT NOT NULL DEFAULT 0,
+    PRIMARY KEY (warehouse_id, product_id),
+    CONSTRAINT fk_warehouse FOREIGN KEY(warehouse_id) REFERENCES warehouses(id) ON DELETE RESTRICT,
+    CONSTRAINT fk_product FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE,
+    CONSTRAINT chk_quantity CHECK (quantity >= 0)
+);
+
+CREATE INDEX idx_warehouse_stock_product_id ON warehouse_stock (product_id);
+
+INSERT INTO warehouses (code, name, is_default) VALUES ('default', 'Default warehouse', TRUE);
+
+-- Everything in stock today sits in the default warehouse; count_in_stock
+-- stays as the total across warehouses.
+INSERT INTO warehouse_stock (warehouse_id, product_id, quantity)
+SELECT w.id, p.id, p.count_in_stock
+FROM products p, warehouses w
+WHERE w.is_default AND p.count_in_stock > 0;
+
+ALTER TABLE order_items ADD COLUMN warehouse_id INT;
+UPDATE order_items SET warehouse_id = (SELECT id FROM warehouses WHERE is_default);
+ALTER TABLE order_items ALTER COLUMN warehouse_id SET NOT NULL;
+ALTER TABLE order_items ADD CONSTRAINT fk_order_items_warehouse FOREIGN KEY(warehouse_id) REFERENCES warehouses(id);
+
+ALTER TABLE inventory_movements ADD COLUMN warehouse_id INT;
+UPDATE inventory_movements SET warehouse_id = (SELECT id FROM warehouses WHERE is_default);
+ALTER TABLE inventory_movements ALTER COLUMN warehouse_id SET NOT NULL;
+ALTER TABLE inventory_movements ADD CONSTRAINT fk_inventory_movements_warehouse FOREIGN KEY(warehouse_id) REFERENCES warehouses(id);
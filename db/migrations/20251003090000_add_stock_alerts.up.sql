@@ -0,0 +1,14 @@
+ALTER TABLE products ADD COLUMN reorder_threshold INT NOT NULL DEFAULT 0;
+
+CREATE TABLE stock_subscriptions (
+    id SERIAL PRIMARY KEY,
+    product_id INT NOT NULL,
+    email VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    notified_at TIMESTAMP,
+    CONSTRAINT fk_product FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+-- A customer waits at most once per product; after being notified they can
+-- subscribe again.
+CREATE UNIQUE INDEX uq_stock_subscriptions_pending ON stock_subscriptions (product_id, email) WHERE notified_at IS NULL;
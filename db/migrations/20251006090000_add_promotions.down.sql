@@ -0,0 +1,5 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS discount_price;
+DROP TABLE IF EXISTS order_adjustments;
+DROP TABLE IF EXISTS promotion_redemptions;
+DROP TABLE IF EXISTS promotion_scopes;
+DROP TABLE IF EXISTS promotions;
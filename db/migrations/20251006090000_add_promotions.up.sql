@@ -0,0 +1,68 @@
+CREATE TABLE promotions (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(64) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    kind VARCHAR(32) NOT NULL,
+    value NUMERIC(10,2) NOT NULL DEFAULT 0,
+    buy_quantity INT NOT NULL DEFAULT 0,
+    get_quantity INT NOT NULL DEFAULT 0,
+    min_subtotal NUMERIC(10,2) NOT NULL DEFAULT 0,
+    starts_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    ends_at TIMESTAMP,
+    usage_limit INT NOT NULL DEFAULT 0,
+    per_user_limit INT NOT NULL DEFAULT 0,
+    times_used INT NOT NULL DEFAULT 0,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP,
+    CONSTRAINT uq_promotions_code UNIQUE (code),
+    CONSTRAINT chk_kind CHECK (kind IN ('percentage', 'fixed_amount', 'free_shipping', 'buy_x_get_y'))
+);
+
+-- A promotion with no scope rows applies to every product.
+CREATE TABLE promotion_scopes (
+    id SERIAL PRIMARY KEY,
+    promotion_id INT NOT NULL,
+    product_id INT,
+    category VARCHAR(255),
+    CONSTRAINT fk_promotion FOREIGN KEY(promotion_id) REFERENCES promotions(id) ON DELETE CASCADE,
+    CONSTRAINT fk_product FOREIGN KEY(product_id) REFERENCES products(id) ON DELETE CASCADE,
+    CONSTRAINT chk_scope CHECK ((product_id IS NULL) <> (category IS NULL))
+);
+
+CREATE INDEX idx_promotion_scopes_promotion_id ON promotion_scopes (promotion_id);
+
+CREATE TABLE promotion_redemptions (
+    id SERIAL PRIMARY KEY,
+    promotion_id INT NOT NULL,
+    order_id INT NOT NULL,
+    user_id INT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_promotion FOREIGN KEY(promotion_id) REFERENCES promotions(id),
+    CONSTRAINT fk_order FOREIGN KEY(order_id) REFERENCES orders(id) ON DELETE CASCADE,
+    CONSTRAINT uq_promotion_redemptions UNIQUE (promotion_id, order_id)
+);
+
+CREATE INDEX idx_promotion_redemptions_user ON promotion_redemptions (promotion_id, user_id);
+
+-- Discounts applied to an order: line level when order_item_id is set,
+-- order level otherwise. Amounts are positive and taken off the total.
+CREATE TABLE order_adjustments (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL,
+    order_item_id INT,
+    promotion_id INT,
+    code VARCHAR(64) NOT NULL DEFAULT '',
+    kind VARCHAR(32) NOT NULL,
+    amount NUMERIC(10,2) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_order FOREIGN KEY(order_id) REFERENCES orders(id) ON DELETE CASCADE,
+    CONSTRAINT fk_order_item FOREIGN KEY(order_item_id) REFERENCES order_items(id) ON DELETE CASCADE,
+    CONSTRAINT fk_promotion FOREIGN KEY(promotion_id) REFERENCES promotions(id),
+    CONSTRAINT chk_kind CHECK (kind IN ('discount', 'shipping_discount'))
+);
+
+CREATE INDEX idx_order_adjustments_order_id ON order_adjustments (order_id);
+
+ALTER TABLE orders ADD COLUMN discount_price NUMERIC(10,2) NOT NULL DEFAULT 0;
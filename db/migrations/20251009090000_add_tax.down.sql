@@ -0,0 +1,11 @@
+ALTER TABLE orders
+    DROP COLUMN IF EXISTS tax_inclusive,
+    DROP COLUMN IF EXISTS tax_postal_code,
+    DROP COLUMN IF EXISTS tax_region,
+    DROP COLUMN IF EXISTS tax_country;
+
+ALTER TABLE order_items
+    DROP COLUMN IF EXISTS tax_amount,
+    DROP COLUMN IF EXISTS tax_rate;
+
+ALTER TABLE products DROP COLUMN IF EXISTS tax_category;
@@ -0,0 +1,13 @@
+ALTER TABLE products ADD COLUMN tax_category VARCHAR(64) NOT NULL DEFAULT '';
+
+ALTER TABLE order_items
+    ADD COLUMN tax_rate NUMERIC(6,4) NOT NULL DEFAULT 0,
+    ADD COLUMN tax_amount NUMERIC(10,2) NOT NULL DEFAULT 0;
+
+-- The address tax was calculated for, so that edits to the order are taxed
+-- the same way, and whether prices already included it.
+ALTER TABLE orders
+    ADD COLUMN tax_country VARCHAR(2) NOT NULL DEFAULT '',
+    ADD COLUMN tax_region VARCHAR(64) NOT NULL DEFAULT '',
+    ADD COLUMN tax_postal_code VARCHAR(32) NOT NULL DEFAULT '',
+    ADD COLUMN tax_inclusive BOOLEAN NOT NULL DEFAULT FALSE;
@@ -0,0 +1,12 @@
+ALTER TABLE orders DROP COLUMN IF EXISTS shipping_method;
+
+ALTER TABLE products
+    DROP COLUMN IF EXISTS height,
+    DROP COLUMN IF EXISTS width,
+    DROP COLUMN IF EXISTS length,
+    DROP COLUMN IF EXISTS weight;
+
+DROP TABLE IF EXISTS shipping_rates;
+DROP TABLE IF EXISTS shipping_zone_regions;
+DROP TABLE IF EXISTS shipping_zones;
+DROP TABLE IF EXISTS shipping_methods;
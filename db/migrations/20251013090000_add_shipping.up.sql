@@ -0,0 +1,69 @@
+CREATE TABLE shipping_methods (
+    id SERIAL PRIMARY KEY,
+    code VARCHAR(32) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    active BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uq_shipping_methods_code UNIQUE (code)
+);
+
+CREATE TABLE shipping_zones (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uq_shipping_zones_name UNIQUE (name)
+);
+
+-- An empty region covers the whole country.
+CREATE TABLE shipping_zone_regions (
+    zone_id INT NOT NULL,
+    country VARCHAR(2) NOT NULL,
+    region VARCHAR(64) NOT NULL DEFAULT '',
+    PRIMARY KEY (zone_id, country, region),
+    CONSTRAINT fk_zone FOREIGN KEY(zone_id) REFERENCES shipping_zones(id) ON DELETE CASCADE
+);
+
+-- A rate without a zone applies to every destination. Zero maximums mean no
+-- upper bound, and a zero free_above never makes shipping free.
+CREATE TABLE shipping_rates (
+    id SERIAL PRIMARY KEY,
+    method_id INT NOT NULL,
+    zone_id INT,
+    min_weight NUMERIC(10,3) NOT NULL DEFAULT 0,
+    max_weight NUMERIC(10,3) NOT NULL DEFAULT 0,
+    min_subtotal NUMERIC(10,2) NOT NULL DEFAULT 0,
+    max_subtotal NUMERIC(10,2) NOT NULL DEFAULT 0,
+    price NUMERIC(10,2) NOT NULL DEFAULT 0,
+    per_kg NUMERIC(10,2) NOT NULL DEFAULT 0,
+    free_above NUMERIC(10,2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_method FOREIGN KEY(method_id) REFERENCES shipping_methods(id) ON DELETE CASCADE,
+    CONSTRAINT fk_zone FOREIGN KEY(zone_id) REFERENCES shipping_zones(id) ON DELETE CASCADE,
+    CONSTRAINT chk_amounts CHECK (
+        min_weight >= 0 AND max_weight >= 0 AND min_subtotal >= 0 AND max_subtotal >= 0
+        AND price >= 0 AND per_kg >= 0 AND free_above >= 0
+    )
+);
+
+CREATE INDEX idx_shipping_rates_method_id ON shipping_rates (method_id);
+
+INSERT INTO shipping_methods (code, name) VALUES
+    ('standard', 'Standard'),
+    ('express', 'Express'),
+    ('pickup', 'Store pickup');
+
+INSERT INTO shipping_rates (method_id, price, per_kg, free_above)
+SELECT id, 5.00, 1.00, 50.00 FROM shipping_methods WHERE code = 'standard';
+INSERT INTO shipping_rates (method_id, price, per_kg)
+SELECT id, 15.00, 2.00 FROM shipping_methods WHERE code = 'express';
+INSERT INTO shipping_rates (method_id)
+SELECT id FROM shipping_methods WHERE code = 'pickup';
+
+-- Weight in kg and dimensions in cm.
+ALTER TABLE products
+    ADD COLUMN weight NUMERIC(10,3) NOT NULL DEFAULT 0,
+    ADD COLUMN length NUMERIC(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN width NUMERIC(10,2) NOT NULL DEFAULT 0,
+    ADD COLUMN height NUMERIC(10,2) NOT NULL DEFAULT 0;
+
+ALTER TABLE orders ADD COLUMN shipping_method VARCHAR(32) NOT NULL DEFAULT '';
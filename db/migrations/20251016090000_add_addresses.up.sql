@@ -0,0 +1,45 @@
+CREATE TABLE addresses (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    line1 VARCHAR(255) NOT NULL,
+    line2 VARCHAR(255) NOT NULL DEFAULT '',
+    city VARCHAR(255) NOT NULL,
+    region VARCHAR(64) NOT NULL DEFAULT '',
+    postal_code VARCHAR(32) NOT NULL DEFAULT '',
+    country VARCHAR(2) NOT NULL,
+    phone VARCHAR(64) NOT NULL DEFAULT '',
+    is_default_shipping BOOLEAN NOT NULL DEFAULT FALSE,
+    is_default_billing BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP,
+    CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX idx_addresses_user_id ON addresses (user_id);
+
+-- A user has at most one default address of each kind.
+CREATE UNIQUE INDEX uq_addresses_default_shipping ON addresses (user_id) WHERE is_default_shipping;
+CREATE UNIQUE INDEX uq_addresses_default_billing ON addresses (user_id) WHERE is_default_billing;
+
+-- Copies of the addresses an order was placed with, so editing or deleting
+-- an address book entry does not rewrite order history. address_id is the
+-- entry the copy was taken from, if any.
+CREATE TABLE order_addresses (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL,
+    kind VARCHAR(16) NOT NULL,
+    address_id INT,
+    name VARCHAR(255) NOT NULL,
+    line1 VARCHAR(255) NOT NULL,
+    line2 VARCHAR(255) NOT NULL DEFAULT '',
+    city VARCHAR(255) NOT NULL,
+    region VARCHAR(64) NOT NULL DEFAULT '',
+    postal_code VARCHAR(32) NOT NULL DEFAULT '',
+    country VARCHAR(2) NOT NULL,
+    phone VARCHAR(64) NOT NULL DEFAULT '',
+    CONSTRAINT fk_order FOREIGN KEY(order_id) REFERENCES orders(id) ON DELETE CASCADE,
+    CONSTRAINT fk_address FOREIGN KEY(address_id) REFERENCES addresses(id) ON DELETE SET NULL,
+    CONSTRAINT uq_order_addresses_kind UNIQUE (order_id, kind),
+    CONSTRAINT chk_kind CHECK (kind IN ('shipping', 'billing'))
+);
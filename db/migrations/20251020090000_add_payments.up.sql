@@ -0,0 +1,22 @@
+CREATE TABLE payments (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL,
+    provider VARCHAR(32) NOT NULL,
+    reference VARCHAR(255) NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    amount NUMERIC(10,2) NOT NULL,
+    captured_amount NUMERIC(10,2) NOT NULL DEFAULT 0,
+    refunded_amount NUMERIC(10,2) NOT NULL DEFAULT 0,
+    currency VARCHAR(3) NOT NULL,
+    card_last4 VARCHAR(4) NOT NULL DEFAULT '',
+    redirect_url TEXT NOT NULL DEFAULT '',
+    failure_reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP,
+    CONSTRAINT fk_order FOREIGN KEY(order_id) REFERENCES orders(id) ON DELETE CASCADE,
+    CONSTRAINT uq_payments_reference UNIQUE (provider, reference),
+    CONSTRAINT chk_status CHECK (status IN ('requires_action', 'authorized', 'captured', 'refunded', 'voided', 'declined')),
+    CONSTRAINT chk_amounts CHECK (amount > 0 AND captured_amount <= amount AND refunded_amount <= captured_amount)
+);
+
+CREATE INDEX idx_payments_order_id ON payments (order_id);
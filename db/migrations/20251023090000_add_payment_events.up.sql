@@ -0,0 +1,16 @@
+CREATE TABLE payment_events (
+    id SERIAL PRIMARY KEY,
+    provider VARCHAR(32) NOT NULL,
+    event_id VARCHAR(255) NOT NULL,
+    type VARCHAR(64) NOT NULL,
+    reference VARCHAR(255) NOT NULL,
+    payload JSONB NOT NULL,
+    attempts INT NOT NULL DEFAULT 1,
+    error TEXT NOT NULL DEFAULT '',
+    received_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    processed_at TIMESTAMP,
+    CONSTRAINT uq_payment_events_event_id UNIQUE (provider, event_id)
+);
+
+CREATE INDEX idx_payment_events_reference ON payment_events (provider, reference);
+CREATE INDEX idx_payment_events_unprocessed ON payment_events (received_at) WHERE processed_at IS NULL;
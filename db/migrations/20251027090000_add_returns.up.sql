@@ -0,0 +1,59 @@
+CREATE TABLE returns (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL,
+    status VARCHAR(16) NOT NULL DEFAULT 'requested',
+    note TEXT NOT NULL DEFAULT '',
+    decision_note TEXT NOT NULL DEFAULT '',
+    decided_by VARCHAR(255) NOT NULL DEFAULT '',
+    decided_at TIMESTAMP,
+    refunded_amount NUMERIC(10,2) NOT NULL DEFAULT 0,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP,
+    CONSTRAINT fk_order FOREIGN KEY(order_id) REFERENCES orders(id) ON DELETE CASCADE,
+    CONSTRAINT chk_status CHECK (status IN ('requested', 'approved', 'rejected'))
+);
+
+CREATE INDEX idx_returns_order_id ON returns (order_id);
+CREATE INDEX idx_returns_status ON returns (status);
+
+CREATE TABLE return_items (
+    id SERIAL PRIMARY KEY,
+    return_id INT NOT NULL,
+    order_item_id INT NOT NULL,
+    product_id INT NOT NULL,
+    quantity INT NOT NULL,
+    reason VARCHAR(32) NOT NULL,
+    CONSTRAINT fk_return FOREIGN KEY(return_id) REFERENCES returns(id) ON DELETE CASCADE,
+    CONSTRAINT fk_order_item FOREIGN KEY(order_item_id) REFERENCES order_items(id) ON DELETE CASCADE,
+    CONSTRAINT chk_quantity CHECK (quantity > 0),
+    CONSTRAINT chk_reason CHECK (reason IN ('damaged', 'wrong_item', 'not_as_described', 'no_longer_needed', 'other'))
+);
+
+CREATE INDEX idx_return_items_return_id ON return_items (return_id);
+CREATE INDEX idx_return_items_order_item_id ON return_items (order_item_id);
+
+-- refunds are credits against an order. Each one was paid back through the
+-- payment it refunds; those made through the API are pending while the
+-- provider is asked for them.
+CREATE TABLE refunds (
+    id SERIAL PRIMARY KEY,
+    order_id INT NOT NULL,
+    payment_id INT,
+    return_id INT,
+    amount NUMERIC(10,2) NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    provider VARCHAR(32) NOT NULL DEFAULT '',
+    reference VARCHAR(255) NOT NULL DEFAULT '',
+    actor VARCHAR(255) NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL DEFAULT 'succeeded',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_order FOREIGN KEY(order_id) REFERENCES orders(id) ON DELETE CASCADE,
+    CONSTRAINT fk_payment FOREIGN KEY(payment_id) REFERENCES payments(id) ON DELETE SET NULL,
+    CONSTRAINT fk_return FOREIGN KEY(return_id) REFERENCES returns(id) ON DELETE SET NULL,
+    CONSTRAINT chk_amount CHECK (amount > 0),
+    CONSTRAINT chk_status CHECK (status IN ('pending', 'succeeded', 'failed'))
+);
+
+CREATE INDEX idx_refunds_order_id ON refunds (order_id);
+
+ALTER TABLE orders ADD COLUMN refunded_amount NUMERIC(10,2) NOT NULL DEFAULT 0;
@@ -0,0 +1,23 @@
+-- jobs is the background job queue. Workers claim due pending jobs with
+-- FOR UPDATE SKIP LOCKED; a failed job is retried at a later run_at until
+-- it has been tried max_attempts times.
+CREATE TABLE jobs (
+    id BIGSERIAL PRIMARY KEY,
+    kind VARCHAR(64) NOT NULL,
+    payload JSONB NOT NULL DEFAULT '{}',
+    -- key makes a job unique, such as one run of a recurring job.
+    key VARCHAR(255),
+    status VARCHAR(16) NOT NULL DEFAULT 'pending',
+    attempts INT NOT NULL DEFAULT 0,
+    max_attempts INT NOT NULL DEFAULT 5,
+    last_error TEXT NOT NULL DEFAULT '',
+    run_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP,
+    finished_at TIMESTAMP,
+    CONSTRAINT uq_key UNIQUE (key),
+    CONSTRAINT chk_status CHECK (status IN ('pending', 'succeeded', 'failed')),
+    CONSTRAINT chk_max_attempts CHECK (max_attempts > 0)
+);
+
+CREATE INDEX idx_jobs_pending ON jobs (run_at, id) WHERE status = 'pending';
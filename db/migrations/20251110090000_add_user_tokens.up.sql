@@ -0,0 +1,19 @@
+ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMP;
+
+-- user_tokens are the single-use tokens emailed to users to verify their
+-- address or reset their password. Only a hash of each token is kept.
+CREATE TABLE user_tokens (
+    id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    purpose VARCHAR(32) NOT NULL,
+    token_hash VARCHAR(64) NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT fk_user FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    CONSTRAINT uq_token_hash UNIQUE (token_hash),
+    CONSTRAINT chk_purpose CHECK (purpose IN ('verify_email', 'reset_password'))
+);
+
+CREATE INDEX idx_user_tokens_user_id ON user_tokens (user_id, purpose);
+CREATE INDEX idx_users_email ON users (LOWER(email));
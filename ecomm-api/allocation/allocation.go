@@ -0,0 +1,126 @@
+package allocation
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+func New(name string) (Strategy, error) {
+	switch name {
+	case StrategyNearest:
+		return Nearest{}, nil
+	case StrategyMostStock:
+		return MostStock{}, nil
+	case StrategySplit:
+		return Split{}, nil
+	default:
+		return nil, fmt.Errorf("unknown allocation strategy %q: must be %s, %s or %s",
+			name, StrategyNearest, StrategyMostStock, StrategySplit)
+	}
+}
+
+// Nearest ships the whole quantity from the closest warehouse that has it.
+// Without a destination, warehouses are ranked by priority.
+type Nearest struct{}
+
+func (Nearest) Allocate(req Request) ([]Allocation, error) {
+	if err := checkQuantity(req); err != nil {
+		return nil, err
+	}
+	for _, s := range byPreference(req) {
+		if s.Quantity >= req.Quantity {
+			return []Allocation{{WarehouseID: s.WarehouseID, Quantity: req.Quantity}}, nil
+		}
+	}
+	return nil, ErrUnfulfillable
+}
+
+// MostStock ships the whole quantity from the warehouse holding the most
+// units, keeping stock levels balanced.
+type MostStock struct{}
+
+func (MostStock) Allocate(req Request) ([]Allocation, error) {
+	if err := checkQuantity(req); err != nil {
+		return nil, err
+	}
+	stock := byPreference(req)
+	sort.SliceStable(stock, func(i, j int) bool {
+		return stock[i].Quantity > stock[j].Quantity
+	})
+
+	if len(stock) == 0 || stock[0].Quantity < req.Quantity {
+		return nil, ErrUnfulfillable
+	}
+	return []Allocation{{WarehouseID: stock[0].WarehouseID, Quantity: req.Quantity}}, nil
+}
+
+// Split takes from the preferred warehouses in turn until the quantity is
+// covered, shipping the item in several parcels if needed.
+type Split struct{}
+
+func (Split) Allocate(req Request) ([]Allocation, error) {
+	if err := checkQuantity(req); err != nil {
+		return nil, err
+	}
+	var (
+		res       []Allocation
+		remaining = req.Quantity
+	)
+	for _, s := range byPreference(req) {
+		if remaining == 0 {
+			break
+		}
+		if s.Quantity <= 0 {
+			continue
+		}
+		take := min(s.Quantity, remaining)
+		res = append(res, Allocation{WarehouseID: s.WarehouseID, Quantity: take})
+		remaining -= take
+	}
+
+	if remaining > 0 {
+		return nil, ErrUnfulfillable
+	}
+	return res, nil
+}
+
+func checkQuantity(req Request) error {
+	if req.Quantity <= 0 {
+		return fmt.Errorf("%d: %w", req.Quantity, ErrInvalidQuantity)
+	}
+	return nil
+}
+
+// byPreference orders warehouses by distance to the destination, then by
+// priority (lower first), then by ID so results are deterministic.
+func byPreference(req Request) []Stock {
+	stock := append([]Stock(nil), req.Stock...)
+	sort.SliceStable(stock, func(i, j int) bool {
+		if req.Destination != nil {
+			di := distanceKm(stock[i].Location, *req.Destination)
+			dj := distanceKm(stock[j].Location, *req.Destination)
+			if di != dj {
+				return di < dj
+			}
+		}
+		if stock[i].Priority != stock[j].Priority {
+			return stock[i].Priority < stock[j].Priority
+		}
+		return stock[i].WarehouseID < stock[j].WarehouseID
+	})
+	return stock
+}
+
+// distanceKm is the great-circle distance between two points.
+func distanceKm(a, b Location) float64 {
+	const earthRadiusKm = 6371
+
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
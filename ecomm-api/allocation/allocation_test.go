@@ -0,0 +1,103 @@
+package allocation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocate(t *testing.T) {
+	// Madrid, Paris and Berlin.
+	stock := []Stock{
+		{WarehouseID: 1, Location: Location{40.42, -3.70}, Priority: 2, Quantity: 5},
+		{WarehouseID: 2, Location: Location{48.86, 2.35}, Priority: 1, Quantity: 2},
+		{WarehouseID: 3, Location: Location{52.52, 13.40}, Priority: 3, Quantity: 8},
+	}
+	lisbon := &Location{38.72, -9.14}
+	brussels := &Location{50.85, 4.35}
+
+	tsc := []struct {
+		name     string
+		strategy Strategy
+		req      Request
+		want     []Allocation
+		err      error
+	}{
+		{
+			name:     "nearest picks the closest warehouse with enough stock",
+			strategy: Nearest{},
+			req:      Request{Quantity: 3, Stock: stock, Destination: brussels},
+			want:     []Allocation{{WarehouseID: 3, Quantity: 3}},
+		},
+		{
+			name:     "nearest without destination follows priority",
+			strategy: Nearest{},
+			req:      Request{Quantity: 2, Stock: stock},
+			want:     []Allocation{{WarehouseID: 2, Quantity: 2}},
+		},
+		{
+			name:     "nearest fails when no single warehouse has enough",
+			strategy: Nearest{},
+			req:      Request{Quantity: 9, Stock: stock, Destination: lisbon},
+			err:      ErrUnfulfillable,
+		},
+		{
+			name:     "most stock picks the fullest warehouse",
+			strategy: MostStock{},
+			req:      Request{Quantity: 3, Stock: stock, Destination: lisbon},
+			want:     []Allocation{{WarehouseID: 3, Quantity: 3}},
+		},
+		{
+			name:     "split fills from the nearest warehouses in turn",
+			strategy: Split{},
+			req:      Request{Quantity: 9, Stock: stock, Destination: lisbon},
+			want: []Allocation{
+				{WarehouseID: 1, Quantity: 5},
+				{WarehouseID: 2, Quantity: 2},
+				{WarehouseID: 3, Quantity: 2},
+			},
+		},
+		{
+			name:     "split fails when total stock is short",
+			strategy: Split{},
+			req:      Request{Quantity: 16, Stock: stock},
+			err:      ErrUnfulfillable,
+		},
+		{
+			name:     "nearest rejects a negative quantity",
+			strategy: Nearest{},
+			req:      Request{Quantity: -5, Stock: stock, Destination: brussels},
+			err:      ErrInvalidQuantity,
+		},
+		{
+			name:     "most stock rejects a negative quantity",
+			strategy: MostStock{},
+			req:      Request{Quantity: -5, Stock: stock},
+			err:      ErrInvalidQuantity,
+		},
+		{
+			name:     "split rejects a negative quantity",
+			strategy: Split{},
+			req:      Request{Quantity: -5, Stock: stock},
+			err:      ErrInvalidQuantity,
+		},
+		{
+			name:     "split rejects a zero quantity",
+			strategy: Split{},
+			req:      Request{Quantity: 0, Stock: stock},
+			err:      ErrInvalidQuantity,
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := tc.strategy.Allocate(tc.req)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
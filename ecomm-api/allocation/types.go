@@ -0,0 +1,46 @@
+package allocation
+
+import "errors"
+
+const (
+	StrategyNearest   = "nearest"
+	StrategyMostStock = "most_stock"
+	StrategySplit     = "split"
+)
+
+var (
+	ErrUnfulfillable = errors.New("no warehouse can fulfil the requested quantity")
+	// ErrInvalidQuantity means the requested quantity is not positive.
+	// Allocations are taken out of stock, so a negative one would add to it.
+	ErrInvalidQuantity = errors.New("quantity to allocate must be positive")
+)
+
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// Stock is what one warehouse holds of the product being allocated.
+type Stock struct {
+	WarehouseID int64
+	Location    Location
+	Priority    int
+	Quantity    int64
+}
+
+type Request struct {
+	Quantity int64
+	Stock    []Stock
+	// Destination is where the order ships to, if known.
+	Destination *Location
+}
+
+type Allocation struct {
+	WarehouseID int64
+	Quantity    int64
+}
+
+// Strategy decides which warehouses fulfil a line item.
+type Strategy interface {
+	Allocate(req Request) ([]Allocation, error)
+}
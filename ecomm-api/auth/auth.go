@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func LoadConfig() (*Config, error) {
+	cfg := &Config{
+		VerifyEmailTTL:   48 * time.Hour,
+		PasswordResetTTL: time.Hour,
+		VerifyEmailURL:   os.Getenv("VERIFY_EMAIL_URL"),
+		PasswordResetURL: os.Getenv("PASSWORD_RESET_URL"),
+	}
+	if cfg.VerifyEmailURL == "" {
+		cfg.VerifyEmailURL = "http://localhost:8080/verify-email"
+	}
+	if cfg.PasswordResetURL == "" {
+		cfg.PasswordResetURL = "http://localhost:8080/reset-password"
+	}
+
+	if v := os.Getenv("REQUIRE_VERIFIED_EMAIL"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REQUIRE_VERIFIED_EMAIL %q: must be a boolean", v)
+		}
+		cfg.RequireVerifiedEmail = b
+	}
+	for _, d := range []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"EMAIL_VERIFICATION_TTL", &cfg.VerifyEmailTTL},
+		{"PASSWORD_RESET_TTL", &cfg.PasswordResetTTL},
+	} {
+		v := os.Getenv(d.env)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid %s %q: must be a positive duration", d.env, v)
+		}
+		*d.dst = parsed
+	}
+
+	return cfg, nil
+}
+
+// NewToken returns a random token to send to a user and the hash to store
+// in its place, so that a leaked database holds no usable tokens.
+func NewToken() (token, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, HashToken(token), nil
+}
+
+// HashToken returns the stored form of token. Tokens are random, so a fast
+// hash is enough.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Link adds token to base as the "token" query parameter.
+func Link(base, token string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base + "?token=" + url.QueryEscape(token)
+	}
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+// HashPassword returns the bcrypt hash of password.
+func HashPassword(password string) (string, error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+	return string(b), nil
+}
+
+// CheckPassword reports whether password matches a hash from HashPassword.
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NormalizeEmail is the form emails are looked up and rate limited by.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
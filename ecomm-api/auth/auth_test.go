@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewToken(t *testing.T) {
+	token, hash, err := NewToken()
+	require.NoError(t, err)
+	require.Len(t, token, 43)
+	require.Len(t, hash, 64)
+	require.Equal(t, hash, HashToken(token))
+	require.NotEqual(t, token, hash)
+
+	other, _, err := NewToken()
+	require.NoError(t, err)
+	require.NotEqual(t, token, other)
+}
+
+func TestLink(t *testing.T) {
+	tsc := []struct {
+		name string
+		base string
+		want string
+	}{
+		{name: "plain", base: "https://shop.example/reset", want: "https://shop.example/reset?token=a-b_c"},
+		{name: "with query", base: "https://shop.example/account?tab=security", want: "https://shop.example/account?tab=security&token=a-b_c"},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			link := Link(tc.base, "a-b_c")
+			require.Equal(t, tc.want, link)
+
+			u, err := url.Parse(link)
+			require.NoError(t, err)
+			require.Equal(t, "a-b_c", u.Query().Get("token"))
+		})
+	}
+}
+
+func TestPassword(t *testing.T) {
+	hash, err := HashPassword("correct horse")
+	require.NoError(t, err)
+	require.NotEqual(t, "correct horse", hash)
+	require.True(t, CheckPassword(hash, "correct horse"))
+	require.False(t, CheckPassword(hash, "wrong horse"))
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	require.Equal(t, "ana@example.com", NormalizeEmail("  Ana@Example.COM "))
+}
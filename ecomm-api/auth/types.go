@@ -0,0 +1,25 @@
+package auth
+
+import "time"
+
+// Purposes of user tokens. A token only works for the flow it was made
+// for.
+const (
+	PurposeVerifyEmail   = "verify_email"
+	PurposeResetPassword = "reset_password"
+)
+
+// MinPasswordLength is the shortest password ResetPassword accepts.
+const MinPasswordLength = 8
+
+type Config struct {
+	// RequireVerifiedEmail blocks checkout for users who have not verified
+	// their email address.
+	RequireVerifiedEmail bool
+	VerifyEmailTTL       time.Duration
+	PasswordResetTTL     time.Duration
+	// VerifyEmailURL and PasswordResetURL are the pages the emailed links
+	// open, with the token added as the "token" query parameter.
+	VerifyEmailURL   string
+	PasswordResetURL string
+}
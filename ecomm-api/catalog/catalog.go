@@ -0,0 +1,259 @@
+package catalog
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+)
+
+var columns = []string{"sku", "name", "image", "category", "description", "rating", "num_reviews", "price", "count_in_stock"}
+
+// Reader yields the records of an import one at a time. Next returns io.EOF
+// once the input is exhausted; any other error means the input cannot be read
+// any further.
+type Reader interface {
+	Next() (Row, error)
+}
+
+func NewReader(format string, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatCSV:
+		cr := csv.NewReader(r)
+		cr.ReuseRecord = true
+		header, err := cr.Read()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read csv header: %w", err)
+		}
+		index := make(map[string]int, len(header))
+		for i, h := range header {
+			index[h] = i
+		}
+		missing := missingColumns(func(col string) bool {
+			_, ok := index[col]
+			return ok
+		})
+		if len(missing) > 0 {
+			return nil, fmt.Errorf("csv header is missing %s", strings.Join(missing, ", "))
+		}
+		return &csvReader{r: cr, index: index}, nil
+	case FormatNDJSON:
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64*1024), 1024*1024)
+		return &ndjsonReader{sc: sc}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q: must be %s or %s", format, FormatCSV, FormatNDJSON)
+	}
+}
+
+// missingColumns returns the columns has does not find. Every column is
+// required: an import overwrites all of a product's fields, so one left out
+// would be saved as its zero value.
+func missingColumns(has func(col string) bool) []string {
+	var missing []string
+	for _, col := range columns {
+		if !has(col) {
+			missing = append(missing, col)
+		}
+	}
+	return missing
+}
+
+type csvReader struct {
+	r     *csv.Reader
+	index map[string]int
+}
+
+func (c *csvReader) Next() (Row, error) {
+	fields, err := c.r.Read()
+	var perr *csv.ParseError
+	if errors.As(err, &perr) {
+		return Row{Line: perr.Line, Err: err}, nil
+	}
+	if err != nil {
+		return Row{}, err
+	}
+	line, _ := c.r.FieldPos(0)
+
+	get := func(col string) string {
+		if i, ok := c.index[col]; ok && i < len(fields) {
+			return fields[i]
+		}
+		return ""
+	}
+
+	var rec record
+	rec.SKU = get("sku")
+	rec.Name = get("name")
+	rec.Image = get("image")
+	rec.Category = get("category")
+	rec.Description = get("description")
+	for _, f := range []struct {
+		col string
+		dst *int64
+	}{{"rating", &rec.Rating}, {"num_reviews", &rec.NumReviews}, {"count_in_stock", &rec.CountInStock}} {
+		if v := get(f.col); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return Row{Line: line, Err: fmt.Errorf("invalid %s %q", f.col, v)}, nil
+			}
+			*f.dst = n
+		}
+	}
+	if v := get("price"); v != "" {
+		n, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return Row{Line: line, Err: fmt.Errorf("invalid price %q", v)}, nil
+		}
+		rec.Price = n
+	}
+
+	return toRow(line, rec), nil
+}
+
+type ndjsonReader struct {
+	sc   *bufio.Scanner
+	line int
+}
+
+func (n *ndjsonReader) Next() (Row, error) {
+	for n.sc.Scan() {
+		n.line++
+		b := n.sc.Bytes()
+		if len(b) == 0 {
+			continue
+		}
+
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal(b, &keys); err != nil {
+			return Row{Line: n.line, Err: fmt.Errorf("invalid json: %w", err)}, nil
+		}
+		missing := missingColumns(func(col string) bool {
+			_, ok := keys[col]
+			return ok
+		})
+		if len(missing) > 0 {
+			return Row{Line: n.line, Err: fmt.Errorf("missing %s", strings.Join(missing, ", "))}, nil
+		}
+
+		var rec record
+		if err := json.Unmarshal(b, &rec); err != nil {
+			return Row{Line: n.line, Err: fmt.Errorf("invalid json: %w", err)}, nil
+		}
+		return toRow(n.line, rec), nil
+	}
+
+	if err := n.sc.Err(); err != nil {
+		return Row{}, err
+	}
+	return Row{}, io.EOF
+}
+
+func toRow(line int, rec record) Row {
+	row := Row{
+		Line: line,
+		Product: storer.Product{
+			SKU:          rec.SKU,
+			Name:         rec.Name,
+			Image:        rec.Image,
+			Category:     rec.Category,
+			Description:  rec.Description,
+			Rating:       rec.Rating,
+			NumReviews:   rec.NumReviews,
+			Price:        rec.Price,
+			CountInStock: rec.CountInStock,
+		},
+	}
+	row.Err = validate(&row.Product)
+	return row
+}
+
+func validate(p *storer.Product) error {
+	switch {
+	case p.SKU == "":
+		return fmt.Errorf("sku is required")
+	case p.Name == "":
+		return fmt.Errorf("name is required")
+	case p.Image == "":
+		return fmt.Errorf("image is required")
+	case p.Category == "":
+		return fmt.Errorf("category is required")
+	case p.Price < 0:
+		return fmt.Errorf("price must not be negative")
+	case p.Rating < 0 || p.NumReviews < 0 || p.CountInStock < 0:
+		return fmt.Errorf("rating, num_reviews and count_in_stock must not be negative")
+	}
+	return nil
+}
+
+// Writer encodes products in an export format.
+type Writer interface {
+	Write(p *storer.Product) error
+	Flush() error
+}
+
+func NewWriter(format string, w io.Writer) (Writer, error) {
+	switch format {
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(columns); err != nil {
+			return nil, err
+		}
+		return &csvWriter{w: cw}, nil
+	case FormatNDJSON:
+		return &ndjsonWriter{enc: json.NewEncoder(w)}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format %q: must be %s or %s", format, FormatCSV, FormatNDJSON)
+	}
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c *csvWriter) Write(p *storer.Product) error {
+	return c.w.Write([]string{
+		p.SKU,
+		p.Name,
+		p.Image,
+		p.Category,
+		p.Description,
+		strconv.FormatInt(p.Rating, 10),
+		strconv.FormatInt(p.NumReviews, 10),
+		strconv.FormatFloat(p.Price, 'f', 2, 64),
+		strconv.FormatInt(p.CountInStock, 10),
+	})
+}
+
+func (c *csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonWriter struct {
+	enc *json.Encoder
+}
+
+func (n *ndjsonWriter) Write(p *storer.Product) error {
+	return n.enc.Encode(record{
+		SKU:          p.SKU,
+		Name:         p.Name,
+		Image:        p.Image,
+		Category:     p.Category,
+		Description:  p.Description,
+		Rating:       p.Rating,
+		NumReviews:   p.NumReviews,
+		Price:        p.Price,
+		CountInStock: p.CountInStock,
+	})
+}
+
+func (n *ndjsonWriter) Flush() error {
+	return nil
+}
@@ -0,0 +1,122 @@
+package catalog
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/stretchr/testify/require"
+)
+
+func readAll(t *testing.T, r Reader) []Row {
+	var rows []Row
+	for {
+		row, err := r.Next()
+		if err == io.EOF {
+			return rows
+		}
+		require.NoError(t, err)
+		rows = append(rows, row)
+	}
+}
+
+func TestReader(t *testing.T) {
+	tsc := []struct {
+		name   string
+		format string
+		input  string
+		test   func(t *testing.T, rows []Row)
+	}{
+		{
+			name:   "csv",
+			format: FormatCSV,
+			input: "sku,name,image,category,description,rating,num_reviews,price,count_in_stock\n" +
+				"A-1,Mug,mug.jpg,kitchen,,0,0,9.50,0\n" +
+				"A-2,Cup,cup.jpg,kitchen,,0,0,abc,3\n" +
+				",Bowl,bowl.jpg,kitchen,,0,0,4,1\n",
+			test: func(t *testing.T, rows []Row) {
+				require.Len(t, rows, 3)
+
+				require.NoError(t, rows[0].Err)
+				require.Equal(t, 2, rows[0].Line)
+				require.Equal(t, "A-1", rows[0].Product.SKU)
+				require.Equal(t, 9.5, rows[0].Product.Price)
+				require.Equal(t, int64(0), rows[0].Product.CountInStock)
+
+				require.EqualError(t, rows[1].Err, `invalid price "abc"`)
+				require.Equal(t, 3, rows[1].Line)
+
+				require.EqualError(t, rows[2].Err, "sku is required")
+			},
+		},
+		{
+			name:   "ndjson",
+			format: FormatNDJSON,
+			input: `{"sku":"A-1","name":"Mug","image":"mug.jpg","category":"kitchen","description":"","rating":0,"num_reviews":0,"price":9.5,"count_in_stock":2}` + "\n" +
+				"\n" +
+				`{"sku":"A-2",` + "\n" +
+				`{"sku":"A-3","price":4}` + "\n",
+			test: func(t *testing.T, rows []Row) {
+				require.Len(t, rows, 3)
+
+				require.NoError(t, rows[0].Err)
+				require.Equal(t, "Mug", rows[0].Product.Name)
+
+				require.Error(t, rows[1].Err)
+				require.Equal(t, 3, rows[1].Line)
+
+				// A partial record would zero the fields it leaves out.
+				require.EqualError(t, rows[2].Err, "missing name, image, category, description, rating, num_reviews, count_in_stock")
+				require.Equal(t, 4, rows[2].Line)
+			},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			r, err := NewReader(tc.format, strings.NewReader(tc.input))
+			require.NoError(t, err)
+			tc.test(t, readAll(t, r))
+		})
+	}
+}
+
+func TestReaderRequiresEveryCSVColumn(t *testing.T) {
+	// A price-only sheet would otherwise zero the stock, rating and reviews
+	// of every product in it.
+	_, err := NewReader(FormatCSV, strings.NewReader("sku,price\nA-1,9.50\n"))
+	require.EqualError(t, err, "csv header is missing name, image, category, description, rating, num_reviews, count_in_stock")
+}
+
+func TestWriterRoundTrip(t *testing.T) {
+	p := &storer.Product{
+		SKU:          "A-1",
+		Name:         "Mug, large",
+		Image:        "mug.jpg",
+		Category:     "kitchen",
+		Description:  "Holds \"a lot\"",
+		Rating:       4,
+		NumReviews:   12,
+		Price:        9.5,
+		CountInStock: 3,
+	}
+
+	for _, format := range []string{FormatCSV, FormatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			var buf bytes.Buffer
+			w, err := NewWriter(format, &buf)
+			require.NoError(t, err)
+			require.NoError(t, w.Write(p))
+			require.NoError(t, w.Flush())
+
+			r, err := NewReader(format, &buf)
+			require.NoError(t, err)
+			rows := readAll(t, r)
+			require.Len(t, rows, 1)
+			require.NoError(t, rows[0].Err)
+			require.Equal(t, *p, rows[0].Product)
+		})
+	}
+}
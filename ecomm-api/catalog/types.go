@@ -0,0 +1,45 @@
+package catalog
+
+import "github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// Row is one record of an import. Err is set when the record could not be
+// parsed or failed validation; Product is only meaningful when Err is nil.
+type Row struct {
+	Line    int
+	Product storer.Product
+	Err     error
+}
+
+type RowError struct {
+	Line  int    `json:"line"`
+	SKU   string `json:"sku,omitempty"`
+	Error string `json:"error"`
+}
+
+type Report struct {
+	DryRun    bool       `json:"dry_run"`
+	Processed int        `json:"processed"`
+	Created   int        `json:"created"`
+	Updated   int        `json:"updated"`
+	Failed    int        `json:"failed"`
+	Errors    []RowError `json:"errors"`
+}
+
+// record is the wire format shared by both formats; CSV headers use the same
+// names as the JSON keys.
+type record struct {
+	SKU          string  `json:"sku"`
+	Name         string  `json:"name"`
+	Image        string  `json:"image"`
+	Category     string  `json:"category"`
+	Description  string  `json:"description"`
+	Rating       int64   `json:"rating"`
+	NumReviews   int64   `json:"num_reviews"`
+	Price        float64 `json:"price"`
+	CountInStock int64   `json:"count_in_stock"`
+}
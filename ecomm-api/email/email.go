@@ -0,0 +1,157 @@
+package email
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"os"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/mail"
+)
+
+//go:embed templates
+var builtin embed.FS
+
+func LoadConfig() *Config {
+	cfg := &Config{
+		ShopName:    os.Getenv("SHOP_NAME"),
+		TemplateDir: os.Getenv("EMAIL_TEMPLATE_DIR"),
+	}
+	if cfg.ShopName == "" {
+		cfg.ShopName = "ecomm"
+	}
+	return cfg
+}
+
+// Mailer renders emails from templates and sends them. Each email <name>
+// has a text template, templates/<name>.txt, whose "subject" block is the
+// subject, and optionally an HTML template, templates/<name>.html. They
+// are executed with a View.
+type Mailer struct {
+	Sender   mail.Sender
+	From     string
+	ShopName string
+
+	text map[string]*texttemplate.Template
+	html map[string]*htmltemplate.Template
+}
+
+// View is what templates are executed with.
+type View struct {
+	Shop string
+	Data any
+}
+
+var funcs = map[string]any{
+	"money": func(amount float64, currency string) string {
+		return fmt.Sprintf("%.2f %s", amount, currency)
+	},
+	"duration": func(d time.Duration) string {
+		n, unit := int(d.Minutes()), "minute"
+		if d%time.Hour == 0 {
+			n, unit = int(d.Hours()), "hour"
+		}
+		if n != 1 {
+			unit += "s"
+		}
+		return fmt.Sprintf("%d %s", n, unit)
+	},
+}
+
+// NewMailer parses the built-in templates and, when cfg.TemplateDir is set,
+// the ones there.
+func NewMailer(cfg *Config, sender mail.Sender, from string) (*Mailer, error) {
+	m := &Mailer{
+		Sender:   sender,
+		From:     from,
+		ShopName: cfg.ShopName,
+		text:     map[string]*texttemplate.Template{},
+		html:     map[string]*htmltemplate.Template{},
+	}
+
+	sources := []fs.FS{builtin}
+	if cfg.TemplateDir != "" {
+		sources = append(sources, os.DirFS(cfg.TemplateDir))
+	}
+	for _, src := range sources {
+		if err := m.parse(src); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *Mailer) parse(src fs.FS) error {
+	for _, ext := range []string{"txt", "html"} {
+		files, err := fs.Glob(src, "templates/*."+ext)
+		if err != nil {
+			return fmt.Errorf("failed to list %s templates: %w", ext, err)
+		}
+		for _, f := range files {
+			b, err := fs.ReadFile(src, f)
+			if err != nil {
+				return fmt.Errorf("failed to read template %s: %w", f, err)
+			}
+			name := strings.TrimSuffix(strings.TrimPrefix(f, "templates/"), "."+ext)
+			if ext == "txt" {
+				m.text[name], err = texttemplate.New(name).Funcs(funcs).Parse(string(b))
+			} else {
+				m.html[name], err = htmltemplate.New(name).Funcs(funcs).Parse(string(b))
+			}
+			if err != nil {
+				return fmt.Errorf("failed to parse template %s: %w", f, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Render builds the email name for to from data.
+func (m *Mailer) Render(name, to string, data any) (*mail.Message, error) {
+	t, ok := m.text[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown email template %q", name)
+	}
+	v := View{Shop: m.ShopName, Data: data}
+
+	var text bytes.Buffer
+	if err := t.Execute(&text, v); err != nil {
+		return nil, fmt.Errorf("failed to render %s email: %w", name, err)
+	}
+	var subject bytes.Buffer
+	if st := t.Lookup("subject"); st != nil {
+		if err := st.Execute(&subject, v); err != nil {
+			return nil, fmt.Errorf("failed to render %s subject: %w", name, err)
+		}
+	}
+
+	msg := &mail.Message{
+		From:    m.From,
+		To:      []string{to},
+		Subject: strings.TrimSpace(subject.String()),
+		Text:    strings.TrimSpace(text.String()) + "\n",
+	}
+	if ht, ok := m.html[name]; ok {
+		var html bytes.Buffer
+		if err := ht.Execute(&html, v); err != nil {
+			return nil, fmt.Errorf("failed to render %s HTML: %w", name, err)
+		}
+		msg.HTML = html.String()
+	}
+	return msg, nil
+}
+
+// Send renders the email name for to and sends it.
+func (m *Mailer) Send(ctx context.Context, name, to string, data any) error {
+	msg, err := m.Render(name, to, data)
+	if err != nil {
+		return err
+	}
+	return m.Sender.Send(ctx, msg)
+}
@@ -0,0 +1,130 @@
+package email
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/mail"
+	"github.com/stretchr/testify/require"
+)
+
+var order = Order{
+	ID:       42,
+	Currency: "USD",
+	Items: []OrderItem{
+		{Name: "Mug <large>", Quantity: 2, Price: 9.5, Total: 19},
+		{Name: "Tea", Quantity: 1, Price: 4, Total: 4},
+	},
+	Subtotal:  23,
+	Discount:  3,
+	Shipping:  5,
+	Tax:       2.3,
+	Total:     27.3,
+	CreatedAt: time.Date(2025, 11, 10, 12, 0, 0, 0, time.UTC),
+	ShipTo:    []string{"Ana Diaz", "1 Main St", "Springfield 12345 US"},
+}
+
+func TestRender(t *testing.T) {
+	m, err := NewMailer(&Config{ShopName: "Teashop"}, nil, "shop@example.com")
+	require.NoError(t, err)
+
+	tsc := []struct {
+		name     string
+		data     any
+		subject  string
+		text     []string
+		html     []string
+		notInTxt []string
+	}{
+		{
+			name:    TemplateOrderConfirmation,
+			data:    order,
+			subject: "Your Teashop order #42 is confirmed",
+			text:    []string{"2 x Mug <large>  19.00 USD", "Discount: -3.00 USD", "Total: 27.30 USD", "Ana Diaz\n1 Main St"},
+			html:    []string{"Mug &lt;large&gt;", "27.30 USD"},
+		},
+		{
+			name:    TemplateOrderCancelled,
+			data:    order,
+			subject: "Your Teashop order #42 was cancelled",
+			text:    []string{"order #42 for 27.30 USD has been cancelled", "1 x Tea"},
+		},
+		{
+			name:     TemplateOrderShipped,
+			data:     Shipment{Order: order, Carrier: "UPS", TrackingNumber: "1Z999"},
+			subject:  "Your Teashop order #42 is on its way",
+			text:     []string{"has shipped with UPS.", "Tracking number: 1Z999"},
+			notInTxt: []string{"Track it at"},
+		},
+		{
+			name:    TemplatePasswordReset,
+			data:    PasswordReset{Name: "Ana", URL: "https://shop.example/reset?token=abc", ExpiresIn: time.Hour},
+			subject: "Reset your Teashop password",
+			text:    []string{"Hi Ana,", "within 1 hour:", "https://shop.example/reset?token=abc"},
+			html:    []string{`href="https://shop.example/reset?token=abc"`},
+		},
+		{
+			name:    TemplateVerifyEmail,
+			data:    VerifyEmail{URL: "https://shop.example/verify?token=abc", ExpiresIn: 48 * time.Hour},
+			subject: "Confirm your Teashop email address",
+			text:    []string{"Hi,", "within 48 hours", "https://shop.example/verify?token=abc"},
+			html:    []string{`href="https://shop.example/verify?token=abc"`},
+		},
+		{
+			name:    TemplateRefund,
+			data:    Refund{OrderID: 42, Amount: 9.5, Currency: "USD", Reason: "damaged"},
+			subject: "Teashop refunded 9.50 USD for order #42",
+			text:    []string{"refunded 9.50 USD for your order #42", "Reason: damaged"},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			msg, err := m.Render(tc.name, "ana@example.com", tc.data)
+			require.NoError(t, err)
+			require.Equal(t, "shop@example.com", msg.From)
+			require.Equal(t, []string{"ana@example.com"}, msg.To)
+			require.Equal(t, tc.subject, msg.Subject)
+			require.NotEmpty(t, msg.HTML)
+			require.Contains(t, msg.Text, "Teashop")
+			for _, s := range tc.text {
+				require.Contains(t, msg.Text, s)
+			}
+			for _, s := range tc.notInTxt {
+				require.NotContains(t, msg.Text, s)
+			}
+			for _, s := range tc.html {
+				require.Contains(t, msg.HTML, s)
+			}
+		})
+	}
+
+	_, err = m.Render("welcome", "ana@example.com", nil)
+	require.Error(t, err)
+}
+
+func TestTemplateDir(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, "templates"), 0o755))
+	err := os.WriteFile(filepath.Join(dir, "templates", "refund.txt"),
+		[]byte(`{{define "subject"}}Refund for #{{.Data.OrderID}}{{end}}Money back: {{money .Data.Amount .Data.Currency}}`), 0o644)
+	require.NoError(t, err)
+
+	sink := filepath.Join(t.TempDir(), "mail")
+	m, err := NewMailer(&Config{ShopName: "Teashop", TemplateDir: dir}, &mail.MaildirSender{Dir: sink}, "shop@example.com")
+	require.NoError(t, err)
+
+	msg, err := m.Render(TemplateRefund, "ana@example.com", Refund{OrderID: 7, Amount: 5, Currency: "EUR"})
+	require.NoError(t, err)
+	require.Equal(t, "Refund for #7", msg.Subject)
+	require.Equal(t, "Money back: 5.00 EUR\n", msg.Text)
+
+	// Templates that are not overridden are still the built-in ones.
+	require.NoError(t, m.Send(context.Background(), TemplateOrderConfirmation, "ana@example.com", order))
+	files, err := os.ReadDir(filepath.Join(sink, "new"))
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+}
@@ -0,0 +1,73 @@
+package email
+
+import "time"
+
+// Names of the templates.
+const (
+	TemplateOrderConfirmation = "order_confirmation"
+	TemplateOrderCancelled    = "order_cancelled"
+	TemplateOrderShipped      = "order_shipped"
+	TemplatePasswordReset     = "password_reset"
+	TemplateVerifyEmail       = "verify_email"
+	TemplateRefund            = "refund"
+)
+
+type Config struct {
+	// ShopName signs the emails.
+	ShopName string
+	// TemplateDir, when set, holds templates that replace the built-in ones
+	// of the same name.
+	TemplateDir string
+}
+
+// Order is what the order emails show of an order.
+type Order struct {
+	ID        int64
+	Currency  string
+	Items     []OrderItem
+	Subtotal  float64
+	Discount  float64
+	Shipping  float64
+	Tax       float64
+	Total     float64
+	CreatedAt time.Time
+	// ShipTo is the shipping address, one line per entry.
+	ShipTo []string
+}
+
+type OrderItem struct {
+	Name     string
+	Quantity int64
+	Price    float64
+	Total    float64
+}
+
+// Shipment is the data of the order_shipped email.
+type Shipment struct {
+	Order          Order
+	Carrier        string
+	TrackingNumber string
+	TrackingURL    string
+}
+
+// PasswordReset is the data of the password_reset email.
+type PasswordReset struct {
+	Name      string
+	URL       string
+	ExpiresIn time.Duration
+}
+
+// VerifyEmail is the data of the verify_email email.
+type VerifyEmail struct {
+	Name      string
+	URL       string
+	ExpiresIn time.Duration
+}
+
+// Refund is the data of the refund email.
+type Refund struct {
+	OrderID  int64
+	Amount   float64
+	Currency string
+	Reason   string
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"net/mail"
+	"strconv"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/auth"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+)
+
+const accountEmailSent = "If an account exists for that address, an email is on its way."
+
+// requestEmailVerification sends a verification link. Like
+// requestPasswordReset it answers 202 whether or not the address has an
+// account.
+func (h *handler) requestEmailVerification(w http.ResponseWriter, r *http.Request) {
+	address, ok := h.decodeAccountEmail(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.server.RequestEmailVerification(r.Context(), address); err != nil {
+		http.Error(w, "Failed to request email verification", http.StatusInternalServerError)
+		return
+	}
+
+	writeAccountEmailSent(w)
+}
+
+func (h *handler) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	var req VerifyEmailReq
+	if err := decodeStrictJSON(r, &req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err := h.server.VerifyEmail(r.Context(), req.Token)
+	if errors.Is(err, storer.ErrInvalidToken) {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) requestPasswordReset(w http.ResponseWriter, r *http.Request) {
+	address, ok := h.decodeAccountEmail(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.server.RequestPasswordReset(r.Context(), address); err != nil {
+		http.Error(w, "Failed to request password reset", http.StatusInternalServerError)
+		return
+	}
+
+	writeAccountEmailSent(w)
+}
+
+func (h *handler) resetPassword(w http.ResponseWriter, r *http.Request) {
+	var req ResetPasswordReq
+	if err := decodeStrictJSON(r, &req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	// bcrypt only uses the first 72 bytes.
+	if len(req.Password) < auth.MinPasswordLength || len(req.Password) > 72 {
+		http.Error(w, "Password must be between "+strconv.Itoa(auth.MinPasswordLength)+" and 72 characters", http.StatusBadRequest)
+		return
+	}
+
+	err := h.server.ResetPassword(r.Context(), req.Token, req.Password)
+	if errors.Is(err, storer.ErrInvalidToken) {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to reset password", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeAccountEmail reads the address of an account email request and
+// throttles requests for it, whoever makes them, so that an address cannot
+// be flooded with emails.
+func (h *handler) decodeAccountEmail(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req AccountEmailReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return "", false
+	}
+	addr, err := mail.ParseAddress(req.Email)
+	if err != nil || addr.Name != "" {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return "", false
+	}
+	address := auth.NormalizeEmail(addr.Address)
+
+	res, err := h.limiter.Allow(r, "auth.email", address)
+	if err != nil {
+		// Fail open like the rate limit middleware.
+		logger.FromContext(r.Context()).Error("rate limiter unavailable", "policy", "auth.email", "error", err)
+		return address, true
+	}
+	if !res.Allowed {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(res.RetryAfter.Seconds()))))
+		http.Error(w, "Too many requests", http.StatusTooManyRequests)
+		return "", false
+	}
+	return address, true
+}
+
+func writeAccountEmailSent(w http.ResponseWriter) {
+	res := AccountEmailRes{Message: accountEmailSent}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(res)
+}
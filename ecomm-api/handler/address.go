@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *handler) createAddress(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UserAddressReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	normalizeAddressReq(&req.AddressReq)
+	if msg := validateAddressReq(req.AddressReq); msg != "" {
+		http.Error(w, "Invalid address: "+msg, http.StatusBadRequest)
+		return
+	}
+
+	address, err := h.server.CreateAddress(r.Context(), toStorerAddress(userID, 0, req))
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create address", http.StatusInternalServerError)
+		return
+	}
+
+	res := toAddressRes(address)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) listAddresses(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	addresses, err := h.server.ListAddresses(r.Context(), userID)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to list addresses", http.StatusInternalServerError)
+		return
+	}
+
+	res := []AddressRes{}
+	for i := range addresses {
+		res = append(res, toAddressRes(&addresses[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) getAddress(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := parseAddressPath(w, r)
+	if !ok {
+		return
+	}
+
+	address, err := h.server.GetAddress(r.Context(), userID, id)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Address not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get address", http.StatusInternalServerError)
+		return
+	}
+
+	res := toAddressRes(address)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// updateAddress replaces an address book entry. Orders already placed with
+// it keep the address they were placed with.
+func (h *handler) updateAddress(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := parseAddressPath(w, r)
+	if !ok {
+		return
+	}
+
+	var req UserAddressReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	normalizeAddressReq(&req.AddressReq)
+	if msg := validateAddressReq(req.AddressReq); msg != "" {
+		http.Error(w, "Invalid address: "+msg, http.StatusBadRequest)
+		return
+	}
+
+	address, err := h.server.UpdateAddress(r.Context(), toStorerAddress(userID, id, req))
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Address not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update address", http.StatusInternalServerError)
+		return
+	}
+
+	res := toAddressRes(address)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) deleteAddress(w http.ResponseWriter, r *http.Request) {
+	userID, id, ok := parseAddressPath(w, r)
+	if !ok {
+		return
+	}
+
+	err := h.server.DeleteAddress(r.Context(), userID, id)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Address not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete address", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseAddressPath reads the user and address IDs of
+// /users/{id}/addresses/{addressID}, writing the error response when either
+// is invalid.
+func parseAddressPath(w http.ResponseWriter, r *http.Request) (userID, id int64, ok bool) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	id, err = strconv.ParseInt(chi.URLParam(r, "addressID"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid address ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return userID, id, true
+}
+
+func normalizeAddressReq(a *AddressReq) {
+	a.Name = strings.TrimSpace(a.Name)
+	a.Line1 = strings.TrimSpace(a.Line1)
+	a.Line2 = strings.TrimSpace(a.Line2)
+	a.City = strings.TrimSpace(a.City)
+	a.Region = strings.TrimSpace(a.Region)
+	a.PostalCode = strings.TrimSpace(a.PostalCode)
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+	a.Phone = strings.TrimSpace(a.Phone)
+}
+
+func validateAddressReq(a AddressReq) string {
+	switch {
+	case a.Name == "" || a.Line1 == "" || a.City == "":
+		return "name, line1 and city are required"
+	case len(a.Country) != 2:
+		return "country must be a two-letter code"
+	}
+	return ""
+}
+
+func toStorerAddress(userID, id int64, req UserAddressReq) *storer.Address {
+	return &storer.Address{
+		ID:                id,
+		UserID:            userID,
+		Name:              req.Name,
+		Line1:             req.Line1,
+		Line2:             req.Line2,
+		City:              req.City,
+		Region:            req.Region,
+		PostalCode:        req.PostalCode,
+		Country:           req.Country,
+		Phone:             req.Phone,
+		IsDefaultShipping: req.IsDefaultShipping,
+		IsDefaultBilling:  req.IsDefaultBilling,
+	}
+}
+
+func toAddressRes(a *storer.Address) AddressRes {
+	return AddressRes{
+		ID:                a.ID,
+		UserID:            a.UserID,
+		Name:              a.Name,
+		Line1:             a.Line1,
+		Line2:             a.Line2,
+		City:              a.City,
+		Region:            a.Region,
+		PostalCode:        a.PostalCode,
+		Country:           a.Country,
+		Phone:             a.Phone,
+		IsDefaultShipping: a.IsDefaultShipping,
+		IsDefaultBilling:  a.IsDefaultBilling,
+		CreatedAt:         a.CreatedAt,
+		UpdatedAt:         a.UpdatedAt,
+	}
+}
+
+func toOrderAddressRes(a *storer.OrderAddress) *OrderAddressRes {
+	if a == nil {
+		return nil
+	}
+	return &OrderAddressRes{
+		AddressID:  a.AddressID,
+		Name:       a.Name,
+		Line1:      a.Line1,
+		Line2:      a.Line2,
+		City:       a.City,
+		Region:     a.Region,
+		PostalCode: a.PostalCode,
+		Country:    a.Country,
+		Phone:      a.Phone,
+	}
+}
@@ -0,0 +1,154 @@
+package handler
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/go-chi/chi/v5"
+)
+
+// requireAdmin only lets through requests bearing the configured admin token.
+// With no token configured the admin API is disabled.
+func (h *handler) requireAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || h.cfg.AdminToken == "" ||
+			subtle.ConstantTimeCompare([]byte(token), []byte(h.cfg.AdminToken)) != 1 {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		// Only an authenticated admin may say who they are in X-Actor.
+		actor := "admin"
+		if a := r.Header.Get("X-Actor"); a != "" {
+			actor = a
+		}
+		next.ServeHTTP(w, r.WithContext(storer.WithActor(r.Context(), actor)))
+	})
+}
+
+func (h *handler) listDeletedProducts(w http.ResponseWriter, r *http.Request) {
+	products, err := h.server.ListDeletedProducts(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to list deleted products", http.StatusInternalServerError)
+		return
+	}
+
+	res := []ProductRes{}
+	for _, p := range products {
+		res = append(res, toProductRes(&p))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) restoreProduct(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.server.RestoreProduct(r.Context(), i)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Deleted product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to restore product", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) listDeletedOrders(w http.ResponseWriter, r *http.Request) {
+	orders, err := h.server.ListDeletedOrders(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to list deleted orders", http.StatusInternalServerError)
+		return
+	}
+
+	res := []OrderRes{}
+	for _, o := range orders {
+		res = append(res, toOrderRes(&o))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) restoreOrder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.server.RestoreOrder(r.Context(), i)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Deleted order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to restore order", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *handler) shipOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ShipOrderReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.TrackingURL != "" {
+		u, err := url.Parse(req.TrackingURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, "tracking_url must be an absolute http or https URL", http.StatusBadRequest)
+			return
+		}
+	}
+
+	order, err := h.server.ShipOrder(r.Context(), id, &storer.Shipment{
+		Carrier:        req.Carrier,
+		TrackingNumber: req.TrackingNumber,
+		TrackingURL:    req.TrackingURL,
+	})
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, storer.ErrOrderNotPaid) {
+		http.Error(w, "Only paid orders can be shipped", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to ship order", http.StatusInternalServerError)
+		return
+	}
+
+	res := toOrderRes(order)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/catalog"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+)
+
+const (
+	defaultImportBatchSize = 500
+	maxImportBatchSize     = 5000
+)
+
+var formatContentTypes = map[string]string{
+	catalog.FormatCSV:    "text/csv",
+	catalog.FormatNDJSON: "application/x-ndjson",
+}
+
+// catalogFormat picks the format from the format query parameter, falling
+// back to the given content type.
+func catalogFormat(r *http.Request, contentType string) string {
+	if f := r.URL.Query().Get("format"); f != "" {
+		return f
+	}
+	mt, _, _ := mime.ParseMediaType(contentType)
+	for format, ct := range formatContentTypes {
+		if mt == ct {
+			return format
+		}
+	}
+	return ""
+}
+
+func (h *handler) importProducts(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	// Rows for soft deleted products fail unless restore=true is given.
+	opts := storer.UpsertOptions{
+		DryRun:  q.Get("dry_run") == "true",
+		Restore: q.Get("restore") == "true",
+	}
+
+	batchSize := defaultImportBatchSize
+	if v := q.Get("batch_size"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxImportBatchSize {
+			http.Error(w, "Invalid batch_size", http.StatusBadRequest)
+			return
+		}
+		batchSize = n
+	}
+
+	rows, err := catalog.NewReader(catalogFormat(r, r.Header.Get("Content-Type")), r.Body)
+	if err != nil {
+		http.Error(w, "Invalid import: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.server.ImportProducts(r.Context(), rows, batchSize, opts)
+	if err != nil {
+		logger.FromContext(r.Context()).Error("failed to import products", "error", err)
+		http.Error(w, "Failed to import products", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(report)
+}
+
+func (h *handler) exportProducts(w http.ResponseWriter, r *http.Request) {
+	format := catalogFormat(r, r.Header.Get("Accept"))
+	if format == "" {
+		format = catalog.FormatNDJSON
+	}
+
+	cw, err := catalog.NewWriter(format, w)
+	if err != nil {
+		http.Error(w, "Invalid export: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	w.Header().Set("Content-Disposition", `attachment; filename="products.`+format+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent, so a failure half way can only be logged
+	// and surfaced as a truncated body.
+	if err := h.server.ExportProducts(r.Context(), cw); err != nil {
+		logger.FromContext(r.Context()).Error("failed to export products", "error", err)
+	}
+}
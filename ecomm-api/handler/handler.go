@@ -1,39 +1,56 @@
 package handler
 
 import (
-	"context"
 	"encoding/json"
-	"log"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"os"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/allocation"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/promotion"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/ratelimit"
 	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/server"
 	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
 	"github.com/go-chi/chi/v5"
 )
 
 type handler struct {
-	ctx    context.Context
-	server *server.Server
+	server  *server.Server
+	limiter *ratelimit.Limiter
+	cfg     *Config
 }
 
-func NewHandler(srv *server.Server) *handler {
+func NewHandler(srv *server.Server, limiter *ratelimit.Limiter, cfg *Config) *handler {
 	return &handler{
-		ctx:    context.Background(),
-		server: srv,
+		server:  srv,
+		limiter: limiter,
+		cfg:     cfg,
+	}
+}
+
+func LoadConfig() *Config {
+	return &Config{
+		AdminToken:           os.Getenv("ADMIN_TOKEN"),
+		PaymentWebhookSecret: os.Getenv("PAYMENT_WEBHOOK_SECRET"),
 	}
 }
 
 func (h *handler) createProduct(w http.ResponseWriter, r *http.Request) {
 	var p ProductReq
 
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+	if err := decodeJSON(r, &p); err != nil {
 		http.Error(w, "Invalid request payload", http.StatusBadRequest)
 		return
 	}
 
-	product, err := h.server.CreateProduct(h.ctx, toStorerProduct(p))
+	product, err := h.server.CreateProduct(r.Context(), toStorerProduct(p))
 
 	if err != nil {
 		http.Error(w, "Failed to create product", http.StatusInternalServerError)
@@ -42,6 +59,7 @@ func (h *handler) createProduct(w http.ResponseWriter, r *http.Request) {
 
 	res := toProductRes(product)
 
+	w.Header().Set("ETag", productETag(product))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(res)
@@ -55,20 +73,21 @@ func (h *handler) getProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	product, err := h.server.GetProduct(h.ctx, i)
+	product, err := h.server.GetProduct(r.Context(), i)
 	if err != nil {
 		http.Error(w, "Product not found", http.StatusNotFound)
 		return
 	}
 
 	res := toProductRes(product)
+	w.Header().Set("ETag", productETag(product))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(res)
 }
 
 func (h *handler) listProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := h.server.ListProducts(h.ctx)
+	products, err := h.server.ListProducts(r.Context())
 	if err != nil {
 		http.Error(w, "Failed to list products", http.StatusInternalServerError)
 		return
@@ -92,27 +111,72 @@ func (h *handler) updateProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var p ProductReq
-	if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
-		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		http.Error(w, "If-Match header is required", http.StatusPreconditionRequired)
+		return
+	}
+	// A weak tag is well formed but never matches under strong comparison.
+	if strings.HasPrefix(strings.TrimSpace(ifMatch), "W/") {
+		http.Error(w, "If-Match needs a strong ETag", http.StatusPreconditionFailed)
+		return
+	}
+	version, ok := parseETag(ifMatch)
+	if !ok {
+		http.Error(w, "Invalid If-Match header", http.StatusBadRequest)
 		return
 	}
 
-	product, err := h.server.GetProduct(h.ctx, i)
+	if ct := r.Header.Get("Content-Type"); ct != "" && !isMergePatchContentType(ct) {
+		http.Error(w, "Content-Type must be application/merge-patch+json or application/json", http.StatusUnsupportedMediaType)
+		return
+	}
+
+	var p ProductPatchReq
+	if err := decodeStrictJSON(r, &p); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	product, err := h.server.GetProduct(r.Context(), i)
 	if err != nil {
 		http.Error(w, "Product not found", http.StatusNotFound)
 		return
 	}
 
-	patchProductReq(product, p)
+	if product.Version != version {
+		w.Header().Set("ETag", productETag(product))
+		http.Error(w, "Product has been modified", http.StatusPreconditionFailed)
+		return
+	}
+
+	if err := patchProductReq(product, p); err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	product, err = h.server.UpdateProduct(h.ctx, product)
+	product, err = h.server.UpdateProduct(r.Context(), product)
+	if errors.Is(err, storer.ErrVersionConflict) {
+		http.Error(w, "Product has been modified", http.StatusPreconditionFailed)
+		return
+	}
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	// Lowering count_in_stock takes stock out of the warehouses in order of
+	// preference; use the stock adjustment endpoint to pick one.
+	if errors.Is(err, storer.ErrInsufficientStock) {
+		http.Error(w, "Not enough stock in the warehouses", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to update product", http.StatusInternalServerError)
 		return
 	}
 
 	res := toProductRes(product)
+	w.Header().Set("ETag", productETag(product))
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(res)
@@ -126,7 +190,11 @@ func (h *handler) deleteProduct(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.server.DeleteProduct(h.ctx, i)
+	err = h.server.DeleteProduct(r.Context(), i)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to delete product", http.StatusInternalServerError)
 		return
@@ -135,62 +203,188 @@ func (h *handler) deleteProduct(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// actorFromRequest names who is making a change, for audit records. Nobody
+// is authenticated outside the admin API, so the client IP is the best there
+// is; requireAdmin replaces it with the admin's X-Actor header.
+func actorFromRequest(r *http.Request) string {
+	return "anonymous " + ratelimit.ByIP(r)
+}
+
+// decodeJSON decodes the request body into v inside its own span, so slow
+// payloads show up separately from the work done with them.
+func decodeJSON(r *http.Request, v any) error {
+	_, span := tracing.Tracer().Start(r.Context(), "json.decode")
+	err := json.NewDecoder(r.Body).Decode(v)
+	tracing.End(span, err)
+	return err
+}
+
+// productETag is the strong entity tag clients send back in If-Match to
+// update a product.
+func productETag(p *storer.Product) string {
+	return `"` + strconv.FormatInt(p.Version, 10) + `"`
+}
+
+// parseETag reads the product version out of an If-Match header. If-Match
+// uses the strong comparison, so weak tags never match.
+func parseETag(s string) (int64, bool) {
+	unquoted, ok := strings.CutPrefix(strings.TrimSpace(s), `"`)
+	if !ok {
+		return 0, false
+	}
+	unquoted, ok = strings.CutSuffix(unquoted, `"`)
+	if !ok {
+		return 0, false
+	}
+	v, err := strconv.ParseInt(unquoted, 10, 64)
+	return v, err == nil
+}
+
+// decodeStrictJSON is decodeJSON that rejects unknown fields and anything
+// after the first JSON value.
+func decodeStrictJSON(r *http.Request, v any) error {
+	_, span := tracing.Tracer().Start(r.Context(), "json.decode")
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	if err == nil && dec.More() {
+		err = fmt.Errorf("unexpected data after JSON object")
+	}
+
+	tracing.End(span, err)
+	return err
+}
+
 func toStorerProduct(p ProductReq) *storer.Product {
 	return &storer.Product{
-		Name:         p.Name,
-		Image:        p.Image,
-		Category:     p.Category,
-		Description:  p.Description,
-		Rating:       p.Rating,
-		NumReviews:   p.NumReviews,
-		Price:        p.Price,
-		CountInStock: p.CountInStock,
+		SKU:              p.SKU,
+		Name:             p.Name,
+		Image:            p.Image,
+		Category:         p.Category,
+		Description:      p.Description,
+		Rating:           p.Rating,
+		NumReviews:       p.NumReviews,
+		Price:            p.Price,
+		CountInStock:     p.CountInStock,
+		ReorderThreshold: p.ReorderThreshold,
+		TaxCategory:      p.TaxCategory,
+		Weight:           p.Weight,
+		Length:           p.Length,
+		Width:            p.Width,
+		Height:           p.Height,
 	}
 }
 
 func toProductRes(p *storer.Product) ProductRes {
 	return ProductRes{
-		ID:           p.ID,
-		Name:         p.Name,
-		Image:        p.Image,
-		Category:     p.Category,
-		Description:  p.Description,
-		Rating:       p.Rating,
-		NumReviews:   p.NumReviews,
-		Price:        p.Price,
-		CountInStock: p.CountInStock,
-		CreatedAt:    p.CreatedAt,
-		UpdatedAt:    p.UpdatedAt,
+		ID:               p.ID,
+		SKU:              p.SKU,
+		Name:             p.Name,
+		Image:            p.Image,
+		Category:         p.Category,
+		Description:      p.Description,
+		Rating:           p.Rating,
+		NumReviews:       p.NumReviews,
+		Price:            p.Price,
+		CountInStock:     p.CountInStock,
+		ReorderThreshold: p.ReorderThreshold,
+		TaxCategory:      p.TaxCategory,
+		Weight:           p.Weight,
+		Length:           p.Length,
+		Width:            p.Width,
+		Height:           p.Height,
+		CreatedAt:        p.CreatedAt,
+		UpdatedAt:        p.UpdatedAt,
 	}
 }
 
-func patchProductReq(product *storer.Product, p ProductReq) {
-	if p.Name != "" {
-		product.Name = p.Name
+// patchProductReq applies a merge patch to product. Only the description and
+// the tax category can be cleared with null; the other columns are required.
+func patchProductReq(product *storer.Product, p ProductPatchReq) error {
+	if err := applyString("name", &product.Name, p.Name); err != nil {
+		return err
 	}
-	if p.Image != "" {
-		product.Image = p.Image
+	if err := applyString("image", &product.Image, p.Image); err != nil {
+		return err
 	}
-	if p.Category != "" {
-		product.Category = p.Category
+	if err := applyString("category", &product.Category, p.Category); err != nil {
+		return err
 	}
-	if p.Description != "" {
-		product.Description = p.Description
+	if p.Description.Set {
+		product.Description = p.Description.Value
 	}
-	if p.Rating != 0 {
-		product.Rating = p.Rating
+	if p.TaxCategory.Set {
+		product.TaxCategory = p.TaxCategory.Value
 	}
-	if p.NumReviews != 0 {
-		product.NumReviews = p.NumReviews
+	if err := applyNonNegative("rating", &product.Rating, p.Rating); err != nil {
+		return err
 	}
-	if p.Price != 0 {
-		product.Price = p.Price
+	if err := applyNonNegative("num_reviews", &product.NumReviews, p.NumReviews); err != nil {
+		return err
 	}
-	if p.CountInStock != 0 {
-		product.CountInStock = p.CountInStock
+	if err := applyNonNegative("count_in_stock", &product.CountInStock, p.CountInStock); err != nil {
+		return err
+	}
+	if err := applyNonNegative("reorder_threshold", &product.ReorderThreshold, p.ReorderThreshold); err != nil {
+		return err
+	}
+	if err := applyNonNegativeFloat("price", &product.Price, p.Price); err != nil {
+		return err
+	}
+	if err := applyNonNegativeFloat("weight", &product.Weight, p.Weight); err != nil {
+		return err
+	}
+	if err := applyNonNegativeFloat("length", &product.Length, p.Length); err != nil {
+		return err
+	}
+	if err := applyNonNegativeFloat("width", &product.Width, p.Width); err != nil {
+		return err
+	}
+	if err := applyNonNegativeFloat("height", &product.Height, p.Height); err != nil {
+		return err
 	}
 
 	product.UpdatedAt = toTimePtr(time.Now())
+	return nil
+}
+
+func applyString(field string, dst *string, v Optional[string]) error {
+	if !v.Set {
+		return nil
+	}
+	if v.Null || v.Value == "" {
+		return fmt.Errorf("%s cannot be null or empty", field)
+	}
+	*dst = v.Value
+	return nil
+}
+
+func applyNonNegative(field string, dst *int64, v Optional[int64]) error {
+	if !v.Set {
+		return nil
+	}
+	if v.Null || v.Value < 0 {
+		return fmt.Errorf("%s must be a non-negative integer", field)
+	}
+	*dst = v.Value
+	return nil
+}
+
+func applyNonNegativeFloat(field string, dst *float64, v Optional[float64]) error {
+	if !v.Set {
+		return nil
+	}
+	if v.Null || v.Value < 0 {
+		return fmt.Errorf("%s must be a non-negative number", field)
+	}
+	*dst = v.Value
+	return nil
+}
+
+func isMergePatchContentType(ct string) bool {
+	mt, _, err := mime.ParseMediaType(ct)
+	return err == nil && (mt == "application/merge-patch+json" || mt == "application/json")
 }
 
 func toTimePtr(t time.Time) *time.Time {
@@ -199,14 +393,61 @@ func toTimePtr(t time.Time) *time.Time {
 
 func (h *handler) createOrder(w http.ResponseWriter, r *http.Request) {
 	var o OrderReq
-	if err := json.NewDecoder(r.Body).Decode(&o); err != nil {
+	if err := decodeJSON(r, &o); err != nil {
 		http.Error(w, "bad request", http.StatusBadRequest)
 		return
 	}
 
-	created, err := h.server.CreateOrder(h.ctx, toStorerOrder(o))
+	for _, oi := range o.Items {
+		if oi.Quantity <= 0 {
+			http.Error(w, "item quantities must be > 0", http.StatusBadRequest)
+			return
+		}
+	}
+
+	for _, a := range []*AddressReq{o.ShippingAddress, o.BillingAddress} {
+		if a == nil {
+			continue
+		}
+		normalizeAddressReq(a)
+		if msg := validateAddressReq(*a); msg != "" {
+			http.Error(w, "Invalid address: "+msg, http.StatusBadRequest)
+			return
+		}
+	}
+
+	created, err := h.server.CreateOrder(r.Context(), toStorerOrder(o))
+	if errors.Is(err, storer.ErrInvalidQuantity) {
+		http.Error(w, "item quantities must be > 0", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, storer.ErrInsufficientStock) {
+		http.Error(w, "insufficient stock", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, storer.ErrUnknownProduct) {
+		http.Error(w, "unknown product", http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, storer.ErrAddressRequired) || errors.Is(err, storer.ErrUnknownAddress) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, storer.ErrEmailNotVerified) {
+		http.Error(w, "Verify your email address before checking out", http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, storer.ErrUnknownShippingMethod) {
+		http.Error(w, "shipping method not available for this address", http.StatusUnprocessableEntity)
+		return
+	}
+	var coupon *promotion.IneligibleError
+	if errors.As(err, &coupon) {
+		http.Error(w, coupon.Error(), http.StatusUnprocessableEntity)
+		return
+	}
 	if err != nil {
-		log.Println("CreateOrder error:", err)
+		logger.FromContext(r.Context()).Error("failed to create order", "error", err)
 		http.Error(w, "internal server error", http.StatusInternalServerError)
 		return
 	}
@@ -225,7 +466,7 @@ func (h *handler) getOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	order, err := h.server.GetOrder(h.ctx, i)
+	order, err := h.server.GetOrder(r.Context(), i)
 	if err != nil {
 		http.Error(w, "Order not found", http.StatusNotFound)
 		return
@@ -238,17 +479,149 @@ func (h *handler) getOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *handler) listOrders(w http.ResponseWriter, r *http.Request) {
-	orders, err := h.server.ListOrders(h.ctx)
+	f, err := parseOrderFilter(r)
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Ask for one extra row to know whether there is a next page.
+	limit := f.Limit
+	f.Limit++
+
+	orders, err := h.server.ListOrders(r.Context(), f)
 	if err != nil {
 		http.Error(w, "Failed to list orders", http.StatusInternalServerError)
 		return
 	}
 
-	var res []OrderRes
+	res := ListOrdersRes{Orders: []OrderRes{}}
+	if len(orders) > limit {
+		orders = orders[:limit]
+		res.NextCursor = strconv.FormatInt(orders[limit-1].ID, 10)
+	}
 	for _, o := range orders {
-		res = append(res, toOrderRes(&o))
+		res.Orders = append(res.Orders, toOrderRes(&o))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+const (
+	defaultOrdersPageSize = 50
+	maxOrdersPageSize     = 200
+)
+
+func parseOrderFilter(r *http.Request) (storer.OrderFilter, error) {
+	q := r.URL.Query()
+	f := storer.OrderFilter{
+		Status: q.Get("status"),
+		Limit:  defaultOrdersPageSize,
+	}
+
+	if v := q.Get("user_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid user_id")
+		}
+		f.UserID = id
+	}
+	if v := q.Get("cursor"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("invalid cursor")
+		}
+		f.After = id
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxOrdersPageSize {
+			return f, fmt.Errorf("invalid limit: must be between 1 and %d", maxOrdersPageSize)
+		}
+		f.Limit = n
+	}
+	for _, p := range []struct {
+		name string
+		dst  **time.Time
+	}{{"created_from", &f.CreatedFrom}, {"created_to", &f.CreatedTo}} {
+		if v := q.Get(p.name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s: must be RFC 3339", p.name)
+			}
+			*p.dst = &t
+		}
+	}
+	for _, p := range []struct {
+		name string
+		dst  **float64
+	}{{"min_total", &f.MinTotal}, {"max_total", &f.MaxTotal}} {
+		if v := q.Get(p.name); v != "" {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return f, fmt.Errorf("invalid %s", p.name)
+			}
+			*p.dst = &n
+		}
+	}
+
+	return f, nil
+}
+
+func (h *handler) updateOrder(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req UpdateOrderReq
+	if err := decodeJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	u := &storer.OrderUpdate{
+		OrderID:       i,
+		PaymentMethod: req.PaymentMethod,
+		ShipTo:        toLocation(req.ShipTo),
+	}
+	seen := make(map[int64]bool, len(req.Items))
+	for _, e := range req.Items {
+		if e.Quantity < 0 || seen[e.ProductID] {
+			http.Error(w, "Invalid item edits: quantities must be >= 0 and products unique", http.StatusBadRequest)
+			return
+		}
+		seen[e.ProductID] = true
+		u.Items = append(u.Items, storer.OrderItemEdit{ProductID: e.ProductID, Quantity: e.Quantity})
+	}
+
+	order, err := h.server.UpdateOrder(r.Context(), u)
+	switch {
+	case errors.Is(err, storer.ErrNotFound):
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	case errors.Is(err, storer.ErrOrderNotPending):
+		http.Error(w, "Order can only be changed while pending", http.StatusConflict)
+		return
+	case errors.Is(err, storer.ErrInsufficientStock):
+		http.Error(w, "Insufficient stock", http.StatusConflict)
+		return
+	case errors.Is(err, storer.ErrUnknownProduct):
+		http.Error(w, "Unknown product", http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, storer.ErrUnknownShippingMethod):
+		http.Error(w, "Shipping method not available for the new items", http.StatusUnprocessableEntity)
+		return
+	case err != nil:
+		http.Error(w, "Failed to update order", http.StatusInternalServerError)
+		return
 	}
 
+	res := toOrderRes(order)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(res)
@@ -262,7 +635,15 @@ func (h *handler) deleteOrder(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.server.DeleteOrder(h.ctx, i)
+	err = h.server.DeleteOrder(r.Context(), i)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, storer.ErrOrderPaid) {
+		http.Error(w, "Order is paid; refund it with POST /admin/orders/{id}/refunds", http.StatusConflict)
+		return
+	}
 	if err != nil {
 		http.Error(w, "Failed to delete order", http.StatusInternalServerError)
 		return
@@ -272,13 +653,45 @@ func (h *handler) deleteOrder(w http.ResponseWriter, r *http.Request) {
 }
 
 func toStorerOrder(o OrderReq) *storer.Order {
-	return &storer.Order{
-		PaymentMethod: o.PaymentMethod,
-		TaxPrice:      o.TaxPrice,
-		ShippingPrice: o.ShippingPrice,
-		TotalPrice:    o.TotalPrice,
-		Items:         toStorerOrderItems(o.Items),
+	order := &storer.Order{
+		UserID:         o.UserID,
+		PaymentMethod:  o.PaymentMethod,
+		ShippingMethod: o.ShippingMethod,
+		Items:          toStorerOrderItems(o.Items),
+		ShipTo:         toLocation(o.ShipTo),
+		CouponCodes:    o.CouponCodes,
+	}
+	order.ShippingAddress = toStorerOrderAddress(o.ShippingAddress, o.ShippingAddressID)
+	order.BillingAddress = toStorerOrderAddress(o.BillingAddress, o.BillingAddressID)
+	return order
+}
+
+// toStorerOrderAddress returns an inline address, or one naming only the
+// address book entry to copy. Nil leaves the choice to the server.
+func toStorerOrderAddress(a *AddressReq, id *int64) *storer.OrderAddress {
+	switch {
+	case a != nil:
+		return &storer.OrderAddress{
+			Name:       a.Name,
+			Line1:      a.Line1,
+			Line2:      a.Line2,
+			City:       a.City,
+			Region:     a.Region,
+			PostalCode: a.PostalCode,
+			Country:    a.Country,
+			Phone:      a.Phone,
+		}
+	case id != nil:
+		return &storer.OrderAddress{AddressID: id}
+	}
+	return nil
+}
+
+func toLocation(l *LocationReq) *allocation.Location {
+	if l == nil {
+		return nil
 	}
+	return &allocation.Location{Latitude: l.Latitude, Longitude: l.Longitude}
 }
 
 func toStorerOrderItems(items []OrderItem) []storer.OrderItem {
@@ -297,26 +710,55 @@ func toStorerOrderItems(items []OrderItem) []storer.OrderItem {
 
 func toOrderRes(o *storer.Order) OrderRes {
 	return OrderRes{
-		ID:            o.ID,
-		Items:         toOrderItems(o.Items),
-		PaymentMethod: o.PaymentMethod,
-		TaxPrice:      o.TaxPrice,
-		ShippingPrice: o.ShippingPrice,
-		TotalPrice:    o.TotalPrice,
-		CreatedAt:     o.CreatedAt,
-		UpdatedAt:     o.UpdatedAt,
+		ID:              o.ID,
+		UserID:          o.UserID,
+		Status:          o.Status,
+		Items:           toOrderItems(o.Items),
+		PaymentMethod:   o.PaymentMethod,
+		TaxPrice:        o.TaxPrice,
+		TaxInclusive:    o.TaxInclusive,
+		ShippingPrice:   o.ShippingPrice,
+		ShippingMethod:  o.ShippingMethod,
+		DiscountPrice:   o.DiscountPrice,
+		TotalPrice:      o.TotalPrice,
+		RefundedAmount:  o.RefundedAmount,
+		RefundStatus:    o.RefundStatus(),
+		Adjustments:     toOrderAdjustments(o.Adjustments),
+		ShippingAddress: toOrderAddressRes(o.ShippingAddress),
+		BillingAddress:  toOrderAddressRes(o.BillingAddress),
+		CreatedAt:       o.CreatedAt,
+		UpdatedAt:       o.UpdatedAt,
 	}
 }
 
+func toOrderAdjustments(adjustments []storer.OrderAdjustment) []OrderAdjustmentRes {
+	res := []OrderAdjustmentRes{}
+	for _, a := range adjustments {
+		res = append(res, OrderAdjustmentRes{
+			ID:          a.ID,
+			OrderItemID: a.OrderItemID,
+			Code:        a.Code,
+			Kind:        a.Kind,
+			Amount:      a.Amount,
+			Description: a.Description,
+		})
+	}
+	return res
+}
+
 func toOrderItems(items []storer.OrderItem) []OrderItem {
 	var res []OrderItem
 	for _, i := range items {
 		res = append(res, OrderItem{
-			Name:      i.Name,
-			Quantity:  i.Quantity,
-			Image:     i.Image,
-			Price:     i.Price,
-			ProductID: i.ProductID,
+			ID:          i.ID,
+			Name:        i.Name,
+			Quantity:    i.Quantity,
+			Image:       i.Image,
+			Price:       i.Price,
+			ProductID:   i.ProductID,
+			WarehouseID: i.WarehouseID,
+			TaxRate:     i.TaxRate,
+			TaxAmount:   i.TaxAmount,
 		})
 	}
 	return res
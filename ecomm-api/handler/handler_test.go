@@ -0,0 +1,604 @@
+package handler
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/email"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/mail"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/ratelimit"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/server"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+const testAdminToken = "admin-secret"
+
+// arrayConverter lets slices through as query arguments, the way the pgx
+// driver accepts them for "= ANY($1)".
+type arrayConverter struct{}
+
+func (arrayConverter) ConvertValue(v any) (driver.Value, error) {
+	switch v := v.(type) {
+	case []int64, []string:
+		return v, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+// withTestHandler runs fn against the full router, backed by a sqlmock
+// database. Rate limits are high enough never to get in the way.
+func withTestHandler(t *testing.T, fn func(h http.Handler, mock sqlmock.Sqlmock), opts ...server.Option) {
+	mockDB, mock, err := sqlmock.New(
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual),
+		sqlmock.ValueConverterOption(arrayConverter{}),
+	)
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	st := storer.NewPySQLStorer(sqlx.NewDb(mockDB, "sqlmock"))
+	limiter := ratelimit.NewLimiter(ratelimit.NewMemoryStore(), ratelimit.ByIP,
+		&ratelimit.Config{Default: ratelimit.Policy{Rate: 1000, Burst: 1000}})
+	h := NewHandler(server.NewServer(st, opts...), limiter, &Config{AdminToken: testAdminToken})
+
+	fn(RegisterRoutes(h), mock)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func serve(h http.Handler, method, target string, body io.Reader, header map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, body)
+	for k, v := range header {
+		req.Header.Set(k, v)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+var (
+	orderColumns = []string{"id", "user_id", "status", "payment_method", "tax_price", "shipping_price", "total_price", "discount_price", "created_at", "updated_at", "deleted_at"}
+	adminHeader  = map[string]string{"Authorization": "Bearer " + testAdminToken}
+)
+
+func TestParseOrderFilter(t *testing.T) {
+	tsc := []struct {
+		name  string
+		query string
+		want  storer.OrderFilter
+		err   string
+	}{
+		{name: "defaults", want: storer.OrderFilter{Limit: defaultOrdersPageSize}},
+		{
+			name:  "cursor and limit",
+			query: "cursor=42&limit=10&status=paid&user_id=7",
+			want:  storer.OrderFilter{After: 42, Limit: 10, Status: "paid", UserID: 7},
+		},
+		{name: "max limit", query: "limit=200", want: storer.OrderFilter{Limit: maxOrdersPageSize}},
+		{name: "limit too large", query: "limit=201", err: "invalid limit"},
+		{name: "limit zero", query: "limit=0", err: "invalid limit"},
+		{name: "bad cursor", query: "cursor=abc", err: "invalid cursor"},
+		{name: "bad date", query: "created_from=yesterday", err: "invalid created_from"},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := parseOrderFilter(httptest.NewRequest(http.MethodGet, "/orders?"+tc.query, nil))
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, f)
+		})
+	}
+}
+
+func TestListOrdersPages(t *testing.T) {
+	now := time.Now()
+
+	tsc := []struct {
+		name       string
+		query      string
+		after      int64
+		ids        []int64
+		want       []int64
+		nextCursor string
+	}{
+		{name: "first page with more", query: "?limit=2", ids: []int64{9, 8, 7}, want: []int64{9, 8}, nextCursor: "8"},
+		{name: "exactly one page", query: "?limit=2", ids: []int64{9, 8}, want: []int64{9, 8}},
+		{name: "last page", query: "?limit=2&cursor=8", after: 8, ids: []int64{7}, want: []int64{7}},
+		{name: "past the end", query: "?limit=2&cursor=1", after: 1, want: []int64{}},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestHandler(t, func(h http.Handler, mock sqlmock.Sqlmock) {
+				rows := sqlmock.NewRows(orderColumns)
+				for _, id := range tc.ids {
+					rows.AddRow(id, 1, storer.OrderStatusPending, "card", 0.0, 0.0, 10.0, 0.0, now, nil, nil)
+				}
+				if tc.after != 0 {
+					mock.ExpectQuery("SELECT * FROM orders WHERE deleted_at IS NULL AND id < $1 ORDER BY id DESC LIMIT $2").
+						WithArgs(tc.after, 3).WillReturnRows(rows)
+				} else {
+					mock.ExpectQuery("SELECT * FROM orders WHERE deleted_at IS NULL ORDER BY id DESC LIMIT $1").
+						WithArgs(3).WillReturnRows(rows)
+				}
+				if len(tc.ids) > 0 {
+					for _, q := range []string{
+						"SELECT * FROM order_items WHERE order_id = ANY($1) ORDER BY id",
+						"SELECT * FROM order_adjustments WHERE order_id = ANY($1) ORDER BY id",
+						"SELECT * FROM order_addresses WHERE order_id = ANY($1)",
+					} {
+						mock.ExpectQuery(q).WithArgs(tc.ids).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+					}
+				}
+
+				rec := serve(h, http.MethodGet, "/orders"+tc.query, nil, nil)
+				require.Equal(t, http.StatusOK, rec.Code)
+
+				var res ListOrdersRes
+				require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+				got := []int64{}
+				for _, o := range res.Orders {
+					got = append(got, o.ID)
+				}
+				require.Equal(t, tc.want, got)
+				require.Equal(t, tc.nextCursor, res.NextCursor)
+			})
+		})
+	}
+}
+
+func TestParseETag(t *testing.T) {
+	tsc := []struct {
+		name    string
+		tag     string
+		version int64
+		ok      bool
+	}{
+		{name: "strong", tag: `"3"`, version: 3, ok: true},
+		{name: "surrounding spaces", tag: ` "3" `, version: 3, ok: true},
+		{name: "weak", tag: `W/"3"`},
+		{name: "unquoted", tag: `3`},
+		{name: "not a version", tag: `"abc"`},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			version, ok := parseETag(tc.tag)
+			require.Equal(t, tc.ok, ok)
+			require.Equal(t, tc.version, version)
+		})
+	}
+}
+
+func TestPatchProductReq(t *testing.T) {
+	base := storer.Product{
+		ID:           1,
+		Name:         "Mug",
+		Image:        "mug.jpg",
+		Category:     "kitchen",
+		Description:  "Holds tea",
+		TaxCategory:  "standard",
+		Rating:       4,
+		NumReviews:   12,
+		Price:        9.5,
+		CountInStock: 3,
+	}
+
+	tsc := []struct {
+		name  string
+		patch string
+		want  func(p *storer.Product)
+		err   string
+	}{
+		{
+			name:  "absent fields are left unchanged",
+			patch: `{"price": 5}`,
+			want:  func(p *storer.Product) { p.Price = 5 },
+		},
+		{
+			name:  "explicit zero is applied",
+			patch: `{"rating": 0, "count_in_stock": 0, "price": 0}`,
+			want:  func(p *storer.Product) { p.Rating, p.CountInStock, p.Price = 0, 0, 0 },
+		},
+		{
+			name:  "null clears the description",
+			patch: `{"description": null}`,
+			want:  func(p *storer.Product) { p.Description = "" },
+		},
+		{name: "null name", patch: `{"name": null}`, err: "name cannot be null or empty"},
+		{name: "empty name", patch: `{"name": ""}`, err: "name cannot be null or empty"},
+		{name: "negative integer", patch: `{"num_reviews": -1}`, err: "num_reviews must be a non-negative integer"},
+		{name: "negative number", patch: `{"price": -0.5}`, err: "price must be a non-negative number"},
+		{name: "null number", patch: `{"weight": null}`, err: "weight must be a non-negative number"},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			var p ProductPatchReq
+			require.NoError(t, json.Unmarshal([]byte(tc.patch), &p))
+
+			product := base
+			err := patchProductReq(&product, p)
+			if tc.err != "" {
+				require.EqualError(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.NotNil(t, product.UpdatedAt)
+
+			want := base
+			tc.want(&want)
+			want.UpdatedAt = product.UpdatedAt
+			require.Equal(t, want, product)
+		})
+	}
+}
+
+func TestUpdateProductRejectsInvalidPatch(t *testing.T) {
+	tsc := []struct {
+		name  string
+		patch string
+		// loaded is set when the patch is only rejected once applied to the
+		// stored product.
+		loaded bool
+	}{
+		{name: "unknown field", patch: `{"colour": "blue"}`},
+		{name: "null name", patch: `{"name": null}`, loaded: true},
+		{name: "empty name", patch: `{"name": ""}`, loaded: true},
+		{name: "negative stock", patch: `{"count_in_stock": -2}`, loaded: true},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestHandler(t, func(h http.Handler, mock sqlmock.Sqlmock) {
+				if tc.loaded {
+					mock.ExpectQuery("SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL").WithArgs(1).
+						WillReturnRows(sqlmock.NewRows([]string{"id", "name", "version"}).AddRow(1, "Mug", 3))
+				}
+
+				header := map[string]string{"Content-Type": "application/merge-patch+json", "If-Match": `"3"`}
+				rec := serve(h, http.MethodPatch, "/products/1", strings.NewReader(tc.patch), header)
+				require.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+	}
+}
+
+func TestUpdateProductIfMatch(t *testing.T) {
+	tsc := []struct {
+		name    string
+		ifMatch string
+		code    int
+	}{
+		{name: "missing", code: http.StatusPreconditionRequired},
+		{name: "weak", ifMatch: `W/"3"`, code: http.StatusPreconditionFailed},
+		{name: "malformed", ifMatch: `3`, code: http.StatusBadRequest},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestHandler(t, func(h http.Handler, mock sqlmock.Sqlmock) {
+				header := map[string]string{"Content-Type": "application/merge-patch+json"}
+				if tc.ifMatch != "" {
+					header["If-Match"] = tc.ifMatch
+				}
+				rec := serve(h, http.MethodPatch, "/products/1", strings.NewReader(`{"price": 5}`), header)
+				require.Equal(t, tc.code, rec.Code)
+			})
+		})
+	}
+}
+
+func TestImportProductsRequiresAdmin(t *testing.T) {
+	withTestHandler(t, func(h http.Handler, mock sqlmock.Sqlmock) {
+		rec := serve(h, http.MethodPost, "/products/import?format=ndjson",
+			strings.NewReader(`{"sku":"MUG-1","name":"Mug","price":1}`+"\n"), nil)
+		require.Equal(t, http.StatusForbidden, rec.Code)
+	})
+}
+
+func TestReconcileStock(t *testing.T) {
+	tsc := []struct {
+		name  string
+		query string
+		want  []StockReconciliationRes
+	}{
+		{
+			name: "all products",
+			want: []StockReconciliationRes{
+				{ProductID: 1, SKU: "MUG-1", CountInStock: 10, LedgerStock: 10},
+				{ProductID: 2, SKU: "CUP-1", CountInStock: 7, LedgerStock: 9, Drift: -2},
+			},
+		},
+		{
+			name:  "drift only",
+			query: "?drift_only=true",
+			want: []StockReconciliationRes{
+				{ProductID: 2, SKU: "CUP-1", CountInStock: 7, LedgerStock: 9, Drift: -2},
+			},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestHandler(t, func(h http.Handler, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(`SELECT p.id AS product_id, p.sku, p.count_in_stock, COALESCE(SUM(m.delta), 0) AS ledger_stock
+		FROM products p
+		LEFT JOIN inventory_movements m ON m.product_id = p.id
+		WHERE p.deleted_at IS NULL
+		GROUP BY p.id, p.sku, p.count_in_stock
+		ORDER BY p.id`).
+					WillReturnRows(sqlmock.NewRows([]string{"product_id", "sku", "count_in_stock", "ledger_stock"}).
+						AddRow(1, "MUG-1", 10, 10).
+						AddRow(2, "CUP-1", 7, 9))
+
+				rec := serve(h, http.MethodGet, "/admin/inventory/reconcile"+tc.query, nil, adminHeader)
+				require.Equal(t, http.StatusOK, rec.Code)
+
+				var res []StockReconciliationRes
+				require.NoError(t, json.NewDecoder(rec.Body).Decode(&res))
+				require.Equal(t, tc.want, res)
+			})
+		})
+	}
+}
+
+func TestQuoteShipping(t *testing.T) {
+	tooMany := strings.Repeat("1:1,", maxQuoteItems) + "1:1"
+
+	tsc := []struct {
+		name  string
+		items string
+		found []int64
+		code  int
+	}{
+		{name: "too many items", items: tooMany, code: http.StatusBadRequest},
+		{name: "bad quantity", items: "1:0", code: http.StatusBadRequest},
+		{name: "unknown product", items: "1:2,2:1", found: []int64{1}, code: http.StatusUnprocessableEntity},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestHandler(t, func(h http.Handler, mock sqlmock.Sqlmock) {
+				if tc.found != nil {
+					rows := sqlmock.NewRows([]string{"id", "name", "price"})
+					for _, id := range tc.found {
+						rows.AddRow(id, "Mug", 10)
+					}
+					mock.ExpectQuery("SELECT * FROM products WHERE id = ANY($1) AND deleted_at IS NULL").
+						WithArgs([]int64{1, 2}).WillReturnRows(rows)
+				}
+
+				rec := serve(h, http.MethodGet, "/shipping/quote?country=US&items="+tc.items, nil, nil)
+				require.Equal(t, tc.code, rec.Code)
+			})
+		})
+	}
+}
+
+func TestAddresses(t *testing.T) {
+	const valid = `{"name":"Ada","line1":"1 Main St","city":"Springfield","country":"us"}`
+
+	tsc := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		header map[string]string
+		test   func(mock sqlmock.Sqlmock)
+		code   int
+	}{
+		{name: "list needs admin", method: http.MethodGet, target: "/users/4/addresses", code: http.StatusForbidden},
+		{name: "create needs admin", method: http.MethodPost, target: "/users/4/addresses", body: valid, code: http.StatusForbidden},
+		{name: "delete needs admin", method: http.MethodDelete, target: "/users/4/addresses/9", code: http.StatusForbidden},
+		{
+			name:   "invalid address",
+			method: http.MethodPost,
+			target: "/users/4/addresses",
+			body:   `{"name":"Ada","line1":"1 Main St","city":"Springfield","country":"USA"}`,
+			header: adminHeader,
+			code:   http.StatusBadRequest,
+		},
+		{
+			name:   "unknown user",
+			method: http.MethodGet,
+			target: "/users/4/addresses",
+			header: adminHeader,
+			test: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery("SELECT EXISTS (SELECT 1 FROM users WHERE id=$1)").WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+			},
+			code: http.StatusNotFound,
+		},
+		{
+			name:   "another user's address",
+			method: http.MethodDelete,
+			target: "/users/4/addresses/9",
+			header: adminHeader,
+			test: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("DELETE FROM addresses WHERE id=$1 AND user_id=$2").WithArgs(9, 4).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+			},
+			code: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestHandler(t, func(h http.Handler, mock sqlmock.Sqlmock) {
+				if tc.test != nil {
+					tc.test(mock)
+				}
+				rec := serve(h, tc.method, tc.target, strings.NewReader(tc.body), tc.header)
+				require.Equal(t, tc.code, rec.Code)
+			})
+		})
+	}
+}
+
+func TestPaymentActionsRequireAdmin(t *testing.T) {
+	for _, action := range []string{"capture", "void", "refund"} {
+		t.Run(action, func(t *testing.T) {
+			withTestHandler(t, func(h http.Handler, mock sqlmock.Sqlmock) {
+				rec := serve(h, http.MethodPost, "/payments/3/"+action, strings.NewReader(`{"amount": 5}`), nil)
+				require.Equal(t, http.StatusForbidden, rec.Code)
+			})
+		})
+	}
+}
+
+func TestWebhookSubscriptionRejectsPrivateHosts(t *testing.T) {
+	for _, u := range []string{
+		"http://localhost:8080/hooks",
+		"http://127.0.0.1/hooks",
+		"http://10.0.0.8/hooks",
+		"http://169.254.169.254/latest/meta-data",
+		"http://[::1]/hooks",
+	} {
+		t.Run(u, func(t *testing.T) {
+			withTestHandler(t, func(h http.Handler, mock sqlmock.Sqlmock) {
+				body := `{"url": "` + u + `", "event_types": ["order.created"]}`
+				rec := serve(h, http.MethodPost, "/webhooks/subscriptions", strings.NewReader(body), adminHeader)
+				require.Equal(t, http.StatusBadRequest, rec.Code)
+				require.Contains(t, rec.Body.String(), "public host")
+			})
+		})
+	}
+}
+
+func TestShipOrder(t *testing.T) {
+	const lock = "SELECT status FROM orders WHERE id=$1 AND deleted_at IS NULL FOR UPDATE"
+
+	tsc := []struct {
+		name   string
+		body   string
+		header map[string]string
+		expect func(mock sqlmock.Sqlmock)
+		code   int
+	}{
+		{name: "requires admin", body: `{"carrier": "DHL"}`, code: http.StatusForbidden},
+		{name: "bad tracking url", body: `{"tracking_url": "javascript:alert(1)"}`, header: adminHeader, code: http.StatusBadRequest},
+		{
+			name:   "unknown order",
+			body:   `{"carrier": "DHL"}`,
+			header: adminHeader,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lock).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"status"}))
+				mock.ExpectRollback()
+			},
+			code: http.StatusNotFound,
+		},
+		{
+			name:   "order not paid",
+			body:   `{"carrier": "DHL"}`,
+			header: adminHeader,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(lock).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(storer.OrderStatusPending))
+				mock.ExpectRollback()
+			},
+			code: http.StatusConflict,
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestHandler(t, func(h http.Handler, mock sqlmock.Sqlmock) {
+				if tc.expect != nil {
+					tc.expect(mock)
+				}
+				rec := serve(h, http.MethodPost, "/admin/orders/3/ship", strings.NewReader(tc.body), tc.header)
+				require.Equal(t, tc.code, rec.Code)
+			})
+		})
+	}
+}
+
+func TestAccountEmailRequestsLookAlike(t *testing.T) {
+	mailer, err := email.NewMailer(&email.Config{ShopName: "Teashop"}, &mail.FileSender{Dir: t.TempDir()}, "shop@example.com")
+	require.NoError(t, err)
+
+	for _, target := range []string{"/auth/password-reset/request", "/auth/verify-email/request"} {
+		t.Run(target, func(t *testing.T) {
+			var bodies []string
+			// The first address has an account and the second does not, but
+			// the requests queue the same job and get the same answer.
+			for _, address := range []string{"ada@example.com", "nobody@example.com"} {
+				withTestHandler(t, func(h http.Handler, mock sqlmock.Sqlmock) {
+					mock.ExpectQuery(`INSERT INTO jobs (kind, payload, key, max_attempts, run_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (key) DO NOTHING
+		RETURNING id`).
+						WithArgs(server.JobSendEmail, sqlmock.AnyArg(), nil, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+						WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+					rec := serve(h, http.MethodPost, target, strings.NewReader(`{"email": "`+address+`"}`), nil)
+					require.Equal(t, http.StatusAccepted, rec.Code)
+					bodies = append(bodies, rec.Body.String())
+				}, server.WithMailer(mailer))
+			}
+			require.Equal(t, bodies[0], bodies[1])
+		})
+	}
+}
+
+func TestUpdateOrderUnknownProduct(t *testing.T) {
+	withTestHandler(t, func(h http.Handler, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT * FROM orders WHERE id=$1 AND deleted_at IS NULL").WithArgs(3).
+			WillReturnRows(sqlmock.NewRows(orderColumns).
+				AddRow(3, 7, storer.OrderStatusPending, "card", 0, 0, 10, 0, time.Now(), nil, nil))
+		mock.ExpectQuery("SELECT * FROM order_items WHERE order_id=$1").WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "quantity", "price"}).AddRow(1, 4, 1, 10))
+		mock.ExpectQuery("SELECT * FROM order_adjustments WHERE order_id=$1 ORDER BY id").WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT * FROM order_addresses WHERE order_id=$1").WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT * FROM products WHERE id = ANY($1) AND deleted_at IS NULL").WithArgs([]int64{99}).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		rec := serve(h, http.MethodPatch, "/orders/3", strings.NewReader(`{"items": [{"product_id": 99, "quantity": 1}]}`), nil)
+		require.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+		require.Equal(t, "Unknown product\n", rec.Body.String())
+	})
+}
+
+func TestCreateOrderRejectsNonPositiveQuantities(t *testing.T) {
+	for _, qty := range []string{"0", "-5"} {
+		t.Run(qty, func(t *testing.T) {
+			withTestHandler(t, func(h http.Handler, mock sqlmock.Sqlmock) {
+				body := `{"user_id": 7, "payment_method": "card", "items": [{"product_id": 4, "quantity": ` + qty + `}]}`
+				rec := serve(h, http.MethodPost, "/orders", strings.NewReader(body), nil)
+				require.Equal(t, http.StatusBadRequest, rec.Code)
+			})
+		})
+	}
+}
+
+func TestDeletePaidOrder(t *testing.T) {
+	withTestHandler(t, func(h http.Handler, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT EXISTS (SELECT 1 FROM orders WHERE id=$1 AND deleted_at IS NULL)").WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("SELECT * FROM payments WHERE order_id=$1 ORDER BY id").WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "status"}).AddRow(1, "captured"))
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT status FROM orders WHERE id=$1 AND deleted_at IS NULL FOR UPDATE").WithArgs(3).
+			WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(storer.OrderStatusPaid))
+		mock.ExpectRollback()
+
+		rec := serve(h, http.MethodDelete, "/orders/3", nil, nil)
+		require.Equal(t, http.StatusConflict, rec.Code)
+		require.Contains(t, rec.Body.String(), "/refunds")
+	})
+}
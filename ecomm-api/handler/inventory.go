@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *handler) adjustStock(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req StockAdjustReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "" {
+		req.Reason = storer.MovementAdjustment
+	}
+	// Orders, cancellations and imports write their own movements.
+	if req.Delta == 0 || (req.Reason != storer.MovementAdjustment && req.Reason != storer.MovementReturn) {
+		http.Error(w, "delta must be non-zero and reason one of adjustment, return", http.StatusBadRequest)
+		return
+	}
+
+	m := &storer.StockMovement{
+		ProductID:   i,
+		WarehouseID: req.WarehouseID,
+		Delta:       req.Delta,
+		Reason:      req.Reason,
+		Reference:   req.Reference,
+	}
+	product, err := h.server.AdjustStock(r.Context(), m)
+	switch {
+	case errors.Is(err, storer.ErrNotFound):
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	case errors.Is(err, storer.ErrUnknownWarehouse):
+		http.Error(w, "Unknown warehouse", http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, storer.ErrInsufficientStock):
+		http.Error(w, "Stock cannot go below zero", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to adjust stock", http.StatusInternalServerError)
+		return
+	}
+
+	res := toProductRes(product)
+	w.Header().Set("ETag", productETag(product))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) listStockMovements(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	movements, err := h.server.ListStockMovements(r.Context(), i)
+	if err != nil {
+		http.Error(w, "Failed to list stock movements", http.StatusInternalServerError)
+		return
+	}
+
+	res := []StockMovementRes{}
+	for _, m := range movements {
+		res = append(res, StockMovementRes{
+			ID:          m.ID,
+			ProductID:   m.ProductID,
+			WarehouseID: m.WarehouseID,
+			Delta:       m.Delta,
+			Reason:      m.Reason,
+			Actor:       m.Actor,
+			Reference:   m.Reference,
+			CreatedAt:   m.CreatedAt,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// reconcileStock rebuilds stock from the ledger and reports where it differs
+// from count_in_stock. With drift_only=true only drifting products are listed.
+func (h *handler) reconcileStock(w http.ResponseWriter, r *http.Request) {
+	rows, err := h.server.ReconcileStock(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to reconcile stock", http.StatusInternalServerError)
+		return
+	}
+
+	driftOnly := r.URL.Query().Get("drift_only") == "true"
+	res := []StockReconciliationRes{}
+	for _, row := range rows {
+		if driftOnly && row.Drift() == 0 {
+			continue
+		}
+		res = append(res, StockReconciliationRes{
+			ProductID:    row.ProductID,
+			SKU:          row.SKU,
+			CountInStock: row.CountInStock,
+			LedgerStock:  row.LedgerStock,
+			Drift:        row.Drift(),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
@@ -0,0 +1,193 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestRequestID(t *testing.T) {
+	tsc := []struct {
+		name   string
+		header string
+		keep   bool
+	}{
+		{name: "generated when missing"},
+		{name: "kept when valid", header: "abc-123_DEF", keep: true},
+		{name: "kept at max length", header: strings.Repeat("a", maxRequestIDLength), keep: true},
+		{name: "replaced when too long", header: strings.Repeat("a", maxRequestIDLength+1)},
+		{name: "replaced with newline", header: "abc\nlevel=ERROR msg=forged"},
+		{name: "replaced with spaces", header: "abc def"},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = logger.RequestID(r.Context())
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tc.header != "" {
+				req.Header.Set(requestIDHeader, tc.header)
+			}
+			rec := httptest.NewRecorder()
+			requestID(next).ServeHTTP(rec, req)
+
+			require.NotEmpty(t, got)
+			require.Equal(t, got, rec.Header().Get(requestIDHeader))
+			require.True(t, validRequestID(got))
+			if tc.keep {
+				require.Equal(t, tc.header, got)
+			} else {
+				require.NotEqual(t, tc.header, got)
+			}
+		})
+	}
+}
+
+func TestActor(t *testing.T) {
+	h := &handler{cfg: &Config{AdminToken: testAdminToken}}
+
+	tsc := []struct {
+		name   string
+		admin  bool
+		header map[string]string
+		want   string
+	}{
+		{name: "anonymous", want: "anonymous ip:192.0.2.1"},
+		{name: "X-Actor ignored without admin token", header: map[string]string{"X-Actor": "alice"}, want: "anonymous ip:192.0.2.1"},
+		{name: "admin", admin: true, want: "admin"},
+		{name: "admin names themselves", admin: true, header: map[string]string{"X-Actor": "alice"}, want: "alice"},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			var got string
+			next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = storer.ActorFrom(r.Context())
+			})
+
+			chain := withActor(next)
+			if tc.admin {
+				chain = withActor(h.requireAdmin(next))
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/", nil)
+			for k, v := range tc.header {
+				req.Header.Set(k, v)
+			}
+			if tc.admin {
+				req.Header.Set("Authorization", "Bearer "+testAdminToken)
+			}
+			chain.ServeHTTP(httptest.NewRecorder(), req)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+// observations returns how many requests requestMetrics has observed under
+// the given labels.
+func observations(t *testing.T, method, route, status string) uint64 {
+	var m dto.Metric
+	o := metrics.HTTPRequestDuration.WithLabelValues(method, route, status)
+	require.NoError(t, o.(prometheus.Metric).Write(&m))
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestRequestMetrics(t *testing.T) {
+	r := chi.NewRouter()
+	r.Use(requestMetrics)
+	r.Get("/products/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "id") == "404" {
+			http.NotFound(w, r)
+		}
+	})
+
+	tsc := []struct {
+		name   string
+		target string
+		route  string
+		status string
+	}{
+		// Requests are labelled with the route pattern, not the path, so
+		// product IDs do not each make a series.
+		{name: "written status", target: "/products/404", route: "/products/{id}", status: "404"},
+		{name: "implicit ok", target: "/products/7", route: "/products/{id}", status: "200"},
+		{name: "no route", target: "/nowhere", route: "unmatched", status: "404"},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			before := observations(t, http.MethodGet, tc.route, tc.status)
+			r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, tc.target, nil))
+			require.Equal(t, before+1, observations(t, http.MethodGet, tc.route, tc.status))
+		})
+	}
+}
+
+func TestRequestTracing(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans))
+	prevProvider, prevPropagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	var logs bytes.Buffer
+	prevLogger := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&logs, nil)))
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+		slog.SetDefault(prevLogger)
+	})
+
+	r := chi.NewRouter()
+	r.Use(requestTracing, requestID, requestLogger)
+	r.Get("/products/{id}", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "boom", http.StatusInternalServerError)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/products/7", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	r.ServeHTTP(httptest.NewRecorder(), req)
+
+	ended := spans.Ended()
+	require.Len(t, ended, 1)
+	span := ended[0]
+	require.Equal(t, "GET /products/{id}", span.Name())
+	require.Equal(t, trace.SpanKindServer, span.SpanKind())
+	// The span continues the caller's trace.
+	require.Equal(t, traceID, span.SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", span.Parent().SpanID().String())
+	require.Equal(t, codes.Error, span.Status().Code)
+	require.Contains(t, span.Attributes(), attribute.String("http.route", "/products/{id}"))
+	require.Contains(t, span.Attributes(), attribute.Int("http.response.status_code", http.StatusInternalServerError))
+
+	// The request log line carries the trace, so logs and traces can be
+	// joined.
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &line))
+	require.Equal(t, "http request", line["msg"])
+	require.Equal(t, traceID, line["trace_id"])
+	require.NotEmpty(t, line["request_id"])
+}
@@ -0,0 +1,228 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/payment"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/go-chi/chi/v5"
+)
+
+// payOrder charges an order's total to a card. Declined payments are
+// recorded and answered with 402, payments waiting for 3-D Secure with 202
+// and the URL the customer authenticates at.
+func (h *handler) payOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req PaymentReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	req.Card.Number = strings.ReplaceAll(strings.TrimSpace(req.Card.Number), " ", "")
+	if req.Card.Number == "" || req.Card.ExpMonth < 1 || req.Card.ExpMonth > 12 || req.Card.ExpYear <= 0 {
+		http.Error(w, "Invalid card: number, exp_month (1-12) and exp_year are required", http.StatusBadRequest)
+		return
+	}
+	capture := true
+	if req.Capture != nil {
+		capture = *req.Capture
+	}
+
+	p, err := h.server.PayOrder(r.Context(), orderID, payment.Card{
+		Number:   req.Card.Number,
+		ExpMonth: req.Card.ExpMonth,
+		ExpYear:  req.Card.ExpYear,
+		CVC:      req.Card.CVC,
+	}, capture)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, storer.ErrOrderNotPending) {
+		http.Error(w, "Only pending orders can be paid", http.StatusConflict)
+		return
+	}
+	if errors.Is(err, storer.ErrPaymentExists) {
+		http.Error(w, "Order already has a payment", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to pay order", http.StatusInternalServerError)
+		return
+	}
+
+	status := http.StatusCreated
+	switch p.Status {
+	case payment.StatusRequiresAction:
+		status = http.StatusAccepted
+	case payment.StatusDeclined:
+		status = http.StatusPaymentRequired
+	}
+
+	res := toPaymentRes(p)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) listPayments(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	payments, err := h.server.ListPayments(r.Context(), orderID)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to list payments", http.StatusInternalServerError)
+		return
+	}
+
+	res := []PaymentRes{}
+	for i := range payments {
+		res = append(res, toPaymentRes(&payments[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) getPayment(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.server.GetPayment(r.Context(), id)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Payment not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get payment", http.StatusInternalServerError)
+		return
+	}
+
+	res := toPaymentRes(p)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) capturePayment(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.server.CapturePayment(r.Context(), id)
+	if !writePaymentError(w, err, "Failed to capture payment") {
+		return
+	}
+
+	res := toPaymentRes(p)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) voidPayment(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.server.VoidPayment(r.Context(), id)
+	if !writePaymentError(w, err, "Failed to void payment") {
+		return
+	}
+
+	res := toPaymentRes(p)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) refundPayment(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid payment ID", http.StatusBadRequest)
+		return
+	}
+
+	var req RefundReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.Amount <= 0 {
+		http.Error(w, "Refund amount must be positive", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.server.RefundPayment(r.Context(), id, req.Amount)
+	if !writePaymentError(w, err, "Failed to refund payment") {
+		return
+	}
+
+	res := toPaymentRes(p)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// writePaymentError writes the response for an error changing a payment and
+// reports whether there was none.
+func writePaymentError(w http.ResponseWriter, err error, msg string) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, storer.ErrNotFound):
+		http.Error(w, "Payment not found", http.StatusNotFound)
+	case errors.Is(err, storer.ErrPaymentState):
+		http.Error(w, "Payment is not in a state that allows this", http.StatusConflict)
+	case errors.Is(err, storer.ErrRefundTooLarge):
+		http.Error(w, "Refund exceeds the captured amount left", http.StatusConflict)
+	case errors.Is(err, storer.ErrOrderNotPending):
+		http.Error(w, "Order is no longer pending", http.StatusConflict)
+	default:
+		http.Error(w, msg, http.StatusInternalServerError)
+	}
+	return false
+}
+
+func toPaymentRes(p *storer.Payment) PaymentRes {
+	return PaymentRes{
+		ID:             p.ID,
+		OrderID:        p.OrderID,
+		Provider:       p.Provider,
+		Reference:      p.Reference,
+		Status:         p.Status,
+		Amount:         p.Amount,
+		CapturedAmount: p.CapturedAmount,
+		RefundedAmount: p.RefundedAmount,
+		Currency:       p.Currency,
+		CardLast4:      p.CardLast4,
+		RedirectURL:    p.RedirectURL,
+		FailureReason:  p.FailureReason,
+		CreatedAt:      p.CreatedAt,
+		UpdatedAt:      p.UpdatedAt,
+	}
+}
@@ -0,0 +1,151 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/payment"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	maxWebhookBytes          = 64 << 10
+	defaultPaymentEventsPage = 50
+	maxPaymentEventsPage     = 200
+)
+
+// paymentWebhook receives payment events from the provider. The signature
+// covers the raw body, so it is checked before anything is decoded. A
+// delivery of an event that was already processed is acknowledged without
+// applying it again; errors that may be temporary, such as an event for a
+// payment not stored yet, answer with a status the provider retries.
+func (h *handler) paymentWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookBytes))
+	if err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	err = payment.Verify(h.cfg.PaymentWebhookSecret, r.Header.Get(payment.SignatureHeader), body, time.Now())
+	if err != nil {
+		logger.FromContext(r.Context()).Warn("rejected payment webhook", "error", err)
+		http.Error(w, "Invalid signature", http.StatusUnauthorized)
+		return
+	}
+
+	event, err := h.server.HandlePaymentEvent(r.Context(), body)
+	switch {
+	case errors.Is(err, storer.ErrDuplicateEvent):
+		w.WriteHeader(http.StatusOK)
+		return
+	case errors.Is(err, payment.ErrInvalidEvent):
+		http.Error(w, "Invalid event", http.StatusBadRequest)
+		return
+	case errors.Is(err, storer.ErrNotFound):
+		http.Error(w, "Unknown payment", http.StatusNotFound)
+		return
+	case errors.Is(err, storer.ErrPaymentState):
+		http.Error(w, "Payment changed concurrently", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to process event", http.StatusInternalServerError)
+		return
+	}
+
+	res := toPaymentEventRes(event)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// listPaymentEvents lists the latest webhook events, or with
+// ?unprocessed=true only those that still need applying.
+func (h *handler) listPaymentEvents(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	unprocessed := false
+	if v := q.Get("unprocessed"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			http.Error(w, "Invalid unprocessed: must be a boolean", http.StatusBadRequest)
+			return
+		}
+		unprocessed = b
+	}
+	limit := defaultPaymentEventsPage
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPaymentEventsPage {
+			http.Error(w, "Invalid limit: must be between 1 and "+strconv.Itoa(maxPaymentEventsPage), http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	events, err := h.server.ListPaymentEvents(r.Context(), unprocessed, limit)
+	if err != nil {
+		http.Error(w, "Failed to list payment events", http.StatusInternalServerError)
+		return
+	}
+
+	res := []PaymentEventRes{}
+	for i := range events {
+		res = append(res, toPaymentEventRes(&events[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) replayPaymentEvent(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	event, err := h.server.ReplayPaymentEvent(r.Context(), id)
+	switch {
+	case errors.Is(err, storer.ErrNotFound) && event == nil:
+		http.Error(w, "Payment event not found", http.StatusNotFound)
+		return
+	case errors.Is(err, storer.ErrNotFound):
+		http.Error(w, "Unknown payment", http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, payment.ErrInvalidEvent):
+		http.Error(w, "Invalid event", http.StatusUnprocessableEntity)
+		return
+	case errors.Is(err, storer.ErrPaymentState):
+		http.Error(w, "Payment changed concurrently", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Failed to replay event", http.StatusInternalServerError)
+		return
+	}
+
+	res := toPaymentEventRes(event)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func toPaymentEventRes(e *storer.PaymentEvent) PaymentEventRes {
+	return PaymentEventRes{
+		ID:          e.ID,
+		Provider:    e.Provider,
+		EventID:     e.EventID,
+		Type:        e.Type,
+		Reference:   e.Reference,
+		Payload:     json.RawMessage(e.Payload),
+		Attempts:    e.Attempts,
+		Error:       e.Error,
+		ReceivedAt:  e.ReceivedAt,
+		ProcessedAt: e.ProcessedAt,
+	}
+}
@@ -0,0 +1,178 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/promotion"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *handler) createPromotion(w http.ResponseWriter, r *http.Request) {
+	var req PromotionReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if msg := validatePromotionReq(req); msg != "" {
+		http.Error(w, "Invalid promotion: "+msg, http.StatusBadRequest)
+		return
+	}
+
+	p := &storer.Promotion{
+		Code:         req.Code,
+		Description:  req.Description,
+		Kind:         req.Kind,
+		Value:        req.Value,
+		BuyQuantity:  req.BuyQuantity,
+		GetQuantity:  req.GetQuantity,
+		MinSubtotal:  req.MinSubtotal,
+		EndsAt:       req.EndsAt,
+		UsageLimit:   req.UsageLimit,
+		PerUserLimit: req.PerUserLimit,
+		ProductIDs:   req.ProductIDs,
+		Categories:   req.Categories,
+	}
+	if req.StartsAt != nil {
+		p.StartsAt = *req.StartsAt
+	}
+
+	created, err := h.server.CreatePromotion(r.Context(), p)
+	if errors.Is(err, storer.ErrDuplicateCode) {
+		http.Error(w, "Promotion code already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create promotion", http.StatusInternalServerError)
+		return
+	}
+
+	res := toPromotionRes(created)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func validatePromotionReq(req PromotionReq) string {
+	switch {
+	case req.Code == "":
+		return "code is required"
+	case req.MinSubtotal < 0 || req.UsageLimit < 0 || req.PerUserLimit < 0:
+		return "min_subtotal and limits cannot be negative"
+	case req.StartsAt != nil && req.EndsAt != nil && !req.EndsAt.After(*req.StartsAt):
+		return "ends_at must be after starts_at"
+	}
+
+	switch req.Kind {
+	case promotion.KindPercentage:
+		if req.Value <= 0 || req.Value > 100 {
+			return "value must be a percentage in (0, 100]"
+		}
+	case promotion.KindFixedAmount:
+		if req.Value <= 0 {
+			return "value must be a positive amount"
+		}
+	case promotion.KindFreeShipping:
+	case promotion.KindBuyXGetY:
+		if req.BuyQuantity <= 0 || req.GetQuantity <= 0 {
+			return "buy_quantity and get_quantity must be positive"
+		}
+	default:
+		return "kind must be one of percentage, fixed_amount, free_shipping, buy_x_get_y"
+	}
+	return ""
+}
+
+func (h *handler) listPromotions(w http.ResponseWriter, r *http.Request) {
+	promotions, err := h.server.ListPromotions(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to list promotions", http.StatusInternalServerError)
+		return
+	}
+
+	res := []PromotionRes{}
+	for i := range promotions {
+		res = append(res, toPromotionRes(&promotions[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) getPromotion(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid promotion ID", http.StatusBadRequest)
+		return
+	}
+
+	p, err := h.server.GetPromotion(r.Context(), i)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Promotion not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get promotion", http.StatusInternalServerError)
+		return
+	}
+
+	res := toPromotionRes(p)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) deactivatePromotion(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid promotion ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.server.DeactivatePromotion(r.Context(), i)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Promotion not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to deactivate promotion", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func toPromotionRes(p *storer.Promotion) PromotionRes {
+	res := PromotionRes{
+		ID:           p.ID,
+		Code:         p.Code,
+		Description:  p.Description,
+		Kind:         p.Kind,
+		Value:        p.Value,
+		BuyQuantity:  p.BuyQuantity,
+		GetQuantity:  p.GetQuantity,
+		MinSubtotal:  p.MinSubtotal,
+		StartsAt:     p.StartsAt,
+		EndsAt:       p.EndsAt,
+		UsageLimit:   p.UsageLimit,
+		PerUserLimit: p.PerUserLimit,
+		TimesUsed:    p.TimesUsed,
+		Active:       p.Active,
+		ProductIDs:   p.ProductIDs,
+		Categories:   p.Categories,
+		CreatedAt:    p.CreatedAt,
+	}
+	if res.ProductIDs == nil {
+		res.ProductIDs = []int64{}
+	}
+	if res.Categories == nil {
+		res.Categories = []string{}
+	}
+	return res
+}
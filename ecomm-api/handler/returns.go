@@ -0,0 +1,347 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *handler) createReturn(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ReturnReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if msg := validateReturnReq(req); msg != "" {
+		http.Error(w, "Invalid return: "+msg, http.StatusBadRequest)
+		return
+	}
+
+	ret := &storer.Return{OrderID: orderID, Note: strings.TrimSpace(req.Note)}
+	for _, it := range req.Items {
+		ret.Items = append(ret.Items, storer.ReturnItem{
+			OrderItemID: it.OrderItemID,
+			Quantity:    it.Quantity,
+			Reason:      it.Reason,
+		})
+	}
+
+	ret, err = h.server.CreateReturn(r.Context(), ret)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, storer.ErrNotReturnable) {
+		http.Error(w, "Items cannot be returned: the order must be paid and quantities within what is left to return", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create return", http.StatusInternalServerError)
+		return
+	}
+
+	res := toReturnRes(ret, nil)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) listOrderReturns(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	h.writeReturns(w, r, storer.ReturnFilter{OrderID: orderID})
+}
+
+// listReturns lists every return, or with ?status= those in one state, such
+// as the requests waiting for a decision.
+func (h *handler) listReturns(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", storer.ReturnStatusRequested, storer.ReturnStatusApproved, storer.ReturnStatusRejected:
+	default:
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	h.writeReturns(w, r, storer.ReturnFilter{Status: status})
+}
+
+func (h *handler) writeReturns(w http.ResponseWriter, r *http.Request, f storer.ReturnFilter) {
+	returns, err := h.server.ListReturns(r.Context(), f)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to list returns", http.StatusInternalServerError)
+		return
+	}
+
+	res := []ReturnRes{}
+	for i := range returns {
+		res = append(res, toReturnRes(&returns[i], nil))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) getReturn(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid return ID", http.StatusBadRequest)
+		return
+	}
+
+	ret, err := h.server.GetReturn(r.Context(), id)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Return not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get return", http.StatusInternalServerError)
+		return
+	}
+
+	res := toReturnRes(ret, nil)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// approveReturn accepts a return and refunds it. When the return is
+// approved but the refund fails, the answer is 502 and the refund can be
+// made with POST /admin/orders/{id}/refunds.
+func (h *handler) approveReturn(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid return ID", http.StatusBadRequest)
+		return
+	}
+
+	var req ApproveReturnReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.RefundAmount != nil && *req.RefundAmount < 0 {
+		http.Error(w, "Refund amount cannot be negative", http.StatusBadRequest)
+		return
+	}
+	restock := true
+	if req.Restock != nil {
+		restock = *req.Restock
+	}
+
+	ret, refunds, err := h.server.ApproveReturn(r.Context(), id, restock, req.RefundAmount, strings.TrimSpace(req.Note))
+	switch {
+	case ret == nil && errors.Is(err, storer.ErrNotFound):
+		http.Error(w, "Return not found", http.StatusNotFound)
+		return
+	case errors.Is(err, storer.ErrReturnState):
+		http.Error(w, "Return was already decided", http.StatusConflict)
+		return
+	case ret == nil && errors.Is(err, storer.ErrRefundTooLarge):
+		http.Error(w, "Refund amount exceeds the value of the returned items", http.StatusUnprocessableEntity)
+		return
+	case ret == nil && err != nil:
+		http.Error(w, "Failed to approve return", http.StatusInternalServerError)
+		return
+	case errors.Is(err, storer.ErrRefundTooLarge):
+		http.Error(w, "Return approved, but the refund exceeds what was captured for the order", http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, "Return approved, but the refund failed", http.StatusBadGateway)
+		return
+	}
+
+	res := toReturnRes(ret, refunds)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) rejectReturn(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid return ID", http.StatusBadRequest)
+		return
+	}
+
+	var req RejectReturnReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	ret, err := h.server.RejectReturn(r.Context(), id, strings.TrimSpace(req.Note))
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Return not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, storer.ErrReturnState) {
+		http.Error(w, "Return was already decided", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to reject return", http.StatusInternalServerError)
+		return
+	}
+
+	res := toReturnRes(ret, nil)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// refundOrder refunds part or all of an order without a return, e.g. as a
+// goodwill credit.
+func (h *handler) refundOrder(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req RefundOrderReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.Amount <= 0 {
+		http.Error(w, "Refund amount must be positive", http.StatusBadRequest)
+		return
+	}
+
+	refunds, err := h.server.RefundOrder(r.Context(), orderID, req.Amount, strings.TrimSpace(req.Reason))
+	switch {
+	case errors.Is(err, storer.ErrNotFound):
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	case errors.Is(err, storer.ErrRefundTooLarge):
+		http.Error(w, "Refund exceeds what was captured for the order", http.StatusConflict)
+		return
+	case errors.Is(err, storer.ErrPaymentState):
+		http.Error(w, "Payment changed concurrently", http.StatusConflict)
+		return
+	case err != nil && len(refunds) > 0:
+		http.Error(w, "Refund partly made; see GET /orders/{id}/refunds", http.StatusBadGateway)
+		return
+	case err != nil:
+		http.Error(w, "Failed to refund order", http.StatusInternalServerError)
+		return
+	}
+
+	res := toRefundsRes(refunds)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) listRefunds(w http.ResponseWriter, r *http.Request) {
+	orderID, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	refunds, err := h.server.ListRefunds(r.Context(), orderID)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to list refunds", http.StatusInternalServerError)
+		return
+	}
+
+	res := toRefundsRes(refunds)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func validateReturnReq(req ReturnReq) string {
+	if len(req.Items) == 0 {
+		return "items are required"
+	}
+	seen := make(map[int64]bool, len(req.Items))
+	for _, it := range req.Items {
+		if it.Quantity <= 0 || seen[it.OrderItemID] {
+			return "quantities must be positive and order items unique"
+		}
+		seen[it.OrderItemID] = true
+		switch it.Reason {
+		case storer.ReturnReasonDamaged, storer.ReturnReasonWrongItem, storer.ReturnReasonNotAsDescribed,
+			storer.ReturnReasonNoLongerNeeded, storer.ReturnReasonOther:
+		default:
+			return "reason must be damaged, wrong_item, not_as_described, no_longer_needed or other"
+		}
+	}
+	return ""
+}
+
+func toReturnRes(r *storer.Return, refunds []storer.Refund) ReturnRes {
+	res := ReturnRes{
+		ID:             r.ID,
+		OrderID:        r.OrderID,
+		Status:         r.Status,
+		Note:           r.Note,
+		DecisionNote:   r.DecisionNote,
+		DecidedBy:      r.DecidedBy,
+		DecidedAt:      r.DecidedAt,
+		RefundedAmount: r.RefundedAmount,
+		Items:          []ReturnItemRes{},
+		CreatedAt:      r.CreatedAt,
+		UpdatedAt:      r.UpdatedAt,
+	}
+	for _, it := range r.Items {
+		res.Items = append(res.Items, ReturnItemRes{
+			ID:          it.ID,
+			OrderItemID: it.OrderItemID,
+			ProductID:   it.ProductID,
+			Quantity:    it.Quantity,
+			Reason:      it.Reason,
+		})
+	}
+	if len(refunds) > 0 {
+		res.Refunds = toRefundsRes(refunds)
+	}
+	return res
+}
+
+func toRefundsRes(refunds []storer.Refund) []RefundRes {
+	res := []RefundRes{}
+	for _, rf := range refunds {
+		res = append(res, RefundRes{
+			ID:        rf.ID,
+			OrderID:   rf.OrderID,
+			PaymentID: rf.PaymentID,
+			ReturnID:  rf.ReturnID,
+			Amount:    rf.Amount,
+			Reason:    rf.Reason,
+			Provider:  rf.Provider,
+			Reference: rf.Reference,
+			Actor:     rf.Actor,
+			Status:    rf.Status,
+			CreatedAt: rf.CreatedAt,
+		})
+	}
+	return res
+}
@@ -1,27 +1,70 @@
 package handler
 
 import (
+	"context"
 	"net/http"
+	"time"
 
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
 	"github.com/go-chi/chi/v5"
 )
 
 var r *chi.Mux
 
+const shutdownTimeout = 15 * time.Second
+
 func RegisterRoutes(handler *handler) *chi.Mux {
 	r = chi.NewRouter()
+	r.Use(requestTracing, requestID, requestLogger, requestMetrics)
+	r.Use(handler.limiter.Limit("default"))
+	r.Use(withActor)
 
 	r.Route("/products", func(r chi.Router) {
-		r.Post("/", handler.createProduct)
+		r.With(handler.limiter.Limit("products.write")).Post("/", handler.createProduct)
 		r.Get("/", handler.listProducts)
+		r.With(handler.requireAdmin, handler.limiter.Limit("products.import")).Post("/import", handler.importProducts)
+		r.Get("/export", handler.exportProducts)
 
 		r.Route("/{id}", func(r chi.Router) {
 			r.Get("/", handler.getProduct)
-			r.Patch("/", handler.updateProduct)
-			r.Delete("/", handler.deleteProduct)
+			r.Get("/stock", handler.getProductStock)
+			r.With(handler.limiter.Limit("products.subscribe")).Post("/subscriptions", handler.createStockSubscription)
+			r.With(handler.limiter.Limit("products.write")).Patch("/", handler.updateProduct)
+			r.With(handler.limiter.Limit("products.write")).Delete("/", handler.deleteProduct)
+
+			r.With(handler.requireAdmin).Post("/stock/adjust", handler.adjustStock)
+			r.With(handler.requireAdmin).Get("/stock/movements", handler.listStockMovements)
 		})
 	})
 
+	r.Get("/warehouses", handler.listWarehouses)
+
+	// Users do not sign in yet, so nothing ties a request to the user whose
+	// address book it names; only admin clients may read or change one.
+	r.Route("/users/{id}/addresses", func(r chi.Router) {
+		r.Use(handler.requireAdmin)
+
+		r.Post("/", handler.createAddress)
+		r.Get("/", handler.listAddresses)
+		r.Get("/{addressID}", handler.getAddress)
+		r.Put("/{addressID}", handler.updateAddress)
+		r.Delete("/{addressID}", handler.deleteAddress)
+	})
+
+	r.Route("/auth", func(r chi.Router) {
+		r.Use(handler.limiter.Limit("auth"))
+
+		r.Post("/verify-email/request", handler.requestEmailVerification)
+		r.Post("/verify-email/confirm", handler.verifyEmail)
+		r.Post("/password-reset/request", handler.requestPasswordReset)
+		r.Post("/password-reset/confirm", handler.resetPassword)
+	})
+
+	r.Route("/shipping", func(r chi.Router) {
+		r.Get("/methods", handler.listShippingMethods)
+		r.Get("/quote", handler.quoteShipping)
+	})
+
 	r.Route("/health", func(r chi.Router) {
 		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusOK)
@@ -29,19 +72,103 @@ func RegisterRoutes(handler *handler) *chi.Mux {
 		})
 	})
 
+	// Metrics expose order volumes and internals, so scrapers authenticate
+	// with the admin token like any other admin client.
+	r.With(handler.requireAdmin).Handle("/metrics", metrics.Handler())
+
 	r.Route(("/orders"), func(r chi.Router) {
-		r.Post("/", handler.createOrder)
+		r.With(handler.limiter.Limit("orders.create")).Post("/", handler.createOrder)
 		r.Get("/", handler.listOrders)
 		r.Route("/{id}", func(r chi.Router) {
 			r.Get("/", handler.getOrder)
-
+			r.Patch("/", handler.updateOrder)
 			r.Delete("/", handler.deleteOrder)
+			r.Post("/payments", handler.payOrder)
+			r.Get("/payments", handler.listPayments)
+			r.Post("/returns", handler.createReturn)
+			r.Get("/returns", handler.listOrderReturns)
+			r.Get("/refunds", handler.listRefunds)
+		})
+	})
+
+	r.Route("/payments/{id}", func(r chi.Router) {
+		r.Get("/", handler.getPayment)
+		r.With(handler.requireAdmin).Post("/capture", handler.capturePayment)
+		r.With(handler.requireAdmin).Post("/void", handler.voidPayment)
+		r.With(handler.requireAdmin).Post("/refund", handler.refundPayment)
+	})
+
+	r.Route("/webhooks", func(r chi.Router) {
+		r.Post("/payments", handler.paymentWebhook)
+
+		r.Group(func(r chi.Router) {
+			r.Use(handler.requireAdmin)
+
+			r.Post("/subscriptions", handler.createWebhookSubscription)
+			r.Get("/subscriptions", handler.listWebhookSubscriptions)
+			r.Route("/subscriptions/{id}", func(r chi.Router) {
+				r.Get("/", handler.getWebhookSubscription)
+				r.Put("/", handler.updateWebhookSubscription)
+				r.Delete("/", handler.deleteWebhookSubscription)
+				r.Get("/deliveries", handler.listWebhookDeliveries)
+			})
+			r.Get("/deliveries/{id}", handler.getWebhookDelivery)
+			r.Post("/deliveries/{id}/redeliver", handler.redeliverWebhook)
 		})
 	})
 
+	r.Route("/admin", func(r chi.Router) {
+		r.Use(handler.requireAdmin)
+
+		r.Get("/products/deleted", handler.listDeletedProducts)
+		r.Post("/products/{id}/restore", handler.restoreProduct)
+		r.Get("/orders/deleted", handler.listDeletedOrders)
+		r.Post("/orders/{id}/restore", handler.restoreOrder)
+		r.Post("/orders/{id}/ship", handler.shipOrder)
+		r.Get("/inventory/reconcile", handler.reconcileStock)
+		r.Post("/warehouses", handler.createWarehouse)
+
+		r.Post("/promotions", handler.createPromotion)
+		r.Get("/promotions", handler.listPromotions)
+		r.Get("/promotions/{id}", handler.getPromotion)
+		r.Delete("/promotions/{id}", handler.deactivatePromotion)
+
+		r.Post("/shipping/zones", handler.createShippingZone)
+		r.Get("/shipping/zones", handler.listShippingZones)
+		r.Post("/shipping/rates", handler.createShippingRate)
+		r.Get("/shipping/rates", handler.listShippingRates)
+
+		r.Get("/returns", handler.listReturns)
+		r.Get("/returns/{id}", handler.getReturn)
+		r.Post("/returns/{id}/approve", handler.approveReturn)
+		r.Post("/returns/{id}/reject", handler.rejectReturn)
+		r.Post("/orders/{id}/refunds", handler.refundOrder)
+
+		r.Get("/payments/events", handler.listPaymentEvents)
+		r.Post("/payments/events/{id}/replay", handler.replayPaymentEvent)
+	})
+
 	return r
 }
 
-func Start(addr string) error {
-	return http.ListenAndServe(addr, r)
+// Start serves the routes on addr until ctx is done, then stops accepting
+// connections and waits for requests in flight, for at most
+// shutdownTimeout.
+func Start(ctx context.Context, addr string) error {
+	srv := &http.Server{Addr: addr, Handler: r}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- srv.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	return srv.Shutdown(shutdownCtx)
 }
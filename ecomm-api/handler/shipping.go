@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/shipping"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+)
+
+func (h *handler) listShippingMethods(w http.ResponseWriter, r *http.Request) {
+	methods, err := h.server.ListShippingMethods(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to list shipping methods", http.StatusInternalServerError)
+		return
+	}
+
+	res := []ShippingMethodRes{}
+	for _, m := range methods {
+		res = append(res, ShippingMethodRes{Code: m.Code, Name: m.Name})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// quoteShipping prices a list of items with every shipping method available
+// for the destination, e.g.
+// /shipping/quote?country=US&region=CA&items=12:2,15:1 for two of product
+// 12 and one of product 15.
+func (h *handler) quoteShipping(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	dest := shipping.Destination{
+		Country: strings.ToUpper(strings.TrimSpace(q.Get("country"))),
+		Region:  strings.TrimSpace(q.Get("region")),
+	}
+	if dest.Country == "" {
+		http.Error(w, "Invalid query: country is required", http.StatusBadRequest)
+		return
+	}
+	items, err := parseQuoteItems(q.Get("items"))
+	if err != nil {
+		http.Error(w, "Invalid query: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	quotes, err := h.server.QuoteShipping(r.Context(), dest, items)
+	if errors.Is(err, storer.ErrUnknownProduct) {
+		http.Error(w, "Unknown product", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to quote shipping", http.StatusInternalServerError)
+		return
+	}
+
+	res := []ShippingQuoteRes{}
+	for _, q := range quotes {
+		res = append(res, ShippingQuoteRes{
+			Method: q.Method,
+			Name:   q.Name,
+			Weight: q.Weight,
+			Price:  q.Price,
+			Free:   q.Free,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// maxQuoteItems caps the items of one shipping quote, which anyone may ask
+// for.
+const maxQuoteItems = 100
+
+// parseQuoteItems parses a comma-separated list of at most maxQuoteItems
+// product_id:quantity pairs.
+func parseQuoteItems(v string) ([]storer.OrderItem, error) {
+	if v == "" {
+		return nil, fmt.Errorf("items is required")
+	}
+	pairs := strings.Split(v, ",")
+	if len(pairs) > maxQuoteItems {
+		return nil, fmt.Errorf("at most %d items can be quoted", maxQuoteItems)
+	}
+
+	var items []storer.OrderItem
+	for _, pair := range pairs {
+		id, qty, ok := strings.Cut(pair, ":")
+		if !ok {
+			return nil, fmt.Errorf("invalid item %q: want product_id:quantity", pair)
+		}
+		productID, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid product id %q", id)
+		}
+		quantity, err := strconv.ParseInt(qty, 10, 64)
+		if err != nil || quantity < 1 {
+			return nil, fmt.Errorf("invalid quantity %q: must be a positive integer", qty)
+		}
+		items = append(items, storer.OrderItem{ProductID: productID, Quantity: quantity})
+	}
+	return items, nil
+}
+
+func (h *handler) createShippingZone(w http.ResponseWriter, r *http.Request) {
+	var req ShippingZoneReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.Name == "" || len(req.Regions) == 0 {
+		http.Error(w, "name and regions are required", http.StatusBadRequest)
+		return
+	}
+
+	z := &storer.ShippingZone{Name: req.Name}
+	for _, reg := range req.Regions {
+		if len(reg.Country) != 2 {
+			http.Error(w, "country must be a two-letter code", http.StatusBadRequest)
+			return
+		}
+		z.Regions = append(z.Regions, storer.ShippingZoneRegion{Country: reg.Country, Region: reg.Region})
+	}
+
+	zone, err := h.server.CreateShippingZone(r.Context(), z)
+	if errors.Is(err, storer.ErrDuplicateName) {
+		http.Error(w, "Shipping zone already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create shipping zone", http.StatusInternalServerError)
+		return
+	}
+
+	res := toShippingZoneRes(zone)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) listShippingZones(w http.ResponseWriter, r *http.Request) {
+	zones, err := h.server.ListShippingZones(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to list shipping zones", http.StatusInternalServerError)
+		return
+	}
+
+	res := []ShippingZoneRes{}
+	for i := range zones {
+		res = append(res, toShippingZoneRes(&zones[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) createShippingRate(w http.ResponseWriter, r *http.Request) {
+	var req ShippingRateReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if msg := validateShippingRateReq(req); msg != "" {
+		http.Error(w, "Invalid shipping rate: "+msg, http.StatusBadRequest)
+		return
+	}
+
+	rate, err := h.server.CreateShippingRate(r.Context(), &storer.ShippingRate{
+		Method:      req.Method,
+		ZoneID:      req.ZoneID,
+		MinWeight:   req.MinWeight,
+		MaxWeight:   req.MaxWeight,
+		MinSubtotal: req.MinSubtotal,
+		MaxSubtotal: req.MaxSubtotal,
+		Price:       req.Price,
+		PerKg:       req.PerKg,
+		FreeAbove:   req.FreeAbove,
+	})
+	if errors.Is(err, storer.ErrUnknownShippingMethod) || errors.Is(err, storer.ErrUnknownShippingZone) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to create shipping rate", http.StatusInternalServerError)
+		return
+	}
+
+	res := toShippingRateRes(rate)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func validateShippingRateReq(req ShippingRateReq) string {
+	switch {
+	case req.Method == "":
+		return "method is required"
+	case req.MinWeight < 0 || req.MaxWeight < 0 || req.MinSubtotal < 0 || req.MaxSubtotal < 0:
+		return "weight and subtotal bounds cannot be negative"
+	case req.MaxWeight > 0 && req.MaxWeight < req.MinWeight:
+		return "max_weight must not be below min_weight"
+	case req.MaxSubtotal > 0 && req.MaxSubtotal < req.MinSubtotal:
+		return "max_subtotal must not be below min_subtotal"
+	case req.Price < 0 || req.PerKg < 0 || req.FreeAbove < 0:
+		return "price, per_kg and free_above cannot be negative"
+	}
+	return ""
+}
+
+func (h *handler) listShippingRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := h.server.ListShippingRates(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to list shipping rates", http.StatusInternalServerError)
+		return
+	}
+
+	res := []ShippingRateRes{}
+	for i := range rates {
+		res = append(res, toShippingRateRes(&rates[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func toShippingZoneRes(z *storer.ShippingZone) ShippingZoneRes {
+	res := ShippingZoneRes{ID: z.ID, Name: z.Name, Regions: []ShippingRegion{}, CreatedAt: z.CreatedAt}
+	for _, reg := range z.Regions {
+		res.Regions = append(res.Regions, ShippingRegion{Country: reg.Country, Region: reg.Region})
+	}
+	return res
+}
+
+func toShippingRateRes(r *storer.ShippingRate) ShippingRateRes {
+	return ShippingRateRes{
+		ID:          r.ID,
+		Method:      r.Method,
+		ZoneID:      r.ZoneID,
+		MinWeight:   r.MinWeight,
+		MaxWeight:   r.MaxWeight,
+		MinSubtotal: r.MinSubtotal,
+		MaxSubtotal: r.MaxSubtotal,
+		Price:       r.Price,
+		PerKg:       r.PerKg,
+		FreeAbove:   r.FreeAbove,
+		CreatedAt:   r.CreatedAt,
+	}
+}
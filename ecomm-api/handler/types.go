@@ -1,8 +1,22 @@
 package handler
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
+
+type Config struct {
+	AdminToken string
+	// PaymentWebhookSecret signs the payment provider's webhook requests.
+	// Without it every webhook request is rejected.
+	PaymentWebhookSecret string
+	// AllowPrivateWebhookHosts accepts webhook subscriptions to loopback and
+	// private network addresses. It follows webhook.Config.AllowPrivateHosts.
+	AllowPrivateWebhookHosts bool
+}
 
 type ProductReq struct {
+	SKU          string  `json:"sku"`
 	Name         string  `json:"name"`
 	Image        string  `json:"image"`
 	Category     string  `json:"category"`
@@ -11,45 +25,565 @@ type ProductReq struct {
 	NumReviews   int64   `json:"num_reviews"`
 	Price        float64 `json:"price"`
 	CountInStock int64   `json:"count_in_stock"`
+	// ReorderThreshold raises a low-stock alert when stock drops below it.
+	ReorderThreshold int64 `json:"reorder_threshold"`
+	// TaxCategory picks the tax rate; empty means the standard rate.
+	TaxCategory string `json:"tax_category"`
+	// Weight is in kg and the dimensions in cm.
+	Weight float64 `json:"weight"`
+	Length float64 `json:"length"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+}
+
+// ProductPatchReq is a JSON Merge Patch (RFC 7396) document for a product:
+// omitted fields are left untouched, explicit values and nulls are applied.
+type ProductPatchReq struct {
+	Name             Optional[string]  `json:"name"`
+	Image            Optional[string]  `json:"image"`
+	Category         Optional[string]  `json:"category"`
+	Description      Optional[string]  `json:"description"`
+	Rating           Optional[int64]   `json:"rating"`
+	NumReviews       Optional[int64]   `json:"num_reviews"`
+	Price            Optional[float64] `json:"price"`
+	CountInStock     Optional[int64]   `json:"count_in_stock"`
+	ReorderThreshold Optional[int64]   `json:"reorder_threshold"`
+	TaxCategory      Optional[string]  `json:"tax_category"`
+	Weight           Optional[float64] `json:"weight"`
+	Length           Optional[float64] `json:"length"`
+	Width            Optional[float64] `json:"width"`
+	Height           Optional[float64] `json:"height"`
+}
+
+// Optional tells a missing JSON field apart from an explicit null and from a
+// zero value.
+type Optional[T any] struct {
+	Set   bool
+	Null  bool
+	Value T
+}
+
+func (o *Optional[T]) UnmarshalJSON(b []byte) error {
+	o.Set = true
+	if string(b) == "null" {
+		o.Null = true
+		return nil
+	}
+	return json.Unmarshal(b, &o.Value)
 }
 
 type ProductRes struct {
-	ID           int64      `json:"id"`
-	Name         string     `json:"name"`
-	Image        string     `json:"image"`
-	Category     string     `json:"category"`
-	Description  string     `json:"description"`
-	Rating       int64      `json:"rating"`
-	NumReviews   int64      `json:"num_reviews"`
-	Price        float64    `json:"price"`
-	CountInStock int64      `json:"count_in_stock"`
-	CreatedAt    time.Time  `json:"created_at"`
-	UpdatedAt    *time.Time `json:"updated_at"`
+	ID               int64      `json:"id"`
+	SKU              string     `json:"sku"`
+	Name             string     `json:"name"`
+	Image            string     `json:"image"`
+	Category         string     `json:"category"`
+	Description      string     `json:"description"`
+	Rating           int64      `json:"rating"`
+	NumReviews       int64      `json:"num_reviews"`
+	Price            float64    `json:"price"`
+	CountInStock     int64      `json:"count_in_stock"`
+	ReorderThreshold int64      `json:"reorder_threshold"`
+	TaxCategory      string     `json:"tax_category"`
+	Weight           float64    `json:"weight"`
+	Length           float64    `json:"length"`
+	Width            float64    `json:"width"`
+	Height           float64    `json:"height"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        *time.Time `json:"updated_at"`
 }
 
 type OrderReq struct {
+	UserID        int64       `json:"user_id"`
 	Items         []OrderItem `json:"items"`
 	PaymentMethod string      `json:"payment_method"`
-	TaxPrice      float64     `json:"tax_price"`
-	ShippingPrice float64     `json:"shipping_price"`
-	TotalPrice    float64     `json:"total_price"`
+	// ShippingMethod is priced by the server; it defaults to standard.
+	ShippingMethod string `json:"shipping_method"`
+	// ShippingAddress and BillingAddress are given inline or by the ID of
+	// an address book entry. Without either, the user's default is used,
+	// and billing falls back to shipping. The shipping address decides the
+	// tax and shipping charged on the order.
+	ShippingAddress   *AddressReq `json:"shipping_address,omitempty"`
+	ShippingAddressID *int64      `json:"shipping_address_id,omitempty"`
+	BillingAddress    *AddressReq `json:"billing_address,omitempty"`
+	BillingAddressID  *int64      `json:"billing_address_id,omitempty"`
+	// ShipTo lets items ship from the warehouses closest to the customer.
+	ShipTo *LocationReq `json:"ship_to,omitempty"`
+	// CouponCodes are applied in order. The total is computed by the
+	// server from catalogue prices and discounts.
+	CouponCodes []string `json:"coupon_codes,omitempty"`
+}
+
+type AddressReq struct {
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+	Phone      string `json:"phone"`
+}
+
+// UserAddressReq is an address book entry.
+type UserAddressReq struct {
+	AddressReq
+	IsDefaultShipping bool `json:"is_default_shipping"`
+	IsDefaultBilling  bool `json:"is_default_billing"`
+}
+
+type AddressRes struct {
+	ID                int64      `json:"id"`
+	UserID            int64      `json:"user_id"`
+	Name              string     `json:"name"`
+	Line1             string     `json:"line1"`
+	Line2             string     `json:"line2"`
+	City              string     `json:"city"`
+	Region            string     `json:"region"`
+	PostalCode        string     `json:"postal_code"`
+	Country           string     `json:"country"`
+	Phone             string     `json:"phone"`
+	IsDefaultShipping bool       `json:"is_default_shipping"`
+	IsDefaultBilling  bool       `json:"is_default_billing"`
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         *time.Time `json:"updated_at"`
+}
+
+// OrderAddressRes is the copy of an address an order was placed with.
+// AddressID is the address book entry it was copied from, if any.
+type OrderAddressRes struct {
+	AddressID  *int64 `json:"address_id,omitempty"`
+	Name       string `json:"name"`
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2"`
+	City       string `json:"city"`
+	Region     string `json:"region"`
+	PostalCode string `json:"postal_code"`
+	Country    string `json:"country"`
+	Phone      string `json:"phone"`
+}
+
+type LocationReq struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+}
+
+type UpdateOrderReq struct {
+	PaymentMethod string             `json:"payment_method"`
+	Items         []OrderItemEditReq `json:"items"`
+	ShipTo        *LocationReq       `json:"ship_to,omitempty"`
+}
+
+type OrderItemEditReq struct {
+	ProductID int64 `json:"product_id"`
+	Quantity  int64 `json:"quantity"`
+}
+
+type ShipOrderReq struct {
+	Carrier        string `json:"carrier"`
+	TrackingNumber string `json:"tracking_number"`
+	// TrackingURL, when set, is linked from the customer's shipping email.
+	TrackingURL string `json:"tracking_url"`
 }
 
 type OrderItem struct {
+	ID        int64   `json:"id,omitempty"`
 	Name      string  `json:"name"`
 	Quantity  int64   `json:"quantity"`
 	Image     string  `json:"image"`
 	Price     float64 `json:"price"`
 	ProductID int64   `json:"product_id"`
+	// WarehouseID is where the item ships from. It is set by the server.
+	WarehouseID int64 `json:"warehouse_id,omitempty"`
+	// TaxRate and TaxAmount are the tax on the item. They are set by the
+	// server.
+	TaxRate   float64 `json:"tax_rate"`
+	TaxAmount float64 `json:"tax_amount"`
 }
 
 type OrderRes struct {
 	ID            int64       `json:"id"`
+	UserID        int64       `json:"user_id"`
+	Status        string      `json:"status"`
 	Items         []OrderItem `json:"items"`
 	PaymentMethod string      `json:"payment_method"`
 	TaxPrice      float64     `json:"tax_price"`
-	ShippingPrice float64     `json:"shipping_price"`
-	TotalPrice    float64     `json:"total_price"`
-	CreatedAt     time.Time   `json:"created_at"`
-	UpdatedAt     *time.Time  `json:"updated_at"`
+	// TaxInclusive means item prices already include TaxPrice.
+	TaxInclusive   bool    `json:"tax_inclusive"`
+	ShippingPrice  float64 `json:"shipping_price"`
+	ShippingMethod string  `json:"shipping_method"`
+	DiscountPrice  float64 `json:"discount_price"`
+	TotalPrice     float64 `json:"total_price"`
+	RefundedAmount float64 `json:"refunded_amount"`
+	// RefundStatus is "none", "partially_refunded" or "refunded".
+	RefundStatus    string               `json:"refund_status"`
+	Adjustments     []OrderAdjustmentRes `json:"adjustments"`
+	ShippingAddress *OrderAddressRes     `json:"shipping_address"`
+	BillingAddress  *OrderAddressRes     `json:"billing_address"`
+	CreatedAt       time.Time            `json:"created_at"`
+	UpdatedAt       *time.Time           `json:"updated_at"`
+}
+
+// OrderAdjustmentRes is a discount on an order. OrderItemID is set when it
+// applies to a single item.
+type OrderAdjustmentRes struct {
+	ID          int64   `json:"id"`
+	OrderItemID *int64  `json:"order_item_id,omitempty"`
+	Code        string  `json:"code"`
+	Kind        string  `json:"kind"`
+	Amount      float64 `json:"amount"`
+	Description string  `json:"description"`
+}
+
+type ListOrdersRes struct {
+	Orders     []OrderRes `json:"orders"`
+	NextCursor string     `json:"next_cursor,omitempty"`
+}
+
+type StockAdjustReq struct {
+	// WarehouseID defaults to the default warehouse.
+	WarehouseID int64  `json:"warehouse_id"`
+	Delta       int64  `json:"delta"`
+	Reason      string `json:"reason"`
+	Reference   string `json:"reference"`
+}
+
+type StockMovementRes struct {
+	ID          int64     `json:"id"`
+	ProductID   int64     `json:"product_id"`
+	WarehouseID int64     `json:"warehouse_id"`
+	Delta       int64     `json:"delta"`
+	Reason      string    `json:"reason"`
+	Actor       string    `json:"actor"`
+	Reference   string    `json:"reference"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type StockReconciliationRes struct {
+	ProductID    int64  `json:"product_id"`
+	SKU          string `json:"sku"`
+	CountInStock int64  `json:"count_in_stock"`
+	LedgerStock  int64  `json:"ledger_stock"`
+	Drift        int64  `json:"drift"`
+}
+
+type WarehouseReq struct {
+	Code      string  `json:"code"`
+	Name      string  `json:"name"`
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Priority  int     `json:"priority"`
+}
+
+type WarehouseRes struct {
+	ID        int64     `json:"id"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	Latitude  float64   `json:"latitude"`
+	Longitude float64   `json:"longitude"`
+	Priority  int       `json:"priority"`
+	IsDefault bool      `json:"is_default"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type WarehouseStockRes struct {
+	WarehouseID   int64  `json:"warehouse_id"`
+	WarehouseCode string `json:"warehouse_code"`
+	Quantity      int64  `json:"quantity"`
+}
+
+type ProductStockRes struct {
+	ProductID  int64               `json:"product_id"`
+	Total      int64               `json:"total"`
+	Warehouses []WarehouseStockRes `json:"warehouses"`
+}
+
+type StockSubscriptionReq struct {
+	Email string `json:"email"`
+}
+
+type StockSubscriptionRes struct {
+	ID        int64     `json:"id"`
+	ProductID int64     `json:"product_id"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type PromotionReq struct {
+	Code         string     `json:"code"`
+	Description  string     `json:"description"`
+	Kind         string     `json:"kind"`
+	Value        float64    `json:"value"`
+	BuyQuantity  int64      `json:"buy_quantity"`
+	GetQuantity  int64      `json:"get_quantity"`
+	MinSubtotal  float64    `json:"min_subtotal"`
+	StartsAt     *time.Time `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	UsageLimit   int64      `json:"usage_limit"`
+	PerUserLimit int64      `json:"per_user_limit"`
+	ProductIDs   []int64    `json:"product_ids"`
+	Categories   []string   `json:"categories"`
+}
+
+type PromotionRes struct {
+	ID           int64      `json:"id"`
+	Code         string     `json:"code"`
+	Description  string     `json:"description"`
+	Kind         string     `json:"kind"`
+	Value        float64    `json:"value"`
+	BuyQuantity  int64      `json:"buy_quantity"`
+	GetQuantity  int64      `json:"get_quantity"`
+	MinSubtotal  float64    `json:"min_subtotal"`
+	StartsAt     time.Time  `json:"starts_at"`
+	EndsAt       *time.Time `json:"ends_at"`
+	UsageLimit   int64      `json:"usage_limit"`
+	PerUserLimit int64      `json:"per_user_limit"`
+	TimesUsed    int64      `json:"times_used"`
+	Active       bool       `json:"active"`
+	ProductIDs   []int64    `json:"product_ids"`
+	Categories   []string   `json:"categories"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+type ShippingMethodRes struct {
+	Code string `json:"code"`
+	Name string `json:"name"`
+}
+
+// ShippingRegion is a destination in a shipping zone. An empty region covers
+// the whole country.
+type ShippingRegion struct {
+	Country string `json:"country"`
+	Region  string `json:"region"`
+}
+
+type ShippingZoneReq struct {
+	Name    string           `json:"name"`
+	Regions []ShippingRegion `json:"regions"`
+}
+
+type ShippingZoneRes struct {
+	ID        int64            `json:"id"`
+	Name      string           `json:"name"`
+	Regions   []ShippingRegion `json:"regions"`
+	CreatedAt time.Time        `json:"created_at"`
+}
+
+// ShippingRateReq prices a method for a zone, or for every destination
+// without zone_id. Zero maximums mean no upper bound.
+type ShippingRateReq struct {
+	Method      string  `json:"method"`
+	ZoneID      *int64  `json:"zone_id"`
+	MinWeight   float64 `json:"min_weight"`
+	MaxWeight   float64 `json:"max_weight"`
+	MinSubtotal float64 `json:"min_subtotal"`
+	MaxSubtotal float64 `json:"max_subtotal"`
+	Price       float64 `json:"price"`
+	PerKg       float64 `json:"per_kg"`
+	FreeAbove   float64 `json:"free_above"`
+}
+
+type ShippingRateRes struct {
+	ID          int64     `json:"id"`
+	Method      string    `json:"method"`
+	ZoneID      *int64    `json:"zone_id"`
+	MinWeight   float64   `json:"min_weight"`
+	MaxWeight   float64   `json:"max_weight"`
+	MinSubtotal float64   `json:"min_subtotal"`
+	MaxSubtotal float64   `json:"max_subtotal"`
+	Price       float64   `json:"price"`
+	PerKg       float64   `json:"per_kg"`
+	FreeAbove   float64   `json:"free_above"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type ShippingQuoteRes struct {
+	Method string  `json:"method"`
+	Name   string  `json:"name"`
+	Weight float64 `json:"weight"`
+	Price  float64 `json:"price"`
+	Free   bool    `json:"free"`
+}
+
+type CardReq struct {
+	Number   string `json:"number"`
+	ExpMonth int    `json:"exp_month"`
+	ExpYear  int    `json:"exp_year"`
+	CVC      string `json:"cvc"`
+}
+
+// PaymentReq pays an order's total. Capture defaults to true; with false
+// the payment is only authorized and captured later.
+type PaymentReq struct {
+	Card    CardReq `json:"card"`
+	Capture *bool   `json:"capture"`
+}
+
+type RefundReq struct {
+	Amount float64 `json:"amount"`
+}
+
+type PaymentRes struct {
+	ID             int64      `json:"id"`
+	OrderID        int64      `json:"order_id"`
+	Provider       string     `json:"provider"`
+	Reference      string     `json:"reference"`
+	Status         string     `json:"status"`
+	Amount         float64    `json:"amount"`
+	CapturedAmount float64    `json:"captured_amount"`
+	RefundedAmount float64    `json:"refunded_amount"`
+	Currency       string     `json:"currency"`
+	CardLast4      string     `json:"card_last4,omitempty"`
+	RedirectURL    string     `json:"redirect_url,omitempty"`
+	FailureReason  string     `json:"failure_reason,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
+
+type PaymentEventRes struct {
+	ID          int64           `json:"id"`
+	Provider    string          `json:"provider"`
+	EventID     string          `json:"event_id"`
+	Type        string          `json:"type"`
+	Reference   string          `json:"reference"`
+	Payload     json.RawMessage `json:"payload"`
+	Attempts    int             `json:"attempts"`
+	Error       string          `json:"error,omitempty"`
+	ReceivedAt  time.Time       `json:"received_at"`
+	ProcessedAt *time.Time      `json:"processed_at,omitempty"`
+}
+
+type ReturnItemReq struct {
+	OrderItemID int64 `json:"order_item_id"`
+	Quantity    int64 `json:"quantity"`
+	// Reason is one of damaged, wrong_item, not_as_described,
+	// no_longer_needed or other.
+	Reason string `json:"reason"`
+}
+
+type ReturnReq struct {
+	Items []ReturnItemReq `json:"items"`
+	Note  string          `json:"note"`
+}
+
+// ApproveReturnReq approves a return. Restock defaults to true.
+// RefundAmount defaults to, and cannot exceed, what the returned items were
+// paid; 0 refunds nothing.
+type ApproveReturnReq struct {
+	Restock      *bool    `json:"restock"`
+	RefundAmount *float64 `json:"refund_amount"`
+	Note         string   `json:"note"`
+}
+
+type RejectReturnReq struct {
+	Note string `json:"note"`
+}
+
+type ReturnItemRes struct {
+	ID          int64  `json:"id"`
+	OrderItemID int64  `json:"order_item_id"`
+	ProductID   int64  `json:"product_id"`
+	Quantity    int64  `json:"quantity"`
+	Reason      string `json:"reason"`
+}
+
+type ReturnRes struct {
+	ID             int64           `json:"id"`
+	OrderID        int64           `json:"order_id"`
+	Status         string          `json:"status"`
+	Note           string          `json:"note,omitempty"`
+	DecisionNote   string          `json:"decision_note,omitempty"`
+	DecidedBy      string          `json:"decided_by,omitempty"`
+	DecidedAt      *time.Time      `json:"decided_at,omitempty"`
+	RefundedAmount float64         `json:"refunded_amount"`
+	Items          []ReturnItemRes `json:"items"`
+	// Refunds are the refunds made when the return was approved.
+	Refunds   []RefundRes `json:"refunds,omitempty"`
+	CreatedAt time.Time   `json:"created_at"`
+	UpdatedAt *time.Time  `json:"updated_at,omitempty"`
+}
+
+type RefundOrderReq struct {
+	Amount float64 `json:"amount"`
+	Reason string  `json:"reason"`
+}
+
+type RefundRes struct {
+	ID        int64     `json:"id"`
+	OrderID   int64     `json:"order_id"`
+	PaymentID *int64    `json:"payment_id,omitempty"`
+	ReturnID  *int64    `json:"return_id,omitempty"`
+	Amount    float64   `json:"amount"`
+	Reason    string    `json:"reason,omitempty"`
+	Provider  string    `json:"provider"`
+	Reference string    `json:"reference"`
+	Actor     string    `json:"actor"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookSubscriptionReq creates or replaces a subscription. Secret is
+// generated when empty, and kept when empty on an update. Active defaults
+// to true.
+type WebhookSubscriptionReq struct {
+	URL         string   `json:"url"`
+	EventTypes  []string `json:"event_types"`
+	Secret      string   `json:"secret"`
+	Description string   `json:"description"`
+	Active      *bool    `json:"active"`
+}
+
+type WebhookSubscriptionRes struct {
+	ID         int64    `json:"id"`
+	URL        string   `json:"url"`
+	EventTypes []string `json:"event_types"`
+	// Secret is only shown when the subscription is created.
+	Secret      string     `json:"secret,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Active      bool       `json:"active"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   *time.Time `json:"updated_at,omitempty"`
+}
+
+type WebhookAttemptRes struct {
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type WebhookDeliveryRes struct {
+	ID             int64           `json:"id"`
+	SubscriptionID int64           `json:"subscription_id"`
+	EventID        int64           `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	NextAttemptAt  *time.Time      `json:"next_attempt_at,omitempty"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	// AttemptLog is only included for a single delivery.
+	AttemptLog []WebhookAttemptRes `json:"attempt_log,omitempty"`
+}
+
+type AccountEmailReq struct {
+	Email string `json:"email"`
+}
+
+type VerifyEmailReq struct {
+	Token string `json:"token"`
+}
+
+type ResetPasswordReq struct {
+	Token    string `json:"token"`
+	Password string `json:"password"`
+}
+
+// AccountEmailRes answers every request for an account email the same way,
+// whether or not the address has an account.
+type AccountEmailRes struct {
+	Message string `json:"message"`
 }
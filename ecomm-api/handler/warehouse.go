@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *handler) createWarehouse(w http.ResponseWriter, r *http.Request) {
+	var req WarehouseReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.Code == "" || req.Name == "" {
+		http.Error(w, "code and name are required", http.StatusBadRequest)
+		return
+	}
+	if req.Latitude < -90 || req.Latitude > 90 || req.Longitude < -180 || req.Longitude > 180 {
+		http.Error(w, "latitude must be within [-90, 90] and longitude within [-180, 180]", http.StatusBadRequest)
+		return
+	}
+
+	warehouse, err := h.server.CreateWarehouse(r.Context(), &storer.Warehouse{
+		Code:      req.Code,
+		Name:      req.Name,
+		Latitude:  req.Latitude,
+		Longitude: req.Longitude,
+		Priority:  req.Priority,
+	})
+	if err != nil {
+		http.Error(w, "Failed to create warehouse", http.StatusInternalServerError)
+		return
+	}
+
+	res := toWarehouseRes(warehouse)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) listWarehouses(w http.ResponseWriter, r *http.Request) {
+	warehouses, err := h.server.ListWarehouses(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to list warehouses", http.StatusInternalServerError)
+		return
+	}
+
+	res := []WarehouseRes{}
+	for i := range warehouses {
+		res = append(res, toWarehouseRes(&warehouses[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+// getProductStock returns the stock of a product in each warehouse, next to
+// the total available across all of them.
+func (h *handler) getProductStock(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	i, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	stock, err := h.server.ListProductStock(r.Context(), i)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get product stock", http.StatusInternalServerError)
+		return
+	}
+
+	res := ProductStockRes{ProductID: i, Warehouses: []WarehouseStockRes{}}
+	for _, s := range stock {
+		res.Total += s.Quantity
+		res.Warehouses = append(res.Warehouses, WarehouseStockRes{
+			WarehouseID:   s.WarehouseID,
+			WarehouseCode: s.WarehouseCode,
+			Quantity:      s.Quantity,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func toWarehouseRes(w *storer.Warehouse) WarehouseRes {
+	return WarehouseRes{
+		ID:        w.ID,
+		Code:      w.Code,
+		Name:      w.Name,
+		Latitude:  w.Latitude,
+		Longitude: w.Longitude,
+		Priority:  w.Priority,
+		IsDefault: w.IsDefault,
+		CreatedAt: w.CreatedAt,
+	}
+}
@@ -0,0 +1,290 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/outbox"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/webhook"
+	"github.com/go-chi/chi/v5"
+)
+
+func (h *handler) createWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	sub, ok := h.decodeWebhookSubscription(w, r)
+	if !ok {
+		return
+	}
+
+	created, err := h.server.CreateWebhookSubscription(r.Context(), sub)
+	if err != nil {
+		http.Error(w, "Failed to create webhook subscription", http.StatusInternalServerError)
+		return
+	}
+
+	res := toWebhookSubscriptionRes(created)
+	res.Secret = created.Secret
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) decodeWebhookSubscription(w http.ResponseWriter, r *http.Request) (*storer.WebhookSubscription, bool) {
+	var req WebhookSubscriptionReq
+	if err := decodeStrictJSON(r, &req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return nil, false
+	}
+	if msg := validateWebhookSubscriptionReq(req, h.cfg.AllowPrivateWebhookHosts); msg != "" {
+		http.Error(w, "Invalid webhook subscription: "+msg, http.StatusBadRequest)
+		return nil, false
+	}
+
+	sub := &storer.WebhookSubscription{
+		URL:         req.URL,
+		EventTypes:  req.EventTypes,
+		Secret:      req.Secret,
+		Description: req.Description,
+		Active:      true,
+	}
+	if req.Active != nil {
+		sub.Active = *req.Active
+	}
+	return sub, true
+}
+
+func validateWebhookSubscriptionReq(req WebhookSubscriptionReq, allowPrivateHosts bool) string {
+	u, err := url.Parse(req.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "url must be an absolute http or https URL"
+	}
+	if !allowPrivateHosts && webhook.CheckHost(u.Hostname()) != nil {
+		return "url must point at a public host"
+	}
+	if len(req.EventTypes) == 0 {
+		return "event_types is required"
+	}
+	for _, t := range req.EventTypes {
+		if !slices.Contains(outbox.EventTypes, t) {
+			return "unknown event type " + strconv.Quote(t)
+		}
+	}
+	return ""
+}
+
+func (h *handler) listWebhookSubscriptions(w http.ResponseWriter, r *http.Request) {
+	subs, err := h.server.ListWebhookSubscriptions(r.Context())
+	if err != nil {
+		http.Error(w, "Failed to list webhook subscriptions", http.StatusInternalServerError)
+		return
+	}
+
+	res := []WebhookSubscriptionRes{}
+	for i := range subs {
+		res = append(res, toWebhookSubscriptionRes(&subs[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) getWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := h.server.GetWebhookSubscription(r.Context(), id)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Webhook subscription not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get webhook subscription", http.StatusInternalServerError)
+		return
+	}
+
+	res := toWebhookSubscriptionRes(sub)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) updateWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+
+	sub, ok := h.decodeWebhookSubscription(w, r)
+	if !ok {
+		return
+	}
+	sub.ID = id
+
+	updated, err := h.server.UpdateWebhookSubscription(r.Context(), sub)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Webhook subscription not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update webhook subscription", http.StatusInternalServerError)
+		return
+	}
+
+	res := toWebhookSubscriptionRes(updated)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) deleteWebhookSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+
+	err = h.server.DeleteWebhookSubscription(r.Context(), id)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Webhook subscription not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to delete webhook subscription", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// listWebhookDeliveries is the delivery log of a subscription, newest
+// first, optionally only the deliveries with ?status=, such as the dead
+// ones.
+func (h *handler) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid subscription ID", http.StatusBadRequest)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", webhook.DeliveryPending, webhook.DeliverySucceeded, webhook.DeliveryDead:
+	default:
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+
+	deliveries, err := h.server.ListWebhookDeliveries(r.Context(), storer.WebhookDeliveryFilter{SubscriptionID: id, Status: status})
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Webhook subscription not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to list webhook deliveries", http.StatusInternalServerError)
+		return
+	}
+
+	res := []WebhookDeliveryRes{}
+	for i := range deliveries {
+		res = append(res, toWebhookDeliveryRes(&deliveries[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) getWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	d, err := h.server.GetWebhookDelivery(r.Context(), id)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Webhook delivery not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to get webhook delivery", http.StatusInternalServerError)
+		return
+	}
+
+	res := toWebhookDeliveryRes(d)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(res)
+}
+
+func (h *handler) redeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+		return
+	}
+
+	d, err := h.server.RedeliverWebhook(r.Context(), id)
+	if errors.Is(err, storer.ErrNotFound) {
+		http.Error(w, "Webhook delivery not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to redeliver webhook", http.StatusInternalServerError)
+		return
+	}
+
+	res := toWebhookDeliveryRes(d)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(res)
+}
+
+func toWebhookSubscriptionRes(s *storer.WebhookSubscription) WebhookSubscriptionRes {
+	return WebhookSubscriptionRes{
+		ID:          s.ID,
+		URL:         s.URL,
+		EventTypes:  s.EventTypes,
+		Description: s.Description,
+		Active:      s.Active,
+		CreatedAt:   s.CreatedAt,
+		UpdatedAt:   s.UpdatedAt,
+	}
+}
+
+func toWebhookDeliveryRes(d *storer.WebhookDelivery) WebhookDeliveryRes {
+	res := WebhookDeliveryRes{
+		ID:             d.ID,
+		SubscriptionID: d.SubscriptionID,
+		EventID:        d.EventID,
+		EventType:      d.EventType,
+		Payload:        d.Payload,
+		Status:         d.Status,
+		Attempts:       d.Attempts,
+		LastStatusCode: d.LastStatusCode,
+		LastError:      d.LastError,
+		DeliveredAt:    d.DeliveredAt,
+		CreatedAt:      d.CreatedAt,
+	}
+	if d.Status == webhook.DeliveryPending {
+		res.NextAttemptAt = &d.NextAttemptAt
+	}
+	for _, a := range d.AttemptLog {
+		res.AttemptLog = append(res.AttemptLog, WebhookAttemptRes{
+			StatusCode: a.StatusCode,
+			Error:      a.Error,
+			DurationMS: a.DurationMS,
+			CreatedAt:  a.CreatedAt,
+		})
+	}
+	return res
+}
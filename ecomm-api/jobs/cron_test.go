@@ -0,0 +1,77 @@
+package jobs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseSchedule(t *testing.T) {
+	tsc := []struct {
+		spec string
+		err  bool
+	}{
+		{spec: "* * * * *"},
+		{spec: "*/15 9-17 * * 1-5"},
+		{spec: "0,30 0 1,15 * *"},
+		{spec: "5/10 * * * 7"},
+		{spec: "@daily"},
+		{spec: "@every 90s"},
+		{spec: "* * * *", err: true},
+		{spec: "60 * * * *", err: true},
+		{spec: "* 24 * * *", err: true},
+		{spec: "* * 0 * *", err: true},
+		{spec: "* * * 13 *", err: true},
+		{spec: "5-1 * * * *", err: true},
+		{spec: "*/0 * * * *", err: true},
+		{spec: "a * * * *", err: true},
+		{spec: "@every 10ms", err: true},
+		{spec: "@fortnightly", err: true},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.spec, func(t *testing.T) {
+			_, err := ParseSchedule(tc.spec)
+			if tc.err {
+				require.ErrorIs(t, err, ErrInvalidSchedule)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestScheduleNext(t *testing.T) {
+	// A Wednesday.
+	from := time.Date(2025, 11, 5, 10, 7, 30, 0, time.UTC)
+
+	tsc := []struct {
+		name string
+		spec string
+		want time.Time
+	}{
+		{name: "every minute", spec: "* * * * *", want: time.Date(2025, 11, 5, 10, 8, 0, 0, time.UTC)},
+		{name: "step", spec: "*/15 * * * *", want: time.Date(2025, 11, 5, 10, 15, 0, 0, time.UTC)},
+		{name: "step from a value", spec: "5/10 * * * *", want: time.Date(2025, 11, 5, 10, 15, 0, 0, time.UTC)},
+		{name: "later today", spec: "30 14 * * *", want: time.Date(2025, 11, 5, 14, 30, 0, 0, time.UTC)},
+		{name: "tomorrow", spec: "0 9 * * *", want: time.Date(2025, 11, 6, 9, 0, 0, 0, time.UTC)},
+		{name: "hourly", spec: "@hourly", want: time.Date(2025, 11, 5, 11, 0, 0, 0, time.UTC)},
+		{name: "weekly on sunday", spec: "@weekly", want: time.Date(2025, 11, 9, 0, 0, 0, 0, time.UTC)},
+		{name: "sunday as 7", spec: "0 0 * * 7", want: time.Date(2025, 11, 9, 0, 0, 0, 0, time.UTC)},
+		{name: "weekdays", spec: "0 8 * * 1-5", want: time.Date(2025, 11, 6, 8, 0, 0, 0, time.UTC)},
+		{name: "next month", spec: "0 0 1 * *", want: time.Date(2025, 12, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "next year", spec: "0 0 1 3 *", want: time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "day of month or week", spec: "0 0 20 * 5", want: time.Date(2025, 11, 7, 0, 0, 0, 0, time.UTC)},
+		{name: "leap day", spec: "0 0 29 2 *", want: time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{name: "every aligned interval", spec: "@every 20m", want: time.Date(2025, 11, 5, 10, 20, 0, 0, time.UTC)},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			s, err := ParseSchedule(tc.spec)
+			require.NoError(t, err)
+			require.Equal(t, tc.want, s.Next(from))
+		})
+	}
+}
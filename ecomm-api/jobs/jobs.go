@@ -0,0 +1,196 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+)
+
+func LoadConfig() (*Config, error) {
+	cfg := &Config{
+		Workers:      4,
+		PollInterval: time.Second,
+	}
+
+	if v := os.Getenv("JOBS_WORKERS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid JOBS_WORKERS %q: must be a positive integer", v)
+		}
+		cfg.Workers = n
+	}
+	if v := os.Getenv("JOBS_POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid JOBS_POLL_INTERVAL %q: must be a positive duration", v)
+		}
+		cfg.PollInterval = d
+	}
+
+	return cfg, nil
+}
+
+// Backoff is how long to wait before running a job again after its
+// attempt-th failure: doubling from thirty seconds, up to an hour.
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > 8 {
+		return time.Hour
+	}
+	return min((30*time.Second)<<(attempt-1), time.Hour)
+}
+
+// Runner runs the jobs it has handlers for with a pool of workers, and
+// enqueues recurring jobs when they are due. Several runners may share a
+// database: each job is claimed by one of them, and each run of a
+// recurring job is enqueued once.
+type Runner struct {
+	Store        Store
+	Workers      int
+	PollInterval time.Duration
+
+	handlers  map[string]Handler
+	recurring []recurring
+}
+
+type recurring struct {
+	kind     string
+	schedule Schedule
+}
+
+func NewRunner(st Store, cfg *Config) *Runner {
+	return &Runner{
+		Store:        st,
+		Workers:      cfg.Workers,
+		PollInterval: cfg.PollInterval,
+	}
+}
+
+// Handle runs jobs of kind with h. It must be called before Run.
+func (r *Runner) Handle(kind string, h Handler) {
+	if r.handlers == nil {
+		r.handlers = map[string]Handler{}
+	}
+	r.handlers[kind] = h
+}
+
+// Schedule enqueues a job of kind, with no payload, at the times of the
+// cron expression spec; see ParseSchedule. It must be called before Run.
+func (r *Runner) Schedule(kind, spec string) error {
+	s, err := ParseSchedule(spec)
+	if err != nil {
+		return err
+	}
+	r.recurring = append(r.recurring, recurring{kind: kind, schedule: s})
+	return nil
+}
+
+// Run works through jobs until ctx is done, then waits for the jobs that
+// are running to finish. Those jobs are not cancelled with ctx, so that a
+// shutdown does not fail them halfway.
+func (r *Runner) Run(ctx context.Context) {
+	kinds := make([]string, 0, len(r.handlers))
+	for k := range r.handlers {
+		kinds = append(kinds, k)
+	}
+	slices.Sort(kinds)
+
+	var wg sync.WaitGroup
+	if len(kinds) > 0 {
+		for range max(r.Workers, 1) {
+			wg.Go(func() { r.work(ctx, kinds) })
+		}
+	}
+	if len(r.recurring) > 0 {
+		wg.Go(func() { r.schedule(ctx) })
+	}
+	wg.Wait()
+}
+
+func (r *Runner) work(ctx context.Context, kinds []string) {
+	jobCtx := context.WithoutCancel(ctx)
+	for ctx.Err() == nil {
+		ran, err := r.Store.RunJob(jobCtx, kinds, r.run)
+		if err == nil && ran {
+			// There may be more waiting.
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-time.After(r.PollInterval):
+		}
+	}
+}
+
+// run calls the handler of j, turning a panic into an error so that the
+// job is retried instead of taking the worker down.
+func (r *Runner) run(ctx context.Context, j Job) (err error) {
+	h, ok := r.handlers[j.Kind]
+	if !ok {
+		return fmt.Errorf("no handler for job kind %q", j.Kind)
+	}
+
+	start := time.Now()
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+
+		result := "succeeded"
+		if err != nil {
+			result = "failed"
+			slog.Warn("job failed", "job_id", j.ID, "kind", j.Kind, "attempt", j.Attempts+1, "error", err)
+		}
+		metrics.Jobs.WithLabelValues(j.Kind, result).Inc()
+		metrics.JobDuration.WithLabelValues(j.Kind).Observe(time.Since(start).Seconds())
+	}()
+
+	return h(ctx, j)
+}
+
+// schedule enqueues recurring jobs as they fall due. A job's key is its
+// kind and due time, so runners that enqueue the same run create one job.
+func (r *Runner) schedule(ctx context.Context) {
+	next := make([]time.Time, len(r.recurring))
+	for i, rc := range r.recurring {
+		next[i] = rc.schedule.Next(time.Now())
+	}
+
+	ticker := time.NewTicker(r.PollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for i, rc := range r.recurring {
+				if next[i].IsZero() || now.Before(next[i]) {
+					continue
+				}
+				_, err := r.Store.EnqueueJob(ctx, Job{
+					Kind:    rc.kind,
+					Payload: json.RawMessage(`{}`),
+					Key:     fmt.Sprintf("%s@%d", rc.kind, next[i].Unix()),
+					RunAt:   next[i],
+				})
+				if err != nil {
+					// Already logged by the store; try again on the next
+					// tick.
+					continue
+				}
+				next[i] = rc.schedule.Next(now)
+			}
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// memoryStore keeps jobs in memory and runs them the way the database
+// store does, minus the locking.
+type memoryStore struct {
+	mu     sync.Mutex
+	jobs   []*Job
+	status map[int64]string
+	keys   map[string]bool
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{status: map[int64]string{}, keys: map[string]bool{}}
+}
+
+func (s *memoryStore) EnqueueJob(_ context.Context, j Job) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if j.Key != "" {
+		if s.keys[j.Key] {
+			return 0, nil
+		}
+		s.keys[j.Key] = true
+	}
+	if j.MaxAttempts == 0 {
+		j.MaxAttempts = DefaultMaxAttempts
+	}
+	j.ID = int64(len(s.jobs) + 1)
+	s.jobs = append(s.jobs, &j)
+	s.status[j.ID] = StatusPending
+	return j.ID, nil
+}
+
+func (s *memoryStore) RunJob(ctx context.Context, kinds []string, run func(context.Context, Job) error) (bool, error) {
+	s.mu.Lock()
+	var claimed *Job
+	for _, j := range s.jobs {
+		if s.status[j.ID] == StatusPending && !j.RunAt.After(time.Now()) && slices.Contains(kinds, j.Kind) {
+			claimed = j
+			s.status[j.ID] = "running"
+			break
+		}
+	}
+	s.mu.Unlock()
+	if claimed == nil {
+		return false, nil
+	}
+
+	err := run(ctx, *claimed)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	claimed.Attempts++
+	switch {
+	case err == nil:
+		s.status[claimed.ID] = StatusSucceeded
+	case claimed.Attempts >= claimed.MaxAttempts:
+		s.status[claimed.ID] = StatusFailed
+	default:
+		s.status[claimed.ID] = StatusPending
+	}
+	return true, nil
+}
+
+func (s *memoryStore) statuses() map[int64]string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := map[int64]string{}
+	for id, st := range s.status {
+		out[id] = st
+	}
+	return out
+}
+
+func TestRunner(t *testing.T) {
+	st := newMemoryStore()
+	r := NewRunner(st, &Config{Workers: 3, PollInterval: 5 * time.Millisecond})
+
+	var mu sync.Mutex
+	calls := map[string]int{}
+	count := func(kind string) {
+		mu.Lock()
+		defer mu.Unlock()
+		calls[kind]++
+	}
+	r.Handle("ok", func(context.Context, Job) error {
+		count("ok")
+		return nil
+	})
+	r.Handle("flaky", func(_ context.Context, j Job) error {
+		count("flaky")
+		if j.Attempts == 0 {
+			return errors.New("not yet")
+		}
+		return nil
+	})
+	r.Handle("broken", func(context.Context, Job) error {
+		count("broken")
+		panic("boom")
+	})
+
+	ctx := context.Background()
+	for _, j := range []Job{
+		{Kind: "ok"},
+		{Kind: "ok", Key: "once"},
+		{Kind: "ok", Key: "once"},
+		{Kind: "flaky"},
+		{Kind: "broken", MaxAttempts: 2},
+		{Kind: "ok", RunAt: time.Now().Add(time.Hour)},
+	} {
+		_, err := st.EnqueueJob(ctx, j)
+		require.NoError(t, err)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		r.Run(runCtx)
+		close(done)
+	}()
+
+	want := map[int64]string{
+		1: StatusSucceeded,
+		2: StatusSucceeded,
+		3: StatusSucceeded,
+		4: StatusFailed,
+		5: StatusPending,
+	}
+	require.Eventually(t, func() bool {
+		s := st.statuses()
+		for id, status := range want {
+			if s[id] != status {
+				return false
+			}
+		}
+		return true
+	}, time.Second, 5*time.Millisecond)
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("runner did not stop")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, map[string]int{"ok": 2, "flaky": 2, "broken": 2}, calls)
+}
+
+func TestRunnerSchedule(t *testing.T) {
+	st := newMemoryStore()
+	r := NewRunner(st, &Config{Workers: 1, PollInterval: 5 * time.Millisecond})
+
+	ran := make(chan Job, 10)
+	r.Handle("tick", func(_ context.Context, j Job) error {
+		ran <- j
+		return nil
+	})
+	require.NoError(t, r.Schedule("tick", "@every 1s"))
+	require.ErrorIs(t, r.Schedule("tick", "every second"), ErrInvalidSchedule)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Go(func() { r.Run(ctx) })
+
+	var j Job
+	select {
+	case j = <-ran:
+	case <-time.After(3 * time.Second):
+		t.Fatal("recurring job did not run")
+	}
+	cancel()
+	wg.Wait()
+
+	require.Equal(t, "tick", j.Kind)
+	require.Equal(t, j.RunAt, j.RunAt.Truncate(time.Second))
+	require.Equal(t, fmt.Sprintf("tick@%d", j.RunAt.Unix()), j.Key)
+}
+
+func TestBackoff(t *testing.T) {
+	require.Equal(t, 30*time.Second, Backoff(1))
+	require.Equal(t, time.Minute, Backoff(2))
+	require.Equal(t, 16*time.Minute, Backoff(6))
+	require.Equal(t, time.Hour, Backoff(8))
+	require.Equal(t, time.Hour, Backoff(50))
+}
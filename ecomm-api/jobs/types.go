@@ -0,0 +1,55 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	StatusPending   = "pending"
+	StatusSucceeded = "succeeded"
+	// StatusFailed is a job that failed MaxAttempts times. It is not run
+	// again.
+	StatusFailed = "failed"
+)
+
+// DefaultMaxAttempts is how often a job is tried unless it says otherwise.
+const DefaultMaxAttempts = 5
+
+type Config struct {
+	// Workers is how many jobs run at the same time in this process.
+	Workers int
+	// PollInterval is how long an idle worker waits before looking for
+	// jobs again, and how often recurring jobs are checked.
+	PollInterval time.Duration
+}
+
+// Job is a unit of background work, run by the Handler of its kind.
+type Job struct {
+	ID      int64
+	Kind    string
+	Payload json.RawMessage
+	// Key, when set, makes the job unique: enqueueing a job with the key
+	// of an existing one does nothing.
+	Key string
+	// RunAt is when the job becomes due; the zero time means now.
+	RunAt time.Time
+	// Attempts is how often the job has already been tried.
+	Attempts int
+	// MaxAttempts defaults to DefaultMaxAttempts.
+	MaxAttempts int
+}
+
+// Handler runs a job. A job whose handler fails is retried with Backoff
+// until it has been tried MaxAttempts times.
+type Handler func(ctx context.Context, j Job) error
+
+type Store interface {
+	// EnqueueJob stores a job and returns its ID, or 0 when a job with its
+	// key already exists.
+	EnqueueJob(ctx context.Context, j Job) (int64, error)
+	// RunJob claims the oldest due job of one of kinds, runs it and saves
+	// the outcome. It reports whether there was a job to run.
+	RunJob(ctx context.Context, kinds []string, run func(context.Context, Job) error) (bool, error)
+}
@@ -0,0 +1,6 @@
+package logger
+
+type Config struct {
+	Level  string
+	Format string
+}
@@ -0,0 +1,160 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func LoadConfig() *Config {
+	cfg := &Config{
+		Dir:      os.Getenv("MAIL_DIR"),
+		Maildir:  os.Getenv("MAIL_MAILDIR"),
+		SMTPAddr: os.Getenv("SMTP_ADDR"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+	}
+	if cfg.SMTPAddr == "" {
+		cfg.SMTPAddr = "localhost:25"
+	}
+	if cfg.From == "" {
+		cfg.From = "no-reply@ecomm.local"
+	}
+	return cfg
+}
+
+// New returns a MaildirSender when cfg.Maildir is set, a FileSender when
+// cfg.Dir is set and an SMTPSender otherwise.
+func New(cfg *Config) Sender {
+	if cfg.Maildir != "" {
+		return &MaildirSender{Dir: cfg.Maildir}
+	}
+	if cfg.Dir != "" {
+		return &FileSender{Dir: cfg.Dir}
+	}
+	return &SMTPSender{Addr: cfg.SMTPAddr, Username: cfg.Username, Password: cfg.Password}
+}
+
+type SMTPSender struct {
+	Addr     string
+	Username string
+	Password string
+}
+
+func (s *SMTPSender) Send(_ context.Context, m *Message) error {
+	body, err := Encode(m)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return fmt.Errorf("invalid SMTP address %q: %w", s.Addr, err)
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+
+	if err := smtp.SendMail(s.Addr, auth, m.From, m.To, body); err != nil {
+		return fmt.Errorf("failed to send mail to %s: %w", strings.Join(m.To, ", "), err)
+	}
+	return nil
+}
+
+// FileSender writes each message to its own .eml file in Dir.
+type FileSender struct {
+	Dir string
+}
+
+func (s *FileSender) Send(_ context.Context, m *Message) error {
+	body, err := Encode(m)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(s.Dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create mail dir %s: %w", s.Dir, err)
+	}
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().UTC().Format("20060102T150405.000000000"), randomHex(4))
+	if err := os.WriteFile(filepath.Join(s.Dir, name), body, 0o644); err != nil {
+		return fmt.Errorf("failed to write mail to %s: %w", s.Dir, err)
+	}
+	return nil
+}
+
+// Encode renders m as an RFC 5322 message, multipart when it has an HTML
+// body.
+func Encode(m *Message) ([]byte, error) {
+	if m.From == "" || len(m.To) == 0 {
+		return nil, fmt.Errorf("mail needs a sender and at least one recipient")
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", m.From)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", m.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	if m.HTML == "" {
+		b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		b.WriteString(m.Text)
+		return b.Bytes(), nil
+	}
+
+	boundary := randomHex(16)
+	fmt.Fprintf(&b, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", boundary)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n", boundary, m.Text)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/html; charset=utf-8\r\n\r\n%s\r\n", boundary, m.HTML)
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// MaildirSender delivers each message into the Maildir at Dir, so that a
+// mail client can be pointed at it in development. Messages are written to
+// tmp and moved to new once complete.
+type MaildirSender struct {
+	Dir string
+}
+
+func (s *MaildirSender) Send(_ context.Context, m *Message) error {
+	body, err := Encode(m)
+	if err != nil {
+		return err
+	}
+
+	for _, sub := range []string{"tmp", "new", "cur"} {
+		if err := os.MkdirAll(filepath.Join(s.Dir, sub), 0o755); err != nil {
+			return fmt.Errorf("failed to create maildir %s: %w", s.Dir, err)
+		}
+	}
+
+	host, _ := os.Hostname()
+	name := fmt.Sprintf("%d.%s.%s", time.Now().UnixNano(), randomHex(8), strings.ReplaceAll(host, "/", "_"))
+	tmp := filepath.Join(s.Dir, "tmp", name)
+	if err := os.WriteFile(tmp, body, 0o644); err != nil {
+		return fmt.Errorf("failed to write mail to %s: %w", s.Dir, err)
+	}
+	if err := os.Rename(tmp, filepath.Join(s.Dir, "new", name)); err != nil {
+		return fmt.Errorf("failed to deliver mail to %s: %w", s.Dir, err)
+	}
+	return nil
+}
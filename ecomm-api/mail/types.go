@@ -0,0 +1,29 @@
+package mail
+
+import "context"
+
+type Config struct {
+	// Dir, when set, writes messages as .eml files there instead of
+	// sending them, which is handy in development.
+	Dir string
+	// Maildir, when set, delivers messages into a Maildir there instead,
+	// so that a mail client can read them. It takes precedence over Dir.
+	Maildir  string
+	SMTPAddr string
+	Username string
+	Password string
+	From     string
+}
+
+type Message struct {
+	From    string
+	To      []string
+	Subject string
+	// Text is the plain text body. HTML, if set, is sent as an alternative.
+	Text string
+	HTML string
+}
+
+type Sender interface {
+	Send(ctx context.Context, m *Message) error
+}
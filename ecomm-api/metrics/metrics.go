@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ecomm"
+
+var (
+	HTTPRequestDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "http",
+		Name:      "request_duration_seconds",
+		Help:      "Duration of HTTP requests by method, chi route pattern and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	QueryDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "storer",
+		Name:      "query_duration_seconds",
+		Help:      "Duration of storer method calls against the database.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"method"})
+
+	OrdersCreated = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "orders_created_total",
+		Help:      "Number of orders successfully created.",
+	})
+
+	OrderRevenue = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "order_revenue_total",
+		Help:      "Sum of total_price over all created orders.",
+	})
+
+	StockOuts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "stock_outs_total",
+		Help:      "Number of times a product's stock dropped to zero.",
+	})
+
+	FailedCheckouts = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "failed_checkouts_total",
+		Help:      "Number of order creations that failed.",
+	})
+
+	Payments = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "payments_total",
+		Help:      "Number of payment operations, by the status they left the payment in.",
+	}, []string{"status"})
+
+	OutboxEvents = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "outbox_events_total",
+		Help:      "Number of attempts to publish outbox events, by result.",
+	}, []string{"result"})
+
+	WebhookDeliveries = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "webhook_deliveries_total",
+		Help:      "Number of attempts to deliver webhooks to subscribers, by result.",
+	}, []string{"result"})
+
+	Jobs = promauto.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jobs_total",
+		Help:      "Number of background job runs, by kind and result.",
+	}, []string{"kind", "result"})
+
+	JobDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "job_duration_seconds",
+		Help:      "Duration of background job runs, by kind.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"kind"})
+)
+
+// RegisterDB exposes the connection pool statistics of db as gauges.
+func RegisterDB(db *sql.DB) {
+	prometheus.MustRegister(collectors.NewDBStatsCollector(db, namespace))
+}
+
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// ObserveQuery returns a func that records the time elapsed since it was
+// created against the given storer method. Use it as
+// defer metrics.ObserveQuery("GetProduct")().
+func ObserveQuery(method string) func() {
+	start := time.Now()
+	return func() {
+		QueryDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,149 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/mail"
+)
+
+func LoadConfig() (*Config, error) {
+	cfg := &Config{
+		Notifier:   os.Getenv("NOTIFIER"),
+		WebhookURL: os.Getenv("NOTIFY_WEBHOOK_URL"),
+		AlertEmail: os.Getenv("ALERT_EMAIL"),
+	}
+	if cfg.Notifier == "" {
+		cfg.Notifier = NotifierLog
+	}
+
+	switch cfg.Notifier {
+	case NotifierLog:
+	case NotifierWebhook:
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("NOTIFY_WEBHOOK_URL is required with NOTIFIER=%s", NotifierWebhook)
+		}
+	case NotifierMail:
+		if cfg.AlertEmail == "" {
+			return nil, fmt.Errorf("ALERT_EMAIL is required with NOTIFIER=%s", NotifierMail)
+		}
+	default:
+		return nil, fmt.Errorf("unknown NOTIFIER %q: must be %s, %s or %s",
+			cfg.Notifier, NotifierLog, NotifierWebhook, NotifierMail)
+	}
+	return cfg, nil
+}
+
+// New builds the notifier selected by cfg. sender and from are only used by
+// the mail notifier.
+func New(cfg *Config, sender mail.Sender, from string) Notifier {
+	switch cfg.Notifier {
+	case NotifierWebhook:
+		return NewWebhookNotifier(cfg.WebhookURL)
+	case NotifierMail:
+		return &MailNotifier{Sender: sender, From: from, To: cfg.AlertEmail}
+	default:
+		return LogNotifier{}
+	}
+}
+
+// LogNotifier writes alerts to the request-scoped logger.
+type LogNotifier struct{}
+
+func (LogNotifier) Notify(ctx context.Context, a Alert) error {
+	logger.FromContext(ctx).Warn("stock alert",
+		"kind", a.Kind,
+		"product_id", a.ProductID,
+		"sku", a.SKU,
+		"count_in_stock", a.CountInStock,
+		"threshold", a.Threshold,
+		"recipient", a.Recipient,
+	)
+	return nil
+}
+
+// WebhookNotifier POSTs each alert as JSON to URL.
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookNotifier(url string) *WebhookNotifier {
+	return &WebhookNotifier{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, a Alert) error {
+	b, err := json.Marshal(a)
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := n.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", res.Status)
+	}
+	return nil
+}
+
+// MailNotifier emails alerts. Alerts with a recipient go to that customer;
+// the others go to To.
+type MailNotifier struct {
+	Sender mail.Sender
+	From   string
+	To     string
+}
+
+func (n *MailNotifier) Notify(ctx context.Context, a Alert) error {
+	to := a.Recipient
+	if to == "" {
+		to = n.To
+	}
+	return n.Sender.Send(ctx, alertMessage(n.From, to, a))
+}
+
+// MailRecipients sends alerts that have a recipient by mail and everything
+// else to Notifier, so customers hear about restocks whatever notifier the
+// shop uses for its own alerts.
+type MailRecipients struct {
+	Notifier Notifier
+	Sender   mail.Sender
+	From     string
+}
+
+func (n *MailRecipients) Notify(ctx context.Context, a Alert) error {
+	if a.Recipient == "" {
+		return n.Notifier.Notify(ctx, a)
+	}
+	return n.Sender.Send(ctx, alertMessage(n.From, a.Recipient, a))
+}
+
+func alertMessage(from, to string, a Alert) *mail.Message {
+	m := &mail.Message{From: from, To: []string{to}}
+	switch a.Kind {
+	case KindBackInStock:
+		m.Subject = fmt.Sprintf("%s is back in stock", a.Name)
+		m.Text = fmt.Sprintf("Good news: %s is available again.\n", a.Name)
+	default:
+		m.Subject = fmt.Sprintf("Low stock: %s (%s)", a.Name, a.SKU)
+		m.Text = fmt.Sprintf("%s (%s, product %d) is down to %d units; the reorder threshold is %d.\n",
+			a.Name, a.SKU, a.ProductID, a.CountInStock, a.Threshold)
+	}
+	return m
+}
@@ -0,0 +1,101 @@
+package notify
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/mail"
+	"github.com/stretchr/testify/require"
+)
+
+type recorder struct {
+	alerts []Alert
+}
+
+func (r *recorder) Notify(_ context.Context, a Alert) error {
+	r.alerts = append(r.alerts, a)
+	return nil
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	lowStock := Alert{Kind: KindLowStock, ProductID: 1, SKU: "sku-1", Name: "Mug", CountInStock: 2, Threshold: 5}
+
+	tsc := []struct {
+		name   string
+		status int
+		err    bool
+	}{
+		{name: "delivered", status: http.StatusNoContent},
+		{name: "rejected", status: http.StatusInternalServerError, err: true},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			var got Alert
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+
+			err := NewWebhookNotifier(srv.URL).Notify(context.Background(), lowStock)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, lowStock, got)
+		})
+	}
+}
+
+func TestMailNotifiers(t *testing.T) {
+	tsc := []struct {
+		name      string
+		alert     Alert
+		wantMail  string
+		wantOther bool
+	}{
+		{
+			name:      "shop alerts go to the wrapped notifier",
+			alert:     Alert{Kind: KindLowStock, ProductID: 1, Name: "Mug"},
+			wantOther: true,
+		},
+		{
+			name:     "customer alerts are mailed",
+			alert:    Alert{Kind: KindBackInStock, ProductID: 1, Name: "Mug", Recipient: "ana@example.com"},
+			wantMail: "Subject: Mug is back in stock",
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			other := &recorder{}
+			n := &MailRecipients{Notifier: other, Sender: &mail.FileSender{Dir: dir}, From: "shop@example.com"}
+
+			require.NoError(t, n.Notify(context.Background(), tc.alert))
+
+			files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+			require.NoError(t, err)
+			if tc.wantOther {
+				require.Equal(t, []Alert{tc.alert}, other.alerts)
+				require.Empty(t, files)
+				return
+			}
+
+			require.Empty(t, other.alerts)
+			require.Len(t, files, 1)
+			b, err := os.ReadFile(files[0])
+			require.NoError(t, err)
+			require.Contains(t, string(b), "To: "+tc.alert.Recipient)
+			require.Contains(t, string(b), tc.wantMail)
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package notify
+
+import "context"
+
+const (
+	KindLowStock    = "low_stock"
+	KindBackInStock = "back_in_stock"
+)
+
+const (
+	NotifierLog     = "log"
+	NotifierWebhook = "webhook"
+	NotifierMail    = "mail"
+)
+
+type Config struct {
+	// Notifier is where low-stock alerts go: log, webhook or mail.
+	Notifier   string
+	WebhookURL string
+	// AlertEmail receives low-stock alerts when Notifier is mail.
+	AlertEmail string
+}
+
+// Alert is a stock event worth telling someone about. Recipient is set for
+// alerts addressed to a customer, such as back-in-stock notices.
+type Alert struct {
+	Kind         string `json:"kind"`
+	ProductID    int64  `json:"product_id"`
+	SKU          string `json:"sku"`
+	Name         string `json:"name"`
+	CountInStock int64  `json:"count_in_stock"`
+	Threshold    int64  `json:"threshold,omitempty"`
+	Recipient    string `json:"recipient,omitempty"`
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, a Alert) error
+}
@@ -0,0 +1,252 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+)
+
+func LoadConfig() (*Config, error) {
+	cfg := &Config{
+		Publisher:    os.Getenv("OUTBOX_PUBLISHER"),
+		File:         os.Getenv("OUTBOX_FILE"),
+		WebhookURL:   os.Getenv("OUTBOX_WEBHOOK_URL"),
+		PollInterval: time.Second,
+		BatchSize:    100,
+	}
+	if cfg.Publisher == "" {
+		cfg.Publisher = PublisherLog
+	}
+	if cfg.File == "" {
+		cfg.File = "outbox.jsonl"
+	}
+
+	if v := os.Getenv("OUTBOX_POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid OUTBOX_POLL_INTERVAL %q: must be a positive duration", v)
+		}
+		cfg.PollInterval = d
+	}
+	if v := os.Getenv("OUTBOX_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid OUTBOX_BATCH_SIZE %q: must be a positive integer", v)
+		}
+		cfg.BatchSize = n
+	}
+
+	switch cfg.Publisher {
+	case PublisherLog, PublisherFile:
+	case PublisherWebhook:
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("OUTBOX_WEBHOOK_URL is required with OUTBOX_PUBLISHER=%s", PublisherWebhook)
+		}
+	default:
+		return nil, fmt.Errorf("unknown OUTBOX_PUBLISHER %q: must be %s, %s or %s",
+			cfg.Publisher, PublisherLog, PublisherFile, PublisherWebhook)
+	}
+	return cfg, nil
+}
+
+// New builds the publisher selected by cfg.
+func New(cfg *Config) (Publisher, error) {
+	switch cfg.Publisher {
+	case PublisherFile:
+		return NewFilePublisher(cfg.File)
+	case PublisherWebhook:
+		return NewWebhookPublisher(cfg.WebhookURL), nil
+	default:
+		return LogPublisher{}, nil
+	}
+}
+
+// Relay moves events from the outbox to a publisher. Several relays may run
+// against the same database: each event is claimed by one of them.
+type Relay struct {
+	Store     Store
+	Publisher Publisher
+	BatchSize int
+	// Interval is how long to wait before looking again once the outbox
+	// has been drained.
+	Interval time.Duration
+}
+
+// Run relays events until ctx is done. It looks again straight away only
+// after a full batch of which some events were published, so a publisher
+// that is down is not hammered.
+func (r *Relay) Run(ctx context.Context) {
+	for {
+		tried, published, err := r.RelayOnce(ctx)
+		if err == nil && tried >= r.BatchSize && published > 0 {
+			// There may be more waiting.
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(r.Interval):
+		}
+	}
+}
+
+// RelayOnce publishes one batch of events and returns how many it tried
+// and how many of those were published.
+func (r *Relay) RelayOnce(ctx context.Context) (tried, published int, err error) {
+	tried, err = r.Store.RelayOutbox(ctx, r.BatchSize, func(ctx context.Context, e Event) error {
+		err := r.Publisher.Publish(ctx, e)
+		if err != nil {
+			metrics.OutboxEvents.WithLabelValues("failed").Inc()
+			slog.Warn("failed to publish event", "event_id", e.ID, "type", e.Type, "error", err)
+			return err
+		}
+		metrics.OutboxEvents.WithLabelValues("published").Inc()
+		published++
+		return nil
+	})
+	return tried, published, err
+}
+
+// Backoff is how long to wait before publishing an event again after its
+// attempt-th failure: doubling from a second, up to ten minutes.
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > 10 {
+		return 10 * time.Minute
+	}
+	return time.Second << (attempt - 1)
+}
+
+// Fanout publishes each event to every publisher. An event fails if any of
+// them fails and is then published to all of them again, so each should
+// tolerate receiving an event twice.
+type Fanout []Publisher
+
+func (f Fanout) Publish(ctx context.Context, e Event) error {
+	var errs []error
+	for _, p := range f {
+		if err := p.Publish(ctx, e); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// LogPublisher writes events to the default logger.
+type LogPublisher struct{}
+
+func (LogPublisher) Publish(_ context.Context, e Event) error {
+	slog.Info("event", "event_id", e.ID, "type", e.Type, "aggregate_type", e.AggregateType, "aggregate_id", e.AggregateID)
+	return nil
+}
+
+// ChannelPublisher hands events to consumers in the same process. Publish
+// blocks until a consumer takes the event or the buffer has room, so a slow
+// consumer holds the relay back rather than losing events.
+type ChannelPublisher struct {
+	events chan Event
+}
+
+func NewChannelPublisher(buffer int) *ChannelPublisher {
+	return &ChannelPublisher{events: make(chan Event, buffer)}
+}
+
+func (p *ChannelPublisher) Events() <-chan Event {
+	return p.events
+}
+
+func (p *ChannelPublisher) Publish(ctx context.Context, e Event) error {
+	select {
+	case p.events <- e:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// FilePublisher appends events to a file as JSON lines. Each event is
+// synced to disk before Publish returns.
+type FilePublisher struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open outbox file: %w", err)
+	}
+	return &FilePublisher{file: f}, nil
+}
+
+func (p *FilePublisher) Publish(_ context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event %d: %w", e.ID, err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.file.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write event %d: %w", e.ID, err)
+	}
+	if err := p.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync event %d: %w", e.ID, err)
+	}
+	return nil
+}
+
+func (p *FilePublisher) Close() error {
+	return p.file.Close()
+}
+
+// WebhookPublisher POSTs each event as JSON to URL. The Event-ID header
+// lets the receiver drop redeliveries.
+type WebhookPublisher struct {
+	URL    string
+	Client *http.Client
+}
+
+func NewWebhookPublisher(url string) *WebhookPublisher {
+	return &WebhookPublisher{URL: url, Client: &http.Client{Timeout: 10 * time.Second}}
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, e Event) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to encode event %d: %w", e.ID, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.URL, bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("failed to build webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Event-ID", strconv.FormatInt(e.ID, 10))
+	req.Header.Set("Event-Type", e.Type)
+
+	res, err := p.Client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to call webhook: %w", err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return fmt.Errorf("webhook returned %s", res.Status)
+	}
+	return nil
+}
@@ -0,0 +1,176 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var orderCreated = Event{
+	ID:            7,
+	Type:          EventOrderCreated,
+	AggregateType: AggregateOrder,
+	AggregateID:   3,
+	Payload:       json.RawMessage(`{"order_id":3}`),
+	CreatedAt:     time.Date(2025, 10, 30, 9, 0, 0, 0, time.UTC),
+}
+
+func TestChannelPublisher(t *testing.T) {
+	p := NewChannelPublisher(1)
+	require.NoError(t, p.Publish(context.Background(), orderCreated))
+	require.Equal(t, orderCreated, <-p.Events())
+
+	// With the buffer full, Publish waits for a consumer until ctx is done.
+	require.NoError(t, p.Publish(context.Background(), orderCreated))
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, p.Publish(ctx, orderCreated), context.DeadlineExceeded)
+}
+
+func TestFilePublisher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	p, err := NewFilePublisher(path)
+	require.NoError(t, err)
+
+	second := orderCreated
+	second.ID, second.Type = 8, EventOrderCancelled
+	require.NoError(t, p.Publish(context.Background(), orderCreated))
+	require.NoError(t, p.Publish(context.Background(), second))
+	require.NoError(t, p.Close())
+
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var got []Event
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var e Event
+		require.NoError(t, json.Unmarshal(sc.Bytes(), &e))
+		got = append(got, e)
+	}
+	require.NoError(t, sc.Err())
+	require.Equal(t, []Event{orderCreated, second}, got)
+}
+
+func TestWebhookPublisher(t *testing.T) {
+	tsc := []struct {
+		name   string
+		status int
+		err    bool
+	}{
+		{name: "delivered", status: http.StatusAccepted},
+		{name: "rejected", status: http.StatusServiceUnavailable, err: true},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			var got Event
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				require.Equal(t, "application/json", r.Header.Get("Content-Type"))
+				require.Equal(t, "7", r.Header.Get("Event-ID"))
+				require.Equal(t, EventOrderCreated, r.Header.Get("Event-Type"))
+				require.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+
+			err := NewWebhookPublisher(srv.URL).Publish(context.Background(), orderCreated)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, orderCreated, got)
+		})
+	}
+}
+
+// fakeStore hands out its events in batches, recording the outcomes.
+type fakeStore struct {
+	pending   []Event
+	published []int64
+	failed    []int64
+}
+
+func (s *fakeStore) RelayOutbox(ctx context.Context, limit int, publish func(context.Context, Event) error) (int, error) {
+	batch := s.pending[:min(limit, len(s.pending))]
+	s.pending = s.pending[len(batch):]
+	for _, e := range batch {
+		if err := publish(ctx, e); err != nil {
+			s.failed = append(s.failed, e.ID)
+			continue
+		}
+		s.published = append(s.published, e.ID)
+	}
+	return len(batch), nil
+}
+
+type flakyPublisher struct {
+	fail map[int64]bool
+}
+
+func (p flakyPublisher) Publish(_ context.Context, e Event) error {
+	if p.fail[e.ID] {
+		return errors.New("unavailable")
+	}
+	return nil
+}
+
+func TestRelayRun(t *testing.T) {
+	st := &fakeStore{pending: []Event{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}}}
+	r := &Relay{
+		Store:     st,
+		Publisher: flakyPublisher{fail: map[int64]bool{3: true}},
+		BatchSize: 2,
+		Interval:  time.Hour,
+	}
+
+	// Full batches are followed straight away; the short last one makes
+	// Run wait, by which time ctx is done.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	r.Run(ctx)
+
+	require.Empty(t, st.pending)
+	require.Equal(t, []int64{1, 2, 4, 5}, st.published)
+	require.Equal(t, []int64{3}, st.failed)
+}
+
+func TestRelayRunWaitsWhenNothingIsPublished(t *testing.T) {
+	st := &fakeStore{pending: []Event{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}}}
+	r := &Relay{
+		Store:     st,
+		Publisher: flakyPublisher{fail: map[int64]bool{1: true, 2: true}},
+		BatchSize: 2,
+		Interval:  time.Hour,
+	}
+
+	// The first batch is full but all of it failed, so Run waits instead
+	// of asking for the next one.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	r.Run(ctx)
+
+	require.Len(t, st.pending, 2)
+	require.Empty(t, st.published)
+	require.Equal(t, []int64{1, 2}, st.failed)
+}
+
+func TestBackoff(t *testing.T) {
+	require.Equal(t, time.Second, Backoff(0))
+	require.Equal(t, time.Second, Backoff(1))
+	require.Equal(t, 4*time.Second, Backoff(3))
+	require.Equal(t, 512*time.Second, Backoff(10))
+	require.Equal(t, 10*time.Minute, Backoff(11))
+	require.Equal(t, 10*time.Minute, Backoff(100))
+}
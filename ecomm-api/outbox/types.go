@@ -0,0 +1,74 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+)
+
+const (
+	AggregateOrder   = "order"
+	AggregateProduct = "product"
+)
+
+const (
+	EventOrderCreated   = "order.created"
+	EventOrderUpdated   = "order.updated"
+	EventOrderPaid      = "order.paid"
+	EventOrderShipped   = "order.shipped"
+	EventOrderCancelled = "order.cancelled"
+	EventProductCreated = "product.created"
+	EventProductUpdated = "product.updated"
+	EventProductDeleted = "product.deleted"
+)
+
+// EventTypes lists every event type, for validating subscriptions.
+var EventTypes = []string{
+	EventOrderCreated, EventOrderUpdated, EventOrderPaid, EventOrderShipped, EventOrderCancelled,
+	EventProductCreated, EventProductUpdated, EventProductDeleted,
+}
+
+const (
+	PublisherLog     = "log"
+	PublisherFile    = "file"
+	PublisherWebhook = "webhook"
+)
+
+type Config struct {
+	// Publisher is where events go: log, file or webhook. The channel
+	// publisher is for consumers in the same process and is wired in code.
+	Publisher  string
+	File       string
+	WebhookURL string
+	// PollInterval is how long the relay waits when the outbox is empty.
+	PollInterval time.Duration
+	BatchSize    int
+}
+
+// Event is a change to an aggregate, such as an order, that other services
+// may react to. Events are delivered at least once, so consumers should
+// ignore IDs they have already seen; the events of one aggregate arrive in
+// the order they happened.
+type Event struct {
+	ID            int64           `json:"id"`
+	Type          string          `json:"type"`
+	AggregateType string          `json:"aggregate_type"`
+	AggregateID   int64           `json:"aggregate_id"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, e Event) error
+}
+
+// LeaseTime is how long a relay has to publish the events it claimed
+// before another relay may claim them again.
+const LeaseTime = 5 * time.Minute
+
+// Store hands out the events waiting in the outbox. RelayOutbox calls
+// publish for up to limit events, at most one per aggregate, and records
+// whether each was published; it returns how many events it tried.
+type Store interface {
+	RelayOutbox(ctx context.Context, limit int, publish func(context.Context, Event) error) (int, error)
+}
@@ -0,0 +1,177 @@
+package payment
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+func LoadConfig() *Config {
+	cfg := &Config{Gateway: GatewayFake, Currency: "USD"}
+	if v := os.Getenv("PAYMENT_GATEWAY"); v != "" {
+		cfg.Gateway = v
+	}
+	if v := os.Getenv("PAYMENT_CURRENCY"); v != "" {
+		cfg.Currency = strings.ToUpper(v)
+	}
+	return cfg
+}
+
+func New(cfg *Config) (Gateway, error) {
+	switch cfg.Gateway {
+	case GatewayFake:
+		return NewFakeGateway(), nil
+	default:
+		return nil, fmt.Errorf("unknown payment gateway %q", cfg.Gateway)
+	}
+}
+
+// Test cards understood by FakeGateway. Any other number is declined.
+const (
+	TestCardSuccess = "4242424242424242"
+	TestCardDecline = "4000000000000002"
+	TestCard3DS     = "4000000000003220"
+)
+
+// FakeGateway is an in-memory gateway for development and tests. Its
+// outcome depends only on the card number.
+type FakeGateway struct {
+	mu       sync.Mutex
+	seq      int64
+	payments map[string]*fakePayment
+}
+
+type fakePayment struct {
+	status   string
+	amount   float64
+	captured float64
+	refunded float64
+}
+
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{payments: map[string]*fakePayment{}}
+}
+
+func (g *FakeGateway) Name() string {
+	return GatewayFake
+}
+
+func (g *FakeGateway) Authorize(_ context.Context, req AuthorizeRequest) (*Result, error) {
+	if req.Amount <= 0 {
+		return nil, fmt.Errorf("amount %.2f: %w", req.Amount, ErrInvalidAmount)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.seq++
+	ref := fmt.Sprintf("fake_%d", g.seq)
+	p := &fakePayment{amount: req.Amount}
+	g.payments[ref] = p
+
+	res := &Result{Reference: ref}
+	switch number := strings.ReplaceAll(req.Card.Number, " ", ""); {
+	case expired(req.Card):
+		p.status, res.Message = StatusDeclined, "card expired"
+	case number == TestCardSuccess:
+		p.status = StatusAuthorized
+	case number == TestCard3DS:
+		p.status = StatusRequiresAction
+		res.RedirectURL = "https://fake-gateway.invalid/3ds/" + ref
+	case number == TestCardDecline:
+		p.status, res.Message = StatusDeclined, "card declined"
+	default:
+		p.status, res.Message = StatusDeclined, "card not supported by the fake gateway"
+	}
+	res.Status = p.status
+	return res, nil
+}
+
+// Authenticate completes the customer authentication of a payment that
+// requires action, as the 3-D Secure page would.
+func (g *FakeGateway) Authenticate(reference string) (*Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, err := g.payment(reference, StatusRequiresAction)
+	if err != nil {
+		return nil, err
+	}
+	p.status = StatusAuthorized
+	return &Result{Reference: reference, Status: p.status}, nil
+}
+
+func (g *FakeGateway) Capture(_ context.Context, reference string, amount float64) (*Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, err := g.payment(reference, StatusAuthorized)
+	if err != nil {
+		return nil, err
+	}
+	if amount <= 0 || cents(amount) > cents(p.amount) {
+		return nil, fmt.Errorf("capture %.2f of %.2f: %w", amount, p.amount, ErrInvalidAmount)
+	}
+	p.status, p.captured = StatusCaptured, amount
+	return &Result{Reference: reference, Status: p.status}, nil
+}
+
+func (g *FakeGateway) Void(_ context.Context, reference string) (*Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, err := g.payment(reference, StatusAuthorized, StatusRequiresAction)
+	if err != nil {
+		return nil, err
+	}
+	p.status = StatusVoided
+	return &Result{Reference: reference, Status: p.status}, nil
+}
+
+// Refund gives back part or all of a captured payment. The payment is
+// StatusRefunded once everything has been given back.
+func (g *FakeGateway) Refund(_ context.Context, reference string, amount float64) (*Result, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	p, err := g.payment(reference, StatusCaptured)
+	if err != nil {
+		return nil, err
+	}
+	if amount <= 0 || cents(p.refunded+amount) > cents(p.captured) {
+		return nil, fmt.Errorf("refund %.2f of %.2f left: %w", amount, p.captured-p.refunded, ErrInvalidAmount)
+	}
+	p.refunded += amount
+	if cents(p.refunded) == cents(p.captured) {
+		p.status = StatusRefunded
+	}
+	return &Result{Reference: reference, Status: p.status}, nil
+}
+
+// payment returns the payment with the given reference if it is in one of
+// the given states. g.mu must be held.
+func (g *FakeGateway) payment(reference string, states ...string) (*fakePayment, error) {
+	p, ok := g.payments[reference]
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", reference, ErrUnknownReference)
+	}
+	for _, s := range states {
+		if p.status == s {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("%s is %s: %w", reference, p.status, ErrInvalidState)
+}
+
+func expired(c Card) bool {
+	now := time.Now()
+	return c.ExpYear < now.Year() || (c.ExpYear == now.Year() && c.ExpMonth < int(now.Month()))
+}
+
+func cents(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
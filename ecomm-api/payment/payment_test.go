@@ -0,0 +1,130 @@
+package payment
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testCard(number string) Card {
+	return Card{Number: number, ExpMonth: 12, ExpYear: time.Now().Year() + 1, CVC: "123"}
+}
+
+func TestFakeGatewayAuthorize(t *testing.T) {
+	tsc := []struct {
+		name     string
+		card     Card
+		status   string
+		redirect bool
+	}{
+		{name: "success", card: testCard(TestCardSuccess), status: StatusAuthorized},
+		{name: "spaces are ignored", card: testCard("4242 4242 4242 4242"), status: StatusAuthorized},
+		{name: "decline", card: testCard(TestCardDecline), status: StatusDeclined},
+		{name: "3DS required", card: testCard(TestCard3DS), status: StatusRequiresAction, redirect: true},
+		{name: "unknown card", card: testCard("4111111111111111"), status: StatusDeclined},
+		{name: "expired card", card: Card{Number: TestCardSuccess, ExpMonth: 1, ExpYear: 2020}, status: StatusDeclined},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			g := NewFakeGateway()
+			res, err := g.Authorize(context.Background(), AuthorizeRequest{OrderID: 1, Amount: 10, Currency: "USD", Card: tc.card})
+			require.NoError(t, err)
+			require.Equal(t, tc.status, res.Status)
+			require.NotEmpty(t, res.Reference)
+			require.Equal(t, tc.redirect, res.RedirectURL != "")
+			if tc.status == StatusDeclined {
+				require.NotEmpty(t, res.Message)
+			}
+		})
+	}
+}
+
+func TestFakeGatewayLifecycle(t *testing.T) {
+	ctx := context.Background()
+
+	tsc := []struct {
+		name string
+		test func(t *testing.T, g *FakeGateway)
+	}{
+		{
+			name: "capture then refund in two parts",
+			test: func(t *testing.T, g *FakeGateway) {
+				auth, err := g.Authorize(ctx, AuthorizeRequest{Amount: 30, Card: testCard(TestCardSuccess)})
+				require.NoError(t, err)
+
+				res, err := g.Capture(ctx, auth.Reference, 30)
+				require.NoError(t, err)
+				require.Equal(t, StatusCaptured, res.Status)
+
+				res, err = g.Refund(ctx, auth.Reference, 10)
+				require.NoError(t, err)
+				require.Equal(t, StatusCaptured, res.Status)
+
+				_, err = g.Refund(ctx, auth.Reference, 20.01)
+				require.ErrorIs(t, err, ErrInvalidAmount)
+
+				res, err = g.Refund(ctx, auth.Reference, 20)
+				require.NoError(t, err)
+				require.Equal(t, StatusRefunded, res.Status)
+			},
+		},
+		{
+			name: "3DS payment is captured after authentication",
+			test: func(t *testing.T, g *FakeGateway) {
+				auth, err := g.Authorize(ctx, AuthorizeRequest{Amount: 30, Card: testCard(TestCard3DS)})
+				require.NoError(t, err)
+
+				_, err = g.Capture(ctx, auth.Reference, 30)
+				require.ErrorIs(t, err, ErrInvalidState)
+
+				res, err := g.Authenticate(auth.Reference)
+				require.NoError(t, err)
+				require.Equal(t, StatusAuthorized, res.Status)
+
+				res, err = g.Capture(ctx, auth.Reference, 30)
+				require.NoError(t, err)
+				require.Equal(t, StatusCaptured, res.Status)
+			},
+		},
+		{
+			name: "voided payment cannot be captured",
+			test: func(t *testing.T, g *FakeGateway) {
+				auth, err := g.Authorize(ctx, AuthorizeRequest{Amount: 30, Card: testCard(TestCardSuccess)})
+				require.NoError(t, err)
+
+				res, err := g.Void(ctx, auth.Reference)
+				require.NoError(t, err)
+				require.Equal(t, StatusVoided, res.Status)
+
+				_, err = g.Capture(ctx, auth.Reference, 30)
+				require.ErrorIs(t, err, ErrInvalidState)
+			},
+		},
+		{
+			name: "capture more than authorized",
+			test: func(t *testing.T, g *FakeGateway) {
+				auth, err := g.Authorize(ctx, AuthorizeRequest{Amount: 30, Card: testCard(TestCardSuccess)})
+				require.NoError(t, err)
+
+				_, err = g.Capture(ctx, auth.Reference, 30.01)
+				require.ErrorIs(t, err, ErrInvalidAmount)
+			},
+		},
+		{
+			name: "unknown reference",
+			test: func(t *testing.T, g *FakeGateway) {
+				_, err := g.Capture(ctx, "fake_404", 1)
+				require.ErrorIs(t, err, ErrUnknownReference)
+			},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			tc.test(t, NewFakeGateway())
+		})
+	}
+}
@@ -0,0 +1,78 @@
+package payment
+
+import (
+	"context"
+	"errors"
+)
+
+type Config struct {
+	// Gateway picks the payment provider. Only "fake" is built in.
+	Gateway  string
+	Currency string
+}
+
+const (
+	GatewayFake = "fake"
+)
+
+const (
+	// StatusRequiresAction means the customer must authenticate the
+	// payment, e.g. with 3-D Secure, before it is authorized.
+	StatusRequiresAction = "requires_action"
+	StatusAuthorized     = "authorized"
+	StatusCaptured       = "captured"
+	StatusRefunded       = "refunded"
+	StatusVoided         = "voided"
+	StatusDeclined       = "declined"
+)
+
+var (
+	ErrUnknownReference = errors.New("unknown payment reference")
+	// ErrInvalidState means the operation does not apply to the payment in
+	// its current state, e.g. capturing a voided payment.
+	ErrInvalidState  = errors.New("invalid payment state")
+	ErrInvalidAmount = errors.New("invalid payment amount")
+)
+
+// Card is only ever passed to the gateway; the API stores its last four
+// digits.
+type Card struct {
+	Number   string
+	ExpMonth int
+	ExpYear  int
+	CVC      string
+}
+
+type AuthorizeRequest struct {
+	OrderID  int64
+	Amount   float64
+	Currency string
+	Card     Card
+}
+
+// Result is the state of a payment at the provider after an operation. A
+// declined payment is a Result, not an error: errors mean the provider
+// could not be asked.
+type Result struct {
+	Reference string
+	Status    string
+	// RedirectURL is where the customer authenticates a payment that
+	// StatusRequiresAction.
+	RedirectURL string
+	// Message explains a decline.
+	Message string
+}
+
+// Refunder gives back part or all of a captured payment. The payment is
+// StatusRefunded once everything has been given back.
+type Refunder interface {
+	Refund(ctx context.Context, reference string, amount float64) (*Result, error)
+}
+
+type Gateway interface {
+	Refunder
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error)
+	Capture(ctx context.Context, reference string, amount float64) (*Result, error)
+	Void(ctx context.Context, reference string) (*Result, error)
+}
@@ -0,0 +1,72 @@
+package payment
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	const secret = "whsec_test"
+	body := []byte(`{"id":"evt_1","type":"payment.captured","data":{"reference":"fake_1","amount":10}}`)
+	now := time.Unix(1760000000, 0)
+
+	tsc := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		valid  bool
+	}{
+		{name: "valid", secret: secret, header: Sign(secret, now, body), body: body, valid: true},
+		{name: "slightly old", secret: secret, header: Sign(secret, now.Add(-time.Minute), body), body: body, valid: true},
+		{name: "rotated secret", secret: secret, header: Sign("old", now, body) + ",v1=" + signature(secret, strconv.FormatInt(now.Unix(), 10), body), body: body, valid: true},
+		{name: "wrong secret", secret: secret, header: Sign("other", now, body), body: body},
+		{name: "tampered body", secret: secret, header: Sign(secret, now, body), body: []byte(`{"id":"evt_2"}`)},
+		{name: "too old", secret: secret, header: Sign(secret, now.Add(-time.Hour), body), body: body},
+		{name: "from the future", secret: secret, header: Sign(secret, now.Add(time.Hour), body), body: body},
+		{name: "malformed", secret: secret, header: "v1=abc", body: body},
+		{name: "empty", secret: secret, header: "", body: body},
+		{name: "no secret configured", secret: "", header: Sign("", now, body), body: body},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Verify(tc.secret, tc.header, tc.body, now)
+			if tc.valid {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, ErrInvalidSignature)
+			}
+		})
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	tsc := []struct {
+		name  string
+		body  string
+		valid bool
+	}{
+		{name: "captured", body: `{"id":"evt_1","type":"payment.captured","data":{"reference":"fake_1","amount":10}}`, valid: true},
+		{name: "refunded", body: `{"id":"evt_2","type":"payment.refunded","data":{"reference":"fake_1","amount_refunded":4}}`, valid: true},
+		{name: "missing id", body: `{"type":"payment.captured","data":{"reference":"fake_1"}}`},
+		{name: "missing reference", body: `{"id":"evt_1","type":"payment.captured"}`},
+		{name: "unknown type", body: `{"id":"evt_1","type":"charge.disputed","data":{"reference":"fake_1"}}`},
+		{name: "not JSON", body: `evt_1`},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			e, err := ParseEvent([]byte(tc.body))
+			if tc.valid {
+				require.NoError(t, err)
+				require.NotEmpty(t, e.ID)
+			} else {
+				require.ErrorIs(t, err, ErrInvalidEvent)
+			}
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package promotion
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// Eligible reports why r cannot be applied to c, wrapping ErrIneligible, or
+// nil if it can.
+func (r Rule) Eligible(c Cart) error {
+	switch {
+	case c.Now.Before(r.StartsAt):
+		return ineligible(r, "is not active yet")
+	case r.EndsAt != nil && !c.Now.Before(*r.EndsAt):
+		return ineligible(r, "has expired")
+	case r.UsageLimit > 0 && r.TimesUsed >= r.UsageLimit:
+		return ineligible(r, "has reached its usage limit")
+	case r.PerUserLimit > 0 && r.UserUses >= r.PerUserLimit:
+		return ineligible(r, "was already used the maximum number of times")
+	case subtotal(c.Lines) < r.MinSubtotal:
+		return ineligible(r, fmt.Sprintf("needs a subtotal of at least %.2f", r.MinSubtotal))
+	}
+
+	for _, l := range c.Lines {
+		if r.covers(l) {
+			return nil
+		}
+	}
+	return ineligible(r, "does not cover any item in the order")
+}
+
+// Apply applies every rule to the cart in order. Discounts never take a line
+// or the shipping below zero. It fails if any rule is not eligible.
+func Apply(c Cart, rules []Rule) (*Result, error) {
+	res := &Result{}
+
+	// What is left to discount on each line and on shipping.
+	remaining := make([]float64, len(c.Lines))
+	for i, l := range c.Lines {
+		remaining[i] = l.Price * float64(l.Quantity)
+	}
+	shipping := c.Shipping
+
+	seen := map[string]bool{}
+	for _, r := range rules {
+		if seen[r.Code] {
+			return nil, ineligible(r, "was given more than once")
+		}
+		seen[r.Code] = true
+
+		if err := r.Eligible(c); err != nil {
+			return nil, err
+		}
+
+		switch r.Kind {
+		case KindPercentage:
+			for i, l := range c.Lines {
+				if r.covers(l) {
+					res.add(r, i, false, remaining[i]*r.Value/100, &remaining[i])
+				}
+			}
+
+		case KindFixedAmount:
+			// Order-level, spread over the covered lines so later rules
+			// see what is left of each.
+			amount := r.Value
+			var covered float64
+			for i, l := range c.Lines {
+				if r.covers(l) {
+					covered += remaining[i]
+				}
+			}
+			amount = min(amount, covered)
+			adj := Adjustment{RuleID: r.ID, Code: r.Code, Line: -1, Amount: round(amount), Description: describe(r)}
+			if adj.Amount <= 0 {
+				continue
+			}
+			left := adj.Amount
+			for i, l := range c.Lines {
+				if !r.covers(l) || left <= 0 {
+					continue
+				}
+				take := min(remaining[i], left)
+				remaining[i] -= take
+				left -= take
+			}
+			res.Adjustments = append(res.Adjustments, adj)
+			res.Discount += adj.Amount
+
+		case KindFreeShipping:
+			res.add(r, -1, true, shipping, &shipping)
+
+		case KindBuyXGetY:
+			if r.BuyQuantity <= 0 || r.GetQuantity <= 0 {
+				return nil, fmt.Errorf("%s has no buy and get quantities", r.Code)
+			}
+			for i, l := range c.Lines {
+				if !r.covers(l) {
+					continue
+				}
+				free := l.Quantity / (r.BuyQuantity + r.GetQuantity) * r.GetQuantity
+				res.add(r, i, false, float64(free)*l.Price, &remaining[i])
+			}
+
+		default:
+			return nil, fmt.Errorf("%s has unknown kind %q", r.Code, r.Kind)
+		}
+	}
+
+	res.Discount = round(res.Discount)
+	res.ShippingDiscount = round(res.ShippingDiscount)
+	return res, nil
+}
+
+// add records a discount of up to amount, capped at what is left in left.
+func (res *Result) add(r Rule, line int, shipping bool, amount float64, left *float64) {
+	amount = round(min(amount, *left))
+	if amount <= 0 {
+		return
+	}
+	*left -= amount
+
+	res.Adjustments = append(res.Adjustments, Adjustment{
+		RuleID:      r.ID,
+		Code:        r.Code,
+		Line:        line,
+		Shipping:    shipping,
+		Amount:      amount,
+		Description: describe(r),
+	})
+	if shipping {
+		res.ShippingDiscount += amount
+	} else {
+		res.Discount += amount
+	}
+}
+
+func (r Rule) covers(l Line) bool {
+	if len(r.ProductIDs) == 0 && len(r.Categories) == 0 {
+		return true
+	}
+	return slices.Contains(r.ProductIDs, l.ProductID) || slices.Contains(r.Categories, l.Category)
+}
+
+func ineligible(r Rule, reason string) error {
+	return &IneligibleError{Code: r.Code, Reason: reason}
+}
+
+func describe(r Rule) string {
+	switch r.Kind {
+	case KindPercentage:
+		return fmt.Sprintf("%g%% off", r.Value)
+	case KindFixedAmount:
+		return fmt.Sprintf("%.2f off", r.Value)
+	case KindFreeShipping:
+		return "free shipping"
+	case KindBuyXGetY:
+		return fmt.Sprintf("buy %d get %d free", r.BuyQuantity, r.GetQuantity)
+	}
+	return r.Kind
+}
+
+func subtotal(lines []Line) float64 {
+	var total float64
+	for _, l := range lines {
+		total += l.Price * float64(l.Quantity)
+	}
+	return total
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
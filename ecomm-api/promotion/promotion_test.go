@@ -0,0 +1,127 @@
+package promotion
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestApply(t *testing.T) {
+	now := time.Date(2025, 10, 6, 12, 0, 0, 0, time.UTC)
+	yesterday := now.Add(-24 * time.Hour)
+
+	cart := Cart{
+		Lines: []Line{
+			{ProductID: 1, Category: "shoes", Price: 50, Quantity: 2},
+			{ProductID: 2, Category: "socks", Price: 5, Quantity: 6},
+		},
+		Shipping: 7,
+		Now:      now,
+	}
+
+	tsc := []struct {
+		name  string
+		rules []Rule
+		want  *Result
+		err   bool
+	}{
+		{
+			name:  "percentage scoped to a category is line level",
+			rules: []Rule{{ID: 1, Code: "SHOES10", Kind: KindPercentage, Value: 10, Categories: []string{"shoes"}}},
+			want: &Result{
+				Adjustments: []Adjustment{{RuleID: 1, Code: "SHOES10", Line: 0, Amount: 10, Description: "10% off"}},
+				Discount:    10,
+			},
+		},
+		{
+			name:  "fixed amount is order level and capped at the covered subtotal",
+			rules: []Rule{{ID: 2, Code: "SOCKS50", Kind: KindFixedAmount, Value: 50, ProductIDs: []int64{2}}},
+			want: &Result{
+				Adjustments: []Adjustment{{RuleID: 2, Code: "SOCKS50", Line: -1, Amount: 30, Description: "50.00 off"}},
+				Discount:    30,
+			},
+		},
+		{
+			name:  "free shipping",
+			rules: []Rule{{ID: 3, Code: "SHIPFREE", Kind: KindFreeShipping, MinSubtotal: 100}},
+			want: &Result{
+				Adjustments:      []Adjustment{{RuleID: 3, Code: "SHIPFREE", Line: -1, Shipping: true, Amount: 7, Description: "free shipping"}},
+				ShippingDiscount: 7,
+			},
+		},
+		{
+			name:  "buy two get one free",
+			rules: []Rule{{ID: 4, Code: "3FOR2", Kind: KindBuyXGetY, BuyQuantity: 2, GetQuantity: 1, Categories: []string{"socks"}}},
+			want: &Result{
+				Adjustments: []Adjustment{{RuleID: 4, Code: "3FOR2", Line: 1, Amount: 10, Description: "buy 2 get 1 free"}},
+				Discount:    10,
+			},
+		},
+		{
+			name: "stacked rules never discount below zero",
+			rules: []Rule{
+				{ID: 5, Code: "HALF", Kind: KindPercentage, Value: 50},
+				{ID: 6, Code: "BIG", Kind: KindFixedAmount, Value: 1000},
+			},
+			want: &Result{
+				Adjustments: []Adjustment{
+					{RuleID: 5, Code: "HALF", Line: 0, Amount: 50, Description: "50% off"},
+					{RuleID: 5, Code: "HALF", Line: 1, Amount: 15, Description: "50% off"},
+					{RuleID: 6, Code: "BIG", Line: -1, Amount: 65, Description: "1000.00 off"},
+				},
+				Discount: 130,
+			},
+		},
+		{
+			name:  "expired",
+			rules: []Rule{{Code: "OLD", Kind: KindPercentage, Value: 10, EndsAt: &yesterday}},
+			err:   true,
+		},
+		{
+			name:  "not started",
+			rules: []Rule{{Code: "SOON", Kind: KindPercentage, Value: 10, StartsAt: now.Add(time.Hour)}},
+			err:   true,
+		},
+		{
+			name:  "usage limit reached",
+			rules: []Rule{{Code: "ONCE", Kind: KindPercentage, Value: 10, UsageLimit: 1, TimesUsed: 1}},
+			err:   true,
+		},
+		{
+			name:  "per user limit reached",
+			rules: []Rule{{Code: "MINE", Kind: KindPercentage, Value: 10, PerUserLimit: 2, UserUses: 2}},
+			err:   true,
+		},
+		{
+			name:  "minimum subtotal not met",
+			rules: []Rule{{Code: "BIGSPENDER", Kind: KindPercentage, Value: 10, MinSubtotal: 500}},
+			err:   true,
+		},
+		{
+			name:  "scope matches nothing in the cart",
+			rules: []Rule{{Code: "HATS", Kind: KindPercentage, Value: 10, Categories: []string{"hats"}}},
+			err:   true,
+		},
+		{
+			name: "same code twice",
+			rules: []Rule{
+				{Code: "TWICE", Kind: KindPercentage, Value: 10},
+				{Code: "TWICE", Kind: KindPercentage, Value: 10},
+			},
+			err: true,
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := Apply(cart, tc.rules)
+			if tc.err {
+				require.ErrorIs(t, err, ErrIneligible)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
@@ -0,0 +1,92 @@
+package promotion
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	KindPercentage   = "percentage"
+	KindFixedAmount  = "fixed_amount"
+	KindFreeShipping = "free_shipping"
+	KindBuyXGetY     = "buy_x_get_y"
+)
+
+// ErrIneligible matches every IneligibleError, so callers can tell a bad
+// coupon from a failure.
+var ErrIneligible = errors.New("promotion does not apply")
+
+// IneligibleError explains why a code cannot be applied to a cart. Its
+// message is meant for the customer.
+type IneligibleError struct {
+	Code   string
+	Reason string
+}
+
+func (e *IneligibleError) Error() string {
+	return fmt.Sprintf("coupon %s %s", e.Code, e.Reason)
+}
+
+func (e *IneligibleError) Is(target error) bool {
+	return target == ErrIneligible
+}
+
+// Rule is a promotion as the engine sees it, together with how often it has
+// been used so far.
+type Rule struct {
+	ID   int64
+	Code string
+	Kind string
+	// Value is the percentage off for KindPercentage and the amount off for
+	// KindFixedAmount.
+	Value float64
+	// BuyQuantity and GetQuantity describe KindBuyXGetY: for every
+	// BuyQuantity units bought, GetQuantity more are free.
+	BuyQuantity int64
+	GetQuantity int64
+	MinSubtotal float64
+	StartsAt    time.Time
+	EndsAt      *time.Time
+	// UsageLimit and PerUserLimit cap redemptions overall and per user;
+	// zero means unlimited.
+	UsageLimit   int64
+	PerUserLimit int64
+	TimesUsed    int64
+	UserUses     int64
+	// ProductIDs and Categories scope the rule; with neither, it applies
+	// to the whole cart.
+	ProductIDs []int64
+	Categories []string
+}
+
+type Line struct {
+	ProductID int64
+	Category  string
+	Price     float64
+	Quantity  int64
+}
+
+type Cart struct {
+	Lines    []Line
+	Shipping float64
+	Now      time.Time
+}
+
+// Adjustment is one discount. Line is the index of the cart line it applies
+// to, or -1 for the order as a whole.
+type Adjustment struct {
+	RuleID      int64
+	Code        string
+	Line        int
+	Shipping    bool
+	Amount      float64
+	Description string
+}
+
+type Result struct {
+	Adjustments []Adjustment
+	// Discount is taken off the items and ShippingDiscount off shipping.
+	Discount         float64
+	ShippingDiscount float64
+}
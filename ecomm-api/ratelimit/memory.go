@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	// full is how long the bucket takes to refill completely under the
+	// policy it was last taken with.
+	full time.Duration
+}
+
+// MemoryStore is an in-process Store. Buckets that have been idle long enough
+// to refill completely are dropped on the next sweep.
+type MemoryStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	now       func() time.Time
+	lastSweep time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryStore) Take(ctx context.Context, key string, p Policy) (Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	burst := float64(p.Burst)
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		m.buckets[key] = b
+	}
+
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(burst, b.tokens+elapsed*p.Rate)
+	b.last = now
+	b.full = durationFor(burst, p.Rate)
+
+	res := Result{Limit: p.Burst}
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = durationFor(1-b.tokens, p.Rate)
+	}
+
+	res.Remaining = int(b.tokens)
+	res.Reset = durationFor(burst-b.tokens, p.Rate)
+	return res, nil
+}
+
+func (m *MemoryStore) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+
+	for k, b := range m.buckets {
+		if now.Sub(b.last) > b.full {
+			delete(m.buckets, k)
+		}
+	}
+}
+
+func durationFor(tokens, rate float64) time.Duration {
+	if rate <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / rate * float64(time.Second))
+}
@@ -0,0 +1,198 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+)
+
+// KeyFunc identifies the client a request is accounted to. An empty string
+// means the func could not identify it.
+type KeyFunc func(r *http.Request) string
+
+type Limiter struct {
+	store Store
+	key   KeyFunc
+	cfg   *Config
+}
+
+func NewLimiter(store Store, key KeyFunc, cfg *Config) *Limiter {
+	return &Limiter{store: store, key: key, cfg: cfg}
+}
+
+// Policy returns the policy configured for name, or the default one.
+func (l *Limiter) Policy(name string) Policy {
+	if p, ok := l.cfg.Routes[name]; ok {
+		return p
+	}
+	return l.cfg.Default
+}
+
+// Limit returns a middleware that throttles requests against the policy
+// configured for name. Each name has its own set of buckets.
+func (l *Limiter) Limit(name string) func(http.Handler) http.Handler {
+	p := l.Policy(name)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			res, err := l.store.Take(r.Context(), name+":"+l.key(r), p)
+			if err != nil {
+				// Fail open: an unavailable limiter store must not take the API down.
+				logger.FromContext(r.Context()).Error("rate limiter unavailable", "policy", name, "error", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			h := w.Header()
+			h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Set("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+			h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", p.Burst, seconds(durationFor(float64(p.Burst), p.Rate))))
+
+			if !res.Allowed {
+				h.Set("Retry-After", strconv.Itoa(seconds(res.RetryAfter)))
+				http.Error(w, "Too many requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Allow takes a token for an arbitrary key, for callers that need to throttle
+// on something other than the request itself.
+func (l *Limiter) Allow(r *http.Request, name, key string) (Result, error) {
+	return l.store.Take(r.Context(), name+":"+key, l.Policy(name))
+}
+
+func seconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// ByIP keys requests by the client IP in RemoteAddr.
+func ByIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return "ip:" + r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+// ByAPIKey keys requests by the API key in the given header, if it is one of
+// keys. Unknown values do not identify the request, as a client could
+// otherwise get a fresh bucket by sending a new value each time.
+func ByAPIKey(header string, keys []string) KeyFunc {
+	known := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		known[k] = true
+	}
+
+	return func(r *http.Request) string {
+		if v := r.Header.Get(header); known[v] {
+			return strings.ToLower(header) + ":" + v
+		}
+		return ""
+	}
+}
+
+// ByUser keys requests by the authenticated user returned by userID.
+func ByUser(userID func(r *http.Request) (string, bool)) KeyFunc {
+	return func(r *http.Request) string {
+		if id, ok := userID(r); ok {
+			return "user:" + id
+		}
+		return ""
+	}
+}
+
+// First uses the first key func that identifies the request, falling back to
+// the client IP.
+func First(keys ...KeyFunc) KeyFunc {
+	return func(r *http.Request) string {
+		for _, k := range keys {
+			if v := k(r); v != "" {
+				return v
+			}
+		}
+		return ByIP(r)
+	}
+}
+
+// LoadConfig reads the default policy from RATE_LIMIT_RPS and RATE_LIMIT_BURST,
+// per-route overrides from RATE_LIMIT_ROUTES, formatted as
+// "name=rate:burst,name=rate:burst", and the comma separated partner API keys
+// from RATE_LIMIT_API_KEYS.
+func LoadConfig() (*Config, error) {
+	cfg := &Config{
+		Default: Policy{Rate: 10, Burst: 20},
+		Routes: map[string]Policy{
+			"orders.create": {Rate: 1, Burst: 5},
+			"auth":          {Rate: 1, Burst: 10},
+			// Account emails per address: three, then one every ten minutes.
+			"auth.email": {Rate: 1.0 / 600, Burst: 3},
+		},
+	}
+
+	if v := os.Getenv("RATE_LIMIT_RPS"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_RPS %q: %w", v, err)
+		}
+		cfg.Default.Rate = rate
+	}
+	if v := os.Getenv("RATE_LIMIT_BURST"); v != "" {
+		burst, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RATE_LIMIT_BURST %q: %w", v, err)
+		}
+		cfg.Default.Burst = burst
+	}
+
+	if v := os.Getenv("RATE_LIMIT_ROUTES"); v != "" {
+		for _, entry := range strings.Split(v, ",") {
+			name, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+			if !ok {
+				return nil, fmt.Errorf("invalid RATE_LIMIT_ROUTES entry %q: want name=rate:burst", entry)
+			}
+			p, err := parsePolicy(spec)
+			if err != nil {
+				return nil, fmt.Errorf("invalid RATE_LIMIT_ROUTES entry %q: %w", entry, err)
+			}
+			cfg.Routes[name] = p
+		}
+	}
+
+	if v := os.Getenv("RATE_LIMIT_API_KEYS"); v != "" {
+		for _, k := range strings.Split(v, ",") {
+			if k = strings.TrimSpace(k); k != "" {
+				cfg.APIKeys = append(cfg.APIKeys, k)
+			}
+		}
+	}
+
+	return cfg, nil
+}
+
+func parsePolicy(s string) (Policy, error) {
+	rate, burst, ok := strings.Cut(s, ":")
+	if !ok {
+		return Policy{}, fmt.Errorf("want rate:burst")
+	}
+	r, err := strconv.ParseFloat(rate, 64)
+	if err != nil {
+		return Policy{}, err
+	}
+	b, err := strconv.Atoi(burst)
+	if err != nil {
+		return Policy{}, err
+	}
+	return Policy{Rate: r, Burst: b}, nil
+}
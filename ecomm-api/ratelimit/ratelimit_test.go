@@ -0,0 +1,145 @@
+package ratelimit
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	p := Policy{Rate: 1, Burst: 2}
+
+	tsc := []struct {
+		name string
+		test func(t *testing.T, st *MemoryStore, clock *time.Time)
+	}{
+		{
+			name: "allows up to burst",
+			test: func(t *testing.T, st *MemoryStore, clock *time.Time) {
+				res, err := st.Take(context.Background(), "k", p)
+				require.NoError(t, err)
+				require.True(t, res.Allowed)
+				require.Equal(t, 1, res.Remaining)
+
+				res, err = st.Take(context.Background(), "k", p)
+				require.NoError(t, err)
+				require.True(t, res.Allowed)
+				require.Equal(t, 0, res.Remaining)
+
+				res, err = st.Take(context.Background(), "k", p)
+				require.NoError(t, err)
+				require.False(t, res.Allowed)
+				require.Equal(t, time.Second, res.RetryAfter)
+			},
+		},
+		{
+			name: "refills over time",
+			test: func(t *testing.T, st *MemoryStore, clock *time.Time) {
+				for range 2 {
+					_, err := st.Take(context.Background(), "k", p)
+					require.NoError(t, err)
+				}
+
+				*clock = clock.Add(time.Second)
+
+				res, err := st.Take(context.Background(), "k", p)
+				require.NoError(t, err)
+				require.True(t, res.Allowed)
+			},
+		},
+		{
+			name: "keys are independent",
+			test: func(t *testing.T, st *MemoryStore, clock *time.Time) {
+				for range 2 {
+					_, err := st.Take(context.Background(), "a", p)
+					require.NoError(t, err)
+				}
+
+				res, err := st.Take(context.Background(), "b", p)
+				require.NoError(t, err)
+				require.True(t, res.Allowed)
+			},
+		},
+		{
+			name: "sweep keeps buckets of slower policies",
+			test: func(t *testing.T, st *MemoryStore, clock *time.Time) {
+				slow := Policy{Rate: 1.0 / 600, Burst: 1}
+				_, err := st.Take(context.Background(), "slow", slow)
+				require.NoError(t, err)
+
+				// Long enough to drop a bucket under p, not under slow.
+				*clock = clock.Add(2 * time.Minute)
+				_, err = st.Take(context.Background(), "k", p)
+				require.NoError(t, err)
+				require.Contains(t, st.buckets, "slow")
+
+				res, err := st.Take(context.Background(), "slow", slow)
+				require.NoError(t, err)
+				require.False(t, res.Allowed)
+			},
+		},
+		{
+			name: "sweep drops refilled buckets",
+			test: func(t *testing.T, st *MemoryStore, clock *time.Time) {
+				_, err := st.Take(context.Background(), "a", p)
+				require.NoError(t, err)
+
+				*clock = clock.Add(2 * time.Minute)
+				_, err = st.Take(context.Background(), "k", p)
+				require.NoError(t, err)
+				require.NotContains(t, st.buckets, "a")
+			},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			clock := time.Unix(1_700_000_000, 0)
+			st := NewMemoryStore()
+			st.now = func() time.Time { return clock }
+			tc.test(t, st, &clock)
+		})
+	}
+}
+
+func TestLimit(t *testing.T) {
+	cfg := &Config{
+		Default: Policy{Rate: 10, Burst: 10},
+		Routes:  map[string]Policy{"orders.create": {Rate: 0.5, Burst: 1}},
+	}
+	l := NewLimiter(NewMemoryStore(), First(ByAPIKey("X-API-Key", []string{"partner"})), cfg)
+	h := l.Limit("orders.create")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+
+	req := httptest.NewRequest(http.MethodPost, "/orders", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+	require.Equal(t, "1", rec.Header().Get("RateLimit-Limit"))
+	require.Equal(t, "0", rec.Header().Get("RateLimit-Remaining"))
+	require.Equal(t, "1;w=2", rec.Header().Get("RateLimit-Policy"))
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "2", rec.Header().Get("Retry-After"))
+
+	// An unknown API key is accounted to the IP, so it cannot buy a new bucket.
+	req.Header.Set("X-API-Key", "made-up")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	// A known API key from the same IP gets its own bucket.
+	req.Header.Set("X-API-Key", "partner")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusCreated, rec.Code)
+}
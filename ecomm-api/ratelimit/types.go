@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Policy describes a token bucket: Burst tokens at most, refilled at Rate
+// tokens per second.
+type Policy struct {
+	Rate  float64
+	Burst int
+}
+
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+// Store keeps the bucket state for every key. Implementations must be safe for
+// concurrent use.
+type Store interface {
+	Take(ctx context.Context, key string, p Policy) (Result, error)
+}
+
+// Config holds the policy used for routes without an override and the
+// per-route overrides, keyed by the name passed to Limiter.Limit.
+type Config struct {
+	Default Policy
+	Routes  map[string]Policy
+	// APIKeys are the keys partners send in X-API-Key. Only these get a
+	// bucket of their own; any other value is accounted to the client IP.
+	APIKeys []string
+}
@@ -0,0 +1,155 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/auth"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/email"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
+)
+
+// RequestEmailVerification queues an email to address with a link to
+// verify it. The user is looked up, and the token made, only when the email
+// is sent: the request does the same work for every address, so neither its
+// answer nor its timing tells callers which addresses have accounts.
+func (s *Server) RequestEmailVerification(ctx context.Context, address string) error {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.RequestEmailVerification")
+	defer span.End()
+
+	return s.queueAccountEmail(ctx, email.TemplateVerifyEmail, address)
+}
+
+// VerifyEmail marks the address a verification token was sent to as
+// verified. Invalid tokens fail with storer.ErrInvalidToken.
+func (s *Server) VerifyEmail(ctx context.Context, token string) error {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.VerifyEmail")
+	defer span.End()
+
+	u, err := s.storer.VerifyEmail(ctx, auth.HashToken(token))
+	if err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("email verified", "user_id", u.ID)
+	return nil
+}
+
+// RequestPasswordReset queues an email to address with a link to choose a
+// new password. Like RequestEmailVerification it does the same work whether
+// or not the address has an account.
+func (s *Server) RequestPasswordReset(ctx context.Context, address string) error {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.RequestPasswordReset")
+	defer span.End()
+
+	return s.queueAccountEmail(ctx, email.TemplatePasswordReset, address)
+}
+
+// ResetPassword sets the password of the user a reset token was sent to.
+// Invalid tokens fail with storer.ErrInvalidToken.
+func (s *Server) ResetPassword(ctx context.Context, token, password string) error {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ResetPassword")
+	defer span.End()
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		return err
+	}
+	u, err := s.storer.ResetPassword(ctx, auth.HashToken(token), hash)
+	if err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("password reset", "user_id", u.ID)
+	return nil
+}
+
+func (s *Server) queueAccountEmail(ctx context.Context, name, address string) error {
+	if s.mailer == nil {
+		return nil
+	}
+	return s.queueEmail(ctx, emailJob{Template: name, Email: auth.NormalizeEmail(address)}, "")
+}
+
+// accountEmailData makes the token of a verify_email or password_reset
+// email to address and returns the user and the email's data. The user is
+// nil when there is nothing to send: the address has no account, or is
+// already verified.
+func (s *Server) accountEmailData(ctx context.Context, name, address string) (*storer.User, any, error) {
+	u, err := s.storer.GetUserByEmail(ctx, address)
+	if errors.Is(err, storer.ErrNotFound) {
+		return nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch name {
+	case email.TemplateVerifyEmail:
+		if u.EmailVerifiedAt != nil {
+			return nil, nil, nil
+		}
+		token, err := s.newUserToken(ctx, u.ID, auth.PurposeVerifyEmail, s.auth.VerifyEmailTTL)
+		if err != nil {
+			return nil, nil, err
+		}
+		logger.FromContext(ctx).Info("email verification sent", "user_id", u.ID)
+		return u, email.VerifyEmail{
+			Name:      u.Name,
+			URL:       auth.Link(s.auth.VerifyEmailURL, token),
+			ExpiresIn: s.auth.VerifyEmailTTL,
+		}, nil
+	default:
+		token, err := s.newUserToken(ctx, u.ID, auth.PurposeResetPassword, s.auth.PasswordResetTTL)
+		if err != nil {
+			return nil, nil, err
+		}
+		logger.FromContext(ctx).Info("password reset sent", "user_id", u.ID)
+		return u, email.PasswordReset{
+			Name:      u.Name,
+			URL:       auth.Link(s.auth.PasswordResetURL, token),
+			ExpiresIn: s.auth.PasswordResetTTL,
+		}, nil
+	}
+}
+
+func (s *Server) newUserToken(ctx context.Context, userID int64, purpose string, ttl time.Duration) (string, error) {
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.storer.CreateUserToken(ctx, &storer.UserToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(ttl),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// checkVerifiedEmail fails with storer.ErrEmailNotVerified when verified
+// emails are required and userID has not verified theirs. Orders carry the
+// user_id the client sent, so until orders are tied to a signed-in user this
+// only keeps honest clients from checking out unverified.
+func (s *Server) checkVerifiedEmail(ctx context.Context, userID int64) error {
+	if !s.auth.RequireVerifiedEmail {
+		return nil
+	}
+
+	u, err := s.storer.GetUser(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if u.EmailVerifiedAt == nil {
+		return fmt.Errorf("user %d: %w", userID, storer.ErrEmailNotVerified)
+	}
+	return nil
+}
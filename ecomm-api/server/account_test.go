@@ -0,0 +1,103 @@
+package server
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/auth"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/jobs"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestPasswordReset(t *testing.T) {
+	// The request only queues the email, whether or not the address has an
+	// account: no user is looked up and no token made.
+	for _, address := range []string{"Ada@Example.com", "nobody@example.com"} {
+		t.Run(address, func(t *testing.T) {
+			m, _ := newTestMailer(t)
+			withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(enqueueJob).
+					WithArgs(JobSendEmail, []byte(`{"template":"password_reset","email":"`+strings.ToLower(address)+`"}`),
+						nil, jobs.DefaultMaxAttempts, sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+				require.NoError(t, s.RequestPasswordReset(context.Background(), address))
+			}, WithMailer(m))
+		})
+	}
+}
+
+func TestSendAccountEmailJob(t *testing.T) {
+	const getUser = "SELECT id, name, email, is_admin, email_verified_at FROM users WHERE LOWER(email) = LOWER($1) ORDER BY id LIMIT 1"
+	userColumns := []string{"id", "name", "email", "is_admin", "email_verified_at"}
+	cfg := &auth.Config{
+		VerifyEmailTTL:   24 * time.Hour,
+		PasswordResetTTL: time.Hour,
+		VerifyEmailURL:   "https://shop.example/verify",
+		PasswordResetURL: "https://shop.example/reset",
+	}
+
+	t.Run("known address gets a fresh link", func(t *testing.T) {
+		m, sender := newTestMailer(t)
+		withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(getUser).WithArgs("ada@example.com").
+				WillReturnRows(sqlmock.NewRows(userColumns).AddRow(7, "Ada", "ada@example.com", false, nil))
+			mock.ExpectBegin()
+			mock.ExpectExec("UPDATE user_tokens SET used_at=$1 WHERE user_id=$2 AND purpose=$3 AND used_at IS NULL").
+				WithArgs(sqlmock.AnyArg(), 7, auth.PurposeResetPassword).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectQuery(`INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`).
+				WithArgs(7, auth.PurposeResetPassword, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			mock.ExpectCommit()
+
+			err := s.sendEmailJob(context.Background(), jobs.Job{
+				ID:      1,
+				Kind:    JobSendEmail,
+				Payload: []byte(`{"template":"password_reset","email":"ada@example.com"}`),
+			})
+			require.NoError(t, err)
+		}, WithMailer(m), WithAuth(cfg))
+
+		require.Len(t, sender.sent, 1)
+		require.Equal(t, []string{"ada@example.com"}, sender.sent[0].To)
+		require.Contains(t, sender.sent[0].Text, "https://shop.example/reset?token=")
+	})
+
+	t.Run("unknown address gets nothing", func(t *testing.T) {
+		m, sender := newTestMailer(t)
+		withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(getUser).WithArgs("nobody@example.com").WillReturnRows(sqlmock.NewRows(userColumns))
+
+			err := s.sendEmailJob(context.Background(), jobs.Job{
+				ID:      1,
+				Kind:    JobSendEmail,
+				Payload: []byte(`{"template":"password_reset","email":"nobody@example.com"}`),
+			})
+			require.NoError(t, err)
+		}, WithMailer(m), WithAuth(cfg))
+
+		require.Empty(t, sender.sent)
+	})
+
+	t.Run("verified address gets nothing", func(t *testing.T) {
+		m, sender := newTestMailer(t)
+		withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(getUser).WithArgs("ada@example.com").
+				WillReturnRows(sqlmock.NewRows(userColumns).AddRow(7, "Ada", "ada@example.com", false, time.Now()))
+
+			err := s.sendEmailJob(context.Background(), jobs.Job{
+				ID:      1,
+				Kind:    JobSendEmail,
+				Payload: []byte(`{"template":"verify_email","email":"ada@example.com"}`),
+			})
+			require.NoError(t, err)
+		}, WithMailer(m), WithAuth(cfg))
+
+		require.Empty(t, sender.sent)
+	})
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
+)
+
+func (s *Server) CreateAddress(ctx context.Context, a *storer.Address) (*storer.Address, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.CreateAddress")
+	defer span.End()
+
+	address, err := s.storer.CreateAddress(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("address created", "address_id", address.ID, "user_id", address.UserID)
+	return address, nil
+}
+
+func (s *Server) GetAddress(ctx context.Context, userID, id int64) (*storer.Address, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.GetAddress")
+	defer span.End()
+
+	return s.storer.GetAddress(ctx, userID, id)
+}
+
+func (s *Server) ListAddresses(ctx context.Context, userID int64) ([]storer.Address, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListAddresses")
+	defer span.End()
+
+	return s.storer.ListAddresses(ctx, userID)
+}
+
+func (s *Server) UpdateAddress(ctx context.Context, a *storer.Address) (*storer.Address, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.UpdateAddress")
+	defer span.End()
+
+	address, err := s.storer.UpdateAddress(ctx, a)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("address updated", "address_id", address.ID, "user_id", address.UserID)
+	return address, nil
+}
+
+func (s *Server) DeleteAddress(ctx context.Context, userID, id int64) error {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.DeleteAddress")
+	defer span.End()
+
+	if err := s.storer.DeleteAddress(ctx, userID, id); err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("address deleted", "address_id", id, "user_id", userID)
+	return nil
+}
+
+// resolveOrderAddresses settles the addresses an order is placed with. An
+// address that only names an AddressID is copied from the user's address
+// book, a missing one falls back to the user's default, and the billing
+// address falls back to the shipping address. The order is taxed and
+// shipped to its shipping address.
+func (s *Server) resolveOrderAddresses(ctx context.Context, o *storer.Order) error {
+	ship, err := s.orderAddress(ctx, o.UserID, storer.AddressShipping, o.ShippingAddress)
+	if err != nil {
+		return err
+	}
+	if ship == nil {
+		return storer.ErrAddressRequired
+	}
+
+	bill, err := s.orderAddress(ctx, o.UserID, storer.AddressBilling, o.BillingAddress)
+	if err != nil {
+		return err
+	}
+	if bill == nil {
+		copied := *ship
+		bill = &copied
+		bill.Kind = storer.AddressBilling
+	}
+
+	o.ShippingAddress, o.BillingAddress = ship, bill
+	o.TaxCountry, o.TaxRegion, o.TaxPostalCode = ship.Country, ship.Region, ship.PostalCode
+	return nil
+}
+
+func (s *Server) orderAddress(ctx context.Context, userID int64, kind string, a *storer.OrderAddress) (*storer.OrderAddress, error) {
+	if a != nil && a.AddressID == nil {
+		a.Kind = kind
+		return a, nil
+	}
+
+	var (
+		entry *storer.Address
+		err   error
+	)
+	if a != nil {
+		entry, err = s.storer.GetAddress(ctx, userID, *a.AddressID)
+		if errors.Is(err, storer.ErrNotFound) {
+			return nil, fmt.Errorf("%s address %d: %w", kind, *a.AddressID, storer.ErrUnknownAddress)
+		}
+	} else {
+		entry, err = s.storer.DefaultAddress(ctx, userID, kind)
+		if errors.Is(err, storer.ErrNotFound) {
+			return nil, nil
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &storer.OrderAddress{
+		Kind:       kind,
+		AddressID:  &entry.ID,
+		Name:       entry.Name,
+		Line1:      entry.Line1,
+		Line2:      entry.Line2,
+		City:       entry.City,
+		Region:     entry.Region,
+		PostalCode: entry.PostalCode,
+		Country:    entry.Country,
+		Phone:      entry.Phone,
+	}, nil
+}
@@ -0,0 +1,89 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveOrderAddresses(t *testing.T) {
+	const (
+		defaultShipping = "SELECT * FROM addresses WHERE user_id=$1 AND is_default_shipping"
+		defaultBilling  = "SELECT * FROM addresses WHERE user_id=$1 AND is_default_billing"
+		getAddress      = "SELECT * FROM addresses WHERE id=$1 AND user_id=$2"
+	)
+	addressColumns := []string{"id", "user_id", "name", "line1", "city", "region", "postal_code", "country"}
+	unknownID := int64(9)
+
+	tsc := []struct {
+		name    string
+		order   storer.Order
+		test    func(mock sqlmock.Sqlmock)
+		err     error
+		country string
+		billing string
+	}{
+		{
+			name:  "default shipping address, billing falls back to it",
+			order: storer.Order{UserID: 4},
+			test: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(defaultShipping).WithArgs(4).WillReturnRows(sqlmock.NewRows(addressColumns).
+					AddRow(2, 4, "Ada", "1 Main St", "Sacramento", "CA", "95814", "US"))
+				mock.ExpectQuery(defaultBilling).WithArgs(4).WillReturnRows(sqlmock.NewRows(addressColumns))
+			},
+			country: "US",
+			billing: "1 Main St",
+		},
+		{
+			name: "address given with the order",
+			order: storer.Order{UserID: 4, ShippingAddress: &storer.OrderAddress{
+				Name: "Ada", Line1: "2 Side St", City: "Berlin", Country: "DE",
+			}},
+			test: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(defaultBilling).WithArgs(4).WillReturnRows(sqlmock.NewRows(addressColumns).
+					AddRow(3, 4, "Ada", "3 Bill St", "Berlin", "", "10115", "DE"))
+			},
+			country: "DE",
+			billing: "3 Bill St",
+		},
+		{
+			name:  "unknown address book entry",
+			order: storer.Order{UserID: 4, ShippingAddress: &storer.OrderAddress{AddressID: &unknownID}},
+			test: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(getAddress).WithArgs(9, 4).WillReturnRows(sqlmock.NewRows(addressColumns))
+			},
+			err: storer.ErrUnknownAddress,
+		},
+		{
+			name:  "no address at all",
+			order: storer.Order{UserID: 4},
+			test: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(defaultShipping).WithArgs(4).WillReturnRows(sqlmock.NewRows(addressColumns))
+			},
+			err: storer.ErrAddressRequired,
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+				tc.test(mock)
+
+				o := tc.order
+				err := s.resolveOrderAddresses(context.Background(), &o)
+				if tc.err != nil {
+					require.ErrorIs(t, err, tc.err)
+					return
+				}
+				require.NoError(t, err)
+				require.Equal(t, tc.country, o.TaxCountry)
+				require.Equal(t, storer.AddressShipping, o.ShippingAddress.Kind)
+				require.Equal(t, storer.AddressBilling, o.BillingAddress.Kind)
+				require.Equal(t, tc.billing, o.BillingAddress.Line1)
+			})
+		})
+	}
+}
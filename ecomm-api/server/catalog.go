@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/catalog"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
+)
+
+// ImportProducts reads products from r and upserts them in batches of
+// batchSize, each batch in its own transaction. Rows that fail to parse,
+// validate or save are collected in the report instead of stopping the import.
+func (s *Server) ImportProducts(ctx context.Context, r catalog.Reader, batchSize int, opts storer.UpsertOptions) (*catalog.Report, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ImportProducts")
+	defer span.End()
+
+	report := &catalog.Report{DryRun: opts.DryRun, Errors: []catalog.RowError{}}
+	batch := make([]catalog.Row, 0, batchSize)
+
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+
+		products := make([]storer.Product, len(batch))
+		for i, row := range batch {
+			products[i] = row.Product
+		}
+
+		results, err := s.storer.UpsertProducts(ctx, products, opts)
+		if err != nil {
+			return err
+		}
+
+		for i, res := range results {
+			switch {
+			case res.Err != nil:
+				report.Failed++
+				report.Errors = append(report.Errors, catalog.RowError{
+					Line:  batch[i].Line,
+					SKU:   batch[i].Product.SKU,
+					Error: res.Err.Error(),
+				})
+			case res.Created:
+				report.Created++
+			default:
+				report.Updated++
+			}
+		}
+
+		batch = batch[:0]
+		return nil
+	}
+
+	for {
+		row, err := r.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return report, err
+		}
+
+		report.Processed++
+		if row.Err != nil {
+			report.Failed++
+			report.Errors = append(report.Errors, catalog.RowError{
+				Line:  row.Line,
+				SKU:   row.Product.SKU,
+				Error: row.Err.Error(),
+			})
+			continue
+		}
+
+		batch = append(batch, row)
+		if len(batch) == batchSize {
+			if err := flush(); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	if err := flush(); err != nil {
+		return report, err
+	}
+
+	logger.FromContext(ctx).Info("products imported",
+		"dry_run", opts.DryRun,
+		"restore", opts.Restore,
+		"processed", report.Processed,
+		"created", report.Created,
+		"updated", report.Updated,
+		"failed", report.Failed,
+	)
+	return report, nil
+}
+
+func (s *Server) ExportProducts(ctx context.Context, w catalog.Writer) error {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ExportProducts")
+	defer span.End()
+
+	if err := s.storer.StreamProducts(ctx, w.Write); err != nil {
+		return err
+	}
+	return w.Flush()
+}
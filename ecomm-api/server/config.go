@@ -0,0 +1,58 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/allocation"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/jobs"
+)
+
+func LoadConfig() (*Config, error) {
+	cfg := &Config{
+		Retention:     30 * 24 * time.Hour,
+		PurgeInterval: time.Hour,
+
+		AllocationStrategy: allocation.StrategyNearest,
+	}
+
+	for _, d := range []struct {
+		env string
+		dst *time.Duration
+	}{
+		{"RETENTION_PERIOD", &cfg.Retention},
+		{"PURGE_INTERVAL", &cfg.PurgeInterval},
+	} {
+		v := os.Getenv(d.env)
+		if v == "" {
+			continue
+		}
+		parsed, err := time.ParseDuration(v)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid %s %q: must be a positive duration", d.env, v)
+		}
+		*d.dst = parsed
+	}
+
+	if v := os.Getenv("PURGE_SCHEDULE"); v != "" {
+		if _, err := jobs.ParseSchedule(v); err != nil {
+			return nil, fmt.Errorf("invalid PURGE_SCHEDULE: %w", err)
+		}
+		cfg.PurgeSchedule = v
+	} else {
+		if cfg.PurgeInterval < time.Second {
+			return nil, fmt.Errorf("invalid PURGE_INTERVAL %q: must be at least 1s", cfg.PurgeInterval)
+		}
+		cfg.PurgeSchedule = "@every " + cfg.PurgeInterval.String()
+	}
+
+	if v := os.Getenv("ALLOCATION_STRATEGY"); v != "" {
+		if _, err := allocation.New(v); err != nil {
+			return nil, err
+		}
+		cfg.AllocationStrategy = v
+	}
+
+	return cfg, nil
+}
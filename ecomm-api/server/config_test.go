@@ -0,0 +1,39 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tsc := []struct {
+		name     string
+		env      map[string]string
+		schedule string
+		err      string
+	}{
+		{name: "default", schedule: "@every 1h0m0s"},
+		{name: "interval", env: map[string]string{"PURGE_INTERVAL": "15m"}, schedule: "@every 15m0s"},
+		{name: "schedule wins", env: map[string]string{"PURGE_INTERVAL": "15m", "PURGE_SCHEDULE": "0 3 * * *"}, schedule: "0 3 * * *"},
+		{name: "bad retention", env: map[string]string{"RETENTION_PERIOD": "soon"}, err: "RETENTION_PERIOD"},
+		{name: "interval under a second", env: map[string]string{"PURGE_INTERVAL": "500ms"}, err: "PURGE_INTERVAL"},
+		{name: "bad schedule", env: map[string]string{"PURGE_SCHEDULE": "* * *"}, err: "PURGE_SCHEDULE"},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			for _, k := range []string{"RETENTION_PERIOD", "PURGE_INTERVAL", "PURGE_SCHEDULE", "ALLOCATION_STRATEGY"} {
+				t.Setenv(k, tc.env[k])
+			}
+
+			cfg, err := LoadConfig()
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.schedule, cfg.PurgeSchedule)
+		})
+	}
+}
@@ -0,0 +1,203 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/email"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/jobs"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/mail"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/outbox"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+)
+
+// emailJob is the payload of a JobSendEmail job. It says what the email is
+// about rather than holding the rendered email, so the job queue keeps no
+// addresses or links; the email is rendered when the job runs.
+type emailJob struct {
+	Template string `json:"template"`
+	UserID   int64  `json:"user_id,omitempty"`
+	OrderID  int64  `json:"order_id,omitempty"`
+	// Email is the address of an account email, whose user is looked up
+	// when it is sent.
+	Email string `json:"email,omitempty"`
+	// Data is what the email shows that is not read back from the
+	// database, such as the amount of a refund.
+	Data json.RawMessage `json:"data,omitempty"`
+}
+
+// emailUser queues the email name for a user as a JobSendEmail job, so that
+// a mail server that is down delays the email rather than failing what
+// triggered it. Failures are logged and otherwise ignored for the same
+// reason.
+func (s *Server) emailUser(ctx context.Context, userID int64, name string, data any) {
+	if s.mailer == nil {
+		return
+	}
+
+	err := func() error {
+		b, err := json.Marshal(data)
+		if err != nil {
+			return fmt.Errorf("failed to encode %s email: %w", name, err)
+		}
+		return s.queueEmail(ctx, emailJob{Template: name, UserID: userID, Data: b}, "")
+	}()
+	if err != nil {
+		logger.FromContext(ctx).Error("failed to queue email", "template", name, "user_id", userID, "error", err)
+	}
+}
+
+func (s *Server) queueEmail(ctx context.Context, ej emailJob, key string) error {
+	payload, err := json.Marshal(ej)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s email: %w", ej.Template, err)
+	}
+
+	_, err = s.storer.EnqueueJob(ctx, jobs.Job{Kind: JobSendEmail, Payload: payload, Key: key})
+	return err
+}
+
+// orderEmailTemplates are the emails sent for order events.
+var orderEmailTemplates = map[string]string{
+	outbox.EventOrderCreated:   email.TemplateOrderConfirmation,
+	outbox.EventOrderShipped:   email.TemplateOrderShipped,
+	outbox.EventOrderCancelled: email.TemplateOrderCancelled,
+}
+
+// OrderEmails returns the outbox.Publisher that emails customers about
+// their orders: when an order is created, shipped or cancelled. Since the
+// emails follow the outbox, they are queued only for changes that were
+// committed, and once per event however often it is published.
+func (s *Server) OrderEmails() outbox.Publisher {
+	return orderEmails{s}
+}
+
+type orderEmails struct {
+	s *Server
+}
+
+func (p orderEmails) Publish(ctx context.Context, e outbox.Event) error {
+	name, ok := orderEmailTemplates[e.Type]
+	if !ok || p.s.mailer == nil {
+		return nil
+	}
+
+	ej := emailJob{Template: name, OrderID: e.AggregateID}
+	if e.Type == outbox.EventOrderShipped {
+		ej.Data = e.Payload
+	}
+	return p.s.queueEmail(ctx, ej, fmt.Sprintf("%s@%d", JobSendEmail, e.ID))
+}
+
+// sendEmailJob renders and sends an email queued by emailUser, OrderEmails
+// or an account email request.
+func (s *Server) sendEmailJob(ctx context.Context, j jobs.Job) error {
+	var ej emailJob
+	if err := json.Unmarshal(j.Payload, &ej); err != nil {
+		return fmt.Errorf("failed to decode email of job %d: %w", j.ID, err)
+	}
+
+	msg, err := s.renderEmail(ctx, ej)
+	if err != nil {
+		return fmt.Errorf("failed to render %s email of job %d: %w", ej.Template, j.ID, err)
+	}
+	if msg == nil {
+		return nil
+	}
+	return s.mailer.Sender.Send(ctx, msg)
+}
+
+// renderEmail renders a queued email, reading the order it is about as it
+// is now. Cancelled orders are soft deleted, so deleted orders are read too.
+// It returns no message when there is nothing to send, such as a password
+// reset for an address without an account.
+func (s *Server) renderEmail(ctx context.Context, ej emailJob) (*mail.Message, error) {
+	userID := ej.UserID
+	var data any
+	switch ej.Template {
+	case email.TemplateOrderConfirmation, email.TemplateOrderCancelled, email.TemplateOrderShipped:
+		o, err := s.storer.GetOrderWithDeleted(ctx, ej.OrderID)
+		if err != nil {
+			return nil, err
+		}
+		eo := s.emailOrder(o)
+		userID, data = o.UserID, eo
+
+		if ej.Template == email.TemplateOrderShipped {
+			var sh struct {
+				Carrier        string `json:"carrier"`
+				TrackingNumber string `json:"tracking_number"`
+				TrackingURL    string `json:"tracking_url"`
+			}
+			if err := json.Unmarshal(ej.Data, &sh); err != nil {
+				return nil, fmt.Errorf("failed to decode shipment: %w", err)
+			}
+			data = email.Shipment{
+				Order:          eo,
+				Carrier:        sh.Carrier,
+				TrackingNumber: sh.TrackingNumber,
+				TrackingURL:    sh.TrackingURL,
+			}
+		}
+	case email.TemplateRefund:
+		var rf email.Refund
+		if err := json.Unmarshal(ej.Data, &rf); err != nil {
+			return nil, fmt.Errorf("failed to decode refund: %w", err)
+		}
+		data = rf
+	case email.TemplateVerifyEmail, email.TemplatePasswordReset:
+		u, data, err := s.accountEmailData(ctx, ej.Template, ej.Email)
+		if err != nil || u == nil {
+			return nil, err
+		}
+		return s.mailer.Render(ej.Template, u.Email, data)
+	default:
+		return nil, fmt.Errorf("unknown email template %q", ej.Template)
+	}
+
+	u, err := s.storer.GetUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return s.mailer.Render(ej.Template, u.Email, data)
+}
+
+func (s *Server) emailOrder(o *storer.Order) email.Order {
+	eo := email.Order{
+		ID:        o.ID,
+		Currency:  s.currency,
+		Discount:  o.DiscountPrice,
+		Shipping:  o.ShippingPrice,
+		Tax:       o.TaxPrice,
+		Total:     o.TotalPrice,
+		CreatedAt: o.CreatedAt,
+	}
+	for _, oi := range o.Items {
+		total := oi.Price * float64(oi.Quantity)
+		eo.Subtotal += total
+		eo.Items = append(eo.Items, email.OrderItem{
+			Name:     oi.Name,
+			Quantity: oi.Quantity,
+			Price:    oi.Price,
+			Total:    total,
+		})
+	}
+
+	if a := o.ShippingAddress; a != nil {
+		for _, line := range []string{
+			a.Name,
+			a.Line1,
+			a.Line2,
+			strings.Join(strings.Fields(fmt.Sprintf("%s %s %s", a.City, a.Region, a.PostalCode)), " "),
+			a.Country,
+		} {
+			if line != "" {
+				eo.ShipTo = append(eo.ShipTo, line)
+			}
+		}
+	}
+	return eo
+}
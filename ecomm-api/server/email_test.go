@@ -0,0 +1,186 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/email"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/jobs"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/mail"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/outbox"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/stretchr/testify/require"
+)
+
+const enqueueJob = `INSERT INTO jobs (kind, payload, key, max_attempts, run_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (key) DO NOTHING
+		RETURNING id`
+
+// fakeSender records the messages it is asked to send.
+type fakeSender struct {
+	sent []*mail.Message
+}
+
+func (f *fakeSender) Send(_ context.Context, m *mail.Message) error {
+	f.sent = append(f.sent, m)
+	return nil
+}
+
+func newTestMailer(t *testing.T) (*email.Mailer, *fakeSender) {
+	sender := &fakeSender{}
+	m, err := email.NewMailer(&email.Config{ShopName: "Teashop"}, sender, "shop@example.com")
+	require.NoError(t, err)
+	return m, sender
+}
+
+func TestEmailOrder(t *testing.T) {
+	created := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	o := &storer.Order{
+		ID:            3,
+		DiscountPrice: 2,
+		ShippingPrice: 5,
+		TaxPrice:      1.5,
+		TotalPrice:    24.5,
+		CreatedAt:     created,
+		Items: []storer.OrderItem{
+			{Name: "Green tea", Quantity: 2, Price: 6},
+			{Name: "Teapot", Quantity: 1, Price: 8},
+		},
+		ShippingAddress: &storer.OrderAddress{
+			Name:       "Ada Lovelace",
+			Line1:      "12 St James's Square",
+			City:       "London",
+			PostalCode: "SW1Y 4JH",
+			Country:    "GB",
+		},
+	}
+
+	withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+		require.Equal(t, email.Order{
+			ID:       3,
+			Currency: "USD",
+			Items: []email.OrderItem{
+				{Name: "Green tea", Quantity: 2, Price: 6, Total: 12},
+				{Name: "Teapot", Quantity: 1, Price: 8, Total: 8},
+			},
+			Subtotal:  20,
+			Discount:  2,
+			Shipping:  5,
+			Tax:       1.5,
+			Total:     24.5,
+			CreatedAt: created,
+			ShipTo:    []string{"Ada Lovelace", "12 St James's Square", "London SW1Y 4JH", "GB"},
+		}, s.emailOrder(o))
+	})
+}
+
+func TestOrderEmails(t *testing.T) {
+	tsc := []struct {
+		name    string
+		event   outbox.Event
+		payload string
+	}{
+		{
+			name:    "created",
+			event:   outbox.Event{ID: 11, Type: outbox.EventOrderCreated, AggregateType: outbox.AggregateOrder, AggregateID: 3},
+			payload: `{"template":"order_confirmation","order_id":3}`,
+		},
+		{
+			name: "shipped",
+			event: outbox.Event{ID: 12, Type: outbox.EventOrderShipped, AggregateType: outbox.AggregateOrder, AggregateID: 3,
+				Payload: json.RawMessage(`{"carrier":"DHL","tracking_number":"JD014600"}`)},
+			payload: `{"template":"order_shipped","order_id":3,"data":{"carrier":"DHL","tracking_number":"JD014600"}}`,
+		},
+		{
+			name:    "cancelled",
+			event:   outbox.Event{ID: 13, Type: outbox.EventOrderCancelled, AggregateType: outbox.AggregateOrder, AggregateID: 3},
+			payload: `{"template":"order_cancelled","order_id":3}`,
+		},
+		{
+			name:  "no email",
+			event: outbox.Event{ID: 14, Type: outbox.EventOrderPaid, AggregateType: outbox.AggregateOrder, AggregateID: 3},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			m, _ := newTestMailer(t)
+			withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+				if tc.payload != "" {
+					// The job is keyed by the event, so an event published
+					// twice is emailed once.
+					mock.ExpectQuery(enqueueJob).
+						WithArgs(JobSendEmail, []byte(tc.payload), "email.send@"+strconv.FormatInt(tc.event.ID, 10), jobs.DefaultMaxAttempts, sqlmock.AnyArg(), sqlmock.AnyArg()).
+						WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				}
+
+				err := s.OrderEmails().Publish(context.Background(), tc.event)
+				require.NoError(t, err)
+			}, WithMailer(m))
+		})
+	}
+}
+
+func TestSendEmailJob(t *testing.T) {
+	now := time.Now()
+
+	t.Run("order shipped", func(t *testing.T) {
+		m, sender := newTestMailer(t)
+		withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+			// The order is read as it is when the job runs, deleted or not.
+			mock.ExpectQuery("SELECT * FROM orders WHERE id=$1").WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "status", "total_price", "created_at"}).
+					AddRow(3, 7, storer.OrderStatusShipped, 12, now))
+			mock.ExpectQuery("SELECT * FROM order_items WHERE order_id=$1").WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "quantity", "price"}).AddRow(1, "Green tea", 2, 6))
+			mock.ExpectQuery("SELECT * FROM order_adjustments WHERE order_id=$1 ORDER BY id").WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectQuery("SELECT * FROM order_addresses WHERE order_id=$1").WithArgs(3).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectQuery("SELECT id, name, email, is_admin, email_verified_at FROM users WHERE id=$1").WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "is_admin", "email_verified_at"}).
+					AddRow(7, "Ada", "ada@example.com", false, nil))
+
+			err := s.sendEmailJob(context.Background(), jobs.Job{
+				ID:      1,
+				Kind:    JobSendEmail,
+				Payload: []byte(`{"template":"order_shipped","order_id":3,"data":{"carrier":"DHL","tracking_number":"JD014600"}}`),
+			})
+			require.NoError(t, err)
+		}, WithMailer(m))
+
+		require.Len(t, sender.sent, 1)
+		require.Equal(t, []string{"ada@example.com"}, sender.sent[0].To)
+		require.Contains(t, sender.sent[0].Subject, "#3")
+		require.Contains(t, sender.sent[0].Text, "JD014600")
+	})
+
+	t.Run("refund", func(t *testing.T) {
+		m, sender := newTestMailer(t)
+		withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(enqueueJob).
+				WithArgs(JobSendEmail, []byte(`{"template":"refund","user_id":7,"data":{"OrderID":3,"Amount":10,"Currency":"USD","Reason":"damaged"}}`),
+					nil, jobs.DefaultMaxAttempts, sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+			s.emailUser(context.Background(), 7, email.TemplateRefund, email.Refund{OrderID: 3, Amount: 10, Currency: "USD", Reason: "damaged"})
+
+			mock.ExpectQuery("SELECT id, name, email, is_admin, email_verified_at FROM users WHERE id=$1").WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "is_admin", "email_verified_at"}).
+					AddRow(7, "Ada", "ada@example.com", false, nil))
+			err := s.sendEmailJob(context.Background(), jobs.Job{
+				ID:      1,
+				Kind:    JobSendEmail,
+				Payload: []byte(`{"template":"refund","user_id":7,"data":{"OrderID":3,"Amount":10,"Currency":"USD","Reason":"damaged"}}`),
+			})
+			require.NoError(t, err)
+		}, WithMailer(m))
+
+		require.Len(t, sender.sent, 1)
+		require.Contains(t, sender.sent[0].Text, "10.00 USD")
+	})
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
+)
+
+func (s *Server) AdjustStock(ctx context.Context, m *storer.StockMovement) (*storer.Product, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.AdjustStock")
+	defer span.End()
+
+	product, err := s.storer.AdjustStock(ctx, m)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("stock adjusted",
+		"product_id", m.ProductID,
+		"warehouse_id", m.WarehouseID,
+		"delta", m.Delta,
+		"reason", m.Reason,
+		"actor", m.Actor,
+	)
+	return product, nil
+}
+
+func (s *Server) ListStockMovements(ctx context.Context, productID int64) ([]storer.StockMovement, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListStockMovements")
+	defer span.End()
+
+	return s.storer.ListStockMovements(ctx, productID)
+}
+
+func (s *Server) ReconcileStock(ctx context.Context) ([]storer.StockReconciliation, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ReconcileStock")
+	defer span.End()
+
+	return s.storer.ReconcileStock(ctx)
+}
+
+func (s *Server) CreateWarehouse(ctx context.Context, w *storer.Warehouse) (*storer.Warehouse, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.CreateWarehouse")
+	defer span.End()
+
+	warehouse, err := s.storer.CreateWarehouse(ctx, w)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("warehouse created", "warehouse_id", warehouse.ID, "code", warehouse.Code)
+	return warehouse, nil
+}
+
+func (s *Server) ListWarehouses(ctx context.Context) ([]storer.Warehouse, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListWarehouses")
+	defer span.End()
+
+	return s.storer.ListWarehouses(ctx)
+}
+
+func (s *Server) ListProductStock(ctx context.Context, productID int64) ([]storer.WarehouseStock, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListProductStock")
+	defer span.End()
+
+	return s.storer.ListProductStock(ctx, productID)
+}
@@ -0,0 +1,24 @@
+package server
+
+import (
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/jobs"
+)
+
+// Kinds of the background jobs the server runs.
+const (
+	JobRetentionPurge = "retention.purge"
+	JobSendEmail      = "email.send"
+	JobStockAlert     = "stock.alert"
+)
+
+// RegisterJobs sets up the server's background jobs on r, including the
+// recurring ones.
+func (s *Server) RegisterJobs(r *jobs.Runner, cfg *Config) error {
+	r.Handle(JobRetentionPurge, s.retentionPurgeJob(cfg.Retention))
+	r.Handle(JobStockAlert, s.stockAlertJob)
+	if s.mailer != nil {
+		r.Handle(JobSendEmail, s.sendEmailJob)
+	}
+
+	return r.Schedule(JobRetentionPurge, cfg.PurgeSchedule)
+}
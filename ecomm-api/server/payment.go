@@ -0,0 +1,217 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/payment"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
+)
+
+// PayOrder charges the order's total to a card. The payment is stored
+// whatever its outcome, so declines show up in the order's history. With
+// capture, an authorized payment is captured straight away and the order
+// becomes paid. An order that already has an authorized or captured payment
+// cannot be paid again.
+func (s *Server) PayOrder(ctx context.Context, orderID int64, card payment.Card, capture bool) (*storer.Payment, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.PayOrder")
+	defer span.End()
+
+	o, err := s.storer.GetOrder(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+	if o.Status != storer.OrderStatusPending {
+		return nil, fmt.Errorf("order %d is %s: %w", o.ID, o.Status, storer.ErrOrderNotPending)
+	}
+	payments, err := s.storer.ListPayments(ctx, o.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range payments {
+		if p.Status == payment.StatusAuthorized || p.Status == payment.StatusCaptured {
+			return nil, fmt.Errorf("order %d has payment %d: %w", o.ID, p.ID, storer.ErrPaymentExists)
+		}
+	}
+
+	res, err := s.payments.Authorize(ctx, payment.AuthorizeRequest{
+		OrderID:  o.ID,
+		Amount:   o.TotalPrice,
+		Currency: s.currency,
+		Card:     card,
+	})
+	if err != nil {
+		tracing.End(span, err)
+		return nil, fmt.Errorf("failed to authorize payment for order %d: %w", o.ID, err)
+	}
+	metrics.Payments.WithLabelValues(res.Status).Inc()
+
+	p, err := s.storer.CreatePayment(ctx, &storer.Payment{
+		OrderID:       o.ID,
+		Provider:      s.payments.Name(),
+		Reference:     res.Reference,
+		Status:        res.Status,
+		Amount:        o.TotalPrice,
+		Currency:      s.currency,
+		CardLast4:     last4(card.Number),
+		RedirectURL:   res.RedirectURL,
+		FailureReason: res.Message,
+	})
+	if errors.Is(err, storer.ErrPaymentExists) || errors.Is(err, storer.ErrOrderNotPending) {
+		// Another attempt paid the order first; let go of the hold on the
+		// card.
+		if _, verr := s.payments.Void(ctx, res.Reference); verr != nil {
+			logger.FromContext(ctx).Error("failed to void payment of an order paid meanwhile",
+				"order_id", o.ID, "reference", res.Reference, "error", verr)
+		}
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("payment authorized", "payment_id", p.ID, "order_id", o.ID, "status", p.Status)
+	if capture && p.Status == payment.StatusAuthorized {
+		return p, s.capturePayment(ctx, p)
+	}
+	return p, nil
+}
+
+func (s *Server) GetPayment(ctx context.Context, id int64) (*storer.Payment, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.GetPayment")
+	defer span.End()
+
+	return s.storer.GetPayment(ctx, id)
+}
+
+func (s *Server) ListPayments(ctx context.Context, orderID int64) ([]storer.Payment, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListPayments")
+	defer span.End()
+
+	return s.storer.ListPayments(ctx, orderID)
+}
+
+// CapturePayment collects an authorized payment in full and marks its order
+// paid.
+func (s *Server) CapturePayment(ctx context.Context, id int64) (*storer.Payment, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.CapturePayment")
+	defer span.End()
+
+	p, err := s.paymentIn(ctx, id, payment.StatusAuthorized)
+	if err != nil {
+		return nil, err
+	}
+	return p, s.capturePayment(ctx, p)
+}
+
+func (s *Server) capturePayment(ctx context.Context, p *storer.Payment) error {
+	res, err := s.payments.Capture(ctx, p.Reference, p.Amount)
+	if err != nil {
+		return gatewayError(p, "capture", err)
+	}
+	metrics.Payments.WithLabelValues(res.Status).Inc()
+
+	p.Status, p.CapturedAmount = res.Status, p.Amount
+	if err := s.storer.UpdatePayment(ctx, p, payment.StatusAuthorized); err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("payment captured", "payment_id", p.ID, "order_id", p.OrderID, "amount", p.CapturedAmount)
+	return nil
+}
+
+// VoidPayment cancels a payment that was authorized, or is waiting for the
+// customer to authenticate it, before any money moves.
+func (s *Server) VoidPayment(ctx context.Context, id int64) (*storer.Payment, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.VoidPayment")
+	defer span.End()
+
+	p, err := s.paymentIn(ctx, id, payment.StatusAuthorized, payment.StatusRequiresAction)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.payments.Void(ctx, p.Reference)
+	if err != nil {
+		return nil, gatewayError(p, "void", err)
+	}
+	metrics.Payments.WithLabelValues(res.Status).Inc()
+
+	from := p.Status
+	p.Status, p.RedirectURL = res.Status, ""
+	if err := s.storer.UpdatePayment(ctx, p, from); err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("payment voided", "payment_id", p.ID, "order_id", p.OrderID)
+	return p, nil
+}
+
+// RefundPayment gives back part or all of a captured payment and records it
+// as a refund of the payment's order.
+func (s *Server) RefundPayment(ctx context.Context, id int64, amount float64) (*storer.Payment, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.RefundPayment")
+	defer span.End()
+
+	p, err := s.paymentIn(ctx, id, payment.StatusCaptured)
+	if err != nil {
+		return nil, err
+	}
+	if left := p.CapturedAmount - p.RefundedAmount; cents(amount) > cents(left) {
+		return nil, fmt.Errorf("refund %.2f of payment %d with %.2f left: %w", amount, p.ID, left, storer.ErrRefundTooLarge)
+	}
+
+	if _, err := s.refundPayment(ctx, p, amount, nil, ""); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// paymentIn loads a payment made through the configured gateway that is in
+// one of the given states.
+func (s *Server) paymentIn(ctx context.Context, id int64, states ...string) (*storer.Payment, error) {
+	p, err := s.storer.GetPayment(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if p.Provider != s.payments.Name() {
+		return nil, fmt.Errorf("payment %d was made with %s, not %s", p.ID, p.Provider, s.payments.Name())
+	}
+	for _, st := range states {
+		if p.Status == st {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("payment %d is %s: %w", p.ID, p.Status, storer.ErrPaymentState)
+}
+
+// gatewayError maps the gateway's state errors to storer.ErrPaymentState,
+// since the gateway and our records disagree about the payment.
+func gatewayError(p *storer.Payment, op string, err error) error {
+	if errors.Is(err, payment.ErrInvalidState) || errors.Is(err, payment.ErrInvalidAmount) {
+		return fmt.Errorf("failed to %s payment %d: %w: %w", op, p.ID, storer.ErrPaymentState, err)
+	}
+	return fmt.Errorf("failed to %s payment %d: %w", op, p.ID, err)
+}
+
+func last4(number string) string {
+	var digits []rune
+	for _, r := range number {
+		if r >= '0' && r <= '9' {
+			digits = append(digits, r)
+		}
+	}
+	if len(digits) < 4 {
+		return ""
+	}
+	return string(digits[len(digits)-4:])
+}
+
+func cents(v float64) int64 {
+	return int64(math.Round(v * 100))
+}
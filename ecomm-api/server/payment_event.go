@@ -0,0 +1,193 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/payment"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
+)
+
+// HandlePaymentEvent records a webhook body from the payment provider and
+// applies it to the payment it refers to. The body must already have been
+// verified. Events that were already processed return
+// storer.ErrDuplicateEvent and change nothing.
+func (s *Server) HandlePaymentEvent(ctx context.Context, body []byte) (*storer.PaymentEvent, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.HandlePaymentEvent")
+	defer span.End()
+
+	e, err := payment.ParseEvent(body)
+	if err != nil {
+		return nil, err
+	}
+
+	pe, err := s.storer.RecordPaymentEvent(ctx, &storer.PaymentEvent{
+		Provider:  s.payments.Name(),
+		EventID:   e.ID,
+		Type:      e.Type,
+		Reference: e.Data.Reference,
+		Payload:   body,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return pe, s.processPaymentEvent(ctx, pe, e)
+}
+
+// ReplayPaymentEvent applies a stored webhook event again, whether or not
+// it was processed before. Applying an event is idempotent, so replaying
+// one that already took effect changes nothing.
+func (s *Server) ReplayPaymentEvent(ctx context.Context, id int64) (*storer.PaymentEvent, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ReplayPaymentEvent")
+	defer span.End()
+
+	pe, err := s.storer.GetPaymentEvent(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	e, err := payment.ParseEvent(pe.Payload)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("replaying payment event", "event_id", pe.EventID)
+	return pe, s.processPaymentEvent(ctx, pe, e)
+}
+
+func (s *Server) ListPaymentEvents(ctx context.Context, unprocessed bool, limit int) ([]storer.PaymentEvent, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListPaymentEvents")
+	defer span.End()
+
+	return s.storer.ListPaymentEvents(ctx, unprocessed, limit)
+}
+
+func (s *Server) processPaymentEvent(ctx context.Context, pe *storer.PaymentEvent, e *payment.Event) error {
+	applyErr := s.applyPaymentEvent(ctx, e)
+	if err := s.storer.FinishPaymentEvent(ctx, pe, applyErr); err != nil {
+		return err
+	}
+	return applyErr
+}
+
+// applyPaymentEvent moves the payment to the state the event reports. An
+// event the payment has already moved past is ignored, so events may arrive
+// more than once and out of order.
+func (s *Server) applyPaymentEvent(ctx context.Context, e *payment.Event) error {
+	if e.Type == payment.EventRefunded {
+		return s.applyRefundEvent(ctx, e)
+	}
+
+	for attempt := 1; ; attempt++ {
+		p, err := s.storer.GetPaymentByReference(ctx, s.payments.Name(), e.Data.Reference)
+		if err != nil {
+			return err
+		}
+
+		from := p.Status
+		changed, err := eventUpdate(p, e)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			logger.FromContext(ctx).Info("payment event ignored", "event_id", e.ID, "payment_id", p.ID, "status", p.Status)
+			return nil
+		}
+
+		// Another request may have changed the payment since it was read;
+		// read it again and see whether the event still applies.
+		err = s.storer.UpdatePayment(ctx, p, from)
+		if errors.Is(err, storer.ErrPaymentState) && attempt < 3 {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		metrics.Payments.WithLabelValues(p.Status).Inc()
+		logger.FromContext(ctx).Info("payment event applied", "event_id", e.ID, "payment_id", p.ID, "from", from, "to", p.Status)
+		return nil
+	}
+}
+
+// applyRefundEvent records the part of a refund event not recorded yet.
+// Refunds made through the API are recorded when they are made, so their
+// events change nothing; refunds made at the provider become refund records
+// like any other.
+func (s *Server) applyRefundEvent(ctx context.Context, e *payment.Event) error {
+	p, err := s.storer.GetPaymentByReference(ctx, s.payments.Name(), e.Data.Reference)
+	if err != nil {
+		return err
+	}
+
+	total := e.Data.AmountRefunded
+	if p.Status != payment.StatusCaptured || cents(total) <= cents(p.RefundedAmount) {
+		logger.FromContext(ctx).Info("payment event ignored", "event_id", e.ID, "payment_id", p.ID, "status", p.Status)
+		return nil
+	}
+	if cents(total) > cents(p.CapturedAmount) {
+		return fmt.Errorf("event %s refunds %.2f of payment %d with %.2f captured: %w", e.ID, total, p.ID, p.CapturedAmount, payment.ErrInvalidEvent)
+	}
+
+	rf, err := s.storer.RecordRefund(ctx, &storer.Refund{
+		Amount:    float64(cents(total)-cents(p.RefundedAmount)) / 100,
+		Reason:    "refunded at " + p.Provider,
+		Reference: e.ID,
+	}, p)
+	if err != nil {
+		return err
+	}
+
+	metrics.Payments.WithLabelValues(p.Status).Inc()
+	logger.FromContext(ctx).Info("payment event applied", "event_id", e.ID, "payment_id", p.ID, "refund_id", rf.ID, "amount", rf.Amount)
+	return nil
+}
+
+// eventUpdate applies e to p and reports whether p changed.
+func eventUpdate(p *storer.Payment, e *payment.Event) (bool, error) {
+	in := func(states ...string) bool {
+		for _, st := range states {
+			if p.Status == st {
+				return true
+			}
+		}
+		return false
+	}
+
+	switch e.Type {
+	case payment.EventAuthorized:
+		if !in(payment.StatusRequiresAction) {
+			return false, nil
+		}
+		p.Status, p.RedirectURL = payment.StatusAuthorized, ""
+	case payment.EventDeclined:
+		if !in(payment.StatusRequiresAction) {
+			return false, nil
+		}
+		p.Status, p.RedirectURL, p.FailureReason = payment.StatusDeclined, "", e.Data.Message
+	case payment.EventVoided:
+		if !in(payment.StatusRequiresAction, payment.StatusAuthorized) {
+			return false, nil
+		}
+		p.Status, p.RedirectURL = payment.StatusVoided, ""
+	case payment.EventCaptured:
+		if !in(payment.StatusRequiresAction, payment.StatusAuthorized) {
+			return false, nil
+		}
+		amount := e.Data.Amount
+		if amount == 0 {
+			amount = p.Amount
+		}
+		if amount < 0 || cents(amount) > cents(p.Amount) {
+			return false, fmt.Errorf("event %s captures %.2f of payment %d for %.2f: %w", e.ID, amount, p.ID, p.Amount, payment.ErrInvalidEvent)
+		}
+		p.Status, p.RedirectURL, p.CapturedAmount = payment.StatusCaptured, "", amount
+	default:
+		return false, fmt.Errorf("event %s has unknown type %q: %w", e.ID, e.Type, payment.ErrInvalidEvent)
+	}
+	return true, nil
+}
@@ -0,0 +1,142 @@
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/outbox"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/payment"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPayOrder(t *testing.T) {
+	expectOrder := func(mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT * FROM orders WHERE id=$1 AND deleted_at IS NULL").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "status", "total_price"}).AddRow(7, storer.OrderStatusPending, 20))
+		mock.ExpectQuery("SELECT * FROM order_items WHERE order_id=$1").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT * FROM order_adjustments WHERE order_id=$1 ORDER BY id").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT * FROM order_addresses WHERE order_id=$1").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	}
+	expectPayments := func(mock sqlmock.Sqlmock, statuses ...string) {
+		mock.ExpectQuery("SELECT EXISTS (SELECT 1 FROM orders WHERE id=$1 AND deleted_at IS NULL)").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		rows := sqlmock.NewRows([]string{"id", "order_id", "status"})
+		for i, st := range statuses {
+			rows.AddRow(i+1, 7, st)
+		}
+		mock.ExpectQuery("SELECT * FROM payments WHERE order_id=$1 ORDER BY id").WithArgs(7).WillReturnRows(rows)
+	}
+	card := payment.Card{Number: payment.TestCardSuccess, ExpMonth: 12, ExpYear: 2099}
+
+	t.Run("order with an authorized payment", func(t *testing.T) {
+		gw := payment.NewFakeGateway()
+		withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+			expectOrder(mock)
+			expectPayments(mock, payment.StatusDeclined, payment.StatusAuthorized)
+
+			_, err := s.PayOrder(context.Background(), 7, card, false)
+			require.ErrorIs(t, err, storer.ErrPaymentExists)
+		}, WithPaymentGateway(gw, "USD"))
+
+		// Nothing was authorized at the gateway.
+		_, err := gw.Void(context.Background(), "fake_1")
+		require.ErrorIs(t, err, payment.ErrUnknownReference)
+	})
+
+	t.Run("order paid by another attempt meanwhile", func(t *testing.T) {
+		gw := payment.NewFakeGateway()
+		withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+			expectOrder(mock)
+			expectPayments(mock, payment.StatusDeclined)
+			mock.ExpectBegin()
+			mock.ExpectQuery("SELECT status FROM orders WHERE id=$1 AND deleted_at IS NULL FOR UPDATE").WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(storer.OrderStatusPending))
+			mock.ExpectQuery("SELECT EXISTS (SELECT 1 FROM payments WHERE order_id=$1 AND status = ANY($2))").
+				WithArgs(7, []string{payment.StatusAuthorized, payment.StatusCaptured}).
+				WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+			mock.ExpectRollback()
+
+			_, err := s.PayOrder(context.Background(), 7, card, false)
+			require.ErrorIs(t, err, storer.ErrPaymentExists)
+		}, WithPaymentGateway(gw, "USD"))
+
+		// The losing authorization was voided.
+		_, err := gw.Void(context.Background(), "fake_1")
+		require.ErrorIs(t, err, payment.ErrInvalidState)
+	})
+}
+
+func TestDeleteOrderVoidsAuthorizations(t *testing.T) {
+	const lock = "SELECT status FROM orders WHERE id=$1 AND deleted_at IS NULL FOR UPDATE"
+	expectPayments := func(mock sqlmock.Sqlmock, status string) {
+		mock.ExpectQuery("SELECT EXISTS (SELECT 1 FROM orders WHERE id=$1 AND deleted_at IS NULL)").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		mock.ExpectQuery("SELECT * FROM payments WHERE order_id=$1 ORDER BY id").WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "provider", "reference", "status"}).
+				AddRow(1, 7, payment.GatewayFake, "fake_1", status))
+	}
+	authorize := func(gw *payment.FakeGateway, number string) {
+		_, err := gw.Authorize(context.Background(), payment.AuthorizeRequest{
+			Amount: 20,
+			Card:   payment.Card{Number: number, ExpMonth: 12, ExpYear: 2099},
+		})
+		require.NoError(t, err)
+	}
+
+	t.Run("pending order", func(t *testing.T) {
+		gw := payment.NewFakeGateway()
+		authorize(gw, payment.TestCardSuccess)
+		withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+			expectPayments(mock, payment.StatusAuthorized)
+			mock.ExpectBegin()
+			mock.ExpectQuery(lock).WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(storer.OrderStatusPending))
+			mock.ExpectQuery("SELECT * FROM order_items WHERE order_id=$1").WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}))
+			mock.ExpectQuery("DELETE FROM promotion_redemptions WHERE order_id=$1 RETURNING promotion_id").WithArgs(7).
+				WillReturnRows(sqlmock.NewRows([]string{"promotion_id"}))
+			mock.ExpectExec(`INSERT INTO outbox_events (aggregate_type, aggregate_id, type, payload, created_at, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $5)`).
+				WithArgs(outbox.AggregateOrder, 7, outbox.EventOrderCancelled, sqlmock.AnyArg(), sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE orders SET status=$1, deleted_at=$2, updated_at=$2 WHERE id=$3").
+				WithArgs(storer.OrderStatusCancelled, sqlmock.AnyArg(), 7).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			mock.ExpectQuery("SELECT * FROM payments WHERE id=$1").WithArgs(1).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "provider", "reference", "status"}).
+					AddRow(1, 7, payment.GatewayFake, "fake_1", payment.StatusAuthorized))
+			mock.ExpectBegin()
+			mock.ExpectExec(`UPDATE payments SET
+				status=$1, captured_amount=$2, refunded_amount=$3, redirect_url=$4, failure_reason=$5, updated_at=$6
+			WHERE id=$7 AND status=$8`).
+				WithArgs(payment.StatusVoided, 0.0, 0.0, "", sqlmock.AnyArg(), sqlmock.AnyArg(), 1, payment.StatusAuthorized).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectCommit()
+
+			err := s.DeleteOrder(context.Background(), 7)
+			require.NoError(t, err)
+		}, WithPaymentGateway(gw, "USD"))
+
+		// The authorization was voided at the gateway.
+		_, err := gw.Void(context.Background(), "fake_1")
+		require.ErrorIs(t, err, payment.ErrInvalidState)
+	})
+
+	t.Run("paid order", func(t *testing.T) {
+		gw := payment.NewFakeGateway()
+		withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+			expectPayments(mock, payment.StatusCaptured)
+			mock.ExpectBegin()
+			mock.ExpectQuery(lock).WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(storer.OrderStatusPaid))
+			mock.ExpectRollback()
+
+			err := s.DeleteOrder(context.Background(), 7)
+			require.ErrorIs(t, err, storer.ErrOrderPaid)
+		}, WithPaymentGateway(gw, "USD"))
+	})
+}
@@ -0,0 +1,119 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/shipping"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tax"
+)
+
+// orderProducts loads the catalogue entry of each item, in the same order.
+func (s *Server) orderProducts(ctx context.Context, items []storer.OrderItem) ([]*storer.Product, error) {
+	ids := make([]int64, len(items))
+	for i, oi := range items {
+		ids[i] = oi.ProductID
+	}
+	found, err := s.storer.GetProducts(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[int64]*storer.Product, len(found))
+	for i := range found {
+		byID[found[i].ID] = &found[i]
+	}
+	products := make([]*storer.Product, len(items))
+	for i, oi := range items {
+		p, ok := byID[oi.ProductID]
+		if !ok {
+			return nil, fmt.Errorf("product %d: %w", oi.ProductID, storer.ErrUnknownProduct)
+		}
+		products[i] = p
+	}
+	return products, nil
+}
+
+// priceItemEdits calculates the tax on the new quantities of an order
+// update, for the address the order was taxed for when it was created, and
+// requotes shipping for the items the order will hold.
+func (s *Server) priceItemEdits(ctx context.Context, u *storer.OrderUpdate) error {
+	if len(u.Items) == 0 {
+		return nil
+	}
+
+	o, err := s.storer.GetOrder(ctx, u.OrderID)
+	if err != nil {
+		return err
+	}
+
+	var (
+		edited []storer.OrderItem
+		// after is every product of the order with its quantity once the
+		// edits are applied.
+		after []storer.OrderItem
+		index = map[int64]int{}
+	)
+	for _, oi := range o.Items {
+		if i, ok := index[oi.ProductID]; ok {
+			after[i].Quantity += oi.Quantity
+			continue
+		}
+		index[oi.ProductID] = len(after)
+		after = append(after, storer.OrderItem{ProductID: oi.ProductID, Quantity: oi.Quantity})
+	}
+	for _, e := range u.Items {
+		if e.Quantity > 0 {
+			edited = append(edited, storer.OrderItem{ProductID: e.ProductID, Quantity: e.Quantity})
+		}
+		if i, ok := index[e.ProductID]; ok {
+			after[i].Quantity = e.Quantity
+			continue
+		}
+		index[e.ProductID] = len(after)
+		after = append(after, storer.OrderItem{ProductID: e.ProductID, Quantity: e.Quantity})
+	}
+
+	if len(edited) > 0 {
+		products, err := s.orderProducts(ctx, edited)
+		if err != nil {
+			return err
+		}
+		addr := tax.Address{Country: o.TaxCountry, Region: o.TaxRegion, PostalCode: o.TaxPostalCode}
+		if _, err := s.taxItems(ctx, addr, edited, products); err != nil {
+			return err
+		}
+
+		for i, j := 0, 0; i < len(u.Items); i++ {
+			if u.Items[i].Quantity > 0 {
+				u.Items[i].TaxRate = edited[j].TaxRate
+				u.Items[i].TaxAmount = edited[j].TaxAmount
+				j++
+			}
+		}
+	}
+
+	// Orders placed before shipping methods existed keep their price.
+	if o.ShippingMethod == "" {
+		return nil
+	}
+
+	var remaining []storer.OrderItem
+	for _, oi := range after {
+		if oi.Quantity > 0 {
+			remaining = append(remaining, oi)
+		}
+	}
+	products, err := s.orderProducts(ctx, remaining)
+	if err != nil {
+		return err
+	}
+	dest := shipping.Destination{Country: o.TaxCountry, Region: o.TaxRegion}
+	price, err := s.quoteShipping(ctx, dest, o.ShippingMethod, remaining, products)
+	if err != nil {
+		return err
+	}
+	u.ShippingPrice = &price
+	return nil
+}
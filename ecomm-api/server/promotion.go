@@ -0,0 +1,48 @@
+package server
+
+import (
+	"context"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
+)
+
+func (s *Server) CreatePromotion(ctx context.Context, p *storer.Promotion) (*storer.Promotion, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.CreatePromotion")
+	defer span.End()
+
+	promotion, err := s.storer.CreatePromotion(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("promotion created", "promotion_id", promotion.ID, "code", promotion.Code)
+	return promotion, nil
+}
+
+func (s *Server) GetPromotion(ctx context.Context, id int64) (*storer.Promotion, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.GetPromotion")
+	defer span.End()
+
+	return s.storer.GetPromotion(ctx, id)
+}
+
+func (s *Server) ListPromotions(ctx context.Context) ([]storer.Promotion, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListPromotions")
+	defer span.End()
+
+	return s.storer.ListPromotions(ctx)
+}
+
+func (s *Server) DeactivatePromotion(ctx context.Context, id int64) error {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.DeactivatePromotion")
+	defer span.End()
+
+	if err := s.storer.DeactivatePromotion(ctx, id); err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("promotion deactivated", "promotion_id", id)
+	return nil
+}
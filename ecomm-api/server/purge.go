@@ -0,0 +1,29 @@
+package server
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/jobs"
+)
+
+// purgeDeleted hard deletes records that have been soft deleted for longer
+// than retention. It runs as the JobRetentionPurge job.
+func (s *Server) purgeDeleted(ctx context.Context, retention time.Duration) error {
+	products, orders, err := s.storer.PurgeDeleted(ctx, time.Now().Add(-retention))
+	if err != nil {
+		// Already logged by the storer; the job is retried.
+		return err
+	}
+	if products > 0 || orders > 0 {
+		slog.Info("purged soft deleted records", "products", products, "orders", orders)
+	}
+	return nil
+}
+
+func (s *Server) retentionPurgeJob(retention time.Duration) jobs.Handler {
+	return func(ctx context.Context, _ jobs.Job) error {
+		return s.purgeDeleted(ctx, retention)
+	}
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/email"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/payment"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
+)
+
+// RefundOrder gives back amount of what was paid for an order, taken from
+// its captured payments oldest first.
+func (s *Server) RefundOrder(ctx context.Context, orderID int64, amount float64, reason string) ([]storer.Refund, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.RefundOrder")
+	defer span.End()
+
+	return s.refundOrder(ctx, orderID, nil, amount, reason)
+}
+
+func (s *Server) ListRefunds(ctx context.Context, orderID int64) ([]storer.Refund, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListRefunds")
+	defer span.End()
+
+	if _, err := s.storer.GetOrder(ctx, orderID); err != nil {
+		return nil, err
+	}
+	return s.storer.ListRefunds(ctx, orderID)
+}
+
+// refundOrder spreads a refund over the order's payments. When a payment
+// fails partway, the refunds already made are returned with the error.
+func (s *Server) refundOrder(ctx context.Context, orderID int64, returnID *int64, amount float64, reason string) ([]storer.Refund, error) {
+	payments, err := s.storer.ListPayments(ctx, orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	var refundable []*storer.Payment
+	var available int64
+	for i := range payments {
+		p := &payments[i]
+		if p.Status != payment.StatusCaptured || p.Provider != s.payments.Name() {
+			continue
+		}
+		if left := cents(p.CapturedAmount) - cents(p.RefundedAmount); left > 0 {
+			refundable = append(refundable, p)
+			available += left
+		}
+	}
+	want := cents(amount)
+	if want > available {
+		return nil, fmt.Errorf("refund %.2f of order %d with %.2f refundable: %w", amount, orderID, float64(available)/100, storer.ErrRefundTooLarge)
+	}
+
+	refunds := []storer.Refund{}
+	defer func() {
+		s.emailRefunds(ctx, orderID, refunds, reason)
+	}()
+	for _, p := range refundable {
+		if want == 0 {
+			break
+		}
+		take := min(want, cents(p.CapturedAmount)-cents(p.RefundedAmount))
+		rf, err := s.refundPayment(ctx, p, float64(take)/100, returnID, reason)
+		if err != nil {
+			return refunds, err
+		}
+		refunds = append(refunds, *rf)
+		want -= take
+	}
+
+	return refunds, nil
+}
+
+// emailRefunds tells the customer what was refunded, including when a
+// refund failed partway.
+func (s *Server) emailRefunds(ctx context.Context, orderID int64, refunds []storer.Refund, reason string) {
+	if len(refunds) == 0 || s.mailer == nil {
+		return
+	}
+	o, err := s.storer.GetOrder(ctx, orderID)
+	if err != nil {
+		return
+	}
+
+	var total int64
+	for _, rf := range refunds {
+		total += cents(rf.Amount)
+	}
+	s.emailUser(ctx, o.UserID, email.TemplateRefund, email.Refund{
+		OrderID:  orderID,
+		Amount:   float64(total) / 100,
+		Currency: s.currency,
+		Reason:   reason,
+	})
+}
+
+// refundPayment gives amount of p back through the refunder and records it.
+// The refund is recorded as pending before the refunder is asked, so a
+// crash in between leaves a pending refund to check with the provider
+// rather than money given back that nobody knows about.
+func (s *Server) refundPayment(ctx context.Context, p *storer.Payment, amount float64, returnID *int64, reason string) (*storer.Refund, error) {
+	rf, err := s.storer.BeginRefund(ctx, &storer.Refund{
+		ReturnID: returnID,
+		Amount:   amount,
+		Reason:   reason,
+	}, p)
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := s.refunder().Refund(ctx, p.Reference, amount)
+	if err != nil {
+		if ferr := s.storer.FailRefund(ctx, rf, p); ferr != nil {
+			logger.FromContext(ctx).Error("failed to release refused refund", "refund_id", rf.ID, "payment_id", p.ID, "error", ferr)
+		}
+		return nil, gatewayError(p, "refund", err)
+	}
+	metrics.Payments.WithLabelValues(res.Status).Inc()
+
+	rf.Reference = res.Reference
+	if err := s.storer.CompleteRefund(ctx, rf); err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("payment refunded", "payment_id", p.ID, "order_id", p.OrderID, "refund_id", rf.ID, "amount", amount)
+	return rf, nil
+}
+
+func (s *Server) refunder() payment.Refunder {
+	if s.refunds != nil {
+		return s.refunds
+	}
+	return s.payments
+}
@@ -0,0 +1,110 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/payment"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRefundPayment(t *testing.T) {
+	const (
+		getPayment    = "SELECT * FROM payments WHERE id=$1"
+		creditPayment = `UPDATE payments SET
+			refunded_amount = refunded_amount + $1,
+			status = CASE WHEN refunded_amount + $1 >= captured_amount THEN $2 ELSE status END,
+			updated_at = $3
+		WHERE id=$4 AND status=$5 AND refunded_amount + $1 <= captured_amount
+		RETURNING status, refunded_amount, updated_at`
+		insertRefund = `INSERT INTO refunds (order_id, payment_id, return_id, amount, reason, provider, reference, actor, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
+		settleRefund = "UPDATE refunds SET status=$1, reference=$2 WHERE id=$3 AND status=$4"
+	)
+	paymentColumns := []string{"id", "order_id", "provider", "reference", "status", "amount", "captured_amount", "refunded_amount"}
+
+	// expectBegin expects the pending refund to be recorded before the
+	// gateway is asked.
+	expectBegin := func(mock sqlmock.Sqlmock, reference string) {
+		mock.ExpectQuery(getPayment).WithArgs(5).WillReturnRows(sqlmock.NewRows(paymentColumns).
+			AddRow(5, 9, payment.GatewayFake, reference, payment.StatusCaptured, 30, 30, 0))
+		mock.ExpectBegin()
+		mock.ExpectQuery(creditPayment).WithArgs(10.0, payment.StatusRefunded, sqlmock.AnyArg(), 5, payment.StatusCaptured).
+			WillReturnRows(sqlmock.NewRows([]string{"status", "refunded_amount", "updated_at"}).AddRow(payment.StatusCaptured, 10, time.Now()))
+		mock.ExpectQuery(insertRefund).
+			WithArgs(9, 5, nil, 10.0, "", payment.GatewayFake, "", "system", storer.RefundStatusPending, sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+		mock.ExpectCommit()
+	}
+
+	t.Run("refund made", func(t *testing.T) {
+		gw := payment.NewFakeGateway()
+		res, err := gw.Authorize(context.Background(), payment.AuthorizeRequest{
+			Amount: 30,
+			Card:   payment.Card{Number: payment.TestCardSuccess, ExpMonth: 12, ExpYear: 2099},
+		})
+		require.NoError(t, err)
+		_, err = gw.Capture(context.Background(), res.Reference, 30)
+		require.NoError(t, err)
+
+		withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+			expectBegin(mock, res.Reference)
+			mock.ExpectBegin()
+			mock.ExpectExec(settleRefund).WithArgs(storer.RefundStatusSucceeded, res.Reference, 11, storer.RefundStatusPending).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("UPDATE orders SET refunded_amount = refunded_amount + $1, updated_at=$2 WHERE id=$3").
+				WithArgs(10.0, sqlmock.AnyArg(), 9).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("INSERT INTO order_audit_log (order_id, actor, action, details, created_at) VALUES ($1, $2, $3, $4, $5)").
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+
+			_, err := s.RefundPayment(context.Background(), 5, 10)
+			require.NoError(t, err)
+		}, WithPaymentGateway(gw, "USD"))
+	})
+
+	t.Run("refund refused", func(t *testing.T) {
+		withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+			expectBegin(mock, "fake_unknown")
+			mock.ExpectBegin()
+			mock.ExpectExec(settleRefund).WithArgs(storer.RefundStatusFailed, "", 11, storer.RefundStatusPending).
+				WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(`UPDATE payments SET refunded_amount = refunded_amount - $1, status = $2, updated_at = $3
+			WHERE id=$4
+			RETURNING status, refunded_amount, updated_at`).
+				WithArgs(10.0, payment.StatusCaptured, sqlmock.AnyArg(), 5).
+				WillReturnRows(sqlmock.NewRows([]string{"status", "refunded_amount", "updated_at"}).AddRow(payment.StatusCaptured, 0, time.Now()))
+			mock.ExpectCommit()
+
+			_, err := s.RefundPayment(context.Background(), 5, 10)
+			require.ErrorIs(t, err, payment.ErrUnknownReference)
+		})
+	})
+}
+
+func TestApproveReturnCapsRefund(t *testing.T) {
+	withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT * FROM returns WHERE id=$1").WithArgs(4).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "status"}).AddRow(4, 9, storer.ReturnStatusRequested))
+		mock.ExpectQuery("SELECT * FROM return_items WHERE return_id = ANY($1) ORDER BY id").WithArgs([]int64{4}).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "return_id", "order_item_id", "quantity"}).AddRow(1, 4, 20, 1))
+		mock.ExpectQuery("SELECT * FROM orders WHERE id=$1 AND deleted_at IS NULL").WithArgs(9).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "status", "total_price", "tax_inclusive"}).AddRow(9, storer.OrderStatusPaid, 50, true))
+		mock.ExpectQuery("SELECT * FROM order_items WHERE order_id=$1").WithArgs(9).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "order_id", "price", "quantity"}).AddRow(20, 9, 25, 2))
+		mock.ExpectQuery("SELECT * FROM order_adjustments WHERE order_id=$1 ORDER BY id").WithArgs(9).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+		mock.ExpectQuery("SELECT * FROM order_addresses WHERE order_id=$1").WithArgs(9).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		// One of two items worth 25 each was returned; the return stays
+		// undecided.
+		amount := 40.0
+		r, _, err := s.ApproveReturn(context.Background(), 4, true, &amount, "")
+		require.ErrorIs(t, err, storer.ErrRefundTooLarge)
+		require.Nil(t, r)
+	})
+}
@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
+)
+
+func (s *Server) CreateReturn(ctx context.Context, r *storer.Return) (*storer.Return, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.CreateReturn")
+	defer span.End()
+
+	r, err := s.storer.CreateReturn(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("return requested", "return_id", r.ID, "order_id", r.OrderID)
+	return r, nil
+}
+
+func (s *Server) GetReturn(ctx context.Context, id int64) (*storer.Return, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.GetReturn")
+	defer span.End()
+
+	return s.storer.GetReturn(ctx, id)
+}
+
+func (s *Server) ListReturns(ctx context.Context, f storer.ReturnFilter) ([]storer.Return, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListReturns")
+	defer span.End()
+
+	if f.OrderID != 0 {
+		if _, err := s.storer.GetOrder(ctx, f.OrderID); err != nil {
+			return nil, err
+		}
+	}
+	return s.storer.ListReturns(ctx, f)
+}
+
+// ApproveReturn accepts a return, restocking its items if asked, and
+// refunds it. The refund is what the returned items were paid, tax included
+// and discounts shared out, or amount if that is less; zero refunds
+// nothing. A larger amount fails with ErrRefundTooLarge before the return
+// is decided. If the refund fails the return stays approved and is returned
+// with the error, so the refund can be made with RefundOrder.
+func (s *Server) ApproveReturn(ctx context.Context, id int64, restock bool, amount *float64, note string) (*storer.Return, []storer.Refund, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ApproveReturn")
+	defer span.End()
+
+	r, err := s.storer.GetReturn(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	o, err := s.storer.GetOrder(ctx, r.OrderID)
+	if err != nil {
+		return nil, nil, err
+	}
+	refund := returnValue(o, r)
+	if amount != nil {
+		if cents(*amount) > cents(refund) {
+			return nil, nil, fmt.Errorf("refund %.2f for return %d worth %.2f: %w", *amount, r.ID, refund, storer.ErrRefundTooLarge)
+		}
+		refund = *amount
+	}
+
+	r, err = s.storer.ApproveReturn(ctx, id, restock, note)
+	if err != nil {
+		return nil, nil, err
+	}
+	logger.FromContext(ctx).Info("return approved", "return_id", r.ID, "order_id", r.OrderID, "restocked", restock)
+
+	if cents(refund) == 0 {
+		return r, []storer.Refund{}, nil
+	}
+
+	refunds, err := s.refundOrder(ctx, r.OrderID, &r.ID, refund, fmt.Sprintf("return %d", r.ID))
+	for _, rf := range refunds {
+		r.RefundedAmount += rf.Amount
+	}
+	return r, refunds, err
+}
+
+func (s *Server) RejectReturn(ctx context.Context, id int64, note string) (*storer.Return, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.RejectReturn")
+	defer span.End()
+
+	r, err := s.storer.RejectReturn(ctx, id, note)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("return rejected", "return_id", r.ID, "order_id", r.OrderID)
+	return r, nil
+}
+
+// returnValue is what the customer paid for the returned items: their price
+// plus any tax on top, less their share of the order's discounts. It never
+// exceeds what is left to refund of the order.
+func returnValue(o *storer.Order, r *storer.Return) float64 {
+	unit := make(map[int64]float64, len(o.Items))
+	var merchandise float64
+	for _, oi := range o.Items {
+		line := oi.Price * float64(oi.Quantity)
+		if !o.TaxInclusive {
+			line += oi.TaxAmount
+		}
+		merchandise += line
+		if oi.Quantity > 0 {
+			unit[oi.ID] = line / float64(oi.Quantity)
+		}
+	}
+	if merchandise <= 0 {
+		return 0
+	}
+
+	var value float64
+	for _, it := range r.Items {
+		value += unit[it.OrderItemID] * float64(it.Quantity)
+	}
+	// Whatever was paid beyond shipping went to the merchandise, so its
+	// ratio to the list value shares out the discounts.
+	if share := (o.TotalPrice - o.ShippingPrice) / merchandise; share < 1 {
+		value *= max(share, 0)
+	}
+
+	left := float64(cents(o.TotalPrice)-cents(o.RefundedAmount)) / 100
+	return float64(cents(min(value, left))) / 100
+}
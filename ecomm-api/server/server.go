@@ -2,50 +2,320 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"time"
 
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/auth"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/email"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/notify"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/payment"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/shipping"
 	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tax"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
 )
 
 type Server struct {
-	storer *storer.PySQLStorer
+	storer   *storer.PySQLStorer
+	notifier notify.Notifier
+	tax      tax.Calculator
+	payments payment.Gateway
+	refunds  payment.Refunder
+	currency string
+	mailer   *email.Mailer
+	auth     *auth.Config
 }
 
-func NewServer(storer *storer.PySQLStorer) *Server {
-	return &Server{storer: storer}
+type Option func(*Server)
+
+// WithNotifier sets where stock alerts go. By default they are logged.
+func WithNotifier(n notify.Notifier) Option {
+	return func(s *Server) {
+		s.notifier = n
+	}
+}
+
+// WithTaxCalculator sets how orders are taxed. By default no tax is charged.
+func WithTaxCalculator(c tax.Calculator) Option {
+	return func(s *Server) {
+		s.tax = c
+	}
+}
+
+// WithPaymentGateway sets the gateway orders are paid through and the
+// currency they are charged in. By default a payment.FakeGateway charges USD.
+func WithPaymentGateway(g payment.Gateway, currency string) Option {
+	return func(s *Server) {
+		s.payments, s.currency = g, currency
+	}
+}
+
+// WithRefunder sends refunds through r instead of the payment gateway, for
+// providers whose refunds have their own API. r must know the gateway's
+// payment references.
+func WithRefunder(r payment.Refunder) Option {
+	return func(s *Server) {
+		s.refunds = r
+	}
+}
+
+// WithMailer emails customers about their orders through m. By default no
+// emails are sent.
+func WithMailer(m *email.Mailer) Option {
+	return func(s *Server) {
+		s.mailer = m
+	}
+}
+
+// WithAuth sets how account emails are verified and passwords reset, and
+// whether checkout needs a verified email. By default it does not.
+func WithAuth(cfg *auth.Config) Option {
+	return func(s *Server) {
+		s.auth = cfg
+	}
+}
+
+func NewServer(storer *storer.PySQLStorer, opts ...Option) *Server {
+	s := &Server{
+		storer:   storer,
+		notifier: notify.LogNotifier{},
+		tax:      &tax.Table{},
+		payments: payment.NewFakeGateway(),
+		currency: "USD",
+		auth: &auth.Config{
+			VerifyEmailTTL:   48 * time.Hour,
+			PasswordResetTTL: time.Hour,
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	storer.OnStockChange(s.onStockChange)
+	return s
 }
 
 func (s *Server) CreateProduct(ctx context.Context, p *storer.Product) (*storer.Product, error) {
-	return s.storer.CreateProduct(ctx, p)
+	ctx, span := tracing.Tracer().Start(ctx, "Server.CreateProduct")
+	defer span.End()
+
+	product, err := s.storer.CreateProduct(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("product created", "product_id", product.ID)
+	return product, nil
 }
 
 func (s *Server) GetProduct(ctx context.Context, id int64) (*storer.Product, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.GetProduct")
+	defer span.End()
+
 	return s.storer.GetProduct(ctx, id)
 }
 
 func (s *Server) ListProducts(ctx context.Context) ([]storer.Product, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListProducts")
+	defer span.End()
+
 	return s.storer.ListProducts(ctx)
 }
 
 func (s *Server) UpdateProduct(ctx context.Context, p *storer.Product) (*storer.Product, error) {
-	return s.storer.UpdateProduct(ctx, p)
+	ctx, span := tracing.Tracer().Start(ctx, "Server.UpdateProduct")
+	defer span.End()
+
+	product, err := s.storer.UpdateProduct(ctx, p)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("product updated", "product_id", product.ID)
+	return product, nil
 }
 
 func (s *Server) DeleteProduct(ctx context.Context, id int64) error {
-	return s.storer.DeleteProduct(ctx, id)
+	ctx, span := tracing.Tracer().Start(ctx, "Server.DeleteProduct")
+	defer span.End()
+
+	if err := s.storer.DeleteProduct(ctx, id); err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("product deleted", "product_id", id)
+	return nil
 }
 
 func (s *Server) CreateOrder(ctx context.Context, o *storer.Order) (*storer.Order, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.CreateOrder")
+	defer span.End()
+
+	order, err := s.createOrder(ctx, o)
+	if err != nil {
+		metrics.FailedCheckouts.Inc()
+		return nil, err
+	}
+
+	metrics.OrdersCreated.Inc()
+	metrics.OrderRevenue.Add(order.TotalPrice)
+
+	logger.FromContext(ctx).Info("order created", "order_id", order.ID, "items", len(order.Items))
+	return order, nil
+}
+
+// createOrder settles the order's addresses and prices its tax and shipping
+// before storing it. Both are worked out on catalogue prices; the storer
+// scales the tax down by the discounts. Items must have a positive quantity,
+// and users who must verify their email first are turned away.
+func (s *Server) createOrder(ctx context.Context, o *storer.Order) (*storer.Order, error) {
+	for _, oi := range o.Items {
+		if oi.Quantity <= 0 {
+			return nil, fmt.Errorf("product %d quantity %d: %w", oi.ProductID, oi.Quantity, storer.ErrInvalidQuantity)
+		}
+	}
+	if err := s.checkVerifiedEmail(ctx, o.UserID); err != nil {
+		return nil, err
+	}
+	if err := s.resolveOrderAddresses(ctx, o); err != nil {
+		return nil, err
+	}
+
+	products, err := s.orderProducts(ctx, o.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	addr := tax.Address{Country: o.TaxCountry, Region: o.TaxRegion, PostalCode: o.TaxPostalCode}
+	inclusive, err := s.taxItems(ctx, addr, o.Items, products)
+	if err != nil {
+		return nil, err
+	}
+	o.TaxInclusive = inclusive
+
+	if o.ShippingMethod == "" {
+		o.ShippingMethod = shipping.MethodStandard
+	}
+	dest := shipping.Destination{Country: o.TaxCountry, Region: o.TaxRegion}
+	o.ShippingPrice, err = s.quoteShipping(ctx, dest, o.ShippingMethod, o.Items, products)
+	if err != nil {
+		return nil, err
+	}
+
 	return s.storer.CreateOrder(ctx, o)
 }
 
 func (s *Server) GetOrder(ctx context.Context, id int64) (*storer.Order, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.GetOrder")
+	defer span.End()
+
 	return s.storer.GetOrder(ctx, id)
 }
 
-func (s *Server) ListOrders(ctx context.Context) ([]storer.Order, error) {
-	return s.storer.ListOrders(ctx)
+func (s *Server) ListOrders(ctx context.Context, f storer.OrderFilter) ([]storer.Order, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListOrders")
+	defer span.End()
+
+	return s.storer.ListOrders(ctx, f)
+}
+
+func (s *Server) UpdateOrder(ctx context.Context, u *storer.OrderUpdate) (*storer.Order, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.UpdateOrder")
+	defer span.End()
+
+	if err := s.priceItemEdits(ctx, u); err != nil {
+		return nil, err
+	}
+
+	order, err := s.storer.UpdateOrder(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("order updated", "order_id", order.ID, "actor", storer.ActorFrom(ctx))
+	return order, nil
 }
 
+// ShipOrder marks a paid order shipped. Its customer is emailed the
+// shipment from the order.shipped event.
+func (s *Server) ShipOrder(ctx context.Context, id int64, sh *storer.Shipment) (*storer.Order, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ShipOrder")
+	defer span.End()
+
+	if err := s.storer.ShipOrder(ctx, id, sh); err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("order shipped", "order_id", id, "carrier", sh.Carrier)
+	return s.storer.GetOrder(ctx, id)
+}
+
+// DeleteOrder cancels or archives an order and voids the authorizations
+// left open on it. Payments are listed first, as a deleted order has none;
+// one captured in between fails since the order is no longer pending.
 func (s *Server) DeleteOrder(ctx context.Context, id int64) error {
-	return s.storer.DeleteOrder(ctx, id)
+	ctx, span := tracing.Tracer().Start(ctx, "Server.DeleteOrder")
+	defer span.End()
+
+	payments, err := s.storer.ListPayments(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := s.storer.DeleteOrder(ctx, id); err != nil {
+		return err
+	}
+
+	log := logger.FromContext(ctx)
+	log.Info("order deleted", "order_id", id)
+
+	for _, p := range payments {
+		if p.Status != payment.StatusAuthorized && p.Status != payment.StatusRequiresAction {
+			continue
+		}
+		// The order is gone either way; an authorization that cannot be
+		// voided lapses at the gateway.
+		if _, err := s.VoidPayment(ctx, p.ID); err != nil {
+			log.Error("failed to void payment of deleted order", "payment_id", p.ID, "order_id", id, "error", err)
+		}
+	}
+	return nil
+}
+
+func (s *Server) ListDeletedProducts(ctx context.Context) ([]storer.Product, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListDeletedProducts")
+	defer span.End()
+
+	return s.storer.ListDeletedProducts(ctx)
+}
+
+func (s *Server) RestoreProduct(ctx context.Context, id int64) error {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.RestoreProduct")
+	defer span.End()
+
+	if err := s.storer.RestoreProduct(ctx, id); err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("product restored", "product_id", id)
+	return nil
+}
+
+func (s *Server) ListDeletedOrders(ctx context.Context) ([]storer.Order, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListDeletedOrders")
+	defer span.End()
+
+	return s.storer.ListDeletedOrders(ctx)
+}
+
+func (s *Server) RestoreOrder(ctx context.Context, id int64) error {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.RestoreOrder")
+	defer span.End()
+
+	if err := s.storer.RestoreOrder(ctx, id); err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("order restored", "order_id", id)
+	return nil
 }
@@ -0,0 +1,51 @@
+package server
+
+import (
+	"context"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/jmoiron/sqlx"
+	"github.com/stretchr/testify/require"
+)
+
+// arrayConverter lets slices through as query arguments, the way the pgx
+// driver accepts them for "= ANY($1)".
+type arrayConverter struct{}
+
+func (arrayConverter) ConvertValue(v any) (driver.Value, error) {
+	switch v := v.(type) {
+	case []int64, []string:
+		return v, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+// withTestServer runs fn against a server backed by a sqlmock database and
+// checks that every expected query ran.
+func withTestServer(t *testing.T, fn func(s *Server, mock sqlmock.Sqlmock), opts ...Option) {
+	mockDB, mock, err := sqlmock.New(
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual),
+		sqlmock.ValueConverterOption(arrayConverter{}),
+	)
+	require.NoError(t, err)
+	defer mockDB.Close()
+
+	st := storer.NewPySQLStorer(sqlx.NewDb(mockDB, "sqlmock"))
+	fn(NewServer(st, opts...), mock)
+	require.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateOrderRejectsNonPositiveQuantities(t *testing.T) {
+	for _, qty := range []int64{0, -5} {
+		withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+			_, err := s.CreateOrder(context.Background(), &storer.Order{
+				UserID: 7,
+				Items:  []storer.OrderItem{{ProductID: 4, Quantity: 2}, {ProductID: 5, Quantity: qty}},
+			})
+			require.ErrorIs(t, err, storer.ErrInvalidQuantity)
+		})
+	}
+}
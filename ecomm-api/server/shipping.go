@@ -0,0 +1,111 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/shipping"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
+)
+
+func (s *Server) ListShippingMethods(ctx context.Context) ([]storer.ShippingMethod, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListShippingMethods")
+	defer span.End()
+
+	return s.storer.ListShippingMethods(ctx)
+}
+
+func (s *Server) CreateShippingZone(ctx context.Context, z *storer.ShippingZone) (*storer.ShippingZone, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.CreateShippingZone")
+	defer span.End()
+
+	zone, err := s.storer.CreateShippingZone(ctx, z)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("shipping zone created", "zone_id", zone.ID, "name", zone.Name)
+	return zone, nil
+}
+
+func (s *Server) ListShippingZones(ctx context.Context) ([]storer.ShippingZone, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListShippingZones")
+	defer span.End()
+
+	return s.storer.ListShippingZones(ctx)
+}
+
+func (s *Server) CreateShippingRate(ctx context.Context, r *storer.ShippingRate) (*storer.ShippingRate, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.CreateShippingRate")
+	defer span.End()
+
+	rate, err := s.storer.CreateShippingRate(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("shipping rate created", "rate_id", rate.ID, "method", rate.Method)
+	return rate, nil
+}
+
+func (s *Server) ListShippingRates(ctx context.Context) ([]storer.ShippingRate, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListShippingRates")
+	defer span.End()
+
+	return s.storer.ListShippingRates(ctx)
+}
+
+// QuoteShipping prices items shipped to dest with every method available
+// there.
+func (s *Server) QuoteShipping(ctx context.Context, dest shipping.Destination, items []storer.OrderItem) ([]shipping.Quote, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.QuoteShipping")
+	defer span.End()
+
+	products, err := s.orderProducts(ctx, items)
+	if err != nil {
+		return nil, err
+	}
+	table, err := s.storer.ShippingTable(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return table.Quotes(shippingCart(dest, items, products)), nil
+}
+
+// quoteShipping prices items shipped to dest with one method.
+func (s *Server) quoteShipping(ctx context.Context, dest shipping.Destination, method string, items []storer.OrderItem, products []*storer.Product) (float64, error) {
+	table, err := s.storer.ShippingTable(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	q, err := table.Quote(shippingCart(dest, items, products), method)
+	if errors.Is(err, shipping.ErrNoRate) {
+		return 0, fmt.Errorf("%w: %w", storer.ErrUnknownShippingMethod, err)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return q.Price, nil
+}
+
+func shippingCart(dest shipping.Destination, items []storer.OrderItem, products []*storer.Product) shipping.Cart {
+	cart := shipping.Cart{Destination: dest}
+	for i, oi := range items {
+		p := products[i]
+		cart.Items = append(cart.Items, shipping.Item{
+			ProductID: p.ID,
+			UnitPrice: p.Price,
+			Quantity:  oi.Quantity,
+			Weight:    p.Weight,
+			Length:    p.Length,
+			Width:     p.Width,
+			Height:    p.Height,
+		})
+	}
+	return cart
+}
@@ -0,0 +1,124 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/jobs"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/notify"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
+)
+
+func (s *Server) CreateStockSubscription(ctx context.Context, productID int64, email string) (*storer.StockSubscription, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.CreateStockSubscription")
+	defer span.End()
+
+	sub, err := s.storer.CreateStockSubscription(ctx, productID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("stock subscription created", "product_id", productID, "subscription_id", sub.ID)
+	return sub, nil
+}
+
+// onStockChange runs after every committed stock change. Notifiers may call
+// out to webhooks or SMTP servers, so each alert is sent by a
+// JobStockAlert job, which is retried if the notifier fails.
+func (s *Server) onStockChange(ctx context.Context, changes []storer.StockChange) {
+	for _, c := range changes {
+		if c.Before > 0 && c.After <= 0 {
+			metrics.StockOuts.Inc()
+		}
+
+		if stockAlertKind(c) == "" {
+			continue
+		}
+		if err := s.queueStockAlert(ctx, c); err != nil {
+			logger.FromContext(ctx).Error("failed to queue stock alert", "product_id", c.ProductID, "error", err)
+		}
+	}
+}
+
+// stockAlertKind tells which alert, if any, a stock change calls for: a
+// low-stock alert when stock falls below the reorder threshold, or
+// back-in-stock notices when a product sold out gets stock again.
+func stockAlertKind(c storer.StockChange) string {
+	switch {
+	case c.ReorderThreshold > 0 && c.Before >= c.ReorderThreshold && c.After < c.ReorderThreshold:
+		return notify.KindLowStock
+	case c.Before <= 0 && c.After > 0:
+		return notify.KindBackInStock
+	}
+	return ""
+}
+
+func (s *Server) queueStockAlert(ctx context.Context, c storer.StockChange) error {
+	payload, err := json.Marshal(c)
+	if err != nil {
+		return fmt.Errorf("failed to encode stock change of product %d: %w", c.ProductID, err)
+	}
+	_, err = s.storer.EnqueueJob(ctx, jobs.Job{Kind: JobStockAlert, Payload: payload})
+	return err
+}
+
+// stockAlertJob sends the alert queued by onStockChange.
+func (s *Server) stockAlertJob(ctx context.Context, j jobs.Job) error {
+	var c storer.StockChange
+	if err := json.Unmarshal(j.Payload, &c); err != nil {
+		return fmt.Errorf("failed to decode stock change of job %d: %w", j.ID, err)
+	}
+
+	switch stockAlertKind(c) {
+	case notify.KindLowStock:
+		return s.notifier.Notify(ctx, notify.Alert{
+			Kind:         notify.KindLowStock,
+			ProductID:    c.ProductID,
+			SKU:          c.SKU,
+			Name:         c.Name,
+			CountInStock: c.After,
+			Threshold:    c.ReorderThreshold,
+		})
+	case notify.KindBackInStock:
+		return s.notifySubscribers(ctx, c)
+	}
+	return nil
+}
+
+// notifySubscribers tells the pending subscribers of a product that it is
+// back in stock. Each subscriber is only marked as notified once their
+// notice went out, so those that failed are tried again with the job.
+func (s *Server) notifySubscribers(ctx context.Context, c storer.StockChange) error {
+	log := logger.FromContext(ctx)
+
+	subs, err := s.storer.ListPendingStockSubscriptions(ctx, c.ProductID)
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, sub := range subs {
+		err := s.notifier.Notify(ctx, notify.Alert{
+			Kind:         notify.KindBackInStock,
+			ProductID:    c.ProductID,
+			SKU:          c.SKU,
+			Name:         c.Name,
+			CountInStock: c.After,
+			Recipient:    sub.Email,
+		})
+		if err != nil {
+			log.Error("failed to send back in stock notice", "product_id", c.ProductID, "subscription_id", sub.ID, "error", err)
+			errs = append(errs, err)
+			continue
+		}
+		if err := s.storer.MarkStockSubscriptionNotified(ctx, sub.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,95 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/jobs"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/notify"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeNotifier records alerts and fails those for the recipients in fail.
+type fakeNotifier struct {
+	sent []notify.Alert
+	fail map[string]bool
+}
+
+func (n *fakeNotifier) Notify(_ context.Context, a notify.Alert) error {
+	if n.fail[a.Recipient] {
+		return errors.New("mail server down")
+	}
+	n.sent = append(n.sent, a)
+	return nil
+}
+
+func TestStockAlertKind(t *testing.T) {
+	tsc := []struct {
+		name   string
+		change storer.StockChange
+		want   string
+	}{
+		{name: "falls below threshold", change: storer.StockChange{Before: 5, After: 4, ReorderThreshold: 5}, want: notify.KindLowStock},
+		{name: "already below threshold", change: storer.StockChange{Before: 4, After: 3, ReorderThreshold: 5}},
+		{name: "stays at threshold", change: storer.StockChange{Before: 6, After: 5, ReorderThreshold: 5}},
+		{name: "no threshold", change: storer.StockChange{Before: 5, After: 0}},
+		{name: "sold out", change: storer.StockChange{Before: 1, After: 0, ReorderThreshold: 1}, want: notify.KindLowStock},
+		{name: "back in stock", change: storer.StockChange{Before: 0, After: 3, ReorderThreshold: 5}, want: notify.KindBackInStock},
+		{name: "restocked", change: storer.StockChange{Before: 2, After: 10, ReorderThreshold: 5}},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			require.Equal(t, tc.want, stockAlertKind(tc.change))
+		})
+	}
+}
+
+func TestStockAlertJobBackInStock(t *testing.T) {
+	n := &fakeNotifier{fail: map[string]bool{"bob@example.com": true}}
+
+	withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+		mock.ExpectQuery("SELECT * FROM stock_subscriptions WHERE product_id=$1 AND notified_at IS NULL ORDER BY id").
+			WithArgs(9).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "product_id", "email", "created_at", "notified_at"}).
+				AddRow(1, 9, "ada@example.com", time.Now(), nil).
+				AddRow(2, 9, "bob@example.com", time.Now(), nil))
+		// Only the subscriber who was told is marked; bob stays pending.
+		mock.ExpectExec("UPDATE stock_subscriptions SET notified_at=$1 WHERE id=$2 AND notified_at IS NULL").
+			WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		payload, err := json.Marshal(storer.StockChange{ProductID: 9, SKU: "MUG-1", Before: 0, After: 3})
+		require.NoError(t, err)
+
+		err = s.stockAlertJob(context.Background(), jobs.Job{ID: 1, Kind: JobStockAlert, Payload: payload})
+		require.Error(t, err)
+		require.Len(t, n.sent, 1)
+		require.Equal(t, "ada@example.com", n.sent[0].Recipient)
+	}, WithNotifier(n))
+}
+
+func TestOnStockChangeQueuesAlerts(t *testing.T) {
+	withTestServer(t, func(s *Server, mock sqlmock.Sqlmock) {
+		low := storer.StockChange{ProductID: 9, Before: 5, After: 4, ReorderThreshold: 5}
+		payload, err := json.Marshal(low)
+		require.NoError(t, err)
+
+		mock.ExpectQuery(`INSERT INTO jobs (kind, payload, key, max_attempts, run_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (key) DO NOTHING
+		RETURNING id`).
+			WithArgs(JobStockAlert, payload, nil, jobs.DefaultMaxAttempts, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+
+		// Only the change that crosses the threshold is queued.
+		s.onStockChange(context.Background(), []storer.StockChange{
+			low,
+			{ProductID: 10, Before: 20, After: 19, ReorderThreshold: 5},
+		})
+	})
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tax"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
+)
+
+// taxItems calculates the tax on items shipped to addr at catalogue prices
+// and stores it on each item. It reports whether prices include the tax.
+func (s *Server) taxItems(ctx context.Context, addr tax.Address, items []storer.OrderItem, products []*storer.Product) (bool, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.taxItems")
+	defer span.End()
+
+	req := tax.Request{Address: addr}
+	for i, oi := range items {
+		req.Lines = append(req.Lines, tax.Line{
+			ProductID: products[i].ID,
+			Category:  products[i].TaxCategory,
+			UnitPrice: products[i].Price,
+			Quantity:  oi.Quantity,
+		})
+	}
+
+	res, err := s.tax.Calculate(ctx, req)
+	if err != nil {
+		tracing.End(span, err)
+		return false, fmt.Errorf("failed to calculate tax: %w", err)
+	}
+
+	for i := range items {
+		items[i].TaxRate = res.Lines[i].Rate
+		items[i].TaxAmount = res.Lines[i].Amount
+	}
+	return res.Inclusive, nil
+}
@@ -0,0 +1,15 @@
+package server
+
+import "time"
+
+type Config struct {
+	Retention     time.Duration
+	PurgeInterval time.Duration
+	// PurgeSchedule is when soft deleted records past Retention are purged,
+	// as a cron expression; see jobs.ParseSchedule. LoadConfig makes it
+	// "@every PurgeInterval" when PURGE_SCHEDULE is not set.
+	PurgeSchedule string
+	// AllocationStrategy picks the warehouses that fulfil order items:
+	// nearest, most_stock or split.
+	AllocationStrategy string
+}
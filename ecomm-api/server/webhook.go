@@ -0,0 +1,115 @@
+package server
+
+import (
+	"context"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/storer"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/tracing"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/webhook"
+)
+
+// CreateWebhookSubscription subscribes a URL to events, generating its
+// signing secret unless one is given.
+func (s *Server) CreateWebhookSubscription(ctx context.Context, sub *storer.WebhookSubscription) (*storer.WebhookSubscription, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.CreateWebhookSubscription")
+	defer span.End()
+
+	if sub.Secret == "" {
+		secret, err := webhook.NewSecret()
+		if err != nil {
+			return nil, err
+		}
+		sub.Secret = secret
+	}
+
+	sub, err := s.storer.CreateWebhookSubscription(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("webhook subscription created", "subscription_id", sub.ID, "events", sub.EventTypes)
+	return sub, nil
+}
+
+func (s *Server) GetWebhookSubscription(ctx context.Context, id int64) (*storer.WebhookSubscription, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.GetWebhookSubscription")
+	defer span.End()
+
+	return s.storer.GetWebhookSubscription(ctx, id)
+}
+
+func (s *Server) ListWebhookSubscriptions(ctx context.Context) ([]storer.WebhookSubscription, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListWebhookSubscriptions")
+	defer span.End()
+
+	return s.storer.ListWebhookSubscriptions(ctx)
+}
+
+// UpdateWebhookSubscription replaces a subscription's settings. An empty
+// secret keeps the current one.
+func (s *Server) UpdateWebhookSubscription(ctx context.Context, sub *storer.WebhookSubscription) (*storer.WebhookSubscription, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.UpdateWebhookSubscription")
+	defer span.End()
+
+	if sub.Secret == "" {
+		current, err := s.storer.GetWebhookSubscription(ctx, sub.ID)
+		if err != nil {
+			return nil, err
+		}
+		sub.Secret = current.Secret
+	}
+
+	sub, err := s.storer.UpdateWebhookSubscription(ctx, sub)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("webhook subscription updated", "subscription_id", sub.ID, "active", sub.Active)
+	return sub, nil
+}
+
+func (s *Server) DeleteWebhookSubscription(ctx context.Context, id int64) error {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.DeleteWebhookSubscription")
+	defer span.End()
+
+	if err := s.storer.DeleteWebhookSubscription(ctx, id); err != nil {
+		return err
+	}
+
+	logger.FromContext(ctx).Info("webhook subscription deleted", "subscription_id", id)
+	return nil
+}
+
+func (s *Server) ListWebhookDeliveries(ctx context.Context, f storer.WebhookDeliveryFilter) ([]storer.WebhookDelivery, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.ListWebhookDeliveries")
+	defer span.End()
+
+	if f.SubscriptionID != 0 {
+		if _, err := s.storer.GetWebhookSubscription(ctx, f.SubscriptionID); err != nil {
+			return nil, err
+		}
+	}
+	return s.storer.ListWebhookDeliveries(ctx, f)
+}
+
+func (s *Server) GetWebhookDelivery(ctx context.Context, id int64) (*storer.WebhookDelivery, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.GetWebhookDelivery")
+	defer span.End()
+
+	return s.storer.GetWebhookDelivery(ctx, id)
+}
+
+// RedeliverWebhook queues a delivery to be sent again, including one that
+// is dead, and returns it.
+func (s *Server) RedeliverWebhook(ctx context.Context, id int64) (*storer.WebhookDelivery, error) {
+	ctx, span := tracing.Tracer().Start(ctx, "Server.RedeliverWebhook")
+	defer span.End()
+
+	if err := s.storer.RedeliverWebhook(ctx, id); err != nil {
+		return nil, err
+	}
+
+	logger.FromContext(ctx).Info("webhook redelivery queued", "delivery_id", id)
+	return s.storer.GetWebhookDelivery(ctx, id)
+}
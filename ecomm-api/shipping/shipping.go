@@ -0,0 +1,116 @@
+package shipping
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Quotes prices the cart with every method that ships to its destination,
+// in the order of t.Methods.
+func (t *Table) Quotes(cart Cart) []Quote {
+	quotes := []Quote{}
+	for _, m := range t.Methods {
+		q, err := t.Quote(cart, m.Code)
+		if err != nil {
+			continue
+		}
+		quotes = append(quotes, *q)
+	}
+	return quotes
+}
+
+// Quote prices the cart with one method. When several rates match, a rate
+// for the destination's zone beats one for every destination, and then the
+// cheapest wins.
+func (t *Table) Quote(cart Cart, method string) (*Quote, error) {
+	m, ok := t.method(method)
+	if !ok {
+		return nil, fmt.Errorf("%s: %w", method, ErrNoRate)
+	}
+
+	weight := BillableWeight(cart.Items)
+	subtotal := Subtotal(cart.Items)
+	zones := t.zonesFor(cart.Destination)
+
+	var (
+		best      *Quote
+		bestZoned bool
+	)
+	for _, r := range t.Rates {
+		if r.Method != method || !inRange(weight, r.MinWeight, r.MaxWeight) || !inRange(subtotal, r.MinSubtotal, r.MaxSubtotal) {
+			continue
+		}
+		zoned := r.ZoneID != nil
+		if zoned && !zones[*r.ZoneID] {
+			continue
+		}
+
+		q := &Quote{Method: m.Code, Name: m.Name, Weight: round(weight)}
+		if r.FreeAbove > 0 && subtotal >= r.FreeAbove {
+			q.Free = true
+		} else {
+			q.Price = round(r.Price + r.PerKg*weight)
+		}
+
+		if best == nil || (zoned && !bestZoned) || (zoned == bestZoned && q.Price < best.Price) {
+			best, bestZoned = q, zoned
+		}
+	}
+
+	if best == nil {
+		return nil, fmt.Errorf("%s to %s: %w", method, cart.Destination.Country, ErrNoRate)
+	}
+	return best, nil
+}
+
+// BillableWeight is the weight carriers charge for: per item, the larger of
+// its weight and its volumetric weight.
+func BillableWeight(items []Item) float64 {
+	var total float64
+	for _, i := range items {
+		volumetric := i.Length * i.Width * i.Height / VolumetricDivisor
+		total += math.Max(i.Weight, volumetric) * float64(i.Quantity)
+	}
+	return total
+}
+
+func Subtotal(items []Item) float64 {
+	var total float64
+	for _, i := range items {
+		total += i.UnitPrice * float64(i.Quantity)
+	}
+	return total
+}
+
+func (t *Table) method(code string) (Method, bool) {
+	for _, m := range t.Methods {
+		if m.Code == code {
+			return m, true
+		}
+	}
+	return Method{}, false
+}
+
+// zonesFor returns the IDs of the zones that cover d.
+func (t *Table) zonesFor(d Destination) map[int64]bool {
+	ids := map[int64]bool{}
+	for _, z := range t.Zones {
+		for _, r := range z.Regions {
+			if strings.EqualFold(r.Country, d.Country) && (r.Region == "" || strings.EqualFold(r.Region, d.Region)) {
+				ids[z.ID] = true
+				break
+			}
+		}
+	}
+	return ids
+}
+
+// inRange reports whether min <= v <= max, with a zero max meaning no bound.
+func inRange(v, min, max float64) bool {
+	return v >= min && (max == 0 || v <= max)
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
@@ -0,0 +1,117 @@
+package shipping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testTable() *Table {
+	us, california := int64(1), int64(2)
+	return &Table{
+		Methods: []Method{
+			{Code: MethodStandard, Name: "Standard"},
+			{Code: MethodExpress, Name: "Express"},
+			{Code: MethodPickup, Name: "Store pickup"},
+		},
+		Zones: []Zone{
+			{ID: us, Name: "United States", Regions: []Destination{{Country: "US"}}},
+			{ID: california, Name: "California", Regions: []Destination{{Country: "US", Region: "CA"}}},
+		},
+		Rates: []Rate{
+			{ID: 1, Method: MethodStandard, Price: 10, PerKg: 2, FreeAbove: 100},
+			{ID: 2, Method: MethodStandard, ZoneID: &us, Price: 5, PerKg: 1, FreeAbove: 50},
+			{ID: 3, Method: MethodExpress, ZoneID: &us, MaxWeight: 5, Price: 15},
+			{ID: 4, Method: MethodExpress, ZoneID: &us, MinWeight: 5.001, Price: 30},
+			{ID: 5, Method: MethodPickup, ZoneID: &california},
+		},
+	}
+}
+
+func TestQuote(t *testing.T) {
+	ny := Destination{Country: "US", Region: "NY"}
+	light := []Item{{ProductID: 1, UnitPrice: 10, Quantity: 2, Weight: 1}}
+
+	tsc := []struct {
+		name   string
+		method string
+		cart   Cart
+		want   *Quote
+		err    error
+	}{
+		{
+			name:   "zone rate beats the catch-all rate",
+			method: MethodStandard,
+			cart:   Cart{Destination: ny, Items: light},
+			want:   &Quote{Method: MethodStandard, Name: "Standard", Weight: 2, Price: 7},
+		},
+		{
+			name:   "catch-all rate outside every zone",
+			method: MethodStandard,
+			cart:   Cart{Destination: Destination{Country: "DE"}, Items: light},
+			want:   &Quote{Method: MethodStandard, Name: "Standard", Weight: 2, Price: 14},
+		},
+		{
+			name:   "free above the subtotal threshold",
+			method: MethodStandard,
+			cart:   Cart{Destination: ny, Items: []Item{{ProductID: 1, UnitPrice: 30, Quantity: 2, Weight: 1}}},
+			want:   &Quote{Method: MethodStandard, Name: "Standard", Weight: 2, Free: true},
+		},
+		{
+			name:   "bulky item is charged by volume",
+			method: MethodStandard,
+			cart: Cart{Destination: ny, Items: []Item{
+				{ProductID: 1, UnitPrice: 10, Quantity: 1, Weight: 0.5, Length: 30, Width: 20, Height: 10},
+			}},
+			want: &Quote{Method: MethodStandard, Name: "Standard", Weight: 1.2, Price: 6.2},
+		},
+		{
+			name:   "weight bracket",
+			method: MethodExpress,
+			cart:   Cart{Destination: ny, Items: []Item{{ProductID: 1, UnitPrice: 10, Quantity: 3, Weight: 2}}},
+			want:   &Quote{Method: MethodExpress, Name: "Express", Weight: 6, Price: 30},
+		},
+		{
+			name:   "region zone",
+			method: MethodPickup,
+			cart:   Cart{Destination: Destination{Country: "us", Region: "ca"}, Items: light},
+			want:   &Quote{Method: MethodPickup, Name: "Store pickup", Weight: 2},
+		},
+		{
+			name:   "method not available for the destination",
+			method: MethodPickup,
+			cart:   Cart{Destination: ny, Items: light},
+			err:    ErrNoRate,
+		},
+		{
+			name:   "unknown method",
+			method: "drone",
+			cart:   Cart{Destination: ny, Items: light},
+			err:    ErrNoRate,
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := testTable().Quote(tc.cart, tc.method)
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestQuotes(t *testing.T) {
+	cart := Cart{
+		Destination: Destination{Country: "US", Region: "NY"},
+		Items:       []Item{{ProductID: 1, UnitPrice: 10, Quantity: 2, Weight: 1}},
+	}
+
+	require.Equal(t, []Quote{
+		{Method: MethodStandard, Name: "Standard", Weight: 2, Price: 7},
+		{Method: MethodExpress, Name: "Express", Weight: 2, Price: 15},
+	}, testTable().Quotes(cart))
+}
@@ -0,0 +1,84 @@
+package shipping
+
+import "errors"
+
+const (
+	MethodStandard = "standard"
+	MethodExpress  = "express"
+	MethodPickup   = "pickup"
+)
+
+// VolumetricDivisor turns a parcel's volume in cm³ into the weight in kg
+// carriers charge for it, when that is more than its actual weight.
+const VolumetricDivisor = 5000
+
+// ErrNoRate means the method does not ship the cart to its destination.
+var ErrNoRate = errors.New("shipping method not available")
+
+type Destination struct {
+	Country string
+	Region  string
+}
+
+// Item is a cart line. Weight is in kg and dimensions in cm.
+type Item struct {
+	ProductID int64
+	UnitPrice float64
+	Quantity  int64
+	Weight    float64
+	Length    float64
+	Width     float64
+	Height    float64
+}
+
+type Cart struct {
+	Destination Destination
+	Items       []Item
+}
+
+type Method struct {
+	Code string
+	Name string
+}
+
+// Zone groups destinations that share rates. An empty Region covers the
+// whole country.
+type Zone struct {
+	ID      int64
+	Name    string
+	Regions []Destination
+}
+
+// Rate prices a method for carts of a weight and subtotal range shipped to
+// a zone. A nil ZoneID matches every destination, and a zero maximum means
+// no upper bound.
+type Rate struct {
+	ID          int64
+	Method      string
+	ZoneID      *int64
+	MinWeight   float64
+	MaxWeight   float64
+	MinSubtotal float64
+	MaxSubtotal float64
+	Price       float64
+	PerKg       float64
+	// FreeAbove makes shipping free from this subtotal on; zero never does.
+	FreeAbove float64
+}
+
+// Table holds the methods, zones and rates quotes are computed from.
+type Table struct {
+	Methods []Method
+	Zones   []Zone
+	Rates   []Rate
+}
+
+type Quote struct {
+	Method string
+	Name   string
+	// Weight is the billable weight: the larger of the actual and the
+	// volumetric weight of each item.
+	Weight float64
+	Price  float64
+	Free   bool
+}
@@ -0,0 +1,20 @@
+package storer
+
+import "context"
+
+type actorKey struct{}
+
+// WithActor records who is behind the changes made with ctx, for the audit
+// log and the inventory ledger.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFrom returns the actor set with WithActor, or "system" for changes
+// not made on behalf of a request.
+func ActorFrom(ctx context.Context) string {
+	if a, ok := ctx.Value(actorKey{}).(string); ok && a != "" {
+		return a
+	}
+	return "system"
+}
@@ -0,0 +1,257 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateAddress adds an address to a user's address book. A user's first
+// address becomes their default shipping and billing address.
+func (ps *PySQLStorer) CreateAddress(ctx context.Context, a *Address) (*Address, error) {
+	defer metrics.ObserveQuery("CreateAddress")()
+
+	now := time.Now()
+	a.CreatedAt = now
+	a.UpdatedAt = &now
+
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		if err := lockUser(ctx, tx, a.UserID); err != nil {
+			return err
+		}
+
+		var count int
+		if err := tx.GetContext(ctx, &count, "SELECT COUNT(*) FROM addresses WHERE user_id=$1", a.UserID); err != nil {
+			return fmt.Errorf("failed to count addresses of user %d: %w", a.UserID, err)
+		}
+		if count == 0 {
+			a.IsDefaultShipping, a.IsDefaultBilling = true, true
+		}
+		if err := clearDefaultAddresses(ctx, tx, a); err != nil {
+			return err
+		}
+
+		err := tx.QueryRowxContext(ctx,
+			`INSERT INTO addresses (
+				user_id, name, line1, line2, city, region, postal_code, country, phone,
+				is_default_shipping, is_default_billing, created_at, updated_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			RETURNING id`,
+			a.UserID, a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.Phone,
+			a.IsDefaultShipping, a.IsDefaultBilling, a.CreatedAt, a.UpdatedAt,
+		).Scan(&a.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert address: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to create address for user %d: %w", a.UserID, err))
+	}
+
+	return a, nil
+}
+
+func (ps *PySQLStorer) GetAddress(ctx context.Context, userID, id int64) (*Address, error) {
+	defer metrics.ObserveQuery("GetAddress")()
+
+	var a Address
+	err := ps.db.GetContext(ctx, &a, "SELECT * FROM addresses WHERE id=$1 AND user_id=$2", id, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("address %d of user %d: %w", id, userID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get address with id %d: %w", id, err))
+	}
+
+	return &a, nil
+}
+
+// DefaultAddress returns the user's default address of the given kind, or
+// ErrNotFound when they have none.
+func (ps *PySQLStorer) DefaultAddress(ctx context.Context, userID int64, kind string) (*Address, error) {
+	defer metrics.ObserveQuery("DefaultAddress")()
+
+	query := "SELECT * FROM addresses WHERE user_id=$1 AND is_default_shipping"
+	if kind == AddressBilling {
+		query = "SELECT * FROM addresses WHERE user_id=$1 AND is_default_billing"
+	}
+
+	var a Address
+	err := ps.db.GetContext(ctx, &a, query, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("default %s address of user %d: %w", kind, userID, ErrNotFound)
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get default %s address of user %d: %w", kind, userID, err))
+	}
+
+	return &a, nil
+}
+
+func (ps *PySQLStorer) ListAddresses(ctx context.Context, userID int64) ([]Address, error) {
+	defer metrics.ObserveQuery("ListAddresses")()
+
+	var exists bool
+	if err := ps.db.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM users WHERE id=$1)", userID); err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to check user %d: %w", userID, err))
+	}
+	if !exists {
+		return nil, fmt.Errorf("user %d: %w", userID, ErrNotFound)
+	}
+
+	addresses := []Address{}
+	err := ps.db.SelectContext(ctx, &addresses, "SELECT * FROM addresses WHERE user_id=$1 ORDER BY id", userID)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list addresses of user %d: %w", userID, err))
+	}
+
+	return addresses, nil
+}
+
+// UpdateAddress replaces an address. Orders already placed with it keep
+// their own copy.
+func (ps *PySQLStorer) UpdateAddress(ctx context.Context, a *Address) (*Address, error) {
+	defer metrics.ObserveQuery("UpdateAddress")()
+
+	now := time.Now()
+	a.UpdatedAt = &now
+
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		if err := lockUser(ctx, tx, a.UserID); err != nil {
+			return err
+		}
+		if err := clearDefaultAddresses(ctx, tx, a); err != nil {
+			return err
+		}
+
+		err := tx.QueryRowxContext(ctx,
+			`UPDATE addresses SET
+				name=$1, line1=$2, line2=$3, city=$4, region=$5, postal_code=$6, country=$7, phone=$8,
+				is_default_shipping=$9, is_default_billing=$10, updated_at=$11
+			WHERE id=$12 AND user_id=$13
+			RETURNING created_at`,
+			a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.Phone,
+			a.IsDefaultShipping, a.IsDefaultBilling, a.UpdatedAt, a.ID, a.UserID,
+		).Scan(&a.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("address %d of user %d: %w", a.ID, a.UserID, ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update address: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to update address with id %d: %w", a.ID, err))
+	}
+
+	return a, nil
+}
+
+func (ps *PySQLStorer) DeleteAddress(ctx context.Context, userID, id int64) error {
+	defer metrics.ObserveQuery("DeleteAddress")()
+
+	res, err := ps.db.ExecContext(ctx, "DELETE FROM addresses WHERE id=$1 AND user_id=$2", id, userID)
+	if err != nil {
+		return logError(ctx, fmt.Errorf("failed to delete address with id %d: %w", id, err))
+	}
+	return expectAffected(res, "address", id)
+}
+
+// lockUser serializes address book changes of a user, so that two requests
+// cannot both make an address the default.
+func lockUser(ctx context.Context, tx *sqlx.Tx, userID int64) error {
+	var id int64
+	err := tx.GetContext(ctx, &id, "SELECT id FROM users WHERE id=$1 FOR UPDATE", userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("user %d: %w", userID, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock user %d: %w", userID, err)
+	}
+	return nil
+}
+
+// clearDefaultAddresses unsets the user's other defaults of the kinds a
+// becomes the default for.
+func clearDefaultAddresses(ctx context.Context, tx *sqlx.Tx, a *Address) error {
+	if a.IsDefaultShipping {
+		_, err := tx.ExecContext(ctx,
+			"UPDATE addresses SET is_default_shipping=FALSE WHERE user_id=$1 AND id<>$2 AND is_default_shipping", a.UserID, a.ID)
+		if err != nil {
+			return fmt.Errorf("failed to clear default shipping address of user %d: %w", a.UserID, err)
+		}
+	}
+	if a.IsDefaultBilling {
+		_, err := tx.ExecContext(ctx,
+			"UPDATE addresses SET is_default_billing=FALSE WHERE user_id=$1 AND id<>$2 AND is_default_billing", a.UserID, a.ID)
+		if err != nil {
+			return fmt.Errorf("failed to clear default billing address of user %d: %w", a.UserID, err)
+		}
+	}
+	return nil
+}
+
+// insertOrderAddress stores a copy of an address with an order.
+func insertOrderAddress(ctx context.Context, tx *sqlx.Tx, a *OrderAddress) error {
+	err := tx.QueryRowxContext(ctx,
+		`INSERT INTO order_addresses (
+			order_id, kind, address_id, name, line1, line2, city, region, postal_code, country, phone
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+		RETURNING id`,
+		a.OrderID, a.Kind, a.AddressID, a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.Phone,
+	).Scan(&a.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert %s address for order %d: %w", a.Kind, a.OrderID, err)
+	}
+	return nil
+}
+
+// loadOrderAddresses fills in the addresses of every order with a single
+// query.
+func (ps *PySQLStorer) loadOrderAddresses(ctx context.Context, orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(orders))
+	byID := make(map[int64]*Order, len(orders))
+	for i := range orders {
+		ids[i] = orders[i].ID
+		byID[orders[i].ID] = &orders[i]
+	}
+
+	var addresses []OrderAddress
+	err := ps.db.SelectContext(ctx, &addresses, "SELECT * FROM order_addresses WHERE order_id = ANY($1)", ids)
+	if err != nil {
+		return fmt.Errorf("failed to get addresses for orders: %w", err)
+	}
+
+	for i := range addresses {
+		if o, ok := byID[addresses[i].OrderID]; ok {
+			o.setAddress(&addresses[i])
+		}
+	}
+	return nil
+}
+
+func (o *Order) setAddress(a *OrderAddress) {
+	switch a.Kind {
+	case AddressShipping:
+		o.ShippingAddress = a
+	case AddressBilling:
+		o.BillingAddress = a
+	}
+}
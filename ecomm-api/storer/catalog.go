@@ -0,0 +1,149 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/outbox"
+	"github.com/jmoiron/sqlx"
+)
+
+// UpsertProducts inserts or updates, by SKU, a batch of products in one
+// transaction. A row that fails is rolled back to its own savepoint and
+// reported in its UpsertResult without aborting the rest of the batch. With
+// opts.DryRun the transaction is rolled back once every row has been tried.
+func (ps *PySQLStorer) UpsertProducts(ctx context.Context, products []Product, opts UpsertOptions) ([]UpsertResult, error) {
+	defer metrics.ObserveQuery("UpsertProducts")()
+	ctx, changes := trackStockChanges(ctx)
+
+	tx, err := ps.db.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to begin transaction: %w", err))
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	results := make([]UpsertResult, len(products))
+	for i, p := range products {
+		if _, err := tx.ExecContext(ctx, "SAVEPOINT upsert_row"); err != nil {
+			return nil, logError(ctx, fmt.Errorf("failed to create savepoint: %w", err))
+		}
+
+		// Keep the row's stock changes apart until it is known to stick.
+		rowCtx, rowChanges := trackStockChanges(ctx)
+		if err := upsertProduct(rowCtx, tx, &p, now, opts.Restore, &results[i]); err != nil {
+			results[i].Err = err
+			if _, err := tx.ExecContext(ctx, "ROLLBACK TO SAVEPOINT upsert_row"); err != nil {
+				return nil, logError(ctx, fmt.Errorf("failed to roll back to savepoint: %w", err))
+			}
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, "RELEASE SAVEPOINT upsert_row"); err != nil {
+			return nil, logError(ctx, fmt.Errorf("failed to release savepoint: %w", err))
+		}
+		changes.merge(rowChanges)
+	}
+
+	if opts.DryRun {
+		return results, nil
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, logError(ctx, fmt.Errorf("error committing transaction: %w", err))
+	}
+	ps.stockChanged(ctx, changes)
+	return results, nil
+}
+
+// upsertProduct saves one imported product and records any stock change it
+// makes in the inventory ledger. A soft deleted product is only brought back
+// with restore.
+func upsertProduct(ctx context.Context, tx *sqlx.Tx, p *Product, now time.Time, restore bool, res *UpsertResult) error {
+	var current struct {
+		Stock   int64 `db:"count_in_stock"`
+		Deleted bool  `db:"deleted"`
+	}
+	err := tx.GetContext(ctx, &current,
+		"SELECT count_in_stock, deleted_at IS NOT NULL AS deleted FROM products WHERE sku=$1 FOR UPDATE", p.SKU)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("failed to lock product %s: %w", p.SKU, err)
+	}
+	if current.Deleted && !restore {
+		return fmt.Errorf("product %s: %w", p.SKU, ErrProductDeleted)
+	}
+	stock := current.Stock
+
+	err = tx.QueryRowxContext(ctx,
+		`INSERT INTO products (
+			sku, name, image, category, description, rating, num_reviews, price, count_in_stock, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10)
+		ON CONFLICT (sku) DO UPDATE SET
+			name = EXCLUDED.name,
+			image = EXCLUDED.image,
+			category = EXCLUDED.category,
+			description = EXCLUDED.description,
+			rating = EXCLUDED.rating,
+			num_reviews = EXCLUDED.num_reviews,
+			price = EXCLUDED.price,
+			count_in_stock = EXCLUDED.count_in_stock,
+			updated_at = EXCLUDED.updated_at,
+			deleted_at = NULL,
+			version = products.version + 1
+		RETURNING id, (xmax = 0)`,
+		p.SKU, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews,
+		p.Price, p.CountInStock, now,
+	).Scan(&p.ID, &res.Created)
+	if err != nil {
+		return fmt.Errorf("failed to upsert product %s: %w", p.SKU, err)
+	}
+
+	if delta := p.CountInStock - stock; delta != 0 {
+		err := recordStockChange(ctx, tx, StockMovement{
+			ProductID: p.ID,
+			Delta:     delta,
+			Reason:    MovementImport,
+			Reference: "sku:" + p.SKU,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	eventType := outbox.EventProductUpdated
+	if res.Created {
+		eventType = outbox.EventProductCreated
+	}
+	return insertProductEvent(ctx, tx, eventType, p)
+}
+
+// StreamProducts calls fn for every product, reading them one row at a time
+// instead of loading the whole catalog.
+func (ps *PySQLStorer) StreamProducts(ctx context.Context, fn func(*Product) error) error {
+	defer metrics.ObserveQuery("StreamProducts")()
+
+	rows, err := ps.db.QueryxContext(ctx, "SELECT * FROM products WHERE deleted_at IS NULL ORDER BY id")
+	if err != nil {
+		return logError(ctx, fmt.Errorf("failed to stream products: %w", err))
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p Product
+		if err := rows.StructScan(&p); err != nil {
+			return logError(ctx, fmt.Errorf("failed to scan product: %w", err))
+		}
+		if err := fn(&p); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return logError(ctx, fmt.Errorf("failed to stream products: %w", err))
+	}
+	return nil
+}
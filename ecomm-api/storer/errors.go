@@ -0,0 +1,45 @@
+package storer
+
+import "errors"
+
+var (
+	ErrNotFound       = errors.New("record not found")
+	ErrUnknownProduct = errors.New("unknown product")
+	// ErrProductDeleted means an import row matches a soft deleted product
+	// and the import did not ask for deleted products to be restored.
+	ErrProductDeleted  = errors.New("product is deleted")
+	ErrOrderNotPending = errors.New("order is no longer pending")
+	ErrOrderNotPaid    = errors.New("order is not paid")
+	// ErrOrderPaid means a paid order has to be refunded, not cancelled.
+	ErrOrderPaid         = errors.New("order is paid")
+	ErrInsufficientStock = errors.New("insufficient stock")
+	ErrInvalidQuantity   = errors.New("item quantity must be positive")
+	ErrVersionConflict   = errors.New("record was modified concurrently")
+	ErrUnknownWarehouse  = errors.New("unknown warehouse")
+	ErrInvalidCoupon     = errors.New("invalid coupon")
+	ErrDuplicateCode     = errors.New("code already in use")
+	ErrDuplicateName     = errors.New("name already in use")
+	// ErrUnknownShippingMethod also means the method does not ship the
+	// order to its destination.
+	ErrUnknownShippingMethod = errors.New("unknown shipping method")
+	ErrUnknownShippingZone   = errors.New("unknown shipping zone")
+	ErrUnknownAddress        = errors.New("unknown address")
+	ErrAddressRequired       = errors.New("shipping address required")
+	// ErrPaymentState means the payment changed state concurrently or the
+	// operation does not apply to its current state.
+	ErrPaymentState   = errors.New("payment is not in a valid state for this operation")
+	ErrRefundTooLarge = errors.New("refund exceeds the captured amount")
+	// ErrPaymentExists means the order already has an authorized or
+	// captured payment.
+	ErrPaymentExists = errors.New("order already has a payment")
+	// ErrNotReturnable means the order was not paid for, or the items asked
+	// for exceed what is left to return.
+	ErrNotReturnable = errors.New("items cannot be returned")
+	ErrReturnState   = errors.New("return was already decided")
+	// ErrDuplicateEvent means a webhook event was already processed.
+	ErrDuplicateEvent = errors.New("event already processed")
+	// ErrInvalidToken means a user token is unknown, expired, already used
+	// or made for another purpose.
+	ErrInvalidToken     = errors.New("invalid or expired token")
+	ErrEmailNotVerified = errors.New("email address not verified")
+)
@@ -0,0 +1,73 @@
+package storer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/jmoiron/sqlx"
+)
+
+// AdjustStock applies a manual stock correction and records it in the ledger.
+// The stock moves in m.WarehouseID, or in the default warehouse if unset.
+func (ps *PySQLStorer) AdjustStock(ctx context.Context, m *StockMovement) (*Product, error) {
+	defer metrics.ObserveQuery("AdjustStock")()
+	ctx, changes := trackStockChanges(ctx)
+
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		if m.WarehouseID != 0 {
+			var exists bool
+			err := tx.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM warehouses WHERE id=$1)", m.WarehouseID)
+			if err != nil {
+				return fmt.Errorf("failed to get warehouse with id %d: %w", m.WarehouseID, err)
+			}
+			if !exists {
+				return fmt.Errorf("warehouse %d: %w", m.WarehouseID, ErrUnknownWarehouse)
+			}
+		}
+		return adjustStock(ctx, tx, m)
+	})
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrInsufficientStock) || errors.Is(err, ErrUnknownWarehouse) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to adjust stock for product %d: %w", m.ProductID, err))
+	}
+
+	ps.stockChanged(ctx, changes)
+	return ps.GetProduct(ctx, m.ProductID)
+}
+
+func (ps *PySQLStorer) ListStockMovements(ctx context.Context, productID int64) ([]StockMovement, error) {
+	defer metrics.ObserveQuery("ListStockMovements")()
+
+	movements := []StockMovement{}
+	err := ps.db.SelectContext(ctx, &movements,
+		"SELECT * FROM inventory_movements WHERE product_id=$1 ORDER BY id", productID)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list stock movements for product %d: %w", productID, err))
+	}
+
+	return movements, nil
+}
+
+// ReconcileStock rebuilds the stock of every product from the ledger, next to
+// the stored count_in_stock.
+func (ps *PySQLStorer) ReconcileStock(ctx context.Context) ([]StockReconciliation, error) {
+	defer metrics.ObserveQuery("ReconcileStock")()
+
+	var res []StockReconciliation
+	err := ps.db.SelectContext(ctx, &res,
+		`SELECT p.id AS product_id, p.sku, p.count_in_stock, COALESCE(SUM(m.delta), 0) AS ledger_stock
+		FROM products p
+		LEFT JOIN inventory_movements m ON m.product_id = p.id
+		WHERE p.deleted_at IS NULL
+		GROUP BY p.id, p.sku, p.count_in_stock
+		ORDER BY p.id`)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to reconcile stock: %w", err))
+	}
+
+	return res, nil
+}
@@ -0,0 +1,121 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/jobs"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/jmoiron/sqlx"
+)
+
+// EnqueueJob stores a job to be run at j.RunAt, or straight away. A job
+// whose key is already taken is not stored and 0 is returned.
+func (ps *PySQLStorer) EnqueueJob(ctx context.Context, j jobs.Job) (int64, error) {
+	defer metrics.ObserveQuery("EnqueueJob")()
+
+	now := time.Now()
+	if j.RunAt.IsZero() {
+		j.RunAt = now
+	}
+	if j.MaxAttempts == 0 {
+		j.MaxAttempts = jobs.DefaultMaxAttempts
+	}
+	if j.Payload == nil {
+		j.Payload = []byte(`{}`)
+	}
+	var key *string
+	if j.Key != "" {
+		key = &j.Key
+	}
+
+	var id int64
+	err := ps.db.QueryRowxContext(ctx,
+		`INSERT INTO jobs (kind, payload, key, max_attempts, run_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (key) DO NOTHING
+		RETURNING id`,
+		j.Kind, []byte(j.Payload), key, j.MaxAttempts, j.RunAt, now,
+	).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, logError(ctx, fmt.Errorf("failed to enqueue %s job: %w", j.Kind, err))
+	}
+
+	return id, nil
+}
+
+// RunJob claims the oldest due job of one of kinds and runs it. The job
+// stays locked until its outcome is saved, so runners side by side never
+// run the same job at once; if the process dies first the job is released
+// and runs again.
+func (ps *PySQLStorer) RunJob(ctx context.Context, kinds []string, run func(context.Context, jobs.Job) error) (bool, error) {
+	defer metrics.ObserveQuery("RunJob")()
+
+	var ran bool
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		var j Job
+		err := tx.GetContext(ctx, &j,
+			`SELECT * FROM jobs
+			WHERE status = 'pending' AND run_at <= $1 AND kind = ANY($2)
+			ORDER BY run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED`,
+			time.Now(), kinds,
+		)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to claim job: %w", err)
+		}
+		ran = true
+
+		job := jobs.Job{
+			ID:          j.ID,
+			Kind:        j.Kind,
+			Payload:     j.Payload,
+			RunAt:       j.RunAt,
+			Attempts:    j.Attempts,
+			MaxAttempts: j.MaxAttempts,
+		}
+		if j.Key != nil {
+			job.Key = *j.Key
+		}
+		runErr := run(ctx, job)
+
+		now := time.Now()
+		attempts := j.Attempts + 1
+		switch {
+		case runErr == nil:
+			_, err = tx.ExecContext(ctx,
+				"UPDATE jobs SET status=$1, attempts=$2, last_error='', updated_at=$3, finished_at=$3 WHERE id=$4",
+				jobs.StatusSucceeded, attempts, now, j.ID,
+			)
+		case attempts >= j.MaxAttempts:
+			_, err = tx.ExecContext(ctx,
+				"UPDATE jobs SET status=$1, attempts=$2, last_error=$3, updated_at=$4, finished_at=$4 WHERE id=$5",
+				jobs.StatusFailed, attempts, runErr.Error(), now, j.ID,
+			)
+		default:
+			_, err = tx.ExecContext(ctx,
+				"UPDATE jobs SET attempts=$1, last_error=$2, run_at=$3, updated_at=$4 WHERE id=$5",
+				attempts, runErr.Error(), now.Add(jobs.Backoff(attempts)), now, j.ID,
+			)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to save outcome of job %d: %w", j.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return ran, logError(ctx, fmt.Errorf("failed to run job: %w", err))
+	}
+
+	return ran, nil
+}
@@ -0,0 +1,14 @@
+package storer
+
+import (
+	"context"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/logger"
+)
+
+// logError records a storer failure against the request that caused it and
+// hands the error back so call sites can return it directly.
+func logError(ctx context.Context, err error) error {
+	logger.FromContext(ctx).Error("storer error", "error", err)
+	return err
+}
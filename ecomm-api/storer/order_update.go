@@ -0,0 +1,289 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/outbox"
+	"github.com/jmoiron/sqlx"
+)
+
+const (
+	auditItemAdded            = "item_added"
+	auditItemRemoved          = "item_removed"
+	auditItemQuantityChanged  = "item_quantity_changed"
+	auditPaymentMethodChanged = "payment_method_changed"
+	auditStatusChanged        = "status_changed"
+	auditReturnRequested      = "return_requested"
+	auditReturnApproved       = "return_approved"
+	auditReturnRejected       = "return_rejected"
+	auditRefunded             = "refunded"
+)
+
+// UpdateOrder applies item edits and a payment method change to a pending
+// order. Stock, totals and the audit log are updated in the same transaction.
+func (ps *PySQLStorer) UpdateOrder(ctx context.Context, u *OrderUpdate) (*Order, error) {
+	defer metrics.ObserveQuery("UpdateOrder")()
+	ctx, changes := trackStockChanges(ctx)
+
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		var o Order
+		err := tx.GetContext(ctx, &o, "SELECT * FROM orders WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", u.OrderID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("order %d: %w", u.OrderID, ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock order with id %d: %w", u.OrderID, err)
+		}
+		if o.Status != OrderStatusPending {
+			return fmt.Errorf("order %d is %s: %w", o.ID, o.Status, ErrOrderNotPending)
+		}
+		o.ShipTo = u.ShipTo
+
+		var items []OrderItem
+		err = tx.SelectContext(ctx, &items, "SELECT * FROM order_items WHERE order_id=$1", o.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get order items for order id %d: %w", o.ID, err)
+		}
+
+		for _, e := range u.Items {
+			if err := ps.applyItemEdit(ctx, tx, &o, items, e); err != nil {
+				return err
+			}
+		}
+
+		if u.PaymentMethod != "" && u.PaymentMethod != o.PaymentMethod {
+			err := insertOrderAudit(ctx, tx, o.ID, auditPaymentMethodChanged, map[string]any{
+				"from": o.PaymentMethod,
+				"to":   u.PaymentMethod,
+			})
+			if err != nil {
+				return err
+			}
+			o.PaymentMethod = u.PaymentMethod
+		}
+
+		if u.ShippingPrice != nil {
+			o.ShippingPrice = *u.ShippingPrice
+		}
+
+		rules, err := redeemedRules(ctx, tx, o.ID)
+		if err != nil {
+			return err
+		}
+		if err := priceOrder(ctx, tx, &o, rules, false); err != nil {
+			return err
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE orders SET payment_method=$1, shipping_price=$2, updated_at=$3 WHERE id=$4",
+			o.PaymentMethod, o.ShippingPrice, time.Now(), o.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update order with id %d: %w", o.ID, err)
+		}
+
+		o.Items = nil
+		if err := tx.SelectContext(ctx, &o.Items, "SELECT * FROM order_items WHERE order_id=$1 ORDER BY id", o.ID); err != nil {
+			return fmt.Errorf("failed to get order items for order id %d: %w", o.ID, err)
+		}
+		return insertOrderEvent(ctx, tx, outbox.EventOrderUpdated, &o)
+	})
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to update order with id %d: %w", u.OrderID, err))
+	}
+
+	ps.stockChanged(ctx, changes)
+	return ps.GetOrder(ctx, u.OrderID)
+}
+
+func (ps *PySQLStorer) applyItemEdit(ctx context.Context, tx *sqlx.Tx, o *Order, items []OrderItem, e OrderItemEdit) error {
+	// A product may be spread over several items, one per warehouse it
+	// ships from.
+	var (
+		current    []OrderItem
+		currentQty int64
+	)
+	for _, oi := range items {
+		if oi.ProductID == e.ProductID {
+			current = append(current, oi)
+			currentQty += oi.Quantity
+		}
+	}
+
+	switch {
+	case len(current) == 0 && e.Quantity == 0:
+		return nil
+
+	case len(current) == 0:
+		var p Product
+		err := tx.GetContext(ctx, &p, "SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL", e.ProductID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("product %d: %w", e.ProductID, ErrUnknownProduct)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get product with id %d: %w", e.ProductID, err)
+		}
+
+		oi := OrderItem{
+			Name:      p.Name,
+			Image:     p.Image,
+			Price:     p.Price,
+			ProductID: p.ID,
+			OrderID:   o.ID,
+			TaxRate:   e.TaxRate,
+			TaxAmount: e.TaxAmount,
+		}
+		if err := ps.allocateItem(ctx, tx, o, oi, e.Quantity); err != nil {
+			return err
+		}
+		return insertOrderAudit(ctx, tx, o.ID, auditItemAdded, map[string]any{
+			"product_id": p.ID,
+			"quantity":   e.Quantity,
+		})
+
+	case e.Quantity == 0:
+		if err := releaseItems(ctx, tx, o, current); err != nil {
+			return err
+		}
+		return insertOrderAudit(ctx, tx, o.ID, auditItemRemoved, map[string]any{
+			"product_id": e.ProductID,
+			"quantity":   currentQty,
+		})
+
+	case e.Quantity != currentQty:
+		// Put the stock back and allocate the new quantity from scratch,
+		// so the warehouses are chosen as for a new order.
+		if err := releaseItems(ctx, tx, o, current); err != nil {
+			return err
+		}
+		oi := current[0]
+		oi.ID = 0
+		oi.TaxRate, oi.TaxAmount = e.TaxRate, e.TaxAmount
+		if err := ps.allocateItem(ctx, tx, o, oi, e.Quantity); err != nil {
+			return err
+		}
+		return insertOrderAudit(ctx, tx, o.ID, auditItemQuantityChanged, map[string]any{
+			"product_id": e.ProductID,
+			"from":       currentQty,
+			"to":         e.Quantity,
+		})
+	}
+
+	return nil
+}
+
+// allocateItem takes quantity units of oi's product out of stock and adds one
+// order item per warehouse they ship from.
+func (ps *PySQLStorer) allocateItem(ctx context.Context, tx *sqlx.Tx, o *Order, oi OrderItem, quantity int64) error {
+	allocs, err := ps.allocateStock(ctx, tx, oi.ProductID, quantity, o.ShipTo, StockMovement{
+		Reason:    MovementOrder,
+		Reference: orderReference(o.ID),
+	})
+	if err != nil {
+		return err
+	}
+
+	taxes := splitTax(oi.TaxAmount, allocs)
+	for i, a := range allocs {
+		item := oi
+		item.Quantity = a.Quantity
+		item.WarehouseID = a.WarehouseID
+		item.TaxAmount = taxes[i]
+		if _, err := createOrderItem(ctx, tx, &item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// releaseItems returns the stock of items to the warehouses it came from and
+// deletes them from the order.
+func releaseItems(ctx context.Context, tx *sqlx.Tx, o *Order, items []OrderItem) error {
+	for _, oi := range items {
+		err := adjustStock(ctx, tx, &StockMovement{
+			ProductID:   oi.ProductID,
+			WarehouseID: oi.WarehouseID,
+			Delta:       oi.Quantity,
+			Reason:      MovementOrder,
+			Reference:   orderReference(o.ID),
+		})
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM order_items WHERE id=$1", oi.ID); err != nil {
+			return fmt.Errorf("failed to delete order item with id %d: %w", oi.ID, err)
+		}
+	}
+	return nil
+}
+
+// ShipOrder moves a paid order to shipped. The shipment goes out with the
+// order.shipped event; orders in any other state fail with ErrOrderNotPaid.
+func (ps *PySQLStorer) ShipOrder(ctx context.Context, id int64, sh *Shipment) error {
+	defer metrics.ObserveQuery("ShipOrder")()
+
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		var status string
+		err := tx.GetContext(ctx, &status, "SELECT status FROM orders WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("order %d: %w", id, ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock order with id %d: %w", id, err)
+		}
+		if status != OrderStatusPaid {
+			return fmt.Errorf("order %d is %s: %w", id, status, ErrOrderNotPaid)
+		}
+
+		_, err = tx.ExecContext(ctx,
+			"UPDATE orders SET status=$1, updated_at=$2 WHERE id=$3", OrderStatusShipped, time.Now(), id)
+		if err != nil {
+			return fmt.Errorf("failed to mark order %d shipped: %w", id, err)
+		}
+
+		err = insertOrderAudit(ctx, tx, id, auditStatusChanged, map[string]any{
+			"from": OrderStatusPaid,
+			"to":   OrderStatusShipped,
+		})
+		if err != nil {
+			return err
+		}
+		return insertOutboxEvent(ctx, tx, outbox.AggregateOrder, id, outbox.EventOrderShipped, map[string]any{
+			"order_id":        id,
+			"status":          OrderStatusShipped,
+			"carrier":         sh.Carrier,
+			"tracking_number": sh.TrackingNumber,
+			"tracking_url":    sh.TrackingURL,
+		})
+	})
+	if err != nil {
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrOrderNotPaid) {
+			return err
+		}
+		return logError(ctx, fmt.Errorf("failed to ship order %d: %w", id, err))
+	}
+
+	return nil
+}
+
+func insertOrderAudit(ctx context.Context, tx *sqlx.Tx, orderID int64, action string, details map[string]any) error {
+	b, err := json.Marshal(details)
+	if err != nil {
+		return fmt.Errorf("failed to encode audit details: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"INSERT INTO order_audit_log (order_id, actor, action, details, created_at) VALUES ($1, $2, $3, $4, $5)",
+		orderID, ActorFrom(ctx), action, b, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write audit log for order %d: %w", orderID, err)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package storer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/outbox"
+	"github.com/jmoiron/sqlx"
+)
+
+// insertOutboxEvent writes an event to the outbox in tx, so that it is
+// published if and only if tx commits.
+func insertOutboxEvent(ctx context.Context, tx *sqlx.Tx, aggregateType string, aggregateID int64, eventType string, payload any) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s event: %w", eventType, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO outbox_events (aggregate_type, aggregate_id, type, payload, created_at, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $5)`,
+		aggregateType, aggregateID, eventType, b, time.Now(),
+	)
+	if err != nil {
+		return fmt.Errorf("failed to write %s event for %s %d: %w", eventType, aggregateType, aggregateID, err)
+	}
+	return nil
+}
+
+func insertOrderEvent(ctx context.Context, tx *sqlx.Tx, eventType string, o *Order) error {
+	items := make([]map[string]any, 0, len(o.Items))
+	for _, oi := range o.Items {
+		items = append(items, map[string]any{
+			"product_id":   oi.ProductID,
+			"quantity":     oi.Quantity,
+			"price":        oi.Price,
+			"warehouse_id": oi.WarehouseID,
+		})
+	}
+	return insertOutboxEvent(ctx, tx, outbox.AggregateOrder, o.ID, eventType, map[string]any{
+		"order_id":       o.ID,
+		"user_id":        o.UserID,
+		"status":         o.Status,
+		"payment_method": o.PaymentMethod,
+		"total_price":    o.TotalPrice,
+		"items":          items,
+	})
+}
+
+func insertProductEvent(ctx context.Context, tx *sqlx.Tx, eventType string, p *Product) error {
+	return insertOutboxEvent(ctx, tx, outbox.AggregateProduct, p.ID, eventType, map[string]any{
+		"product_id":     p.ID,
+		"sku":            p.SKU,
+		"name":           p.Name,
+		"category":       p.Category,
+		"price":          p.Price,
+		"count_in_stock": p.CountInStock,
+	})
+}
+
+// RelayOutbox publishes up to limit waiting events, taking only the oldest
+// unpublished event of each aggregate so that an aggregate's events go out
+// in order, and one that keeps failing holds back only its own aggregate.
+// Claimed events are leased for outbox.LeaseTime and published after the
+// claim commits, so no transaction stays open while the publisher works and
+// relays running side by side do not publish the same event at once. An
+// event whose outcome is not saved is published again when its lease ends.
+func (ps *PySQLStorer) RelayOutbox(ctx context.Context, limit int, publish func(context.Context, outbox.Event) error) (int, error) {
+	defer metrics.ObserveQuery("RelayOutbox")()
+
+	var events []OutboxEvent
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		now := time.Now()
+		err := tx.SelectContext(ctx, &events,
+			`SELECT * FROM outbox_events e
+			WHERE published_at IS NULL AND next_attempt_at <= $1
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox_events p
+				WHERE p.aggregate_type = e.aggregate_type AND p.aggregate_id = e.aggregate_id
+				AND p.published_at IS NULL AND p.id < e.id
+			)
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED`,
+			now, limit,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to claim outbox events: %w", err)
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, len(events))
+		for i, e := range events {
+			ids[i] = e.ID
+		}
+		_, err = tx.ExecContext(ctx,
+			"UPDATE outbox_events SET next_attempt_at=$1 WHERE id = ANY($2)", now.Add(outbox.LeaseTime), ids)
+		if err != nil {
+			return fmt.Errorf("failed to lease outbox events: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, logError(ctx, fmt.Errorf("failed to relay outbox: %w", err))
+	}
+
+	for _, e := range events {
+		err := publish(ctx, outbox.Event{
+			ID:            e.ID,
+			Type:          e.Type,
+			AggregateType: e.AggregateType,
+			AggregateID:   e.AggregateID,
+			Payload:       json.RawMessage(e.Payload),
+			CreatedAt:     e.CreatedAt,
+		})
+		if err != nil {
+			_, err = ps.db.ExecContext(ctx,
+				"UPDATE outbox_events SET attempts=attempts+1, last_error=$1, next_attempt_at=$2 WHERE id=$3",
+				err.Error(), time.Now().Add(outbox.Backoff(e.Attempts+1)), e.ID,
+			)
+		} else {
+			_, err = ps.db.ExecContext(ctx,
+				"UPDATE outbox_events SET attempts=attempts+1, last_error='', published_at=$1 WHERE id=$2",
+				time.Now(), e.ID,
+			)
+		}
+		if err != nil {
+			return len(events), logError(ctx, fmt.Errorf("failed to save outcome of outbox event %d: %w", e.ID, err))
+		}
+	}
+
+	return len(events), nil
+}
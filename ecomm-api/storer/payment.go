@@ -0,0 +1,304 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/outbox"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/payment"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreatePayment records a payment attempt. Only declined attempts are
+// recorded for an order that is no longer pending or already has an
+// authorized or captured payment; others return ErrOrderNotPending or
+// ErrPaymentExists. A payment that is already captured marks its order
+// paid.
+func (ps *PySQLStorer) CreatePayment(ctx context.Context, p *Payment) (*Payment, error) {
+	defer metrics.ObserveQuery("CreatePayment")()
+
+	now := time.Now()
+	p.CreatedAt = now
+	p.UpdatedAt = &now
+
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		if p.Status != payment.StatusDeclined {
+			if err := lockPayableOrder(ctx, tx, p.OrderID); err != nil {
+				return err
+			}
+		}
+
+		err := tx.QueryRowxContext(ctx,
+			`INSERT INTO payments (
+				order_id, provider, reference, status, amount, captured_amount, refunded_amount, currency,
+				card_last4, redirect_url, failure_reason, created_at, updated_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			RETURNING id`,
+			p.OrderID, p.Provider, p.Reference, p.Status, p.Amount, p.CapturedAmount, p.RefundedAmount, p.Currency,
+			p.CardLast4, p.RedirectURL, p.FailureReason, p.CreatedAt, p.UpdatedAt,
+		).Scan(&p.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert payment: %w", err)
+		}
+
+		if p.Status == payment.StatusCaptured {
+			return markOrderPaid(ctx, tx, p)
+		}
+		return nil
+	})
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrOrderNotPending) || errors.Is(err, ErrPaymentExists) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to create payment for order %d: %w", p.OrderID, err))
+	}
+
+	return p, nil
+}
+
+// lockPayableOrder locks the order a new payment is for and checks that it
+// is still pending and holds no authorized or captured payment, so that two
+// attempts to pay it cannot both take the customer's money.
+func lockPayableOrder(ctx context.Context, tx *sqlx.Tx, orderID int64) error {
+	var status string
+	err := tx.GetContext(ctx, &status, "SELECT status FROM orders WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("order %d: %w", orderID, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock order with id %d: %w", orderID, err)
+	}
+	if status != OrderStatusPending {
+		return fmt.Errorf("order %d is %s: %w", orderID, status, ErrOrderNotPending)
+	}
+
+	var exists bool
+	err = tx.GetContext(ctx, &exists,
+		"SELECT EXISTS (SELECT 1 FROM payments WHERE order_id=$1 AND status = ANY($2))",
+		orderID, []string{payment.StatusAuthorized, payment.StatusCaptured},
+	)
+	if err != nil {
+		return fmt.Errorf("failed to check payments of order %d: %w", orderID, err)
+	}
+	if exists {
+		return fmt.Errorf("order %d: %w", orderID, ErrPaymentExists)
+	}
+	return nil
+}
+
+func (ps *PySQLStorer) GetPayment(ctx context.Context, id int64) (*Payment, error) {
+	defer metrics.ObserveQuery("GetPayment")()
+
+	var p Payment
+	err := ps.db.GetContext(ctx, &p, "SELECT * FROM payments WHERE id=$1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("payment %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get payment with id %d: %w", id, err))
+	}
+
+	return &p, nil
+}
+
+func (ps *PySQLStorer) ListPayments(ctx context.Context, orderID int64) ([]Payment, error) {
+	defer metrics.ObserveQuery("ListPayments")()
+
+	var exists bool
+	err := ps.db.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM orders WHERE id=$1 AND deleted_at IS NULL)", orderID)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to check order %d: %w", orderID, err))
+	}
+	if !exists {
+		return nil, fmt.Errorf("order %d: %w", orderID, ErrNotFound)
+	}
+
+	payments := []Payment{}
+	err = ps.db.SelectContext(ctx, &payments, "SELECT * FROM payments WHERE order_id=$1 ORDER BY id", orderID)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list payments of order %d: %w", orderID, err))
+	}
+
+	return payments, nil
+}
+
+func (ps *PySQLStorer) GetPaymentByReference(ctx context.Context, provider, reference string) (*Payment, error) {
+	defer metrics.ObserveQuery("GetPaymentByReference")()
+
+	var p Payment
+	err := ps.db.GetContext(ctx, &p, "SELECT * FROM payments WHERE provider=$1 AND reference=$2", provider, reference)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("payment %s/%s: %w", provider, reference, ErrNotFound)
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get payment %s/%s: %w", provider, reference, err))
+	}
+
+	return &p, nil
+}
+
+// UpdatePayment stores the new state of a payment that was in state from,
+// and returns ErrPaymentState if it no longer is. A payment that becomes
+// captured marks its order paid, or fails with ErrOrderNotPending if the
+// order is no longer pending.
+func (ps *PySQLStorer) UpdatePayment(ctx context.Context, p *Payment, from string) error {
+	defer metrics.ObserveQuery("UpdatePayment")()
+
+	now := time.Now()
+	p.UpdatedAt = &now
+
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			`UPDATE payments SET
+				status=$1, captured_amount=$2, refunded_amount=$3, redirect_url=$4, failure_reason=$5, updated_at=$6
+			WHERE id=$7 AND status=$8`,
+			p.Status, p.CapturedAmount, p.RefundedAmount, p.RedirectURL, p.FailureReason, p.UpdatedAt, p.ID, from,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update payment with id %d: %w", p.ID, err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("failed to update payment with id %d: %w", p.ID, err)
+		}
+		if n == 0 {
+			return fmt.Errorf("payment %d is no longer %s: %w", p.ID, from, ErrPaymentState)
+		}
+
+		if p.Status == payment.StatusCaptured && from != payment.StatusCaptured {
+			return markOrderPaid(ctx, tx, p)
+		}
+		return nil
+	})
+	if errors.Is(err, ErrPaymentState) || errors.Is(err, ErrOrderNotPending) {
+		return err
+	}
+	if err != nil {
+		return logError(ctx, err)
+	}
+
+	return nil
+}
+
+// markOrderPaid moves the order of a captured payment from pending to paid.
+// It returns ErrOrderNotPending for an order in any other state, so that the
+// payment is not recorded as captured for an order that was cancelled or
+// paid in the meantime.
+func markOrderPaid(ctx context.Context, tx *sqlx.Tx, p *Payment) error {
+	res, err := tx.ExecContext(ctx,
+		"UPDATE orders SET status=$1, updated_at=$2 WHERE id=$3 AND status=$4",
+		OrderStatusPaid, time.Now(), p.OrderID, OrderStatusPending,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to mark order %d paid: %w", p.OrderID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to mark order %d paid: %w", p.OrderID, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("order %d: %w", p.OrderID, ErrOrderNotPending)
+	}
+
+	err = insertOrderAudit(ctx, tx, p.OrderID, auditStatusChanged, map[string]any{
+		"from":       OrderStatusPending,
+		"to":         OrderStatusPaid,
+		"payment_id": p.ID,
+	})
+	if err != nil {
+		return err
+	}
+	return insertOutboxEvent(ctx, tx, outbox.AggregateOrder, p.OrderID, outbox.EventOrderPaid, map[string]any{
+		"order_id":   p.OrderID,
+		"payment_id": p.ID,
+		"amount":     p.CapturedAmount,
+	})
+}
+
+// RecordPaymentEvent stores a webhook event, or counts another attempt at
+// one that has not been processed yet. It returns ErrDuplicateEvent for an
+// event that was already processed.
+func (ps *PySQLStorer) RecordPaymentEvent(ctx context.Context, e *PaymentEvent) (*PaymentEvent, error) {
+	defer metrics.ObserveQuery("RecordPaymentEvent")()
+
+	e.ReceivedAt = time.Now()
+	err := ps.db.QueryRowxContext(ctx,
+		`INSERT INTO payment_events (provider, event_id, type, reference, payload, received_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (provider, event_id) DO UPDATE SET attempts = payment_events.attempts + 1
+		WHERE payment_events.processed_at IS NULL
+		RETURNING id, attempts`,
+		e.Provider, e.EventID, e.Type, e.Reference, e.Payload, e.ReceivedAt,
+	).Scan(&e.ID, &e.Attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("payment event %s/%s: %w", e.Provider, e.EventID, ErrDuplicateEvent)
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to record payment event %s/%s: %w", e.Provider, e.EventID, err))
+	}
+
+	return e, nil
+}
+
+func (ps *PySQLStorer) GetPaymentEvent(ctx context.Context, id int64) (*PaymentEvent, error) {
+	defer metrics.ObserveQuery("GetPaymentEvent")()
+
+	var e PaymentEvent
+	err := ps.db.GetContext(ctx, &e, "SELECT * FROM payment_events WHERE id=$1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("payment event %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get payment event with id %d: %w", id, err))
+	}
+
+	return &e, nil
+}
+
+// ListPaymentEvents returns the latest webhook events, newest first, or
+// only those not processed yet.
+func (ps *PySQLStorer) ListPaymentEvents(ctx context.Context, unprocessed bool, limit int) ([]PaymentEvent, error) {
+	defer metrics.ObserveQuery("ListPaymentEvents")()
+
+	query := "SELECT * FROM payment_events"
+	if unprocessed {
+		query += " WHERE processed_at IS NULL"
+	}
+	query += " ORDER BY id DESC LIMIT $1"
+
+	events := []PaymentEvent{}
+	if err := ps.db.SelectContext(ctx, &events, query, limit); err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list payment events: %w", err))
+	}
+
+	return events, nil
+}
+
+// FinishPaymentEvent records the outcome of applying a webhook event. An
+// event that failed stays unprocessed, so the provider's retry or a replay
+// applies it again.
+func (ps *PySQLStorer) FinishPaymentEvent(ctx context.Context, e *PaymentEvent, applyErr error) error {
+	defer metrics.ObserveQuery("FinishPaymentEvent")()
+
+	e.Error, e.ProcessedAt = "", nil
+	if applyErr != nil {
+		e.Error = applyErr.Error()
+	} else {
+		now := time.Now()
+		e.ProcessedAt = &now
+	}
+
+	_, err := ps.db.ExecContext(ctx,
+		"UPDATE payment_events SET error=$1, processed_at=$2 WHERE id=$3",
+		e.Error, e.ProcessedAt, e.ID,
+	)
+	if err != nil {
+		return logError(ctx, fmt.Errorf("failed to finish payment event with id %d: %w", e.ID, err))
+	}
+
+	return nil
+}
@@ -0,0 +1,461 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/promotion"
+	"github.com/jmoiron/sqlx"
+)
+
+func (ps *PySQLStorer) CreatePromotion(ctx context.Context, p *Promotion) (*Promotion, error) {
+	defer metrics.ObserveQuery("CreatePromotion")()
+
+	now := time.Now()
+	p.CreatedAt = now
+	p.Active = true
+	if p.StartsAt.IsZero() {
+		p.StartsAt = now
+	}
+
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		var exists bool
+		err := tx.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM promotions WHERE code=$1)", p.Code)
+		if err != nil {
+			return fmt.Errorf("failed to check promotion code %s: %w", p.Code, err)
+		}
+		if exists {
+			return fmt.Errorf("promotion %s: %w", p.Code, ErrDuplicateCode)
+		}
+
+		err = tx.QueryRowxContext(ctx,
+			`INSERT INTO promotions (
+				code, description, kind, value, buy_quantity, get_quantity, min_subtotal,
+				starts_at, ends_at, usage_limit, per_user_limit, active, created_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			RETURNING id`,
+			p.Code, p.Description, p.Kind, p.Value, p.BuyQuantity, p.GetQuantity, p.MinSubtotal,
+			p.StartsAt, p.EndsAt, p.UsageLimit, p.PerUserLimit, p.Active, p.CreatedAt,
+		).Scan(&p.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert promotion: %w", err)
+		}
+
+		for _, id := range p.ProductIDs {
+			_, err := tx.ExecContext(ctx, "INSERT INTO promotion_scopes (promotion_id, product_id) VALUES ($1, $2)", p.ID, id)
+			if err != nil {
+				return fmt.Errorf("failed to scope promotion %d to product %d: %w", p.ID, id, err)
+			}
+		}
+		for _, c := range p.Categories {
+			_, err := tx.ExecContext(ctx, "INSERT INTO promotion_scopes (promotion_id, category) VALUES ($1, $2)", p.ID, c)
+			if err != nil {
+				return fmt.Errorf("failed to scope promotion %d to category %s: %w", p.ID, c, err)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrDuplicateCode) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to create promotion %s: %w", p.Code, err))
+	}
+
+	return p, nil
+}
+
+func (ps *PySQLStorer) GetPromotion(ctx context.Context, id int64) (*Promotion, error) {
+	defer metrics.ObserveQuery("GetPromotion")()
+
+	var p Promotion
+	err := ps.db.GetContext(ctx, &p, "SELECT * FROM promotions WHERE id=$1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("promotion %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get promotion with id %d: %w", id, err))
+	}
+
+	promotions := []Promotion{p}
+	if err := loadPromotionScopes(ctx, ps.db, promotions); err != nil {
+		return nil, logError(ctx, err)
+	}
+
+	return &promotions[0], nil
+}
+
+func (ps *PySQLStorer) ListPromotions(ctx context.Context) ([]Promotion, error) {
+	defer metrics.ObserveQuery("ListPromotions")()
+
+	promotions := []Promotion{}
+	err := ps.db.SelectContext(ctx, &promotions, "SELECT * FROM promotions ORDER BY id DESC")
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list promotions: %w", err))
+	}
+
+	if err := loadPromotionScopes(ctx, ps.db, promotions); err != nil {
+		return nil, logError(ctx, err)
+	}
+
+	return promotions, nil
+}
+
+// DeactivatePromotion stops a promotion from being redeemed. Orders that
+// already used it keep their discounts.
+func (ps *PySQLStorer) DeactivatePromotion(ctx context.Context, id int64) error {
+	defer metrics.ObserveQuery("DeactivatePromotion")()
+
+	res, err := ps.db.ExecContext(ctx,
+		"UPDATE promotions SET active=FALSE, updated_at=$1 WHERE id=$2", time.Now(), id)
+	if err != nil {
+		return logError(ctx, fmt.Errorf("failed to deactivate promotion with id %d: %w", id, err))
+	}
+	return expectAffected(res, "promotion", id)
+}
+
+func loadPromotionScopes(ctx context.Context, q sqlx.QueryerContext, promotions []Promotion) error {
+	if len(promotions) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(promotions))
+	byID := make(map[int64]*Promotion, len(promotions))
+	for i := range promotions {
+		ids[i] = promotions[i].ID
+		byID[promotions[i].ID] = &promotions[i]
+	}
+
+	var scopes []struct {
+		PromotionID int64          `db:"promotion_id"`
+		ProductID   sql.NullInt64  `db:"product_id"`
+		Category    sql.NullString `db:"category"`
+	}
+	err := sqlx.SelectContext(ctx, q, &scopes,
+		"SELECT promotion_id, product_id, category FROM promotion_scopes WHERE promotion_id = ANY($1) ORDER BY id", ids)
+	if err != nil {
+		return fmt.Errorf("failed to get promotion scopes: %w", err)
+	}
+
+	for _, s := range scopes {
+		p := byID[s.PromotionID]
+		if s.ProductID.Valid {
+			p.ProductIDs = append(p.ProductIDs, s.ProductID.Int64)
+		}
+		if s.Category.Valid {
+			p.Categories = append(p.Categories, s.Category.String)
+		}
+	}
+	return nil
+}
+
+// redeemPromotions locks the promotions behind codes, checks that userID may
+// still use them and records their redemption by the order. The rules are
+// returned in the order the codes were given.
+//
+// The per-user limit is counted against the order's user_id, which comes
+// from the client; until orders are tied to an authenticated user it only
+// holds for clients that report it honestly.
+func redeemPromotions(ctx context.Context, tx *sqlx.Tx, o *Order, codes []string) ([]promotion.Rule, error) {
+	var promotions []Promotion
+	err := tx.SelectContext(ctx, &promotions,
+		"SELECT * FROM promotions WHERE code = ANY($1) AND active ORDER BY id FOR UPDATE", codes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get promotions: %w", err)
+	}
+	if err := loadPromotionScopes(ctx, tx, promotions); err != nil {
+		return nil, err
+	}
+
+	byCode := make(map[string]*Promotion, len(promotions))
+	ids := make([]int64, len(promotions))
+	for i := range promotions {
+		byCode[promotions[i].Code] = &promotions[i]
+		ids[i] = promotions[i].ID
+	}
+
+	var uses []struct {
+		PromotionID int64 `db:"promotion_id"`
+		Uses        int64 `db:"uses"`
+	}
+	err = tx.SelectContext(ctx, &uses,
+		`SELECT promotion_id, COUNT(*) AS uses FROM promotion_redemptions
+		WHERE user_id=$1 AND promotion_id = ANY($2)
+		GROUP BY promotion_id`,
+		o.UserID, ids,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count promotion uses: %w", err)
+	}
+	userUses := make(map[int64]int64, len(uses))
+	for _, u := range uses {
+		userUses[u.PromotionID] = u.Uses
+	}
+
+	rules := make([]promotion.Rule, 0, len(codes))
+	for _, code := range codes {
+		p, ok := byCode[code]
+		if !ok {
+			err := &promotion.IneligibleError{Code: code, Reason: "does not exist"}
+			return nil, fmt.Errorf("%w: %w", ErrInvalidCoupon, err)
+		}
+		rule := toRule(p)
+		rule.UserUses = userUses[p.ID]
+		rules = append(rules, rule)
+	}
+
+	for _, p := range promotions {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO promotion_redemptions (promotion_id, order_id, user_id, created_at) VALUES ($1, $2, $3, $4)",
+			p.ID, o.ID, o.UserID, o.CreatedAt,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to redeem promotion %d: %w", p.ID, err)
+		}
+		_, err = tx.ExecContext(ctx, "UPDATE promotions SET times_used = times_used + 1 WHERE id=$1", p.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count use of promotion %d: %w", p.ID, err)
+		}
+	}
+
+	return rules, nil
+}
+
+// releasePromotions gives back the promotion uses of a cancelled order, so
+// they count neither towards the usage limit nor towards the user's.
+func releasePromotions(ctx context.Context, tx *sqlx.Tx, orderID int64) error {
+	var ids []int64
+	err := tx.SelectContext(ctx, &ids,
+		"DELETE FROM promotion_redemptions WHERE order_id=$1 RETURNING promotion_id", orderID)
+	if err != nil {
+		return fmt.Errorf("failed to release promotions of order %d: %w", orderID, err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE promotions SET times_used = times_used - 1 WHERE id = ANY($1) AND times_used > 0", ids)
+	if err != nil {
+		return fmt.Errorf("failed to release promotion uses of order %d: %w", orderID, err)
+	}
+	return nil
+}
+
+// redeemedRules returns the promotions an order was created with. Their
+// limits were checked when they were redeemed, so they are left out.
+func redeemedRules(ctx context.Context, tx *sqlx.Tx, orderID int64) ([]promotion.Rule, error) {
+	var promotions []Promotion
+	err := tx.SelectContext(ctx, &promotions,
+		`SELECT p.* FROM promotions p
+		JOIN promotion_redemptions r ON r.promotion_id = p.id
+		WHERE r.order_id=$1
+		ORDER BY r.id`,
+		orderID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get promotions of order %d: %w", orderID, err)
+	}
+	if err := loadPromotionScopes(ctx, tx, promotions); err != nil {
+		return nil, err
+	}
+
+	rules := make([]promotion.Rule, len(promotions))
+	for i := range promotions {
+		rules[i] = toRule(&promotions[i])
+		rules[i].UsageLimit = 0
+		rules[i].PerUserLimit = 0
+	}
+	return rules, nil
+}
+
+func toRule(p *Promotion) promotion.Rule {
+	return promotion.Rule{
+		ID:           p.ID,
+		Code:         p.Code,
+		Kind:         p.Kind,
+		Value:        p.Value,
+		BuyQuantity:  p.BuyQuantity,
+		GetQuantity:  p.GetQuantity,
+		MinSubtotal:  p.MinSubtotal,
+		StartsAt:     p.StartsAt,
+		EndsAt:       p.EndsAt,
+		UsageLimit:   p.UsageLimit,
+		PerUserLimit: p.PerUserLimit,
+		TimesUsed:    p.TimesUsed,
+		ProductIDs:   p.ProductIDs,
+		Categories:   p.Categories,
+	}
+}
+
+// priceOrder recomputes the adjustments and totals of an order from its
+// current items and the given rules. The items' tax is worked out on the
+// catalogue price, so each item's tax is scaled down by its share of the
+// discounts before it is added to the order's. Rules that must apply fail
+// the whole order with ErrInvalidCoupon; otherwise ineligible rules are
+// skipped, which is how an edit that drops an order below a minimum
+// subtotal loses its discount.
+func priceOrder(ctx context.Context, tx *sqlx.Tx, o *Order, rules []promotion.Rule, strict bool) error {
+	var items []struct {
+		OrderItem
+		Category string `db:"category"`
+	}
+	err := tx.SelectContext(ctx, &items,
+		`SELECT oi.*, p.category FROM order_items oi
+		JOIN products p ON p.id = oi.product_id
+		WHERE oi.order_id=$1
+		ORDER BY oi.id`,
+		o.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get order items for order id %d: %w", o.ID, err)
+	}
+
+	// One cart line per product, however many warehouses it ships from;
+	// line-level adjustments go on the product's first item.
+	cart := promotion.Cart{Shipping: o.ShippingPrice, Now: o.CreatedAt}
+	var (
+		lineItem  []int64
+		lineIndex = map[int64]int{}
+		itemLine  = make([]int, len(items))
+		gross     = make([]float64, len(items))
+		subtotal  float64
+	)
+	for k, oi := range items {
+		gross[k] = oi.Price * float64(oi.Quantity)
+		subtotal += gross[k]
+		if i, ok := lineIndex[oi.ProductID]; ok {
+			itemLine[k] = i
+			cart.Lines[i].Quantity += oi.Quantity
+			continue
+		}
+		itemLine[k] = len(cart.Lines)
+		lineIndex[oi.ProductID] = len(cart.Lines)
+		lineItem = append(lineItem, oi.ID)
+		cart.Lines = append(cart.Lines, promotion.Line{
+			ProductID: oi.ProductID,
+			Category:  oi.Category,
+			Price:     oi.Price,
+			Quantity:  oi.Quantity,
+		})
+	}
+
+	if !strict {
+		eligible := rules[:0]
+		for _, r := range rules {
+			if r.Eligible(cart) == nil {
+				eligible = append(eligible, r)
+			}
+		}
+		rules = eligible
+	}
+
+	res, err := promotion.Apply(cart, rules)
+	if errors.Is(err, promotion.ErrIneligible) {
+		return fmt.Errorf("%w: %w", ErrInvalidCoupon, err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply promotions to order %d: %w", o.ID, err)
+	}
+
+	if _, err := tx.ExecContext(ctx, "DELETE FROM order_adjustments WHERE order_id=$1", o.ID); err != nil {
+		return fmt.Errorf("failed to clear adjustments of order %d: %w", o.ID, err)
+	}
+	o.Adjustments = nil
+
+	for _, a := range res.Adjustments {
+		adj := OrderAdjustment{
+			OrderID:     o.ID,
+			PromotionID: &a.RuleID,
+			Code:        a.Code,
+			Kind:        AdjustmentDiscount,
+			Amount:      a.Amount,
+			Description: a.Description,
+			CreatedAt:   time.Now(),
+		}
+		if a.Shipping {
+			adj.Kind = AdjustmentShippingDiscount
+		}
+		if a.Line >= 0 {
+			adj.OrderItemID = &lineItem[a.Line]
+		}
+
+		err := tx.QueryRowxContext(ctx,
+			`INSERT INTO order_adjustments (order_id, order_item_id, promotion_id, code, kind, amount, description, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+			RETURNING id`,
+			adj.OrderID, adj.OrderItemID, adj.PromotionID, adj.Code, adj.Kind, adj.Amount, adj.Description, adj.CreatedAt,
+		).Scan(&adj.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert adjustment for order %d: %w", o.ID, err)
+		}
+		o.Adjustments = append(o.Adjustments, adj)
+	}
+
+	var tax float64
+	discounts := itemDiscounts(gross, itemLine, res.Adjustments)
+	for k, oi := range items {
+		if gross[k] > 0 {
+			tax += oi.TaxAmount * (gross[k] - discounts[k]) / gross[k]
+		}
+	}
+
+	o.DiscountPrice = res.Discount + res.ShippingDiscount
+	o.TaxPrice = math.Round(tax*100) / 100
+	o.TotalPrice = subtotal - o.DiscountPrice + o.ShippingPrice
+	if !o.TaxInclusive {
+		o.TotalPrice += o.TaxPrice
+	}
+
+	_, err = tx.ExecContext(ctx,
+		"UPDATE orders SET discount_price=$1, tax_price=$2, total_price=$3 WHERE id=$4",
+		o.DiscountPrice, o.TaxPrice, o.TotalPrice, o.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update totals of order %d: %w", o.ID, err)
+	}
+	return nil
+}
+
+// itemDiscounts shares the item discounts of adjustments between the order
+// items, whose prices are gross and whose cart lines are itemLine. A line
+// discount goes to the items of its line and an order discount to all of
+// them, in proportion to what is left of their price; shipping discounts
+// are left out. Each adjustment's shares add up to its amount exactly.
+func itemDiscounts(gross []float64, itemLine []int, adjustments []promotion.Adjustment) []float64 {
+	res := make([]float64, len(gross))
+	for _, a := range adjustments {
+		if a.Shipping {
+			continue
+		}
+
+		var items []int
+		var left float64
+		for k := range gross {
+			if a.Line >= 0 && itemLine[k] != a.Line {
+				continue
+			}
+			items = append(items, k)
+			left += gross[k] - res[k]
+		}
+		if left <= 0 {
+			continue
+		}
+
+		amount := math.Min(a.Amount, left)
+		rest := amount
+		for i, k := range items {
+			share := math.Round(amount*(gross[k]-res[k])/left*100) / 100
+			if i == len(items)-1 {
+				share = math.Round(rest*100) / 100
+			}
+			res[k] += share
+			rest -= share
+		}
+	}
+	return res
+}
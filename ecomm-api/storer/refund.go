@@ -0,0 +1,196 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/payment"
+	"github.com/jmoiron/sqlx"
+)
+
+// RecordRefund stores a refund already made through payment p and credits
+// it to the payment, the order and, if set, the return. The payment becomes
+// refunded once all of it has been given back; p is updated to match.
+func (ps *PySQLStorer) RecordRefund(ctx context.Context, rf *Refund, p *Payment) (*Refund, error) {
+	defer metrics.ObserveQuery("RecordRefund")()
+
+	rf.Status = RefundStatusSucceeded
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		if err := insertRefund(ctx, tx, rf, p); err != nil {
+			return err
+		}
+		return creditRefund(ctx, tx, rf)
+	})
+	if errors.Is(err, ErrRefundTooLarge) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to record refund for order %d: %w", rf.OrderID, err))
+	}
+
+	return rf, nil
+}
+
+// BeginRefund records a refund about to be made through payment p as
+// pending and holds its amount on the payment, so that concurrent refunds
+// cannot give back more than was captured. CompleteRefund or FailRefund
+// settles it once the refunder has answered.
+func (ps *PySQLStorer) BeginRefund(ctx context.Context, rf *Refund, p *Payment) (*Refund, error) {
+	defer metrics.ObserveQuery("BeginRefund")()
+
+	rf.Status = RefundStatusPending
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		return insertRefund(ctx, tx, rf, p)
+	})
+	if errors.Is(err, ErrRefundTooLarge) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to begin refund for order %d: %w", rf.OrderID, err))
+	}
+
+	return rf, nil
+}
+
+// CompleteRefund marks a pending refund made under the refunder's
+// reference and credits it to the order and, if set, the return.
+func (ps *PySQLStorer) CompleteRefund(ctx context.Context, rf *Refund) error {
+	defer metrics.ObserveQuery("CompleteRefund")()
+
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		if err := settleRefund(ctx, tx, rf, RefundStatusSucceeded); err != nil {
+			return err
+		}
+		return creditRefund(ctx, tx, rf)
+	})
+	if err != nil {
+		return logError(ctx, fmt.Errorf("failed to complete refund %d: %w", rf.ID, err))
+	}
+
+	return nil
+}
+
+// FailRefund marks a pending refund that the refunder turned down and gives
+// its amount back to payment p; p is updated to match.
+func (ps *PySQLStorer) FailRefund(ctx context.Context, rf *Refund, p *Payment) error {
+	defer metrics.ObserveQuery("FailRefund")()
+
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		if err := settleRefund(ctx, tx, rf, RefundStatusFailed); err != nil {
+			return err
+		}
+
+		err := tx.QueryRowxContext(ctx,
+			`UPDATE payments SET refunded_amount = refunded_amount - $1, status = $2, updated_at = $3
+			WHERE id=$4
+			RETURNING status, refunded_amount, updated_at`,
+			rf.Amount, payment.StatusCaptured, time.Now(), p.ID,
+		).Scan(&p.Status, &p.RefundedAmount, &p.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to release refund from payment %d: %w", p.ID, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return logError(ctx, fmt.Errorf("failed to fail refund %d: %w", rf.ID, err))
+	}
+
+	return nil
+}
+
+// insertRefund credits rf to payment p and stores it.
+func insertRefund(ctx context.Context, tx *sqlx.Tx, rf *Refund, p *Payment) error {
+	rf.OrderID, rf.PaymentID, rf.Provider = p.OrderID, &p.ID, p.Provider
+	rf.Actor, rf.CreatedAt = ActorFrom(ctx), time.Now()
+
+	err := tx.QueryRowxContext(ctx,
+		`UPDATE payments SET
+			refunded_amount = refunded_amount + $1,
+			status = CASE WHEN refunded_amount + $1 >= captured_amount THEN $2 ELSE status END,
+			updated_at = $3
+		WHERE id=$4 AND status=$5 AND refunded_amount + $1 <= captured_amount
+		RETURNING status, refunded_amount, updated_at`,
+		rf.Amount, payment.StatusRefunded, rf.CreatedAt, p.ID, payment.StatusCaptured,
+	).Scan(&p.Status, &p.RefundedAmount, &p.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("refund %.2f of payment %d: %w", rf.Amount, p.ID, ErrRefundTooLarge)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to credit refund to payment %d: %w", p.ID, err)
+	}
+
+	err = tx.QueryRowxContext(ctx,
+		`INSERT INTO refunds (order_id, payment_id, return_id, amount, reason, provider, reference, actor, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`,
+		rf.OrderID, rf.PaymentID, rf.ReturnID, rf.Amount, rf.Reason, rf.Provider, rf.Reference, rf.Actor, rf.Status, rf.CreatedAt,
+	).Scan(&rf.ID)
+	if err != nil {
+		return fmt.Errorf("failed to insert refund: %w", err)
+	}
+	return nil
+}
+
+// settleRefund moves a pending refund to status.
+func settleRefund(ctx context.Context, tx *sqlx.Tx, rf *Refund, status string) error {
+	res, err := tx.ExecContext(ctx,
+		"UPDATE refunds SET status=$1, reference=$2 WHERE id=$3 AND status=$4",
+		status, rf.Reference, rf.ID, RefundStatusPending,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to settle refund %d: %w", rf.ID, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to settle refund %d: %w", rf.ID, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("refund %d is no longer pending", rf.ID)
+	}
+	rf.Status = status
+	return nil
+}
+
+// creditRefund credits a refund that was made to its order and, if set, its
+// return.
+func creditRefund(ctx context.Context, tx *sqlx.Tx, rf *Refund) error {
+	_, err := tx.ExecContext(ctx,
+		"UPDATE orders SET refunded_amount = refunded_amount + $1, updated_at=$2 WHERE id=$3",
+		rf.Amount, time.Now(), rf.OrderID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to credit refund to order %d: %w", rf.OrderID, err)
+	}
+
+	if rf.ReturnID != nil {
+		_, err = tx.ExecContext(ctx,
+			"UPDATE returns SET refunded_amount = refunded_amount + $1, updated_at=$2 WHERE id=$3",
+			rf.Amount, time.Now(), *rf.ReturnID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to credit refund to return %d: %w", *rf.ReturnID, err)
+		}
+	}
+
+	return insertOrderAudit(ctx, tx, rf.OrderID, auditRefunded, map[string]any{
+		"refund_id":  rf.ID,
+		"payment_id": rf.PaymentID,
+		"return_id":  rf.ReturnID,
+		"amount":     rf.Amount,
+	})
+}
+
+func (ps *PySQLStorer) ListRefunds(ctx context.Context, orderID int64) ([]Refund, error) {
+	defer metrics.ObserveQuery("ListRefunds")()
+
+	refunds := []Refund{}
+	err := ps.db.SelectContext(ctx, &refunds, "SELECT * FROM refunds WHERE order_id=$1 ORDER BY id", orderID)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list refunds of order %d: %w", orderID, err))
+	}
+
+	return refunds, nil
+}
@@ -0,0 +1,269 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/jmoiron/sqlx"
+)
+
+// CreateReturn requests the return of items of a paid order. Each item may
+// only be returned up to the quantity ordered, counting the returns that
+// were not rejected.
+func (ps *PySQLStorer) CreateReturn(ctx context.Context, r *Return) (*Return, error) {
+	defer metrics.ObserveQuery("CreateReturn")()
+
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		var status string
+		err := tx.GetContext(ctx, &status, "SELECT status FROM orders WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", r.OrderID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("order %d: %w", r.OrderID, ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock order with id %d: %w", r.OrderID, err)
+		}
+		if status != OrderStatusPaid && status != OrderStatusShipped && status != OrderStatusDelivered {
+			return fmt.Errorf("order %d is %s: %w", r.OrderID, status, ErrNotReturnable)
+		}
+
+		left, err := returnableQuantities(ctx, tx, r.OrderID)
+		if err != nil {
+			return err
+		}
+		for i := range r.Items {
+			it := &r.Items[i]
+			oi, ok := left[it.OrderItemID]
+			if !ok {
+				return fmt.Errorf("item %d is not part of order %d: %w", it.OrderItemID, r.OrderID, ErrNotReturnable)
+			}
+			if it.Quantity > oi.Quantity {
+				return fmt.Errorf("%d of item %d asked, %d left to return: %w", it.Quantity, it.OrderItemID, oi.Quantity, ErrNotReturnable)
+			}
+			oi.Quantity -= it.Quantity
+			left[it.OrderItemID] = oi
+			it.ProductID = oi.ProductID
+		}
+
+		now := time.Now()
+		r.Status, r.CreatedAt, r.UpdatedAt = ReturnStatusRequested, now, &now
+		err = tx.QueryRowxContext(ctx,
+			"INSERT INTO returns (order_id, status, note, created_at, updated_at) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+			r.OrderID, r.Status, r.Note, r.CreatedAt, r.UpdatedAt,
+		).Scan(&r.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert return: %w", err)
+		}
+
+		for i := range r.Items {
+			it := &r.Items[i]
+			it.ReturnID = r.ID
+			err := tx.QueryRowxContext(ctx,
+				"INSERT INTO return_items (return_id, order_item_id, product_id, quantity, reason) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+				it.ReturnID, it.OrderItemID, it.ProductID, it.Quantity, it.Reason,
+			).Scan(&it.ID)
+			if err != nil {
+				return fmt.Errorf("failed to insert return item: %w", err)
+			}
+		}
+
+		return insertOrderAudit(ctx, tx, r.OrderID, auditReturnRequested, map[string]any{
+			"return_id": r.ID,
+			"items":     len(r.Items),
+		})
+	})
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrNotReturnable) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to create return for order %d: %w", r.OrderID, err))
+	}
+
+	return r, nil
+}
+
+// returnableQuantities returns the ID, product and quantity of the items of
+// an order, keyed by ID, with Quantity reduced by what has been asked back in
+// returns not rejected.
+func returnableQuantities(ctx context.Context, tx *sqlx.Tx, orderID int64) (map[int64]OrderItem, error) {
+	var items []OrderItem
+	err := tx.SelectContext(ctx, &items,
+		`SELECT oi.id, oi.product_id, oi.quantity - COALESCE((
+			SELECT SUM(ri.quantity) FROM return_items ri
+			JOIN returns r ON r.id = ri.return_id
+			WHERE ri.order_item_id = oi.id AND r.status <> $2
+		), 0) AS quantity
+		FROM order_items oi WHERE oi.order_id=$1`,
+		orderID, ReturnStatusRejected,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get returnable items of order %d: %w", orderID, err)
+	}
+
+	left := make(map[int64]OrderItem, len(items))
+	for _, oi := range items {
+		left[oi.ID] = oi
+	}
+	return left, nil
+}
+
+func (ps *PySQLStorer) GetReturn(ctx context.Context, id int64) (*Return, error) {
+	defer metrics.ObserveQuery("GetReturn")()
+
+	var r Return
+	err := ps.db.GetContext(ctx, &r, "SELECT * FROM returns WHERE id=$1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("return %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get return with id %d: %w", id, err))
+	}
+
+	returns := []Return{r}
+	if err := loadReturnItems(ctx, ps.db, returns); err != nil {
+		return nil, logError(ctx, err)
+	}
+
+	return &returns[0], nil
+}
+
+// ListReturns returns returns newest first.
+func (ps *PySQLStorer) ListReturns(ctx context.Context, f ReturnFilter) ([]Return, error) {
+	defer metrics.ObserveQuery("ListReturns")()
+
+	query := "SELECT * FROM returns WHERE TRUE"
+	var args []any
+	if f.OrderID != 0 {
+		args = append(args, f.OrderID)
+		query += fmt.Sprintf(" AND order_id = $%d", len(args))
+	}
+	if f.Status != "" {
+		args = append(args, f.Status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	query += " ORDER BY id DESC"
+
+	returns := []Return{}
+	if err := ps.db.SelectContext(ctx, &returns, query, args...); err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list returns: %w", err))
+	}
+
+	if err := loadReturnItems(ctx, ps.db, returns); err != nil {
+		return nil, logError(ctx, err)
+	}
+
+	return returns, nil
+}
+
+func loadReturnItems(ctx context.Context, q sqlx.QueryerContext, returns []Return) error {
+	if len(returns) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(returns))
+	byID := make(map[int64]*Return, len(returns))
+	for i := range returns {
+		ids[i] = returns[i].ID
+		byID[returns[i].ID] = &returns[i]
+	}
+
+	var items []ReturnItem
+	err := sqlx.SelectContext(ctx, q, &items, "SELECT * FROM return_items WHERE return_id = ANY($1) ORDER BY id", ids)
+	if err != nil {
+		return fmt.Errorf("failed to get items for returns: %w", err)
+	}
+
+	for _, it := range items {
+		if r, ok := byID[it.ReturnID]; ok {
+			r.Items = append(r.Items, it)
+		}
+	}
+
+	return nil
+}
+
+// ApproveReturn accepts a requested return. With restock, the returned
+// items go back into the stock of the warehouses they shipped from.
+func (ps *PySQLStorer) ApproveReturn(ctx context.Context, id int64, restock bool, note string) (*Return, error) {
+	return ps.decideReturn(ctx, "ApproveReturn", id, ReturnStatusApproved, restock, note)
+}
+
+func (ps *PySQLStorer) RejectReturn(ctx context.Context, id int64, note string) (*Return, error) {
+	return ps.decideReturn(ctx, "RejectReturn", id, ReturnStatusRejected, false, note)
+}
+
+func (ps *PySQLStorer) decideReturn(ctx context.Context, op string, id int64, status string, restock bool, note string) (*Return, error) {
+	defer metrics.ObserveQuery(op)()
+	ctx, changes := trackStockChanges(ctx)
+
+	var r Return
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, &r, "SELECT * FROM returns WHERE id=$1 FOR UPDATE", id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("return %d: %w", id, ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to lock return with id %d: %w", id, err)
+		}
+		if r.Status != ReturnStatusRequested {
+			return fmt.Errorf("return %d is %s: %w", id, r.Status, ErrReturnState)
+		}
+
+		returns := []Return{r}
+		if err := loadReturnItems(ctx, tx, returns); err != nil {
+			return err
+		}
+		r = returns[0]
+
+		if restock {
+			for _, it := range r.Items {
+				var warehouseID int64
+				err := tx.GetContext(ctx, &warehouseID, "SELECT warehouse_id FROM order_items WHERE id=$1", it.OrderItemID)
+				if err != nil {
+					return fmt.Errorf("failed to get order item %d: %w", it.OrderItemID, err)
+				}
+				err = adjustStock(ctx, tx, &StockMovement{
+					ProductID:   it.ProductID,
+					WarehouseID: warehouseID,
+					Delta:       it.Quantity,
+					Reason:      MovementReturn,
+					Reference:   orderReference(r.OrderID),
+				})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
+		now := time.Now()
+		r.Status, r.DecisionNote, r.DecidedBy, r.DecidedAt, r.UpdatedAt = status, note, ActorFrom(ctx), &now, &now
+		_, err = tx.ExecContext(ctx,
+			"UPDATE returns SET status=$1, decision_note=$2, decided_by=$3, decided_at=$4, updated_at=$4 WHERE id=$5",
+			r.Status, r.DecisionNote, r.DecidedBy, now, r.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update return with id %d: %w", r.ID, err)
+		}
+
+		action := auditReturnRejected
+		if status == ReturnStatusApproved {
+			action = auditReturnApproved
+		}
+		return insertOrderAudit(ctx, tx, r.OrderID, action, map[string]any{
+			"return_id": r.ID,
+			"restocked": restock,
+		})
+	})
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrReturnState) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to decide return %d: %w", id, err))
+	}
+
+	ps.stockChanged(ctx, changes)
+	return &r, nil
+}
@@ -0,0 +1,224 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/shipping"
+	"github.com/jmoiron/sqlx"
+)
+
+func (ps *PySQLStorer) ListShippingMethods(ctx context.Context) ([]ShippingMethod, error) {
+	defer metrics.ObserveQuery("ListShippingMethods")()
+
+	methods := []ShippingMethod{}
+	err := ps.db.SelectContext(ctx, &methods, "SELECT * FROM shipping_methods WHERE active ORDER BY id")
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list shipping methods: %w", err))
+	}
+
+	return methods, nil
+}
+
+func (ps *PySQLStorer) CreateShippingZone(ctx context.Context, z *ShippingZone) (*ShippingZone, error) {
+	defer metrics.ObserveQuery("CreateShippingZone")()
+
+	z.CreatedAt = time.Now()
+
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		var exists bool
+		err := tx.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM shipping_zones WHERE name=$1)", z.Name)
+		if err != nil {
+			return fmt.Errorf("failed to check shipping zone %s: %w", z.Name, err)
+		}
+		if exists {
+			return fmt.Errorf("shipping zone %s: %w", z.Name, ErrDuplicateName)
+		}
+
+		err = tx.QueryRowxContext(ctx,
+			"INSERT INTO shipping_zones (name, created_at) VALUES ($1, $2) RETURNING id",
+			z.Name, z.CreatedAt,
+		).Scan(&z.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert shipping zone: %w", err)
+		}
+
+		for i := range z.Regions {
+			r := &z.Regions[i]
+			r.ZoneID = z.ID
+			r.Country = strings.ToUpper(r.Country)
+			_, err := tx.ExecContext(ctx,
+				`INSERT INTO shipping_zone_regions (zone_id, country, region) VALUES ($1, $2, $3)
+				ON CONFLICT DO NOTHING`,
+				r.ZoneID, r.Country, r.Region,
+			)
+			if err != nil {
+				return fmt.Errorf("failed to add %s %s to shipping zone %d: %w", r.Country, r.Region, z.ID, err)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, ErrDuplicateName) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to create shipping zone %s: %w", z.Name, err))
+	}
+
+	return z, nil
+}
+
+func (ps *PySQLStorer) ListShippingZones(ctx context.Context) ([]ShippingZone, error) {
+	defer metrics.ObserveQuery("ListShippingZones")()
+
+	zones, err := listShippingZones(ctx, ps.db)
+	if err != nil {
+		return nil, logError(ctx, err)
+	}
+	return zones, nil
+}
+
+func listShippingZones(ctx context.Context, q sqlx.QueryerContext) ([]ShippingZone, error) {
+	zones := []ShippingZone{}
+	if err := sqlx.SelectContext(ctx, q, &zones, "SELECT * FROM shipping_zones ORDER BY id"); err != nil {
+		return nil, fmt.Errorf("failed to list shipping zones: %w", err)
+	}
+
+	var regions []ShippingZoneRegion
+	err := sqlx.SelectContext(ctx, q, &regions, "SELECT * FROM shipping_zone_regions ORDER BY zone_id, country, region")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shipping zone regions: %w", err)
+	}
+
+	byZone := make(map[int64][]ShippingZoneRegion, len(zones))
+	for _, r := range regions {
+		byZone[r.ZoneID] = append(byZone[r.ZoneID], r)
+	}
+	for i := range zones {
+		zones[i].Regions = byZone[zones[i].ID]
+	}
+	return zones, nil
+}
+
+// CreateShippingRate adds a rate for the method named by r.Method.
+func (ps *PySQLStorer) CreateShippingRate(ctx context.Context, r *ShippingRate) (*ShippingRate, error) {
+	defer metrics.ObserveQuery("CreateShippingRate")()
+
+	r.CreatedAt = time.Now()
+
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.GetContext(ctx, &r.MethodID, "SELECT id FROM shipping_methods WHERE code=$1", r.Method)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("shipping method %s: %w", r.Method, ErrUnknownShippingMethod)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get shipping method %s: %w", r.Method, err)
+		}
+
+		if r.ZoneID != nil {
+			var exists bool
+			err := tx.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM shipping_zones WHERE id=$1)", *r.ZoneID)
+			if err != nil {
+				return fmt.Errorf("failed to check shipping zone %d: %w", *r.ZoneID, err)
+			}
+			if !exists {
+				return fmt.Errorf("shipping zone %d: %w", *r.ZoneID, ErrUnknownShippingZone)
+			}
+		}
+
+		err = tx.QueryRowxContext(ctx,
+			`INSERT INTO shipping_rates (
+				method_id, zone_id, min_weight, max_weight, min_subtotal, max_subtotal, price, per_kg, free_above, created_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING id`,
+			r.MethodID, r.ZoneID, r.MinWeight, r.MaxWeight, r.MinSubtotal, r.MaxSubtotal, r.Price, r.PerKg, r.FreeAbove, r.CreatedAt,
+		).Scan(&r.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert shipping rate: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, ErrUnknownShippingMethod) || errors.Is(err, ErrUnknownShippingZone) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to create shipping rate for %s: %w", r.Method, err))
+	}
+
+	return r, nil
+}
+
+func (ps *PySQLStorer) ListShippingRates(ctx context.Context) ([]ShippingRate, error) {
+	defer metrics.ObserveQuery("ListShippingRates")()
+
+	rates, err := listShippingRates(ctx, ps.db)
+	if err != nil {
+		return nil, logError(ctx, err)
+	}
+	return rates, nil
+}
+
+func listShippingRates(ctx context.Context, q sqlx.QueryerContext) ([]ShippingRate, error) {
+	rates := []ShippingRate{}
+	err := sqlx.SelectContext(ctx, q, &rates,
+		`SELECT r.*, m.code AS method FROM shipping_rates r
+		JOIN shipping_methods m ON m.id = r.method_id
+		WHERE m.active
+		ORDER BY m.id, r.id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list shipping rates: %w", err)
+	}
+	return rates, nil
+}
+
+// ShippingTable loads the active methods with their zones and rates, for
+// quoting.
+func (ps *PySQLStorer) ShippingTable(ctx context.Context) (*shipping.Table, error) {
+	defer metrics.ObserveQuery("ShippingTable")()
+
+	var methods []ShippingMethod
+	err := ps.db.SelectContext(ctx, &methods, "SELECT * FROM shipping_methods WHERE active ORDER BY id")
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list shipping methods: %w", err))
+	}
+	zones, err := listShippingZones(ctx, ps.db)
+	if err != nil {
+		return nil, logError(ctx, err)
+	}
+	rates, err := listShippingRates(ctx, ps.db)
+	if err != nil {
+		return nil, logError(ctx, err)
+	}
+
+	t := &shipping.Table{}
+	for _, m := range methods {
+		t.Methods = append(t.Methods, shipping.Method{Code: m.Code, Name: m.Name})
+	}
+	for _, z := range zones {
+		zone := shipping.Zone{ID: z.ID, Name: z.Name}
+		for _, r := range z.Regions {
+			zone.Regions = append(zone.Regions, shipping.Destination{Country: r.Country, Region: r.Region})
+		}
+		t.Zones = append(t.Zones, zone)
+	}
+	for _, r := range rates {
+		t.Rates = append(t.Rates, shipping.Rate{
+			ID:          r.ID,
+			Method:      r.Method,
+			ZoneID:      r.ZoneID,
+			MinWeight:   r.MinWeight,
+			MaxWeight:   r.MaxWeight,
+			MinSubtotal: r.MinSubtotal,
+			MaxSubtotal: r.MaxSubtotal,
+			Price:       r.Price,
+			PerKg:       r.PerKg,
+			FreeAbove:   r.FreeAbove,
+		})
+	}
+	return t, nil
+}
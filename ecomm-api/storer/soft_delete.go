@@ -0,0 +1,147 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/jmoiron/sqlx"
+)
+
+func (ps *PySQLStorer) ListDeletedProducts(ctx context.Context) ([]Product, error) {
+	defer metrics.ObserveQuery("ListDeletedProducts")()
+
+	var products []Product
+	err := ps.db.SelectContext(ctx, &products,
+		"SELECT * FROM products WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC")
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list deleted products: %w", err))
+	}
+
+	return products, nil
+}
+
+func (ps *PySQLStorer) RestoreProduct(ctx context.Context, id int64) error {
+	defer metrics.ObserveQuery("RestoreProduct")()
+
+	res, err := ps.db.ExecContext(ctx,
+		"UPDATE products SET deleted_at=NULL, updated_at=$1 WHERE id=$2 AND deleted_at IS NOT NULL", time.Now(), id)
+	if err != nil {
+		return logError(ctx, fmt.Errorf("failed to restore product with id %d: %w", id, err))
+	}
+	return expectAffected(res, "deleted product", id)
+}
+
+func (ps *PySQLStorer) ListDeletedOrders(ctx context.Context) ([]Order, error) {
+	defer metrics.ObserveQuery("ListDeletedOrders")()
+
+	var orders []Order
+	err := ps.db.SelectContext(ctx, &orders,
+		"SELECT * FROM orders WHERE deleted_at IS NOT NULL ORDER BY deleted_at DESC")
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list deleted orders: %w", err))
+	}
+
+	if err := ps.loadOrderItems(ctx, orders); err != nil {
+		return nil, logError(ctx, err)
+	}
+
+	return orders, nil
+}
+
+// RestoreOrder undeletes an order. Orders cancelled by the delete stay
+// cancelled, since their stock has already been released.
+func (ps *PySQLStorer) RestoreOrder(ctx context.Context, id int64) error {
+	defer metrics.ObserveQuery("RestoreOrder")()
+
+	res, err := ps.db.ExecContext(ctx,
+		"UPDATE orders SET deleted_at=NULL, updated_at=$1 WHERE id=$2 AND deleted_at IS NOT NULL", time.Now(), id)
+	if err != nil {
+		return logError(ctx, fmt.Errorf("failed to restore order with id %d: %w", id, err))
+	}
+	return expectAffected(res, "deleted order", id)
+}
+
+// PurgeDeleted hard deletes products and orders soft deleted before cutoff.
+// Financial history is never purged: orders with payments, refunds or returns
+// are kept, as are products that are still referenced by an order item. A
+// purged product takes its inventory movements with it; every product with
+// stock has some, and the ledger of a product that no longer exists
+// reconciles against nothing.
+func (ps *PySQLStorer) PurgeDeleted(ctx context.Context, cutoff time.Time) (products, orders int64, err error) {
+	defer metrics.ObserveQuery("PurgeDeleted")()
+
+	err = ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		var ids []int64
+		err := tx.SelectContext(ctx, &ids,
+			`SELECT o.id FROM orders o WHERE o.deleted_at < $1
+			AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.order_id = o.id)
+			AND NOT EXISTS (SELECT 1 FROM refunds rf WHERE rf.order_id = o.id)
+			AND NOT EXISTS (SELECT 1 FROM returns rt WHERE rt.order_id = o.id)
+			FOR UPDATE`, cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to find orders to purge: %w", err)
+		}
+
+		if len(ids) > 0 {
+			_, err = tx.ExecContext(ctx, "DELETE FROM order_items WHERE order_id = ANY($1)", ids)
+			if err != nil {
+				return fmt.Errorf("failed to purge order items: %w", err)
+			}
+
+			res, err := tx.ExecContext(ctx, "DELETE FROM orders WHERE id = ANY($1)", ids)
+			if err != nil {
+				return fmt.Errorf("failed to purge orders: %w", err)
+			}
+			if orders, err = res.RowsAffected(); err != nil {
+				return fmt.Errorf("failed to purge orders: %w", err)
+			}
+		}
+
+		ids = nil
+		err = tx.SelectContext(ctx, &ids,
+			`SELECT p.id FROM products p WHERE p.deleted_at < $1
+			AND NOT EXISTS (SELECT 1 FROM order_items oi WHERE oi.product_id = p.id)
+			FOR UPDATE`, cutoff)
+		if err != nil {
+			return fmt.Errorf("failed to find products to purge: %w", err)
+		}
+		if len(ids) == 0 {
+			return nil
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM inventory_movements WHERE product_id = ANY($1)", ids)
+		if err != nil {
+			return fmt.Errorf("failed to purge inventory movements: %w", err)
+		}
+
+		res, err := tx.ExecContext(ctx, "DELETE FROM products WHERE id = ANY($1)", ids)
+		if err != nil {
+			return fmt.Errorf("failed to purge products: %w", err)
+		}
+		if products, err = res.RowsAffected(); err != nil {
+			return fmt.Errorf("failed to purge products: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, 0, logError(ctx, fmt.Errorf("failed to purge deleted records: %w", err))
+	}
+
+	return products, orders, nil
+}
+
+// expectAffected turns an update that matched no row into ErrNotFound.
+func expectAffected(res sql.Result, what string, id int64) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to check affected rows for %s %d: %w", what, id, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%s %d: %w", what, id, ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,231 @@
+package storer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/allocation"
+	"github.com/jmoiron/sqlx"
+)
+
+// adjustStock changes the stock of a product by m.Delta and records the
+// movement in the ledger. A negative delta fails with ErrInsufficientStock
+// rather than letting count_in_stock go below zero; deleted products can
+// still take stock back but cannot hand any out. The product version is
+// bumped, so that an If-Match update based on the old stock is rejected.
+func adjustStock(ctx context.Context, tx *sqlx.Tx, m *StockMovement) error {
+	if m.Delta == 0 {
+		return nil
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE products SET count_in_stock = count_in_stock + $1, version = version + 1
+		WHERE id=$2 AND count_in_stock + $1 >= 0 AND ($1 > 0 OR deleted_at IS NULL)`,
+		m.Delta, m.ProductID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to adjust stock for product %d: %w", m.ProductID, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to adjust stock for product %d: %w", m.ProductID, err)
+	}
+	if n == 0 && m.Delta > 0 {
+		return fmt.Errorf("product %d: %w", m.ProductID, ErrNotFound)
+	}
+	if n == 0 {
+		return fmt.Errorf("product %d: %w", m.ProductID, ErrInsufficientStock)
+	}
+
+	return recordMovement(ctx, tx, m)
+}
+
+// recordMovement applies a stock change that has already been made to
+// count_in_stock to the stock of the warehouse it happened in, and writes a
+// ledger entry for it.
+func recordMovement(ctx context.Context, tx *sqlx.Tx, m *StockMovement) error {
+	if m.WarehouseID == 0 {
+		id, err := defaultWarehouseID(ctx, tx)
+		if err != nil {
+			return err
+		}
+		m.WarehouseID = id
+	}
+	if err := adjustWarehouseStock(ctx, tx, m.WarehouseID, m.ProductID, m.Delta); err != nil {
+		return err
+	}
+	if c, ok := ctx.Value(stockChangesKey{}).(*stockChanges); ok {
+		if err := c.record(ctx, tx, m); err != nil {
+			return err
+		}
+	}
+
+	if m.Actor == "" {
+		m.Actor = ActorFrom(ctx)
+	}
+	m.CreatedAt = time.Now()
+
+	err := tx.QueryRowxContext(ctx,
+		`INSERT INTO inventory_movements (product_id, warehouse_id, delta, reason, actor, reference, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`,
+		m.ProductID, m.WarehouseID, m.Delta, m.Reason, m.Actor, m.Reference, m.CreatedAt,
+	).Scan(&m.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record stock movement for product %d: %w", m.ProductID, err)
+	}
+	return nil
+}
+
+func adjustWarehouseStock(ctx context.Context, tx *sqlx.Tx, warehouseID, productID, delta int64) error {
+	if delta > 0 {
+		_, err := tx.ExecContext(ctx,
+			`INSERT INTO warehouse_stock (warehouse_id, product_id, quantity) VALUES ($1, $2, $3)
+			ON CONFLICT (warehouse_id, product_id) DO UPDATE SET quantity = warehouse_stock.quantity + EXCLUDED.quantity`,
+			warehouseID, productID, delta,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to adjust stock of product %d in warehouse %d: %w", productID, warehouseID, err)
+		}
+		return nil
+	}
+
+	res, err := tx.ExecContext(ctx,
+		`UPDATE warehouse_stock SET quantity = quantity + $1
+		WHERE warehouse_id=$2 AND product_id=$3 AND quantity + $1 >= 0`,
+		delta, warehouseID, productID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to adjust stock of product %d in warehouse %d: %w", productID, warehouseID, err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to adjust stock of product %d in warehouse %d: %w", productID, warehouseID, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("product %d in warehouse %d: %w", productID, warehouseID, ErrInsufficientStock)
+	}
+	return nil
+}
+
+func defaultWarehouseID(ctx context.Context, tx *sqlx.Tx) (int64, error) {
+	var id int64
+	if err := tx.GetContext(ctx, &id, "SELECT id FROM warehouses WHERE is_default"); err != nil {
+		return 0, fmt.Errorf("failed to get default warehouse: %w", err)
+	}
+	return id, nil
+}
+
+// allocateStock takes quantity units of a product out of stock, choosing the
+// warehouses with the storer's allocation strategy. It returns how much was
+// taken from each warehouse.
+func (ps *PySQLStorer) allocateStock(ctx context.Context, tx *sqlx.Tx, productID, quantity int64, shipTo *allocation.Location, m StockMovement) ([]allocation.Allocation, error) {
+	req, err := warehouseStock(ctx, tx, productID, quantity, shipTo)
+	if err != nil {
+		return nil, err
+	}
+
+	allocs, err := ps.allocator.Allocate(req)
+	if errors.Is(err, allocation.ErrUnfulfillable) {
+		return nil, fmt.Errorf("product %d: %w", productID, ErrInsufficientStock)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to allocate product %d: %w", productID, err)
+	}
+
+	for _, a := range allocs {
+		mv := m
+		mv.ProductID = productID
+		mv.WarehouseID = a.WarehouseID
+		mv.Delta = -a.Quantity
+		if err := adjustStock(ctx, tx, &mv); err != nil {
+			return nil, err
+		}
+	}
+	return allocs, nil
+}
+
+// recordStockChange is recordMovement for a change to count_in_stock that
+// names no warehouse, such as a product update or an import. Increases go to
+// the default warehouse. Decreases are taken from the warehouses in order of
+// preference, as the split strategy allocates them, since nothing is shipped
+// and there is no reason to insist on one warehouse.
+func recordStockChange(ctx context.Context, tx *sqlx.Tx, m StockMovement) error {
+	if m.WarehouseID != 0 || m.Delta > 0 {
+		return recordMovement(ctx, tx, &m)
+	}
+
+	// count_in_stock already holds the result of the whole change, so it is
+	// tracked as one before it is split; the warehouse movements then only
+	// move After, which is final already.
+	if c, ok := ctx.Value(stockChangesKey{}).(*stockChanges); ok {
+		if err := c.record(ctx, tx, &m); err != nil {
+			return err
+		}
+	}
+
+	req, err := warehouseStock(ctx, tx, m.ProductID, -m.Delta, nil)
+	if err != nil {
+		return err
+	}
+	allocs, err := allocation.Split{}.Allocate(req)
+	if errors.Is(err, allocation.ErrUnfulfillable) {
+		return fmt.Errorf("product %d: %w", m.ProductID, ErrInsufficientStock)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to allocate product %d: %w", m.ProductID, err)
+	}
+
+	for _, a := range allocs {
+		mv := m
+		mv.WarehouseID = a.WarehouseID
+		mv.Delta = -a.Quantity
+		if err := recordMovement(ctx, tx, &mv); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// warehouseStock locks the stock of a product in every warehouse that has
+// some, as a request for quantity units.
+func warehouseStock(ctx context.Context, tx *sqlx.Tx, productID, quantity int64, shipTo *allocation.Location) (allocation.Request, error) {
+	var rows []struct {
+		WarehouseID int64   `db:"warehouse_id"`
+		Quantity    int64   `db:"quantity"`
+		Latitude    float64 `db:"latitude"`
+		Longitude   float64 `db:"longitude"`
+		Priority    int     `db:"priority"`
+	}
+	err := tx.SelectContext(ctx, &rows,
+		`SELECT ws.warehouse_id, ws.quantity, w.latitude, w.longitude, w.priority
+		FROM warehouse_stock ws
+		JOIN warehouses w ON w.id = ws.warehouse_id
+		WHERE ws.product_id=$1 AND ws.quantity > 0
+		ORDER BY ws.warehouse_id
+		FOR UPDATE OF ws`,
+		productID,
+	)
+	if err != nil {
+		return allocation.Request{}, fmt.Errorf("failed to get warehouse stock for product %d: %w", productID, err)
+	}
+
+	req := allocation.Request{Quantity: quantity, Destination: shipTo}
+	for _, r := range rows {
+		req.Stock = append(req.Stock, allocation.Stock{
+			WarehouseID: r.WarehouseID,
+			Location:    allocation.Location{Latitude: r.Latitude, Longitude: r.Longitude},
+			Priority:    r.Priority,
+			Quantity:    r.Quantity,
+		})
+	}
+	return req, nil
+}
+
+func orderReference(orderID int64) string {
+	return fmt.Sprintf("order:%d", orderID)
+}
@@ -0,0 +1,100 @@
+package storer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// StockChange is the net change of a product's count_in_stock made by one
+// committed transaction.
+type StockChange struct {
+	ProductID        int64
+	SKU              string
+	Name             string
+	Before           int64
+	After            int64
+	ReorderThreshold int64
+}
+
+// StockHook is called after a transaction that changed stock commits. It
+// runs on the caller's goroutine, so slow work belongs in a background job.
+type StockHook func(ctx context.Context, changes []StockChange)
+
+// OnStockChange registers h to be told about every committed stock change.
+// Hooks must be registered before the storer is used.
+func (ps *PySQLStorer) OnStockChange(h StockHook) {
+	ps.stockHooks = append(ps.stockHooks, h)
+}
+
+type stockChangesKey struct{}
+
+// stockChanges collects the stock changes of one transaction, per product in
+// the order they were first touched.
+type stockChanges struct {
+	byID  map[int64]*StockChange
+	order []int64
+}
+
+// trackStockChanges returns a context under which recordMovement collects
+// the stock changes it makes, for stockChanged to report after commit.
+func trackStockChanges(ctx context.Context) (context.Context, *stockChanges) {
+	c := &stockChanges{byID: map[int64]*StockChange{}}
+	return context.WithValue(ctx, stockChangesKey{}, c), c
+}
+
+func (c *stockChanges) record(ctx context.Context, tx *sqlx.Tx, m *StockMovement) error {
+	var p Product
+	err := tx.GetContext(ctx, &p,
+		"SELECT id, sku, name, count_in_stock, reorder_threshold FROM products WHERE id=$1", m.ProductID)
+	if err != nil {
+		return fmt.Errorf("failed to get stock of product %d: %w", m.ProductID, err)
+	}
+
+	if sc, ok := c.byID[p.ID]; ok {
+		sc.After = p.CountInStock
+		return nil
+	}
+	c.byID[p.ID] = &StockChange{
+		ProductID:        p.ID,
+		SKU:              p.SKU,
+		Name:             p.Name,
+		Before:           p.CountInStock - m.Delta,
+		After:            p.CountInStock,
+		ReorderThreshold: p.ReorderThreshold,
+	}
+	c.order = append(c.order, p.ID)
+	return nil
+}
+
+// merge folds the changes of a later part of the same transaction into c.
+func (c *stockChanges) merge(later *stockChanges) {
+	for _, id := range later.order {
+		sc := later.byID[id]
+		if cur, ok := c.byID[id]; ok {
+			cur.After = sc.After
+			continue
+		}
+		c.byID[id] = sc
+		c.order = append(c.order, id)
+	}
+}
+
+// stockChanged hands the changes collected in c to the stock hooks. Call it
+// only once the transaction has committed.
+func (ps *PySQLStorer) stockChanged(ctx context.Context, c *stockChanges) {
+	var changes []StockChange
+	for _, id := range c.order {
+		if sc := c.byID[id]; sc.Before != sc.After {
+			changes = append(changes, *sc)
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+
+	for _, h := range ps.stockHooks {
+		h(ctx, changes)
+	}
+}
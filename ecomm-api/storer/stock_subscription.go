@@ -0,0 +1,62 @@
+package storer
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+)
+
+// CreateStockSubscription signs email up for a back-in-stock notice for a
+// product. Subscribing again before being notified is a no-op.
+func (ps *PySQLStorer) CreateStockSubscription(ctx context.Context, productID int64, email string) (*StockSubscription, error) {
+	defer metrics.ObserveQuery("CreateStockSubscription")()
+
+	if _, err := ps.GetProduct(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	var sub StockSubscription
+	err := ps.db.GetContext(ctx, &sub,
+		`INSERT INTO stock_subscriptions (product_id, email, created_at) VALUES ($1, $2, $3)
+		ON CONFLICT (product_id, email) WHERE notified_at IS NULL DO UPDATE SET email = EXCLUDED.email
+		RETURNING *`,
+		productID, email, time.Now(),
+	)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to subscribe to product %d: %w", productID, err))
+	}
+
+	return &sub, nil
+}
+
+// ListPendingStockSubscriptions returns the subscriptions of a product that
+// have not been notified yet.
+func (ps *PySQLStorer) ListPendingStockSubscriptions(ctx context.Context, productID int64) ([]StockSubscription, error) {
+	defer metrics.ObserveQuery("ListPendingStockSubscriptions")()
+
+	var subs []StockSubscription
+	err := ps.db.SelectContext(ctx, &subs,
+		"SELECT * FROM stock_subscriptions WHERE product_id=$1 AND notified_at IS NULL ORDER BY id",
+		productID,
+	)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list stock subscriptions for product %d: %w", productID, err))
+	}
+
+	return subs, nil
+}
+
+// MarkStockSubscriptionNotified records that a subscriber has been told,
+// so that they are not told again. Call it only once the notice was sent.
+func (ps *PySQLStorer) MarkStockSubscriptionNotified(ctx context.Context, id int64) error {
+	defer metrics.ObserveQuery("MarkStockSubscriptionNotified")()
+
+	_, err := ps.db.ExecContext(ctx,
+		"UPDATE stock_subscriptions SET notified_at=$1 WHERE id=$2 AND notified_at IS NULL", time.Now(), id)
+	if err != nil {
+		return logError(ctx, fmt.Errorf("failed to mark stock subscription %d notified: %w", id, err))
+	}
+	return nil
+}
@@ -2,108 +2,263 @@ package storer
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"math"
+	"strings"
 	"time"
 
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/allocation"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/outbox"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/promotion"
 	"github.com/jmoiron/sqlx"
 )
 
 type PySQLStorer struct {
-	db *sqlx.DB
+	db         *sqlx.DB
+	allocator  allocation.Strategy
+	stockHooks []StockHook
 }
 
-func NewPySQLStorer(db *sqlx.DB) *PySQLStorer {
-	return &PySQLStorer{db: db}
+type Option func(*PySQLStorer)
+
+// WithAllocator sets how order items are allocated to warehouses. The
+// default ships each item from the nearest warehouse that has it.
+func WithAllocator(a allocation.Strategy) Option {
+	return func(ps *PySQLStorer) {
+		ps.allocator = a
+	}
+}
+
+func NewPySQLStorer(db *sqlx.DB, opts ...Option) *PySQLStorer {
+	ps := &PySQLStorer{db: db, allocator: allocation.Nearest{}}
+	for _, opt := range opts {
+		opt(ps)
+	}
+	return ps
 }
 
 func (ps *PySQLStorer) CreateProduct(ctx context.Context, p *Product) (*Product, error) {
+	defer metrics.ObserveQuery("CreateProduct")()
+	ctx, changes := trackStockChanges(ctx)
+
 	now := time.Now()
 	p.CreatedAt = now
 	p.UpdatedAt = &now
 
-	var id int64
-	err := ps.db.QueryRowxContext(
-		ctx,
-		`INSERT INTO products (
-            name, image, category, description, rating, num_reviews, price, count_in_stock, created_at, updated_at
-        ) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10)
-        RETURNING id`,
-		p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews,
-		p.Price, p.CountInStock, p.CreatedAt, p.UpdatedAt,
-	).Scan(&id)
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.QueryRowxContext(
+			ctx,
+			`INSERT INTO products (
+				sku, name, image, category, description, rating, num_reviews, price, count_in_stock, reorder_threshold, tax_category,
+				weight, length, width, height, created_at, updated_at
+			) VALUES (COALESCE(NULLIF($1, ''), 'sku-' || gen_random_uuid()),$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17)
+			RETURNING id, version, sku`,
+			p.SKU, p.Name, p.Image, p.Category, p.Description, p.Rating, p.NumReviews,
+			p.Price, p.CountInStock, p.ReorderThreshold, p.TaxCategory,
+			p.Weight, p.Length, p.Width, p.Height, p.CreatedAt, p.UpdatedAt,
+		).Scan(&p.ID, &p.Version, &p.SKU)
+		if err != nil {
+			return fmt.Errorf("failed to insert product: %w", err)
+		}
+
+		if p.CountInStock != 0 {
+			err := recordMovement(ctx, tx, &StockMovement{
+				ProductID: p.ID,
+				Delta:     p.CountInStock,
+				Reason:    MovementAdjustment,
+				Reference: "product-created",
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return insertProductEvent(ctx, tx, outbox.EventProductCreated, p)
+	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to insert product: %w", err)
+		return nil, logError(ctx, fmt.Errorf("failed to create product: %w", err))
 	}
 
-	p.ID = id
+	ps.stockChanged(ctx, changes)
 	return p, nil
 }
 
 func (ps *PySQLStorer) GetProduct(ctx context.Context, id int64) (*Product, error) {
+	defer metrics.ObserveQuery("GetProduct")()
+
 	var p Product
-	err := ps.db.GetContext(ctx, &p, "SELECT * FROM products WHERE id=$1", id)
+	err := ps.db.GetContext(ctx, &p, "SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("product %d: %w", id, ErrNotFound)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get product with id %d: %w", id, err)
+		return nil, logError(ctx, fmt.Errorf("failed to get product with id %d: %w", id, err))
 	}
 	return &p, nil
 }
 
+// GetProducts returns the products with the given ids that exist, in no
+// particular order.
+func (ps *PySQLStorer) GetProducts(ctx context.Context, ids []int64) ([]Product, error) {
+	defer metrics.ObserveQuery("GetProducts")()
+
+	var products []Product
+	err := ps.db.SelectContext(ctx, &products, "SELECT * FROM products WHERE id = ANY($1) AND deleted_at IS NULL", ids)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get products: %w", err))
+	}
+	return products, nil
+}
+
 func (ps *PySQLStorer) ListProducts(ctx context.Context) ([]Product, error) {
+	defer metrics.ObserveQuery("ListProducts")()
+
 	var products []Product
-	err := ps.db.SelectContext(ctx, &products, "SELECT * FROM products")
+	err := ps.db.SelectContext(ctx, &products, "SELECT * FROM products WHERE deleted_at IS NULL")
 	if err != nil {
-		return nil, fmt.Errorf("failed to list products: %w", err)
+		return nil, logError(ctx, fmt.Errorf("failed to list products: %w", err))
 	}
 
 	return products, nil
 }
 
+// UpdateProduct writes p back if it is still at p.Version. A change to
+// count_in_stock is recorded in the inventory ledger as a manual adjustment.
 func (ps *PySQLStorer) UpdateProduct(ctx context.Context, p *Product) (*Product, error) {
-	rows, err := ps.db.NamedQueryContext(
-		ctx,
-		`UPDATE products SET 
-			name = :name, 
-			image = :image, 
-			category = :category, 
-			description = :description, 
-			rating = :rating, 
-			num_reviews = :num_reviews, 
-			price = :price, 
-			count_in_stock = :count_in_stock, 
-			updated_at = :updated_at 
-		WHERE id = :id
-		RETURNING *`,
-		p,
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to update product with id %d: %w", p.ID, err)
+	defer metrics.ObserveQuery("UpdateProduct")()
+	ctx, changes := trackStockChanges(ctx)
+
+	var updated struct {
+		Product
+		PreviousStock int64 `db:"previous_stock"`
 	}
-	defer rows.Close()
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		// Locking the row at p.Version and updating it is one statement, which
+		// also hands back the stock it had before for the ledger.
+		rows, err := sqlx.NamedQueryContext(
+			ctx,
+			tx,
+			`UPDATE products SET 
+				name = :name, 
+				image = :image, 
+				category = :category, 
+				description = :description, 
+				rating = :rating, 
+				num_reviews = :num_reviews, 
+				price = :price, 
+				count_in_stock = :count_in_stock, 
+				reorder_threshold = :reorder_threshold, 
+				tax_category = :tax_category, 
+				weight = :weight, 
+				length = :length, 
+				width = :width, 
+				height = :height, 
+				updated_at = :updated_at, 
+				version = products.version + 1 
+			FROM (
+				SELECT id, count_in_stock FROM products
+				WHERE id = :id AND version = :version AND deleted_at IS NULL
+				FOR UPDATE
+			) prev
+			WHERE products.id = prev.id
+			RETURNING products.*, prev.count_in_stock AS previous_stock`,
+			p,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to update product with id %d: %w", p.ID, err)
+		}
 
-	if rows.Next() {
-		var updated Product
-		if err := rows.StructScan(&updated); err != nil {
-			return nil, fmt.Errorf("failed to scan updated product: %w", err)
+		if !rows.Next() {
+			rows.Close()
+			if err := rows.Err(); err != nil {
+				return fmt.Errorf("failed to update product with id %d: %w", p.ID, err)
+			}
+			return updateMissError(ctx, tx, p)
+		}
+		err = rows.StructScan(&updated)
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("failed to scan updated product: %w", err)
+		}
+
+		if delta := updated.CountInStock - updated.PreviousStock; delta != 0 {
+			err := recordStockChange(ctx, tx, StockMovement{
+				ProductID: p.ID,
+				Delta:     delta,
+				Reason:    MovementAdjustment,
+				Reference: "product-updated",
+			})
+			if err != nil {
+				return err
+			}
 		}
-		return &updated, nil
+		return insertProductEvent(ctx, tx, outbox.EventProductUpdated, &updated.Product)
+	})
+
+	if errors.Is(err, ErrNotFound) || errors.Is(err, ErrVersionConflict) || errors.Is(err, ErrInsufficientStock) {
+		return nil, err
 	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to update product with id %d: %w", p.ID, err))
+	}
+
+	ps.stockChanged(ctx, changes)
+	return &updated.Product, nil
+}
 
-	return nil, fmt.Errorf("no product found with id %d", p.ID)
+// updateMissError explains why p could not be locked for update: either the
+// product is gone or someone else updated it since it was read.
+func updateMissError(ctx context.Context, tx *sqlx.Tx, p *Product) error {
+	var exists bool
+	err := tx.GetContext(ctx, &exists,
+		"SELECT EXISTS (SELECT 1 FROM products WHERE id=$1 AND deleted_at IS NULL)", p.ID)
+	if err != nil {
+		return fmt.Errorf("failed to check product with id %d: %w", p.ID, err)
+	}
+	if !exists {
+		return fmt.Errorf("product %d: %w", p.ID, ErrNotFound)
+	}
+	return fmt.Errorf("product %d at version %d: %w", p.ID, p.Version, ErrVersionConflict)
 }
 
 func (ps *PySQLStorer) DeleteProduct(ctx context.Context, id int64) error {
-	_, err := ps.db.ExecContext(ctx, "DELETE FROM products WHERE id=$1", id)
+	defer metrics.ObserveQuery("DeleteProduct")()
+
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		res, err := tx.ExecContext(ctx,
+			"UPDATE products SET deleted_at=$1 WHERE id=$2 AND deleted_at IS NULL", time.Now(), id)
+		if err != nil {
+			return fmt.Errorf("failed to delete product with id %d: %w", id, err)
+		}
+		if err := expectAffected(res, "product", id); err != nil {
+			return err
+		}
+		return insertOutboxEvent(ctx, tx, outbox.AggregateProduct, id, outbox.EventProductDeleted, map[string]any{
+			"product_id": id,
+		})
+	})
+	if errors.Is(err, ErrNotFound) {
+		return err
+	}
 	if err != nil {
-		return fmt.Errorf("failed to delete product with id %d: %w", id, err)
+		return logError(ctx, err)
 	}
 	return nil
 }
 
 func (ps *PySQLStorer) CreateOrder(ctx context.Context, o *Order) (*Order, error) {
+	defer metrics.ObserveQuery("CreateOrder")()
+	ctx, changes := trackStockChanges(ctx)
+
 	now := time.Now()
 	o.CreatedAt = now
 	o.UpdatedAt = &now
+	if o.Status == "" {
+		o.Status = OrderStatusPending
+	}
 
 	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
 		// insert into orders
@@ -112,22 +267,75 @@ func (ps *PySQLStorer) CreateOrder(ctx context.Context, o *Order) (*Order, error
 			return fmt.Errorf("failed to create order: %w", err)
 		}
 
+		for _, a := range []*OrderAddress{o.ShippingAddress, o.BillingAddress} {
+			if a == nil {
+				continue
+			}
+			a.OrderID = createdOrder.ID
+			if err := insertOrderAddress(ctx, tx, a); err != nil {
+				return err
+			}
+		}
+
+		// An item shipped from several warehouses becomes one order item
+		// per warehouse.
+		var items []OrderItem
 		for _, oi := range o.Items {
+			// Items are sold at the catalogue price, whatever the client sent.
+			var p Product
+			err := tx.GetContext(ctx, &p, "SELECT * FROM products WHERE id=$1 AND deleted_at IS NULL", oi.ProductID)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("product %d: %w", oi.ProductID, ErrUnknownProduct)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to get product with id %d: %w", oi.ProductID, err)
+			}
+			oi.Name, oi.Image, oi.Price = p.Name, p.Image, p.Price
+
 			oi.OrderID = createdOrder.ID
-			// insert into order_items
-			_, err := createOrderItem(ctx, tx, &oi)
+			allocs, err := ps.allocateStock(ctx, tx, oi.ProductID, oi.Quantity, o.ShipTo, StockMovement{
+				Reason:    MovementOrder,
+				Reference: orderReference(createdOrder.ID),
+			})
 			if err != nil {
-				return fmt.Errorf("failed to create order item: %w", err)
+				return err
+			}
+			taxes := splitTax(oi.TaxAmount, allocs)
+			for j, a := range allocs {
+				item := oi
+				item.Quantity = a.Quantity
+				item.WarehouseID = a.WarehouseID
+				item.TaxAmount = taxes[j]
+				// insert into order_items
+				if _, err := createOrderItem(ctx, tx, &item); err != nil {
+					return fmt.Errorf("failed to create order item: %w", err)
+				}
+				items = append(items, item)
 			}
 		}
+		o.Items = items
 
-		return nil
+		var rules []promotion.Rule
+		if len(o.CouponCodes) > 0 {
+			rules, err = redeemPromotions(ctx, tx, o, o.CouponCodes)
+			if err != nil {
+				return err
+			}
+		}
+		if err := priceOrder(ctx, tx, o, rules, true); err != nil {
+			return err
+		}
+		return insertOrderEvent(ctx, tx, outbox.EventOrderCreated, o)
 	})
 
+	if errors.Is(err, ErrInsufficientStock) || errors.Is(err, ErrUnknownProduct) || errors.Is(err, ErrInvalidCoupon) {
+		return nil, err
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to create order: %w", err)
+		return nil, logError(ctx, fmt.Errorf("failed to create order: %w", err))
 	}
 
+	ps.stockChanged(ctx, changes)
 	return o, nil
 }
 
@@ -135,10 +343,12 @@ func createOrder(ctx context.Context, tx *sqlx.Tx, o *Order) (*Order, error) {
 	err := tx.QueryRowxContext(
 		ctx,
 		`INSERT INTO orders (
-			payment_method, tax_price, shipping_price, total_price, created_at, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6)
+			user_id, status, payment_method, tax_price, shipping_price, total_price, created_at, updated_at,
+			tax_country, tax_region, tax_postal_code, tax_inclusive, shipping_method
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 		RETURNING id`,
-		o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice, o.CreatedAt, o.UpdatedAt,
+		o.UserID, o.Status, o.PaymentMethod, o.TaxPrice, o.ShippingPrice, o.TotalPrice, o.CreatedAt, o.UpdatedAt,
+		o.TaxCountry, o.TaxRegion, o.TaxPostalCode, o.TaxInclusive, o.ShippingMethod,
 	).Scan(&o.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert order: %w", err)
@@ -150,10 +360,10 @@ func createOrderItem(ctx context.Context, tx *sqlx.Tx, oi *OrderItem) (*OrderIte
 	err := tx.QueryRowxContext(
 		ctx,
 		`INSERT INTO order_items (
-			name, quantity, image, price, product_id, order_id
-		) VALUES ($1, $2, $3, $4, $5, $6)
+			name, quantity, image, price, product_id, order_id, warehouse_id, tax_rate, tax_amount
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
 		RETURNING id`,
-		oi.Name, oi.Quantity, oi.Image, oi.Price, oi.ProductID, oi.OrderID,
+		oi.Name, oi.Quantity, oi.Image, oi.Price, oi.ProductID, oi.OrderID, oi.WarehouseID, oi.TaxRate, oi.TaxAmount,
 	).Scan(&oi.ID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to insert order item: %w", err)
@@ -161,50 +371,246 @@ func createOrderItem(ctx context.Context, tx *sqlx.Tx, oi *OrderItem) (*OrderIte
 	return oi, nil
 }
 
+// splitTax shares the tax of an item between the parts it was allocated in,
+// by quantity, so that the parts add up to amount exactly.
+func splitTax(amount float64, allocs []allocation.Allocation) []float64 {
+	var quantity int64
+	for _, a := range allocs {
+		quantity += a.Quantity
+	}
+
+	res := make([]float64, len(allocs))
+	left := amount
+	for i, a := range allocs {
+		if i == len(allocs)-1 {
+			res[i] = math.Round(left*100) / 100
+			break
+		}
+		res[i] = math.Round(amount*float64(a.Quantity)/float64(quantity)*100) / 100
+		left -= res[i]
+	}
+	return res
+}
+
 func (ps *PySQLStorer) GetOrder(ctx context.Context, id int64) (*Order, error) {
+	defer metrics.ObserveQuery("GetOrder")()
+	return ps.getOrder(ctx, "SELECT * FROM orders WHERE id=$1 AND deleted_at IS NULL", id)
+}
+
+// GetOrderWithDeleted is GetOrder for an order that may have been soft
+// deleted since, such as one that was cancelled.
+func (ps *PySQLStorer) GetOrderWithDeleted(ctx context.Context, id int64) (*Order, error) {
+	defer metrics.ObserveQuery("GetOrderWithDeleted")()
+	return ps.getOrder(ctx, "SELECT * FROM orders WHERE id=$1", id)
+}
+
+func (ps *PySQLStorer) getOrder(ctx context.Context, query string, id int64) (*Order, error) {
 	var o Order
-	err := ps.db.GetContext(ctx, &o, "SELECT * FROM orders WHERE id=$1", id)
+	err := ps.db.GetContext(ctx, &o, query, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("order %d: %w", id, ErrNotFound)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order with id %d: %w", id, err)
+		return nil, logError(ctx, fmt.Errorf("failed to get order with id %d: %w", id, err))
 	}
 
 	var items []OrderItem
 	err = ps.db.SelectContext(ctx, &items, "SELECT * FROM order_items WHERE order_id=$1", id)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get order items for order id %d: %w", id, err)
+		return nil, logError(ctx, fmt.Errorf("failed to get order items for order id %d: %w", id, err))
 	}
 	o.Items = items
 
+	err = ps.db.SelectContext(ctx, &o.Adjustments, "SELECT * FROM order_adjustments WHERE order_id=$1 ORDER BY id", id)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get adjustments for order id %d: %w", id, err))
+	}
+
+	var addresses []OrderAddress
+	err = ps.db.SelectContext(ctx, &addresses, "SELECT * FROM order_addresses WHERE order_id=$1", id)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get addresses for order id %d: %w", id, err))
+	}
+	for i := range addresses {
+		o.setAddress(&addresses[i])
+	}
+
 	return &o, nil
 }
 
-func (ps *PySQLStorer) ListOrders(ctx context.Context) ([]Order, error) {
+func (ps *PySQLStorer) ListOrders(ctx context.Context, f OrderFilter) ([]Order, error) {
+	defer metrics.ObserveQuery("ListOrders")()
+
+	var (
+		conds = []string{"deleted_at IS NULL"}
+		args  []any
+	)
+	where := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.UserID != 0 {
+		where("user_id = $%d", f.UserID)
+	}
+	if f.Status != "" {
+		where("status = $%d", f.Status)
+	}
+	if f.CreatedFrom != nil {
+		where("created_at >= $%d", *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		where("created_at < $%d", *f.CreatedTo)
+	}
+	if f.MinTotal != nil {
+		where("total_price >= $%d", *f.MinTotal)
+	}
+	if f.MaxTotal != nil {
+		where("total_price <= $%d", *f.MaxTotal)
+	}
+	if f.After != 0 {
+		where("id < $%d", f.After)
+	}
+
+	query := "SELECT * FROM orders WHERE " + strings.Join(conds, " AND ") + " ORDER BY id DESC"
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
 	var orders []Order
-	err := ps.db.SelectContext(ctx, &orders, "SELECT * FROM orders")
+	err := ps.db.SelectContext(ctx, &orders, query, args...)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list orders: %w", err))
+	}
+
+	if err := ps.loadOrderItems(ctx, orders); err != nil {
+		return nil, logError(ctx, err)
+	}
+	if err := ps.loadOrderAdjustments(ctx, orders); err != nil {
+		return nil, logError(ctx, err)
+	}
+	if err := ps.loadOrderAddresses(ctx, orders); err != nil {
+		return nil, logError(ctx, err)
+	}
+
+	return orders, nil
+}
+
+// loadOrderItems fills in the items of every order with a single query,
+// however many orders there are.
+func (ps *PySQLStorer) loadOrderItems(ctx context.Context, orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(orders))
+	byID := make(map[int64]*Order, len(orders))
+	for i := range orders {
+		ids[i] = orders[i].ID
+		byID[orders[i].ID] = &orders[i]
+	}
+
+	var items []OrderItem
+	err := ps.db.SelectContext(ctx, &items, "SELECT * FROM order_items WHERE order_id = ANY($1) ORDER BY id", ids)
 	if err != nil {
-		return nil, fmt.Errorf("failed to list orders: %w", err)
+		return fmt.Errorf("failed to get order items for orders: %w", err)
+	}
+
+	for _, oi := range items {
+		if o, ok := byID[oi.OrderID]; ok {
+			o.Items = append(o.Items, oi)
+		}
 	}
 
+	return nil
+}
+
+// loadOrderAdjustments fills in the adjustments of every order with a single
+// query.
+func (ps *PySQLStorer) loadOrderAdjustments(ctx context.Context, orders []Order) error {
+	if len(orders) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(orders))
+	byID := make(map[int64]*Order, len(orders))
 	for i := range orders {
-		var items []OrderItem
-		err = ps.db.SelectContext(ctx, &items, "SELECT * FROM order_items WHERE order_id=$1", orders[i].ID)
-		if err != nil {
-			return nil, fmt.Errorf("failed to get order items for order id: %w", err)
+		ids[i] = orders[i].ID
+		byID[orders[i].ID] = &orders[i]
+	}
+
+	var adjustments []OrderAdjustment
+	err := ps.db.SelectContext(ctx, &adjustments, "SELECT * FROM order_adjustments WHERE order_id = ANY($1) ORDER BY id", ids)
+	if err != nil {
+		return fmt.Errorf("failed to get adjustments for orders: %w", err)
+	}
+
+	for _, a := range adjustments {
+		if o, ok := byID[a.OrderID]; ok {
+			o.Adjustments = append(o.Adjustments, a)
 		}
-		orders[i].Items = items
 	}
 
-	return orders, nil
+	return nil
 }
 
+// DeleteOrder soft deletes an order. A pending order is cancelled and its
+// reserved stock and promotion uses released; its items are kept as history.
+// A paid order is refused with ErrOrderPaid, since cancelling it would keep
+// the captured payment; it is refunded instead.
 func (ps *PySQLStorer) DeleteOrder(ctx context.Context, id int64) error {
+	defer metrics.ObserveQuery("DeleteOrder")()
+	ctx, changes := trackStockChanges(ctx)
+
 	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
-		_, err := tx.ExecContext(ctx, "DELETE FROM order_items WHERE order_id=$1", id)
+		var status string
+		err := tx.GetContext(ctx, &status, "SELECT status FROM orders WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", id)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("order %d: %w", id, ErrNotFound)
+		}
 		if err != nil {
-			return fmt.Errorf("failed to delete order items for order id %d: %w", id, err)
+			return fmt.Errorf("failed to lock order with id %d: %w", id, err)
+		}
+		if status == OrderStatusPaid {
+			return fmt.Errorf("order %d: %w", id, ErrOrderPaid)
 		}
 
-		_, err = tx.ExecContext(ctx, "DELETE FROM orders WHERE id=$1", id)
+		if status == OrderStatusPending {
+			var items []OrderItem
+			err := tx.SelectContext(ctx, &items, "SELECT * FROM order_items WHERE order_id=$1", id)
+			if err != nil {
+				return fmt.Errorf("failed to get order items for order id %d: %w", id, err)
+			}
+			for _, oi := range items {
+				err := adjustStock(ctx, tx, &StockMovement{
+					ProductID:   oi.ProductID,
+					WarehouseID: oi.WarehouseID,
+					Delta:       oi.Quantity,
+					Reason:      MovementCancellation,
+					Reference:   orderReference(id),
+				})
+				if err != nil {
+					return err
+				}
+			}
+			if err := releasePromotions(ctx, tx, id); err != nil {
+				return err
+			}
+			status = OrderStatusCancelled
+
+			err = insertOutboxEvent(ctx, tx, outbox.AggregateOrder, id, outbox.EventOrderCancelled, map[string]any{
+				"order_id": id,
+				"status":   status,
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		_, err = tx.ExecContext(ctx,
+			"UPDATE orders SET status=$1, deleted_at=$2, updated_at=$2 WHERE id=$3", status, now, id)
 		if err != nil {
 			return fmt.Errorf("failed to delete order with id %d: %w", id, err)
 		}
@@ -213,9 +619,13 @@ func (ps *PySQLStorer) DeleteOrder(ctx context.Context, id int64) error {
 	})
 
 	if err != nil {
-		return fmt.Errorf("failed to delete order with id %d: %w", id, err)
+		if errors.Is(err, ErrNotFound) || errors.Is(err, ErrOrderPaid) {
+			return err
+		}
+		return logError(ctx, fmt.Errorf("failed to delete order with id %d: %w", id, err))
 	}
 
+	ps.stockChanged(ctx, changes)
 	return nil
 }
 
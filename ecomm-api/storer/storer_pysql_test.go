@@ -2,17 +2,44 @@ package storer
 
 import (
 	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/allocation"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/auth"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/jobs"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/outbox"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/promotion"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/webhook"
 	"github.com/jmoiron/sqlx"
 	"github.com/stretchr/testify/require"
 )
 
-func withTestDB(t *testing.T, fn func(db *sqlx.DB, mock sqlmock.Sqlmock)) {
-	mockDB, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual))
+// arrayConverter lets slices through as query arguments, the way the pgx
+// driver accepts them for "= ANY($1)".
+type arrayConverter struct{}
+
+func (arrayConverter) ConvertValue(v any) (driver.Value, error) {
+	if ids, ok := v.([]int64); ok {
+		return ids, nil
+	}
+	if strs, ok := v.([]string); ok {
+		return strs, nil
+	}
+	return driver.DefaultParameterConverter.ConvertValue(v)
+}
+
+func withTestDB(t testing.TB, fn func(db *sqlx.DB, mock sqlmock.Sqlmock)) {
+	mockDB, mock, err := sqlmock.New(
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual),
+		sqlmock.ValueConverterOption(arrayConverter{}),
+	)
 	if err != nil {
 		t.Fatalf("failed to open sqlmock database: %v", err)
 	}
@@ -185,3 +212,1574 @@ func TestGetProduct(t *testing.T) {
 		})
 	}
 }
+
+var (
+	orderColumns      = []string{"id", "user_id", "status", "payment_method", "tax_price", "shipping_price", "total_price", "discount_price", "created_at", "updated_at", "deleted_at"}
+	orderItemColumns  = []string{"id", "name", "quantity", "image", "price", "product_id", "order_id", "warehouse_id"}
+	adjustmentColumns = []string{"id", "order_id", "order_item_id", "promotion_id", "code", "kind", "amount", "description", "created_at"}
+	addressColumns    = []string{"id", "order_id", "kind", "address_id", "name", "line1", "line2", "city", "region", "postal_code", "country", "phone"}
+)
+
+func TestListOrders(t *testing.T) {
+	now := time.Now()
+
+	tsc := []struct {
+		name string
+		test func(t *testing.T, st *PySQLStorer, mock sqlmock.Sqlmock)
+	}{
+		{
+			name: "ListOrders loads items, adjustments and addresses in one query each",
+			test: func(t *testing.T, st *PySQLStorer, mock sqlmock.Sqlmock) {
+				orders := sqlmock.NewRows(orderColumns).
+					AddRow(2, 7, OrderStatusPending, "card", 1.0, 2.0, 13.0, 0.0, now, nil, nil).
+					AddRow(1, 7, OrderStatusPending, "card", 1.0, 2.0, 20.0, 3.0, now, nil, nil)
+				items := sqlmock.NewRows(orderItemColumns).
+					AddRow(10, "a", 1, "a.jpg", 10.0, 100, 1, 1).
+					AddRow(11, "b", 1, "b.jpg", 10.0, 101, 2, 1).
+					AddRow(12, "c", 1, "c.jpg", 10.0, 102, 1, 1)
+
+				mock.ExpectQuery("SELECT * FROM orders WHERE deleted_at IS NULL ORDER BY id DESC").WillReturnRows(orders)
+				mock.ExpectQuery("SELECT * FROM order_items WHERE order_id = ANY($1) ORDER BY id").
+					WithArgs([]int64{2, 1}).WillReturnRows(items)
+				mock.ExpectQuery("SELECT * FROM order_adjustments WHERE order_id = ANY($1) ORDER BY id").
+					WithArgs([]int64{2, 1}).
+					WillReturnRows(sqlmock.NewRows(adjustmentColumns).
+						AddRow(30, 1, nil, 5, "SAVE3", AdjustmentDiscount, 3.0, "3.00 off", now))
+				mock.ExpectQuery("SELECT * FROM order_addresses WHERE order_id = ANY($1)").
+					WithArgs([]int64{2, 1}).
+					WillReturnRows(sqlmock.NewRows(addressColumns).
+						AddRow(40, 2, AddressShipping, 8, "Ada", "1 Main St", "", "Springfield", "IL", "62701", "US", "").
+						AddRow(41, 2, AddressBilling, nil, "Ada", "2 Side St", "", "Springfield", "IL", "62701", "US", ""))
+
+				res, err := st.ListOrders(context.Background(), OrderFilter{})
+				require.NoError(t, err)
+				require.Len(t, res, 2)
+				require.Len(t, res[0].Items, 1)
+				require.Equal(t, "b", res[0].Items[0].Name)
+				require.Empty(t, res[0].Adjustments)
+				require.Len(t, res[1].Items, 2)
+				require.Len(t, res[1].Adjustments, 1)
+				require.Equal(t, "SAVE3", res[1].Adjustments[0].Code)
+				require.Equal(t, "1 Main St", res[0].ShippingAddress.Line1)
+				require.Equal(t, "2 Side St", res[0].BillingAddress.Line1)
+				require.Nil(t, res[1].ShippingAddress)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "ListOrders applies filters and cursor",
+			test: func(t *testing.T, st *PySQLStorer, mock sqlmock.Sqlmock) {
+				minTotal := 10.0
+				mock.ExpectQuery("SELECT * FROM orders WHERE deleted_at IS NULL AND user_id = $1 AND status = $2 AND total_price >= $3 AND id < $4 ORDER BY id DESC LIMIT $5").
+					WithArgs(7, OrderStatusPaid, minTotal, 50, 21).
+					WillReturnRows(sqlmock.NewRows(orderColumns))
+
+				res, err := st.ListOrders(context.Background(), OrderFilter{
+					UserID:   7,
+					Status:   OrderStatusPaid,
+					MinTotal: &minTotal,
+					After:    50,
+					Limit:    21,
+				})
+				require.NoError(t, err)
+				require.Empty(t, res)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewPySQLStorer(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+// countingConn counts the statements sent through a sqlmock connection.
+type countingConn struct {
+	driver.Conn
+	queries *atomic.Int64
+}
+
+func (c countingConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.queries.Add(1)
+	return c.Conn.(driver.QueryerContext).QueryContext(ctx, query, args)
+}
+
+func (c countingConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.queries.Add(1)
+	return c.Conn.(driver.ExecerContext).ExecContext(ctx, query, args)
+}
+
+func (c countingConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	return c.Conn.(driver.ConnBeginTx).BeginTx(ctx, opts)
+}
+
+func (c countingConn) CheckNamedValue(nv *driver.NamedValue) error {
+	return c.Conn.(driver.NamedValueChecker).CheckNamedValue(nv)
+}
+
+type countingConnector struct {
+	driver  driver.Driver
+	dsn     string
+	queries *atomic.Int64
+}
+
+func (c countingConnector) Connect(context.Context) (driver.Conn, error) {
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	return countingConn{Conn: conn, queries: c.queries}, nil
+}
+
+func (c countingConnector) Driver() driver.Driver { return c.driver }
+
+// withCountingDB is withTestDB that also counts the statements run.
+func withCountingDB(t testing.TB, fn func(db *sqlx.DB, mock sqlmock.Sqlmock, queries *atomic.Int64)) {
+	dsn := t.Name()
+	mockDB, mock, err := sqlmock.NewWithDSN(dsn,
+		sqlmock.QueryMatcherOption(sqlmock.QueryMatcherEqual),
+		sqlmock.ValueConverterOption(arrayConverter{}),
+	)
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	defer mockDB.Close()
+
+	var queries atomic.Int64
+	counted := sql.OpenDB(countingConnector{driver: mockDB.Driver(), dsn: dsn, queries: &queries})
+	defer counted.Close()
+
+	fn(sqlx.NewDb(counted, "sqlmock"), mock, &queries)
+}
+
+// BenchmarkListOrders shows that the number of queries issued by ListOrders
+// does not depend on the number of orders, reporting how many it ran per
+// call.
+func BenchmarkListOrders(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		b.Run(fmt.Sprintf("orders=%d", n), func(b *testing.B) {
+			withCountingDB(b, func(db *sqlx.DB, mock sqlmock.Sqlmock, queries *atomic.Int64) {
+				st := NewPySQLStorer(db)
+				now := time.Now()
+				ids := make([]int64, n)
+				for i := range ids {
+					ids[i] = int64(n - i)
+				}
+
+				calls := 0
+				for b.Loop() {
+					calls++
+					b.StopTimer()
+					orders := sqlmock.NewRows(orderColumns)
+					items := sqlmock.NewRows(orderItemColumns)
+					for i, id := range ids {
+						orders.AddRow(id, 1, OrderStatusPending, "card", 0.0, 0.0, 10.0, 0.0, now, nil, nil)
+						items.AddRow(int64(i+1), "item", 1, "item.jpg", 10.0, 1, id, 1)
+					}
+					mock.ExpectQuery("SELECT * FROM orders WHERE deleted_at IS NULL ORDER BY id DESC").WillReturnRows(orders)
+					mock.ExpectQuery("SELECT * FROM order_items WHERE order_id = ANY($1) ORDER BY id").
+						WithArgs(ids).WillReturnRows(items)
+					mock.ExpectQuery("SELECT * FROM order_adjustments WHERE order_id = ANY($1) ORDER BY id").
+						WithArgs(ids).WillReturnRows(sqlmock.NewRows(adjustmentColumns))
+					mock.ExpectQuery("SELECT * FROM order_addresses WHERE order_id = ANY($1)").
+						WithArgs(ids).WillReturnRows(sqlmock.NewRows(addressColumns))
+					b.StartTimer()
+
+					res, err := st.ListOrders(context.Background(), OrderFilter{})
+					require.NoError(b, err)
+					require.Len(b, res, n)
+				}
+
+				require.NoError(b, mock.ExpectationsWereMet())
+				b.ReportMetric(float64(queries.Load())/float64(calls), "queries/op")
+			})
+		})
+	}
+}
+
+func TestRecordPaymentEvent(t *testing.T) {
+	const query = `INSERT INTO payment_events (provider, event_id, type, reference, payload, received_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (provider, event_id) DO UPDATE SET attempts = payment_events.attempts + 1
+		WHERE payment_events.processed_at IS NULL
+		RETURNING id, attempts`
+	event := func() *PaymentEvent {
+		return &PaymentEvent{
+			Provider:  "fake",
+			EventID:   "evt_1",
+			Type:      "payment.captured",
+			Reference: "fake_1",
+			Payload:   []byte(`{"id":"evt_1"}`),
+		}
+	}
+
+	tsc := []struct {
+		name string
+		test func(t *testing.T, st *PySQLStorer, mock sqlmock.Sqlmock)
+	}{
+		{
+			name: "RecordPaymentEvent stores a new event",
+			test: func(t *testing.T, st *PySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query).
+					WithArgs("fake", "evt_1", "payment.captured", "fake_1", []byte(`{"id":"evt_1"}`), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "attempts"}).AddRow(3, 1))
+
+				e, err := st.RecordPaymentEvent(context.Background(), event())
+				require.NoError(t, err)
+				require.Equal(t, int64(3), e.ID)
+				require.Equal(t, 1, e.Attempts)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "RecordPaymentEvent counts retries of an unprocessed event",
+			test: func(t *testing.T, st *PySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query).
+					WithArgs("fake", "evt_1", "payment.captured", "fake_1", []byte(`{"id":"evt_1"}`), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "attempts"}).AddRow(3, 2))
+
+				e, err := st.RecordPaymentEvent(context.Background(), event())
+				require.NoError(t, err)
+				require.Equal(t, 2, e.Attempts)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+		{
+			name: "RecordPaymentEvent rejects a processed event",
+			test: func(t *testing.T, st *PySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(query).
+					WithArgs("fake", "evt_1", "payment.captured", "fake_1", []byte(`{"id":"evt_1"}`), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id", "attempts"}))
+
+				_, err := st.RecordPaymentEvent(context.Background(), event())
+				require.ErrorIs(t, err, ErrDuplicateEvent)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewPySQLStorer(db)
+				tc.test(t, st, mock)
+			})
+		})
+	}
+}
+
+func TestRecordRefund(t *testing.T) {
+	const (
+		creditPayment = `UPDATE payments SET
+			refunded_amount = refunded_amount + $1,
+			status = CASE WHEN refunded_amount + $1 >= captured_amount THEN $2 ELSE status END,
+			updated_at = $3
+		WHERE id=$4 AND status=$5 AND refunded_amount + $1 <= captured_amount
+		RETURNING status, refunded_amount, updated_at`
+		insertRefund = `INSERT INTO refunds (order_id, payment_id, return_id, amount, reason, provider, reference, actor, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING id`
+		settleRefund = "UPDATE refunds SET status=$1, reference=$2 WHERE id=$3 AND status=$4"
+		creditOrder  = "UPDATE orders SET refunded_amount = refunded_amount + $1, updated_at=$2 WHERE id=$3"
+		creditReturn = "UPDATE returns SET refunded_amount = refunded_amount + $1, updated_at=$2 WHERE id=$3"
+		audit        = "INSERT INTO order_audit_log (order_id, actor, action, details, created_at) VALUES ($1, $2, $3, $4, $5)"
+	)
+	payment := func() *Payment {
+		return &Payment{ID: 5, OrderID: 9, Provider: "fake", Status: "captured", CapturedAmount: 30}
+	}
+	returnID := int64(4)
+
+	tsc := []struct {
+		name string
+		test func(t *testing.T, st *PySQLStorer, mock sqlmock.Sqlmock)
+	}{
+		{
+			name: "RecordRefund credits the payment, the order and the return",
+			test: func(t *testing.T, st *PySQLStorer, mock sqlmock.Sqlmock) {
+				now := time.Now()
+				mock.ExpectBegin()
+				mock.ExpectQuery(creditPayment).
+					WithArgs(30.0, "refunded", sqlmock.AnyArg(), 5, "captured").
+					WillReturnRows(sqlmock.NewRows([]string{"status", "refunded_amount", "updated_at"}).AddRow("refunded", 30.0, now))
+				mock.ExpectQuery(insertRefund).
+					WithArgs(9, 5, 4, 30.0, "return 4", "fake", "fake_1", "system", RefundStatusSucceeded, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+				mock.ExpectExec(creditOrder).WithArgs(30.0, sqlmock.AnyArg(), 9).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(creditReturn).WithArgs(30.0, sqlmock.AnyArg(), 4).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(audit).
+					WithArgs(9, "system", auditRefunded, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				p := payment()
+				rf, err := st.RecordRefund(context.Background(), &Refund{ReturnID: &returnID, Amount: 30, Reason: "return 4", Reference: "fake_1"}, p)
+				require.NoError(t, err)
+				require.Equal(t, int64(11), rf.ID)
+				require.Equal(t, "refunded", p.Status)
+				require.Equal(t, 30.0, p.RefundedAmount)
+			},
+		},
+		{
+			name: "RecordRefund rejects more than was captured",
+			test: func(t *testing.T, st *PySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(creditPayment).
+					WithArgs(40.0, "refunded", sqlmock.AnyArg(), 5, "captured").
+					WillReturnRows(sqlmock.NewRows([]string{"status", "refunded_amount", "updated_at"}))
+				mock.ExpectRollback()
+
+				_, err := st.RecordRefund(context.Background(), &Refund{Amount: 40}, payment())
+				require.ErrorIs(t, err, ErrRefundTooLarge)
+			},
+		},
+		{
+			name: "BeginRefund holds the amount on the payment only",
+			test: func(t *testing.T, st *PySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectQuery(creditPayment).
+					WithArgs(10.0, "refunded", sqlmock.AnyArg(), 5, "captured").
+					WillReturnRows(sqlmock.NewRows([]string{"status", "refunded_amount", "updated_at"}).AddRow("captured", 10.0, time.Now()))
+				mock.ExpectQuery(insertRefund).
+					WithArgs(9, 5, nil, 10.0, "", "fake", "", "system", RefundStatusPending, sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+				mock.ExpectCommit()
+
+				rf, err := st.BeginRefund(context.Background(), &Refund{Amount: 10}, payment())
+				require.NoError(t, err)
+				require.Equal(t, RefundStatusPending, rf.Status)
+			},
+		},
+		{
+			name: "CompleteRefund credits the order and the return",
+			test: func(t *testing.T, st *PySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(settleRefund).
+					WithArgs(RefundStatusSucceeded, "fake_1", 11, RefundStatusPending).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(creditOrder).WithArgs(10.0, sqlmock.AnyArg(), 9).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(creditReturn).WithArgs(10.0, sqlmock.AnyArg(), 4).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(audit).
+					WithArgs(9, "system", auditRefunded, sqlmock.AnyArg(), sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectCommit()
+
+				rf := &Refund{ID: 11, OrderID: 9, ReturnID: &returnID, Amount: 10, Reference: "fake_1", Status: RefundStatusPending}
+				err := st.CompleteRefund(context.Background(), rf)
+				require.NoError(t, err)
+				require.Equal(t, RefundStatusSucceeded, rf.Status)
+			},
+		},
+		{
+			name: "FailRefund gives the amount back to the payment",
+			test: func(t *testing.T, st *PySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(settleRefund).
+					WithArgs(RefundStatusFailed, "", 11, RefundStatusPending).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(`UPDATE payments SET refunded_amount = refunded_amount - $1, status = $2, updated_at = $3
+			WHERE id=$4
+			RETURNING status, refunded_amount, updated_at`).
+					WithArgs(10.0, "captured", sqlmock.AnyArg(), 5).
+					WillReturnRows(sqlmock.NewRows([]string{"status", "refunded_amount", "updated_at"}).AddRow("captured", 0.0, time.Now()))
+				mock.ExpectCommit()
+
+				p := payment()
+				p.RefundedAmount = 10
+				err := st.FailRefund(context.Background(), &Refund{ID: 11, OrderID: 9, Amount: 10}, p)
+				require.NoError(t, err)
+				require.Equal(t, 0.0, p.RefundedAmount)
+			},
+		},
+		{
+			name: "a settled refund cannot be settled again",
+			test: func(t *testing.T, st *PySQLStorer, mock sqlmock.Sqlmock) {
+				mock.ExpectBegin()
+				mock.ExpectExec(settleRefund).
+					WithArgs(RefundStatusSucceeded, "fake_1", 11, RefundStatusPending).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := st.CompleteRefund(context.Background(), &Refund{ID: 11, OrderID: 9, Amount: 10, Reference: "fake_1"})
+				require.Error(t, err)
+			},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewPySQLStorer(db)
+				tc.test(t, st, mock)
+
+				err := mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestRelayOutbox(t *testing.T) {
+	const claim = `SELECT * FROM outbox_events e
+			WHERE published_at IS NULL AND next_attempt_at <= $1
+			AND NOT EXISTS (
+				SELECT 1 FROM outbox_events p
+				WHERE p.aggregate_type = e.aggregate_type AND p.aggregate_id = e.aggregate_id
+				AND p.published_at IS NULL AND p.id < e.id
+			)
+			ORDER BY id
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED`
+	columns := []string{"id", "aggregate_type", "aggregate_id", "type", "payload", "attempts", "last_error", "created_at", "next_attempt_at", "published_at"}
+	now := time.Now()
+
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewPySQLStorer(db)
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(claim).WithArgs(sqlmock.AnyArg(), 10).
+			WillReturnRows(sqlmock.NewRows(columns).
+				AddRow(1, "order", 3, "order.created", []byte(`{"order_id":3}`), 0, "", now, now, nil).
+				AddRow(2, "product", 4, "product.updated", []byte(`{"product_id":4}`), 2, "timeout", now, now, nil))
+		mock.ExpectExec("UPDATE outbox_events SET next_attempt_at=$1 WHERE id = ANY($2)").
+			WithArgs(sqlmock.AnyArg(), []int64{1, 2}).WillReturnResult(sqlmock.NewResult(0, 2))
+		// The events are published once the lease is committed.
+		mock.ExpectCommit()
+		mock.ExpectExec("UPDATE outbox_events SET attempts=attempts+1, last_error='', published_at=$1 WHERE id=$2").
+			WithArgs(sqlmock.AnyArg(), 1).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE outbox_events SET attempts=attempts+1, last_error=$1, next_attempt_at=$2 WHERE id=$3").
+			WithArgs("unavailable", sqlmock.AnyArg(), 2).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		var seen []string
+		n, err := st.RelayOutbox(context.Background(), 10, func(_ context.Context, e outbox.Event) error {
+			seen = append(seen, e.Type)
+			if e.AggregateType == outbox.AggregateProduct {
+				return errors.New("unavailable")
+			}
+			require.JSONEq(t, `{"order_id":3}`, string(e.Payload))
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, 2, n)
+		require.Equal(t, []string{"order.created", "product.updated"}, seen)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestDeliverWebhooks(t *testing.T) {
+	const claim = `SELECT d.*, s.url, s.secret FROM webhook_deliveries d
+			JOIN webhook_subscriptions s ON s.id = d.subscription_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= $1 AND s.active
+			ORDER BY d.next_attempt_at, d.id
+			LIMIT $2
+			FOR UPDATE OF d SKIP LOCKED`
+	const logAttempt = `INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, duration_ms, created_at)
+		VALUES ($1, $2, $3, $4, $5)`
+	const saveOutcome = `UPDATE webhook_deliveries SET status=$1, attempts=$2, last_status_code=$3, last_error=$4,
+		next_attempt_at=$5, delivered_at=$6, updated_at=$7
+		WHERE id=$8`
+	columns := []string{"id", "subscription_id", "event_id", "event_type", "payload", "status", "attempts",
+		"last_status_code", "last_error", "next_attempt_at", "delivered_at", "created_at", "updated_at", "url", "secret"}
+
+	tsc := []struct {
+		name     string
+		attempts int
+		attempt  webhook.Attempt
+		status   string
+	}{
+		{name: "delivered", attempts: 2, attempt: webhook.Attempt{StatusCode: 200}, status: webhook.DeliverySucceeded},
+		{name: "retried", attempts: 2, attempt: webhook.Attempt{StatusCode: 503, Error: "subscriber returned 503"}, status: webhook.DeliveryPending},
+		{name: "dead after last attempt", attempts: 4, attempt: webhook.Attempt{Error: "connection refused"}, status: webhook.DeliveryDead},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewPySQLStorer(db)
+				now := time.Now()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(claim).WithArgs(sqlmock.AnyArg(), 10).
+					WillReturnRows(sqlmock.NewRows(columns).
+						AddRow(5, 2, 7, "order.created", []byte(`{"id":7}`), "pending", tc.attempts,
+							0, "", now, nil, now, nil, "https://partner.example/hooks", "whsec_test"))
+				mock.ExpectExec("UPDATE webhook_deliveries SET next_attempt_at=$1 WHERE id = ANY($2)").
+					WithArgs(sqlmock.AnyArg(), []int64{5}).WillReturnResult(sqlmock.NewResult(0, 1))
+				// The delivery is sent once the lease is committed.
+				mock.ExpectCommit()
+				mock.ExpectBegin()
+				mock.ExpectExec(logAttempt).
+					WithArgs(5, tc.attempt.StatusCode, tc.attempt.Error, int64(0), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(1, 1))
+				mock.ExpectExec(saveOutcome).
+					WithArgs(tc.status, tc.attempts+1, tc.attempt.StatusCode, tc.attempt.Error,
+						sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), 5).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				n, err := st.DeliverWebhooks(context.Background(), 10, 5, func(_ context.Context, d webhook.Delivery) webhook.Attempt {
+					require.Equal(t, "https://partner.example/hooks", d.URL)
+					require.Equal(t, "whsec_test", d.Secret)
+					require.Equal(t, int64(7), d.EventID)
+					return tc.attempt
+				})
+				require.NoError(t, err)
+				require.Equal(t, 1, n)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestRunJob(t *testing.T) {
+	const claim = `SELECT * FROM jobs
+			WHERE status = 'pending' AND run_at <= $1 AND kind = ANY($2)
+			ORDER BY run_at, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED`
+	columns := []string{"id", "kind", "payload", "key", "status", "attempts", "max_attempts", "last_error",
+		"run_at", "created_at", "updated_at", "finished_at"}
+	kinds := []string{"retention.purge"}
+
+	tsc := []struct {
+		name     string
+		attempts int
+		err      error
+		expect   func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name: "succeeded",
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE jobs SET status=$1, attempts=$2, last_error='', updated_at=$3, finished_at=$3 WHERE id=$4").
+					WithArgs(jobs.StatusSucceeded, 1, sqlmock.AnyArg(), 9).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:     "retried",
+			attempts: 1,
+			err:      errors.New("database busy"),
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE jobs SET attempts=$1, last_error=$2, run_at=$3, updated_at=$4 WHERE id=$5").
+					WithArgs(2, "database busy", sqlmock.AnyArg(), sqlmock.AnyArg(), 9).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name:     "failed after last attempt",
+			attempts: 2,
+			err:      errors.New("database busy"),
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec("UPDATE jobs SET status=$1, attempts=$2, last_error=$3, updated_at=$4, finished_at=$4 WHERE id=$5").
+					WithArgs(jobs.StatusFailed, 3, "database busy", sqlmock.AnyArg(), 9).WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewPySQLStorer(db)
+				now := time.Now()
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(claim).WithArgs(sqlmock.AnyArg(), kinds).
+					WillReturnRows(sqlmock.NewRows(columns).
+						AddRow(9, "retention.purge", []byte(`{}`), "retention.purge@1762160400", "pending", tc.attempts, 3, "",
+							now, now, nil, nil))
+				tc.expect(mock)
+				mock.ExpectCommit()
+
+				ran, err := st.RunJob(context.Background(), kinds, func(_ context.Context, j jobs.Job) error {
+					require.Equal(t, int64(9), j.ID)
+					require.Equal(t, "retention.purge@1762160400", j.Key)
+					require.Equal(t, tc.attempts, j.Attempts)
+					return tc.err
+				})
+				require.NoError(t, err)
+				require.True(t, ran)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+
+	t.Run("nothing due", func(t *testing.T) {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			st := NewPySQLStorer(db)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(claim).WithArgs(sqlmock.AnyArg(), kinds).WillReturnRows(sqlmock.NewRows(columns))
+			mock.ExpectCommit()
+
+			ran, err := st.RunJob(context.Background(), kinds, func(context.Context, jobs.Job) error {
+				t.Fatal("no job should run")
+				return nil
+			})
+			require.NoError(t, err)
+			require.False(t, ran)
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	})
+}
+
+func TestVerifyEmail(t *testing.T) {
+	const use = `UPDATE user_tokens SET used_at=$1
+		WHERE token_hash=$2 AND purpose=$3 AND used_at IS NULL AND expires_at > $1
+		RETURNING user_id`
+
+	t.Run("verified", func(t *testing.T) {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			st := NewPySQLStorer(db)
+			now := time.Now()
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(use).WithArgs(sqlmock.AnyArg(), "hash", auth.PurposeVerifyEmail).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(7))
+			mock.ExpectQuery(`UPDATE users SET email_verified_at = COALESCE(email_verified_at, $1) WHERE id=$2
+			RETURNING `+userColumns).WithArgs(sqlmock.AnyArg(), 7).
+				WillReturnRows(sqlmock.NewRows([]string{"id", "name", "email", "is_admin", "email_verified_at"}).
+					AddRow(7, "Ana", "ana@example.com", false, now))
+			mock.ExpectCommit()
+
+			u, err := st.VerifyEmail(context.Background(), "hash")
+			require.NoError(t, err)
+			require.Equal(t, int64(7), u.ID)
+			require.NotNil(t, u.EmailVerifiedAt)
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			st := NewPySQLStorer(db)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(use).WithArgs(sqlmock.AnyArg(), "hash", auth.PurposeVerifyEmail).
+				WillReturnRows(sqlmock.NewRows([]string{"user_id"}))
+			mock.ExpectRollback()
+
+			_, err := st.VerifyEmail(context.Background(), "hash")
+			require.ErrorIs(t, err, ErrInvalidToken)
+
+			err = mock.ExpectationsWereMet()
+			require.NoError(t, err)
+		})
+	})
+}
+
+func TestApplyItemEditAudit(t *testing.T) {
+	const (
+		restock = `UPDATE products SET count_in_stock = count_in_stock + $1, version = version + 1
+		WHERE id=$2 AND count_in_stock + $1 >= 0 AND ($1 > 0 OR deleted_at IS NULL)`
+		restockWarehouse = `INSERT INTO warehouse_stock (warehouse_id, product_id, quantity) VALUES ($1, $2, $3)
+			ON CONFLICT (warehouse_id, product_id) DO UPDATE SET quantity = warehouse_stock.quantity + EXCLUDED.quantity`
+		takeWarehouse = `UPDATE warehouse_stock SET quantity = quantity + $1
+		WHERE warehouse_id=$2 AND product_id=$3 AND quantity + $1 >= 0`
+		movement = `INSERT INTO inventory_movements (product_id, warehouse_id, delta, reason, actor, reference, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`
+		warehouseStock = `SELECT ws.warehouse_id, ws.quantity, w.latitude, w.longitude, w.priority
+		FROM warehouse_stock ws
+		JOIN warehouses w ON w.id = ws.warehouse_id
+		WHERE ws.product_id=$1 AND ws.quantity > 0
+		ORDER BY ws.warehouse_id
+		FOR UPDATE OF ws`
+		insertItem = `INSERT INTO order_items (
+			name, quantity, image, price, product_id, order_id, warehouse_id, tax_rate, tax_amount
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id`
+		audit = "INSERT INTO order_audit_log (order_id, actor, action, details, created_at) VALUES ($1, $2, $3, $4, $5)"
+	)
+	items := []OrderItem{
+		{ID: 20, Name: "mug", Quantity: 3, Price: 10, ProductID: 5, OrderID: 1, WarehouseID: 2},
+	}
+
+	tsc := []struct {
+		name   string
+		edit   OrderItemEdit
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name: "unchanged quantity is not audited",
+			edit: OrderItemEdit{ProductID: 5, Quantity: 3},
+		},
+		{
+			name: "item removed",
+			edit: OrderItemEdit{ProductID: 5, Quantity: 0},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(restock).WithArgs(3, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(restockWarehouse).WithArgs(2, 5, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(movement).WithArgs(5, 2, 3, MovementOrder, "alice", "order:1", sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectExec("DELETE FROM order_items WHERE id=$1").WithArgs(20).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(audit).WithArgs(1, "alice", auditItemRemoved, []byte(`{"product_id":5,"quantity":3}`), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+		{
+			name: "quantity changed",
+			edit: OrderItemEdit{ProductID: 5, Quantity: 1},
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectExec(restock).WithArgs(3, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(restockWarehouse).WithArgs(2, 5, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(movement).WithArgs(5, 2, 3, MovementOrder, "alice", "order:1", sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+				mock.ExpectExec("DELETE FROM order_items WHERE id=$1").WithArgs(20).WillReturnResult(sqlmock.NewResult(0, 1))
+
+				mock.ExpectQuery(warehouseStock).WithArgs(5).
+					WillReturnRows(sqlmock.NewRows([]string{"warehouse_id", "quantity", "latitude", "longitude", "priority"}).
+						AddRow(2, 3, 0.0, 0.0, 0))
+				mock.ExpectExec(restock).WithArgs(-1, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectExec(takeWarehouse).WithArgs(-1, 2, 5).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(movement).WithArgs(5, 2, -1, MovementOrder, "alice", "order:1", sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+				mock.ExpectQuery(insertItem).WithArgs("mug", 1, "", 10.0, 5, 1, 2, 0.0, 0.0).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(21))
+				mock.ExpectExec(audit).WithArgs(1, "alice", auditItemQuantityChanged, []byte(`{"from":3,"product_id":5,"to":1}`), sqlmock.AnyArg()).
+					WillReturnResult(sqlmock.NewResult(0, 1))
+			},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewPySQLStorer(db)
+				ctx := WithActor(context.Background(), "alice")
+
+				mock.ExpectBegin()
+				if tc.expect != nil {
+					tc.expect(mock)
+				}
+				mock.ExpectCommit()
+
+				err := st.execTx(ctx, func(tx *sqlx.Tx) error {
+					return st.applyItemEdit(ctx, tx, &Order{ID: 1}, items, tc.edit)
+				})
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestPurgeDeleted(t *testing.T) {
+	const (
+		findOrders = `SELECT o.id FROM orders o WHERE o.deleted_at < $1
+			AND NOT EXISTS (SELECT 1 FROM payments p WHERE p.order_id = o.id)
+			AND NOT EXISTS (SELECT 1 FROM refunds rf WHERE rf.order_id = o.id)
+			AND NOT EXISTS (SELECT 1 FROM returns rt WHERE rt.order_id = o.id)
+			FOR UPDATE`
+		findProducts = `SELECT p.id FROM products p WHERE p.deleted_at < $1
+			AND NOT EXISTS (SELECT 1 FROM order_items oi WHERE oi.product_id = p.id)
+			FOR UPDATE`
+	)
+	cutoff := time.Now().Add(-30 * 24 * time.Hour)
+
+	tsc := []struct {
+		name     string
+		orders   []int64
+		products []int64
+	}{
+		{name: "orders without money attached", orders: []int64{3, 4}},
+		// Products with stock have ledger rows, which go with them.
+		{name: "products with inventory movements", products: []int64{8, 9}},
+		{name: "nothing purgeable"},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewPySQLStorer(db)
+
+				rows := sqlmock.NewRows([]string{"id"})
+				for _, id := range tc.orders {
+					rows.AddRow(id)
+				}
+				mock.ExpectBegin()
+				mock.ExpectQuery(findOrders).WithArgs(cutoff).WillReturnRows(rows)
+				if len(tc.orders) > 0 {
+					mock.ExpectExec("DELETE FROM order_items WHERE order_id = ANY($1)").WithArgs(tc.orders).
+						WillReturnResult(sqlmock.NewResult(0, 5))
+					mock.ExpectExec("DELETE FROM orders WHERE id = ANY($1)").WithArgs(tc.orders).
+						WillReturnResult(sqlmock.NewResult(0, int64(len(tc.orders))))
+				}
+				rows = sqlmock.NewRows([]string{"id"})
+				for _, id := range tc.products {
+					rows.AddRow(id)
+				}
+				mock.ExpectQuery(findProducts).WithArgs(cutoff).WillReturnRows(rows)
+				if len(tc.products) > 0 {
+					mock.ExpectExec("DELETE FROM inventory_movements WHERE product_id = ANY($1)").WithArgs(tc.products).
+						WillReturnResult(sqlmock.NewResult(0, 6))
+					mock.ExpectExec("DELETE FROM products WHERE id = ANY($1)").WithArgs(tc.products).
+						WillReturnResult(sqlmock.NewResult(0, int64(len(tc.products))))
+				}
+				mock.ExpectCommit()
+
+				products, orders, err := st.PurgeDeleted(context.Background(), cutoff)
+				require.NoError(t, err)
+				require.Equal(t, int64(len(tc.products)), products)
+				require.Equal(t, int64(len(tc.orders)), orders)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestAdjustStock(t *testing.T) {
+	const adjust = `UPDATE products SET count_in_stock = count_in_stock + $1, version = version + 1
+		WHERE id=$2 AND count_in_stock + $1 >= 0 AND ($1 > 0 OR deleted_at IS NULL)`
+
+	tsc := []struct {
+		name  string
+		delta int64
+		err   error
+	}{
+		{name: "not enough stock", delta: -5, err: ErrInsufficientStock},
+		{name: "unknown product", delta: 5, err: ErrNotFound},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewPySQLStorer(db)
+
+				mock.ExpectBegin()
+				mock.ExpectExec(adjust).WithArgs(tc.delta, 9).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectRollback()
+
+				err := st.execTx(context.Background(), func(tx *sqlx.Tx) error {
+					return adjustStock(context.Background(), tx, &StockMovement{ProductID: 9, Delta: tc.delta})
+				})
+				require.ErrorIs(t, err, tc.err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestUpsertProductsDeleted(t *testing.T) {
+	const lock = "SELECT count_in_stock, deleted_at IS NOT NULL AS deleted FROM products WHERE sku=$1 FOR UPDATE"
+
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewPySQLStorer(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec("SAVEPOINT upsert_row").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(lock).WithArgs("MUG-1").
+			WillReturnRows(sqlmock.NewRows([]string{"count_in_stock", "deleted"}).AddRow(4, true))
+		mock.ExpectExec("ROLLBACK TO SAVEPOINT upsert_row").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		res, err := st.UpsertProducts(context.Background(), []Product{{SKU: "MUG-1", Name: "Mug"}}, UpsertOptions{})
+		require.NoError(t, err)
+		require.Len(t, res, 1)
+		require.ErrorIs(t, res[0].Err, ErrProductDeleted)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestReconcileStock(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewPySQLStorer(db)
+
+		mock.ExpectQuery(`SELECT p.id AS product_id, p.sku, p.count_in_stock, COALESCE(SUM(m.delta), 0) AS ledger_stock
+		FROM products p
+		LEFT JOIN inventory_movements m ON m.product_id = p.id
+		WHERE p.deleted_at IS NULL
+		GROUP BY p.id, p.sku, p.count_in_stock
+		ORDER BY p.id`).
+			WillReturnRows(sqlmock.NewRows([]string{"product_id", "sku", "count_in_stock", "ledger_stock"}).
+				AddRow(1, "MUG-1", 10, 10).
+				AddRow(2, "CUP-1", 7, 9).
+				AddRow(3, "NEW-1", 0, 0))
+
+		res, err := st.ReconcileStock(context.Background())
+		require.NoError(t, err)
+		require.Len(t, res, 3)
+
+		drifts := []int64{}
+		for _, r := range res {
+			drifts = append(drifts, r.Drift())
+		}
+		require.Equal(t, []int64{0, -2, 0}, drifts)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestAdjustStockLedger(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewPySQLStorer(db)
+		ctx := WithActor(context.Background(), "alice")
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE products SET count_in_stock = count_in_stock + $1, version = version + 1
+		WHERE id=$2 AND count_in_stock + $1 >= 0 AND ($1 > 0 OR deleted_at IS NULL)`).
+			WithArgs(4, 9).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`INSERT INTO warehouse_stock (warehouse_id, product_id, quantity) VALUES ($1, $2, $3)
+			ON CONFLICT (warehouse_id, product_id) DO UPDATE SET quantity = warehouse_stock.quantity + EXCLUDED.quantity`).
+			WithArgs(2, 9, 4).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`INSERT INTO inventory_movements (product_id, warehouse_id, delta, reason, actor, reference, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`).
+			WithArgs(9, 2, 4, MovementAdjustment, "alice", "recount", sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(30))
+		mock.ExpectCommit()
+
+		m := &StockMovement{ProductID: 9, WarehouseID: 2, Delta: 4, Reason: MovementAdjustment, Reference: "recount"}
+		err := st.execTx(ctx, func(tx *sqlx.Tx) error {
+			return adjustStock(ctx, tx, m)
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(30), m.ID)
+		require.Equal(t, "alice", m.Actor)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestRecordStockChange(t *testing.T) {
+	const (
+		warehouseStock = `SELECT ws.warehouse_id, ws.quantity, w.latitude, w.longitude, w.priority
+		FROM warehouse_stock ws
+		JOIN warehouses w ON w.id = ws.warehouse_id
+		WHERE ws.product_id=$1 AND ws.quantity > 0
+		ORDER BY ws.warehouse_id
+		FOR UPDATE OF ws`
+		takeWarehouse = `UPDATE warehouse_stock SET quantity = quantity + $1
+		WHERE warehouse_id=$2 AND product_id=$3 AND quantity + $1 >= 0`
+		movement = `INSERT INTO inventory_movements (product_id, warehouse_id, delta, reason, actor, reference, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`
+	)
+	stock := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"warehouse_id", "quantity", "latitude", "longitude", "priority"}).
+			AddRow(1, 3, 0.0, 0.0, 0).
+			AddRow(2, 4, 0.0, 0.0, 1)
+	}
+
+	tsc := []struct {
+		name   string
+		delta  int64
+		err    error
+		expect func(mock sqlmock.Sqlmock)
+	}{
+		{
+			name:  "decrease spread over warehouses",
+			delta: -5,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(warehouseStock).WithArgs(9).WillReturnRows(stock())
+				for _, w := range []struct{ id, delta int64 }{{1, -3}, {2, -2}} {
+					mock.ExpectExec(takeWarehouse).WithArgs(w.delta, w.id, 9).WillReturnResult(sqlmock.NewResult(0, 1))
+					mock.ExpectQuery(movement).WithArgs(9, w.id, w.delta, MovementImport, "system", "sku:MUG-1", sqlmock.AnyArg()).
+						WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(w.id))
+				}
+			},
+		},
+		{
+			name:  "decrease beyond warehouse stock",
+			delta: -8,
+			err:   ErrInsufficientStock,
+			expect: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(warehouseStock).WithArgs(9).WillReturnRows(stock())
+			},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewPySQLStorer(db)
+
+				mock.ExpectBegin()
+				tc.expect(mock)
+				if tc.err != nil {
+					mock.ExpectRollback()
+				} else {
+					mock.ExpectCommit()
+				}
+
+				err := st.execTx(context.Background(), func(tx *sqlx.Tx) error {
+					return recordStockChange(context.Background(), tx, StockMovement{
+						ProductID: 9,
+						Delta:     tc.delta,
+						Reason:    MovementImport,
+						Reference: "sku:MUG-1",
+					})
+				})
+				if tc.err != nil {
+					require.ErrorIs(t, err, tc.err)
+				} else {
+					require.NoError(t, err)
+				}
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestRecordStockChangeTracksWholeChange(t *testing.T) {
+	const (
+		product        = "SELECT id, sku, name, count_in_stock, reorder_threshold FROM products WHERE id=$1"
+		warehouseStock = `SELECT ws.warehouse_id, ws.quantity, w.latitude, w.longitude, w.priority
+		FROM warehouse_stock ws
+		JOIN warehouses w ON w.id = ws.warehouse_id
+		WHERE ws.product_id=$1 AND ws.quantity > 0
+		ORDER BY ws.warehouse_id
+		FOR UPDATE OF ws`
+		takeWarehouse = `UPDATE warehouse_stock SET quantity = quantity + $1
+		WHERE warehouse_id=$2 AND product_id=$3 AND quantity + $1 >= 0`
+		movement = `INSERT INTO inventory_movements (product_id, warehouse_id, delta, reason, actor, reference, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id`
+	)
+	// count_in_stock went from 10 to 2 before the change is split over
+	// warehouse 1, holding 1, and warehouse 2, holding 9.
+	productRow := func() *sqlmock.Rows {
+		return sqlmock.NewRows([]string{"id", "sku", "name", "count_in_stock", "reorder_threshold"}).
+			AddRow(9, "MUG-1", "Mug", 2, 5)
+	}
+
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewPySQLStorer(db)
+		ctx, changes := trackStockChanges(context.Background())
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(product).WithArgs(9).WillReturnRows(productRow())
+		mock.ExpectQuery(warehouseStock).WithArgs(9).WillReturnRows(
+			sqlmock.NewRows([]string{"warehouse_id", "quantity", "latitude", "longitude", "priority"}).
+				AddRow(1, 1, 0.0, 0.0, 0).
+				AddRow(2, 9, 0.0, 0.0, 1))
+		for _, w := range []struct{ id, delta int64 }{{1, -1}, {2, -7}} {
+			mock.ExpectExec(takeWarehouse).WithArgs(w.delta, w.id, 9).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectQuery(product).WithArgs(9).WillReturnRows(productRow())
+			mock.ExpectQuery(movement).WithArgs(9, w.id, w.delta, MovementAdjustment, "system", "", sqlmock.AnyArg()).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(w.id))
+		}
+		mock.ExpectCommit()
+
+		err := st.execTx(ctx, func(tx *sqlx.Tx) error {
+			return recordStockChange(ctx, tx, StockMovement{ProductID: 9, Delta: -8, Reason: MovementAdjustment})
+		})
+		require.NoError(t, err)
+
+		// The change crosses the reorder threshold, whichever warehouse
+		// the first movement came from.
+		require.Equal(t, StockChange{ProductID: 9, SKU: "MUG-1", Name: "Mug", Before: 10, After: 2, ReorderThreshold: 5}, *changes.byID[9])
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestStockChanges(t *testing.T) {
+	const stock = "SELECT id, sku, name, count_in_stock, reorder_threshold FROM products WHERE id=$1"
+	columns := []string{"id", "sku", "name", "count_in_stock", "reorder_threshold"}
+
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		ctx := context.Background()
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(stock).WithArgs(1).WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "MUG-1", "Mug", 7, 5))
+		mock.ExpectQuery(stock).WithArgs(1).WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "MUG-1", "Mug", 4, 5))
+		mock.ExpectQuery(stock).WithArgs(2).WillReturnRows(sqlmock.NewRows(columns).AddRow(2, "CUP-1", "Cup", 3, 0))
+		mock.ExpectQuery(stock).WithArgs(1).WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "MUG-1", "Mug", 10, 5))
+		mock.ExpectQuery(stock).WithArgs(3).WillReturnRows(sqlmock.NewRows(columns).AddRow(3, "PEN-1", "Pen", 1, 0))
+		mock.ExpectCommit()
+
+		tx, err := db.Beginx()
+		require.NoError(t, err)
+
+		c := &stockChanges{byID: map[int64]*StockChange{}}
+		// Two movements of the same product net out to one change.
+		require.NoError(t, c.record(ctx, tx, &StockMovement{ProductID: 1, Delta: -3}))
+		require.NoError(t, c.record(ctx, tx, &StockMovement{ProductID: 1, Delta: -3}))
+		require.NoError(t, c.record(ctx, tx, &StockMovement{ProductID: 2, Delta: 3}))
+		require.Equal(t, StockChange{ProductID: 1, SKU: "MUG-1", Name: "Mug", Before: 10, After: 4, ReorderThreshold: 5}, *c.byID[1])
+		require.Equal(t, StockChange{ProductID: 2, SKU: "CUP-1", Name: "Cup", Before: 0, After: 3}, *c.byID[2])
+
+		later := &stockChanges{byID: map[int64]*StockChange{}}
+		require.NoError(t, later.record(ctx, tx, &StockMovement{ProductID: 1, Delta: 6}))
+		require.NoError(t, later.record(ctx, tx, &StockMovement{ProductID: 3, Delta: 1}))
+		require.NoError(t, tx.Commit())
+
+		// Merging keeps the first Before and takes the later After.
+		c.merge(later)
+		require.Equal(t, []int64{1, 2, 3}, c.order)
+		require.Equal(t, int64(10), c.byID[1].Before)
+		require.Equal(t, int64(10), c.byID[1].After)
+		require.Equal(t, int64(0), c.byID[3].Before)
+
+		// Product 1 is back where it started, so only 2 and 3 are reported.
+		var reported []StockChange
+		st := NewPySQLStorer(db)
+		st.OnStockChange(func(_ context.Context, changes []StockChange) { reported = changes })
+		st.stockChanged(ctx, c)
+		require.Len(t, reported, 2)
+		require.Equal(t, int64(2), reported[0].ProductID)
+		require.Equal(t, int64(3), reported[1].ProductID)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestDeleteOrderReleasesPromotions(t *testing.T) {
+	tsc := []struct {
+		name     string
+		status   string
+		released []int64
+	}{
+		{name: "pending order gives its promotions back", status: OrderStatusPending, released: []int64{3, 5}},
+		{name: "order without promotions", status: OrderStatusPending},
+		{name: "shipped order keeps its promotions", status: OrderStatusShipped},
+		{name: "paid order is refunded, not cancelled", status: OrderStatusPaid},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewPySQLStorer(db)
+
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT status FROM orders WHERE id=$1 AND deleted_at IS NULL FOR UPDATE").
+					WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(tc.status))
+				if tc.status == OrderStatusPaid {
+					mock.ExpectRollback()
+
+					err := st.DeleteOrder(context.Background(), 7)
+					require.ErrorIs(t, err, ErrOrderPaid)
+					require.NoError(t, mock.ExpectationsWereMet())
+					return
+				}
+				status := tc.status
+				if tc.status == OrderStatusPending {
+					status = OrderStatusCancelled
+					mock.ExpectQuery("SELECT * FROM order_items WHERE order_id=$1").
+						WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"id"}))
+					rows := sqlmock.NewRows([]string{"promotion_id"})
+					for _, id := range tc.released {
+						rows.AddRow(id)
+					}
+					mock.ExpectQuery("DELETE FROM promotion_redemptions WHERE order_id=$1 RETURNING promotion_id").
+						WithArgs(7).WillReturnRows(rows)
+					if len(tc.released) > 0 {
+						mock.ExpectExec("UPDATE promotions SET times_used = times_used - 1 WHERE id = ANY($1) AND times_used > 0").
+							WithArgs(tc.released).WillReturnResult(sqlmock.NewResult(0, int64(len(tc.released))))
+					}
+					mock.ExpectExec(`INSERT INTO outbox_events (aggregate_type, aggregate_id, type, payload, created_at, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $5)`).
+						WithArgs(outbox.AggregateOrder, 7, outbox.EventOrderCancelled, sqlmock.AnyArg(), sqlmock.AnyArg()).
+						WillReturnResult(sqlmock.NewResult(0, 1))
+				}
+				mock.ExpectExec("UPDATE orders SET status=$1, deleted_at=$2, updated_at=$2 WHERE id=$3").
+					WithArgs(status, sqlmock.AnyArg(), 7).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectCommit()
+
+				err := st.DeleteOrder(context.Background(), 7)
+				require.NoError(t, err)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestSplitTax(t *testing.T) {
+	tsc := []struct {
+		name   string
+		amount float64
+		allocs []allocation.Allocation
+		want   []float64
+	}{
+		{
+			name:   "one warehouse",
+			amount: 7.25,
+			allocs: []allocation.Allocation{{WarehouseID: 1, Quantity: 3}},
+			want:   []float64{7.25},
+		},
+		{
+			name:   "by quantity",
+			amount: 10,
+			allocs: []allocation.Allocation{{WarehouseID: 1, Quantity: 3}, {WarehouseID: 2, Quantity: 1}},
+			want:   []float64{7.5, 2.5},
+		},
+		{
+			name:   "rounding goes to the last part",
+			amount: 1,
+			allocs: []allocation.Allocation{{WarehouseID: 1, Quantity: 1}, {WarehouseID: 2, Quantity: 1}, {WarehouseID: 3, Quantity: 1}},
+			want:   []float64{0.33, 0.33, 0.34},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			got := splitTax(tc.amount, tc.allocs)
+			require.InDeltaSlice(t, tc.want, got, 1e-9)
+		})
+	}
+}
+
+func TestItemDiscounts(t *testing.T) {
+	tsc := []struct {
+		name        string
+		gross       []float64
+		itemLine    []int
+		adjustments []promotion.Adjustment
+		want        []float64
+	}{
+		{
+			name:        "order discount by price",
+			gross:       []float64{30, 10},
+			itemLine:    []int{0, 1},
+			adjustments: []promotion.Adjustment{{Line: -1, Amount: 8}},
+			want:        []float64{6, 2},
+		},
+		{
+			name:        "line discount stays on its line",
+			gross:       []float64{30, 10, 20},
+			itemLine:    []int{0, 1, 0},
+			adjustments: []promotion.Adjustment{{Line: 0, Amount: 5}},
+			want:        []float64{3, 0, 2},
+		},
+		{
+			name:     "order discount shares what the line discount left",
+			gross:    []float64{20, 20},
+			itemLine: []int{0, 1},
+			adjustments: []promotion.Adjustment{
+				{Line: 0, Amount: 10},
+				{Line: -1, Amount: 6},
+			},
+			want: []float64{12, 4},
+		},
+		{
+			name:        "shipping discount is not on the items",
+			gross:       []float64{20},
+			itemLine:    []int{0},
+			adjustments: []promotion.Adjustment{{Line: -1, Shipping: true, Amount: 5}},
+			want:        []float64{0},
+		},
+		{
+			name:        "rounding goes to the last item",
+			gross:       []float64{10, 10, 10},
+			itemLine:    []int{0, 1, 2},
+			adjustments: []promotion.Adjustment{{Line: -1, Amount: 1}},
+			want:        []float64{0.33, 0.33, 0.34},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			got := itemDiscounts(tc.gross, tc.itemLine, tc.adjustments)
+			require.InDeltaSlice(t, tc.want, got, 1e-9)
+		})
+	}
+}
+
+func TestCreateAddress(t *testing.T) {
+	const (
+		lock         = "SELECT id FROM users WHERE id=$1 FOR UPDATE"
+		count        = "SELECT COUNT(*) FROM addresses WHERE user_id=$1"
+		clearShip    = "UPDATE addresses SET is_default_shipping=FALSE WHERE user_id=$1 AND id<>$2 AND is_default_shipping"
+		clearBilling = "UPDATE addresses SET is_default_billing=FALSE WHERE user_id=$1 AND id<>$2 AND is_default_billing"
+		insert       = `INSERT INTO addresses (
+				user_id, name, line1, line2, city, region, postal_code, country, phone,
+				is_default_shipping, is_default_billing, created_at, updated_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			RETURNING id`
+	)
+
+	tsc := []struct {
+		name        string
+		existing    int
+		defaultShip bool
+		test        func(mock sqlmock.Sqlmock, a *Address)
+	}{
+		{
+			name: "first address becomes both defaults",
+			test: func(mock sqlmock.Sqlmock, a *Address) {
+				mock.ExpectExec(clearShip).WithArgs(4, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectExec(clearBilling).WithArgs(4, 0).WillReturnResult(sqlmock.NewResult(0, 0))
+				mock.ExpectQuery(insert).
+					WithArgs(4, a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.Phone, true, true, sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+			},
+		},
+		{
+			name:        "new default shipping address takes over",
+			existing:    2,
+			defaultShip: true,
+			test: func(mock sqlmock.Sqlmock, a *Address) {
+				mock.ExpectExec(clearShip).WithArgs(4, 0).WillReturnResult(sqlmock.NewResult(0, 1))
+				mock.ExpectQuery(insert).
+					WithArgs(4, a.Name, a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country, a.Phone, true, false, sqlmock.AnyArg(), sqlmock.AnyArg()).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(11))
+			},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewPySQLStorer(db)
+				a := &Address{UserID: 4, Name: "Ada", Line1: "1 Main St", City: "Springfield", Country: "US", IsDefaultShipping: tc.defaultShip}
+
+				mock.ExpectBegin()
+				mock.ExpectQuery(lock).WithArgs(4).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+				mock.ExpectQuery(count).WithArgs(4).WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(tc.existing))
+				tc.test(mock, a)
+				mock.ExpectCommit()
+
+				res, err := st.CreateAddress(context.Background(), a)
+				require.NoError(t, err)
+				require.Equal(t, int64(11), res.ID)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestAddressNotFound(t *testing.T) {
+	tsc := []struct {
+		name string
+		test func(st *PySQLStorer, mock sqlmock.Sqlmock) error
+	}{
+		{
+			name: "create for unknown user",
+			test: func(st *PySQLStorer, mock sqlmock.Sqlmock) error {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT id FROM users WHERE id=$1 FOR UPDATE").WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}))
+				mock.ExpectRollback()
+				_, err := st.CreateAddress(context.Background(), &Address{UserID: 4})
+				return err
+			},
+		},
+		{
+			name: "update another user's address",
+			test: func(st *PySQLStorer, mock sqlmock.Sqlmock) error {
+				mock.ExpectBegin()
+				mock.ExpectQuery("SELECT id FROM users WHERE id=$1 FOR UPDATE").WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(4))
+				mock.ExpectQuery(`UPDATE addresses SET
+				name=$1, line1=$2, line2=$3, city=$4, region=$5, postal_code=$6, country=$7, phone=$8,
+				is_default_shipping=$9, is_default_billing=$10, updated_at=$11
+			WHERE id=$12 AND user_id=$13
+			RETURNING created_at`).
+					WithArgs("Ada", "", "", "", "", "", "", "", false, false, sqlmock.AnyArg(), 9, 4).
+					WillReturnRows(sqlmock.NewRows([]string{"created_at"}))
+				mock.ExpectRollback()
+				_, err := st.UpdateAddress(context.Background(), &Address{ID: 9, UserID: 4, Name: "Ada"})
+				return err
+			},
+		},
+		{
+			name: "delete another user's address",
+			test: func(st *PySQLStorer, mock sqlmock.Sqlmock) error {
+				mock.ExpectExec("DELETE FROM addresses WHERE id=$1 AND user_id=$2").WithArgs(9, 4).
+					WillReturnResult(sqlmock.NewResult(0, 0))
+				return st.DeleteAddress(context.Background(), 4, 9)
+			},
+		},
+		{
+			name: "list for unknown user",
+			test: func(st *PySQLStorer, mock sqlmock.Sqlmock) error {
+				mock.ExpectQuery("SELECT EXISTS (SELECT 1 FROM users WHERE id=$1)").WithArgs(4).
+					WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				_, err := st.ListAddresses(context.Background(), 4)
+				return err
+			},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				err := tc.test(NewPySQLStorer(db), mock)
+				require.ErrorIs(t, err, ErrNotFound)
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestCreatePayment(t *testing.T) {
+	const (
+		lock   = "SELECT status FROM orders WHERE id=$1 AND deleted_at IS NULL FOR UPDATE"
+		live   = "SELECT EXISTS (SELECT 1 FROM payments WHERE order_id=$1 AND status = ANY($2))"
+		insert = `INSERT INTO payments (
+				order_id, provider, reference, status, amount, captured_amount, refunded_amount, currency,
+				card_last4, redirect_url, failure_reason, created_at, updated_at
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
+			RETURNING id`
+	)
+	liveStates := []string{"authorized", "captured"}
+
+	tsc := []struct {
+		name   string
+		status string
+		test   func(mock sqlmock.Sqlmock)
+		err    error
+	}{
+		{
+			name:   "declined attempts are always recorded",
+			status: "declined",
+			test: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(insert).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:   "first authorization of a pending order",
+			status: "authorized",
+			test: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(lock).WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(OrderStatusPending))
+				mock.ExpectQuery(live).WithArgs(7, liveStates).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+				mock.ExpectQuery(insert).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+				mock.ExpectCommit()
+			},
+		},
+		{
+			name:   "order already authorized",
+			status: "authorized",
+			test: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(lock).WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(OrderStatusPending))
+				mock.ExpectQuery(live).WithArgs(7, liveStates).WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+				mock.ExpectRollback()
+			},
+			err: ErrPaymentExists,
+		},
+		{
+			name:   "order paid meanwhile",
+			status: "requires_action",
+			test: func(mock sqlmock.Sqlmock) {
+				mock.ExpectQuery(lock).WithArgs(7).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(OrderStatusPaid))
+				mock.ExpectRollback()
+			},
+			err: ErrOrderNotPending,
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+				st := NewPySQLStorer(db)
+
+				mock.ExpectBegin()
+				tc.test(mock)
+
+				p, err := st.CreatePayment(context.Background(), &Payment{OrderID: 7, Provider: "fake", Reference: "fake_1", Status: tc.status, Amount: 20})
+				if tc.err != nil {
+					require.ErrorIs(t, err, tc.err)
+				} else {
+					require.NoError(t, err)
+					require.Equal(t, int64(3), p.ID)
+				}
+
+				err = mock.ExpectationsWereMet()
+				require.NoError(t, err)
+			})
+		})
+	}
+}
+
+func TestUpdatePaymentOrderNotPending(t *testing.T) {
+	withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+		st := NewPySQLStorer(db)
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`UPDATE payments SET
+				status=$1, captured_amount=$2, refunded_amount=$3, redirect_url=$4, failure_reason=$5, updated_at=$6
+			WHERE id=$7 AND status=$8`).
+			WithArgs("captured", 20.0, 0.0, "", "", sqlmock.AnyArg(), 3, "authorized").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE orders SET status=$1, updated_at=$2 WHERE id=$3 AND status=$4").
+			WithArgs(OrderStatusPaid, sqlmock.AnyArg(), 7, OrderStatusPending).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		p := &Payment{ID: 3, OrderID: 7, Status: "captured", Amount: 20, CapturedAmount: 20}
+		err := st.UpdatePayment(context.Background(), p, "authorized")
+		require.ErrorIs(t, err, ErrOrderNotPending)
+
+		err = mock.ExpectationsWereMet()
+		require.NoError(t, err)
+	})
+}
+
+func TestShipOrder(t *testing.T) {
+	const lock = "SELECT status FROM orders WHERE id=$1 AND deleted_at IS NULL FOR UPDATE"
+	sh := &Shipment{Carrier: "DHL", TrackingNumber: "JD014600"}
+
+	t.Run("paid order ships", func(t *testing.T) {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			st := NewPySQLStorer(db)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(lock).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(OrderStatusPaid))
+			mock.ExpectExec("UPDATE orders SET status=$1, updated_at=$2 WHERE id=$3").
+				WithArgs(OrderStatusShipped, sqlmock.AnyArg(), 3).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec("INSERT INTO order_audit_log (order_id, actor, action, details, created_at) VALUES ($1, $2, $3, $4, $5)").
+				WithArgs(3, "system", auditStatusChanged, []byte(`{"from":"paid","to":"shipped"}`), sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectExec(`INSERT INTO outbox_events (aggregate_type, aggregate_id, type, payload, created_at, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, $5)`).
+				WithArgs(outbox.AggregateOrder, 3, outbox.EventOrderShipped,
+					[]byte(`{"carrier":"DHL","order_id":3,"status":"shipped","tracking_number":"JD014600","tracking_url":""}`), sqlmock.AnyArg()).
+				WillReturnResult(sqlmock.NewResult(1, 1))
+			mock.ExpectCommit()
+
+			require.NoError(t, st.ShipOrder(context.Background(), 3, sh))
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+
+	t.Run("pending order does not", func(t *testing.T) {
+		withTestDB(t, func(db *sqlx.DB, mock sqlmock.Sqlmock) {
+			st := NewPySQLStorer(db)
+
+			mock.ExpectBegin()
+			mock.ExpectQuery(lock).WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{"status"}).AddRow(OrderStatusPending))
+			mock.ExpectRollback()
+
+			err := st.ShipOrder(context.Background(), 3, sh)
+			require.ErrorIs(t, err, ErrOrderNotPaid)
+			require.NoError(t, mock.ExpectationsWereMet())
+		})
+	})
+}
@@ -1,37 +1,548 @@
 package storer
 
-import "time"
+import (
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/allocation"
+)
 
 type Product struct {
+	ID           int64   `db:"id"`
+	SKU          string  `db:"sku"`
+	Name         string  `db:"name"`
+	Image        string  `db:"image"`
+	Category     string  `db:"category"`
+	Description  string  `db:"description"`
+	Rating       int64   `db:"rating"`
+	NumReviews   int64   `db:"num_reviews"`
+	Price        float64 `db:"price"`
+	CountInStock int64   `db:"count_in_stock"`
+	// ReorderThreshold raises a low-stock alert when stock drops below it;
+	// zero disables the alert.
+	ReorderThreshold int64 `db:"reorder_threshold"`
+	// TaxCategory picks the tax rate; empty means the standard rate.
+	TaxCategory string `db:"tax_category"`
+	// Weight is in kg and the dimensions in cm. Shipping is charged on
+	// whichever of the weight and the volume weighs more.
+	Weight    float64    `db:"weight"`
+	Length    float64    `db:"length"`
+	Width     float64    `db:"width"`
+	Height    float64    `db:"height"`
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt *time.Time `db:"updated_at"`
+	DeletedAt *time.Time `db:"deleted_at"`
+	Version   int64      `db:"version"`
+}
+
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+)
+
+type Order struct {
+	ID            int64   `db:"id"`
+	UserID        int64   `db:"user_id"`
+	Status        string  `db:"status"`
+	PaymentMethod string  `db:"payment_method"`
+	TaxPrice      float64 `db:"tax_price"`
+	ShippingPrice float64 `db:"shipping_price"`
+	TotalPrice    float64 `db:"total_price"`
+	// DiscountPrice is the sum of the order's adjustments.
+	DiscountPrice float64 `db:"discount_price"`
+	// TaxCountry, TaxRegion and TaxPostalCode are the address the order is
+	// taxed for. TaxInclusive means item prices already include the tax.
+	TaxCountry    string `db:"tax_country"`
+	TaxRegion     string `db:"tax_region"`
+	TaxPostalCode string `db:"tax_postal_code"`
+	TaxInclusive  bool   `db:"tax_inclusive"`
+	// ShippingMethod is the method ShippingPrice was quoted for.
+	ShippingMethod string `db:"shipping_method"`
+	// RefundedAmount is the sum of the order's refunds.
+	RefundedAmount float64    `db:"refunded_amount"`
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      *time.Time `db:"updated_at"`
+	DeletedAt      *time.Time `db:"deleted_at"`
+	Items          []OrderItem
+	Adjustments    []OrderAdjustment
+	// CouponCodes are the promotions to apply when the order is created.
+	CouponCodes []string `db:"-"`
+	// ShipTo is where the order is delivered, used to pick warehouses.
+	ShipTo *allocation.Location `db:"-"`
+	// ShippingAddress and BillingAddress are stored with the order when it
+	// is created.
+	ShippingAddress *OrderAddress `db:"-"`
+	BillingAddress  *OrderAddress `db:"-"`
+}
+
+const (
+	RefundStatusNone    = "none"
+	RefundStatusPartial = "partially_refunded"
+	RefundStatusFull    = "refunded"
+)
+
+// RefundStatus tells whether none, part or all of the order's total has been
+// refunded.
+func (o *Order) RefundStatus() string {
+	switch {
+	case o.RefundedAmount <= 0:
+		return RefundStatusNone
+	case o.RefundedAmount < o.TotalPrice-0.005:
+		return RefundStatusPartial
+	default:
+		return RefundStatusFull
+	}
+}
+
+// Shipment is how an order was sent to its customer.
+type Shipment struct {
+	Carrier        string
+	TrackingNumber string
+	TrackingURL    string
+}
+
+type OrderItem struct {
+	ID          int64   `db:"id"`
+	Name        string  `db:"name"`
+	Quantity    int64   `db:"quantity"`
+	Image       string  `db:"image"`
+	Price       float64 `db:"price"`
+	ProductID   int64   `db:"product_id"`
+	OrderID     int64   `db:"order_id"`
+	WarehouseID int64   `db:"warehouse_id"`
+	TaxRate     float64 `db:"tax_rate"`
+	TaxAmount   float64 `db:"tax_amount"`
+}
+
+// OrderFilter narrows ListOrders. Zero values mean "no filter". Results are
+// returned newest first; After is the keyset cursor, i.e. the ID of the last
+// order of the previous page.
+type OrderFilter struct {
+	UserID      int64
+	Status      string
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+	MinTotal    *float64
+	MaxTotal    *float64
+	After       int64
+	Limit       int
+}
+
+// OrderItemEdit sets the quantity of a product in an order. A product that is
+// not in the order yet is added; a zero quantity removes it.
+type OrderItemEdit struct {
+	ProductID int64
+	Quantity  int64
+	// TaxRate and TaxAmount are the tax on the whole new quantity.
+	TaxRate   float64
+	TaxAmount float64
+}
+
+type OrderUpdate struct {
+	OrderID       int64
+	PaymentMethod string
+	Items         []OrderItemEdit
+	// ShipTo is used to allocate added items, like Order.ShipTo.
+	ShipTo *allocation.Location
+	// ShippingPrice, when set, is the shipping requoted for the new items.
+	ShippingPrice *float64
+}
+
+// UpsertOptions controls an UpsertProducts batch. With DryRun nothing is
+// saved; with Restore rows matching a soft deleted product restore it
+// instead of failing with ErrProductDeleted.
+type UpsertOptions struct {
+	DryRun  bool
+	Restore bool
+}
+
+// UpsertResult reports what happened to one product of an UpsertProducts batch.
+type UpsertResult struct {
+	Created bool
+	Err     error
+}
+
+const (
+	MovementOrder        = "order"
+	MovementCancellation = "cancellation"
+	MovementAdjustment   = "adjustment"
+	MovementImport       = "import"
+	MovementReturn       = "return"
+)
+
+// StockMovement is one entry of the inventory ledger. Replaying every
+// movement of a product yields its count_in_stock.
+type StockMovement struct {
+	ID        int64 `db:"id"`
+	ProductID int64 `db:"product_id"`
+	// WarehouseID is where the stock moved; zero means the default warehouse.
+	WarehouseID int64     `db:"warehouse_id"`
+	Delta       int64     `db:"delta"`
+	Reason      string    `db:"reason"`
+	Actor       string    `db:"actor"`
+	Reference   string    `db:"reference"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+type StockReconciliation struct {
+	ProductID    int64  `db:"product_id"`
+	SKU          string `db:"sku"`
+	CountInStock int64  `db:"count_in_stock"`
+	LedgerStock  int64  `db:"ledger_stock"`
+}
+
+func (r StockReconciliation) Drift() int64 {
+	return r.CountInStock - r.LedgerStock
+}
+
+type Warehouse struct {
+	ID        int64     `db:"id"`
+	Code      string    `db:"code"`
+	Name      string    `db:"name"`
+	Latitude  float64   `db:"latitude"`
+	Longitude float64   `db:"longitude"`
+	Priority  int       `db:"priority"`
+	IsDefault bool      `db:"is_default"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// WarehouseStock is how much of a product one warehouse holds.
+type WarehouseStock struct {
+	WarehouseID   int64  `db:"warehouse_id"`
+	WarehouseCode string `db:"warehouse_code"`
+	ProductID     int64  `db:"product_id"`
+	Quantity      int64  `db:"quantity"`
+}
+
+// StockSubscription asks for an email when a product is back in stock.
+type StockSubscription struct {
+	ID         int64      `db:"id"`
+	ProductID  int64      `db:"product_id"`
+	Email      string     `db:"email"`
+	CreatedAt  time.Time  `db:"created_at"`
+	NotifiedAt *time.Time `db:"notified_at"`
+}
+
+type Promotion struct {
 	ID           int64      `db:"id"`
-	Name         string     `db:"name"`
-	Image        string     `db:"image"`
-	Category     string     `db:"category"`
+	Code         string     `db:"code"`
 	Description  string     `db:"description"`
-	Rating       int64      `db:"rating"`
-	NumReviews   int64      `db:"num_reviews"`
-	Price        float64    `db:"price"`
-	CountInStock int64      `db:"count_in_stock"`
+	Kind         string     `db:"kind"`
+	Value        float64    `db:"value"`
+	BuyQuantity  int64      `db:"buy_quantity"`
+	GetQuantity  int64      `db:"get_quantity"`
+	MinSubtotal  float64    `db:"min_subtotal"`
+	StartsAt     time.Time  `db:"starts_at"`
+	EndsAt       *time.Time `db:"ends_at"`
+	UsageLimit   int64      `db:"usage_limit"`
+	PerUserLimit int64      `db:"per_user_limit"`
+	TimesUsed    int64      `db:"times_used"`
+	Active       bool       `db:"active"`
 	CreatedAt    time.Time  `db:"created_at"`
 	UpdatedAt    *time.Time `db:"updated_at"`
+	ProductIDs   []int64    `db:"-"`
+	Categories   []string   `db:"-"`
 }
-type Order struct {
+
+const (
+	AdjustmentDiscount         = "discount"
+	AdjustmentShippingDiscount = "shipping_discount"
+)
+
+// OrderAdjustment is a discount applied to an order. OrderItemID is set for
+// line-level adjustments and nil for order-level ones.
+type OrderAdjustment struct {
+	ID          int64     `db:"id"`
+	OrderID     int64     `db:"order_id"`
+	OrderItemID *int64    `db:"order_item_id"`
+	PromotionID *int64    `db:"promotion_id"`
+	Code        string    `db:"code"`
+	Kind        string    `db:"kind"`
+	Amount      float64   `db:"amount"`
+	Description string    `db:"description"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+type ShippingMethod struct {
+	ID        int64     `db:"id"`
+	Code      string    `db:"code"`
+	Name      string    `db:"name"`
+	Active    bool      `db:"active"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// ShippingZone groups destinations that share shipping rates.
+type ShippingZone struct {
+	ID        int64                `db:"id"`
+	Name      string               `db:"name"`
+	CreatedAt time.Time            `db:"created_at"`
+	Regions   []ShippingZoneRegion `db:"-"`
+}
+
+// ShippingZoneRegion is a destination in a zone. An empty Region covers the
+// whole country.
+type ShippingZoneRegion struct {
+	ZoneID  int64  `db:"zone_id"`
+	Country string `db:"country"`
+	Region  string `db:"region"`
+}
+
+// ShippingRate prices a method for a zone, or every destination when ZoneID
+// is nil. Method is the code of the method.
+type ShippingRate struct {
+	ID          int64     `db:"id"`
+	MethodID    int64     `db:"method_id"`
+	Method      string    `db:"method"`
+	ZoneID      *int64    `db:"zone_id"`
+	MinWeight   float64   `db:"min_weight"`
+	MaxWeight   float64   `db:"max_weight"`
+	MinSubtotal float64   `db:"min_subtotal"`
+	MaxSubtotal float64   `db:"max_subtotal"`
+	Price       float64   `db:"price"`
+	PerKg       float64   `db:"per_kg"`
+	FreeAbove   float64   `db:"free_above"`
+	CreatedAt   time.Time `db:"created_at"`
+}
+
+// Address is an entry in a user's address book.
+type Address struct {
+	ID                int64      `db:"id"`
+	UserID            int64      `db:"user_id"`
+	Name              string     `db:"name"`
+	Line1             string     `db:"line1"`
+	Line2             string     `db:"line2"`
+	City              string     `db:"city"`
+	Region            string     `db:"region"`
+	PostalCode        string     `db:"postal_code"`
+	Country           string     `db:"country"`
+	Phone             string     `db:"phone"`
+	IsDefaultShipping bool       `db:"is_default_shipping"`
+	IsDefaultBilling  bool       `db:"is_default_billing"`
+	CreatedAt         time.Time  `db:"created_at"`
+	UpdatedAt         *time.Time `db:"updated_at"`
+}
+
+const (
+	AddressShipping = "shipping"
+	AddressBilling  = "billing"
+)
+
+// OrderAddress is the copy of an address an order was placed with.
+// AddressID is the address book entry it was copied from, if any.
+type OrderAddress struct {
+	ID         int64  `db:"id"`
+	OrderID    int64  `db:"order_id"`
+	Kind       string `db:"kind"`
+	AddressID  *int64 `db:"address_id"`
+	Name       string `db:"name"`
+	Line1      string `db:"line1"`
+	Line2      string `db:"line2"`
+	City       string `db:"city"`
+	Region     string `db:"region"`
+	PostalCode string `db:"postal_code"`
+	Country    string `db:"country"`
+	Phone      string `db:"phone"`
+}
+
+// Payment is an attempt to pay for an order through a payment gateway.
+// Status is one of the payment.Status values.
+type Payment struct {
+	ID             int64      `db:"id"`
+	OrderID        int64      `db:"order_id"`
+	Provider       string     `db:"provider"`
+	Reference      string     `db:"reference"`
+	Status         string     `db:"status"`
+	Amount         float64    `db:"amount"`
+	CapturedAmount float64    `db:"captured_amount"`
+	RefundedAmount float64    `db:"refunded_amount"`
+	Currency       string     `db:"currency"`
+	CardLast4      string     `db:"card_last4"`
+	RedirectURL    string     `db:"redirect_url"`
+	FailureReason  string     `db:"failure_reason"`
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      *time.Time `db:"updated_at"`
+}
+
+// PaymentEvent is a webhook event received from a payment provider. The
+// payload is kept as received so the event can be replayed. An event is
+// processed once it has been applied; until then Error holds why the last
+// attempt failed.
+type PaymentEvent struct {
+	ID          int64      `db:"id"`
+	Provider    string     `db:"provider"`
+	EventID     string     `db:"event_id"`
+	Type        string     `db:"type"`
+	Reference   string     `db:"reference"`
+	Payload     []byte     `db:"payload"`
+	Attempts    int        `db:"attempts"`
+	Error       string     `db:"error"`
+	ReceivedAt  time.Time  `db:"received_at"`
+	ProcessedAt *time.Time `db:"processed_at"`
+}
+
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+)
+
+const (
+	ReturnReasonDamaged        = "damaged"
+	ReturnReasonWrongItem      = "wrong_item"
+	ReturnReasonNotAsDescribed = "not_as_described"
+	ReturnReasonNoLongerNeeded = "no_longer_needed"
+	ReturnReasonOther          = "other"
+)
+
+// Return is a customer's request to send back items of an order. Admins
+// approve or reject it; approving may put the items back in stock.
+type Return struct {
+	ID           int64      `db:"id"`
+	OrderID      int64      `db:"order_id"`
+	Status       string     `db:"status"`
+	Note         string     `db:"note"`
+	DecisionNote string     `db:"decision_note"`
+	DecidedBy    string     `db:"decided_by"`
+	DecidedAt    *time.Time `db:"decided_at"`
+	// RefundedAmount is the sum of the refunds made for the return.
+	RefundedAmount float64    `db:"refunded_amount"`
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      *time.Time `db:"updated_at"`
+	Items          []ReturnItem
+}
+
+type ReturnItem struct {
+	ID          int64  `db:"id"`
+	ReturnID    int64  `db:"return_id"`
+	OrderItemID int64  `db:"order_item_id"`
+	ProductID   int64  `db:"product_id"`
+	Quantity    int64  `db:"quantity"`
+	Reason      string `db:"reason"`
+}
+
+// ReturnFilter narrows ListReturns. Zero values mean "no filter".
+type ReturnFilter struct {
+	OrderID int64
+	Status  string
+}
+
+// Refund is money given back for an order, through one of its payments.
+type Refund struct {
+	ID        int64     `db:"id"`
+	OrderID   int64     `db:"order_id"`
+	PaymentID *int64    `db:"payment_id"`
+	ReturnID  *int64    `db:"return_id"`
+	Amount    float64   `db:"amount"`
+	Reason    string    `db:"reason"`
+	Provider  string    `db:"provider"`
+	Reference string    `db:"reference"`
+	Actor     string    `db:"actor"`
+	Status    string    `db:"status"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// A refund made through the API is pending while the refunder is asked for
+// it. One that stays pending lost the refunder's answer and must be checked
+// with the provider.
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusSucceeded = "succeeded"
+	RefundStatusFailed    = "failed"
+)
+
+// OutboxEvent is an event waiting in the outbox, or already published.
+type OutboxEvent struct {
 	ID            int64      `db:"id"`
-	PaymentMethod string     `db:"payment_method"`
-	TaxPrice      float64    `db:"tax_price"`
-	ShippingPrice float64    `db:"shipping_price"`
-	TotalPrice    float64    `db:"total_price"`
+	AggregateType string     `db:"aggregate_type"`
+	AggregateID   int64      `db:"aggregate_id"`
+	Type          string     `db:"type"`
+	Payload       []byte     `db:"payload"`
+	Attempts      int        `db:"attempts"`
+	LastError     string     `db:"last_error"`
 	CreatedAt     time.Time  `db:"created_at"`
-	UpdatedAt     *time.Time `db:"updated_at"`
-	Items         []OrderItem
+	NextAttemptAt time.Time  `db:"next_attempt_at"`
+	PublishedAt   *time.Time `db:"published_at"`
 }
 
-type OrderItem struct {
-	ID        int64   `db:"id"`
-	Name      string  `db:"name"`
-	Quantity  int64   `db:"quantity"`
-	Image     string  `db:"image"`
-	Price     float64 `db:"price"`
-	ProductID int64   `db:"product_id"`
-	OrderID   int64   `db:"order_id"`
+// WebhookSubscription is an endpoint that receives the events of the given
+// types, signed with its secret.
+type WebhookSubscription struct {
+	ID          int64      `db:"id"`
+	URL         string     `db:"url"`
+	Secret      string     `db:"secret"`
+	Description string     `db:"description"`
+	Active      bool       `db:"active"`
+	CreatedAt   time.Time  `db:"created_at"`
+	UpdatedAt   *time.Time `db:"updated_at"`
+	EventTypes  []string   `db:"-"`
+}
+
+type WebhookDelivery struct {
+	ID             int64      `db:"id"`
+	SubscriptionID int64      `db:"subscription_id"`
+	EventID        int64      `db:"event_id"`
+	EventType      string     `db:"event_type"`
+	Payload        []byte     `db:"payload"`
+	Status         string     `db:"status"`
+	Attempts       int        `db:"attempts"`
+	LastStatusCode int        `db:"last_status_code"`
+	LastError      string     `db:"last_error"`
+	NextAttemptAt  time.Time  `db:"next_attempt_at"`
+	DeliveredAt    *time.Time `db:"delivered_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      *time.Time `db:"updated_at"`
+	// AttemptLog is only loaded by GetWebhookDelivery.
+	AttemptLog []WebhookAttempt `db:"-"`
+}
+
+type WebhookAttempt struct {
+	ID         int64     `db:"id"`
+	DeliveryID int64     `db:"delivery_id"`
+	StatusCode int       `db:"status_code"`
+	Error      string    `db:"error"`
+	DurationMS int64     `db:"duration_ms"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+type WebhookDeliveryFilter struct {
+	SubscriptionID int64
+	Status         string
+}
+
+type Job struct {
+	ID          int64      `db:"id"`
+	Kind        string     `db:"kind"`
+	Payload     []byte     `db:"payload"`
+	Key         *string    `db:"key"`
+	Status      string     `db:"status"`
+	Attempts    int        `db:"attempts"`
+	MaxAttempts int        `db:"max_attempts"`
+	LastError   string     `db:"last_error"`
+	RunAt       time.Time  `db:"run_at"`
+	CreatedAt   time.Time  `db:"created_at"`
+	UpdatedAt   *time.Time `db:"updated_at"`
+	FinishedAt  *time.Time `db:"finished_at"`
+}
+
+// User is an account, without its password.
+type User struct {
+	ID              int64      `db:"id"`
+	Name            string     `db:"name"`
+	Email           string     `db:"email"`
+	IsAdmin         bool       `db:"is_admin"`
+	EmailVerifiedAt *time.Time `db:"email_verified_at"`
+}
+
+// UserToken is a single-use token emailed to a user, stored as a hash.
+// Purpose is one of the auth.Purpose values.
+type UserToken struct {
+	ID        int64      `db:"id"`
+	UserID    int64      `db:"user_id"`
+	Purpose   string     `db:"purpose"`
+	TokenHash string     `db:"token_hash"`
+	ExpiresAt time.Time  `db:"expires_at"`
+	UsedAt    *time.Time `db:"used_at"`
+	CreatedAt time.Time  `db:"created_at"`
 }
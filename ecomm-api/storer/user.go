@@ -0,0 +1,158 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/auth"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/jmoiron/sqlx"
+)
+
+// userColumns are the columns of User, leaving out the password.
+const userColumns = "id, name, email, is_admin, email_verified_at"
+
+func (ps *PySQLStorer) GetUser(ctx context.Context, id int64) (*User, error) {
+	defer metrics.ObserveQuery("GetUser")()
+
+	var u User
+	err := ps.db.GetContext(ctx, &u, "SELECT "+userColumns+" FROM users WHERE id=$1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get user with id %d: %w", id, err))
+	}
+
+	return &u, nil
+}
+
+// GetUserByEmail finds a user by email address, ignoring case.
+func (ps *PySQLStorer) GetUserByEmail(ctx context.Context, email string) (*User, error) {
+	defer metrics.ObserveQuery("GetUserByEmail")()
+
+	var u User
+	err := ps.db.GetContext(ctx, &u,
+		"SELECT "+userColumns+" FROM users WHERE LOWER(email) = LOWER($1) ORDER BY id LIMIT 1", email)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("user with email %s: %w", email, ErrNotFound)
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get user by email: %w", err))
+	}
+
+	return &u, nil
+}
+
+// CreateUserToken stores a token for a user, given by its hash. Tokens the
+// user was sent earlier for the same purpose stop working, so only the
+// latest email's link does.
+func (ps *PySQLStorer) CreateUserToken(ctx context.Context, t *UserToken) (*UserToken, error) {
+	defer metrics.ObserveQuery("CreateUserToken")()
+
+	t.CreatedAt = time.Now()
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		_, err := tx.ExecContext(ctx,
+			"UPDATE user_tokens SET used_at=$1 WHERE user_id=$2 AND purpose=$3 AND used_at IS NULL",
+			t.CreatedAt, t.UserID, t.Purpose,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to revoke earlier tokens: %w", err)
+		}
+
+		err = tx.QueryRowxContext(ctx,
+			`INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`,
+			t.UserID, t.Purpose, t.TokenHash, t.ExpiresAt, t.CreatedAt,
+		).Scan(&t.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to create %s token for user %d: %w", t.Purpose, t.UserID, err))
+	}
+
+	return t, nil
+}
+
+// VerifyEmail uses a verify_email token to mark its user's address as
+// verified.
+func (ps *PySQLStorer) VerifyEmail(ctx context.Context, tokenHash string) (*User, error) {
+	defer metrics.ObserveQuery("VerifyEmail")()
+
+	var u User
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		userID, err := useToken(ctx, tx, auth.PurposeVerifyEmail, tokenHash)
+		if err != nil {
+			return err
+		}
+
+		return tx.GetContext(ctx, &u,
+			`UPDATE users SET email_verified_at = COALESCE(email_verified_at, $1) WHERE id=$2
+			RETURNING `+userColumns,
+			time.Now(), userID,
+		)
+	})
+	if errors.Is(err, ErrInvalidToken) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to verify email: %w", err))
+	}
+
+	return &u, nil
+}
+
+// ResetPassword uses a reset_password token to replace its user's password
+// with passwordHash. Following the emailed link also proves the address,
+// so it is marked as verified.
+func (ps *PySQLStorer) ResetPassword(ctx context.Context, tokenHash, passwordHash string) (*User, error) {
+	defer metrics.ObserveQuery("ResetPassword")()
+
+	var u User
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		userID, err := useToken(ctx, tx, auth.PurposeResetPassword, tokenHash)
+		if err != nil {
+			return err
+		}
+
+		return tx.GetContext(ctx, &u,
+			`UPDATE users SET password=$1, email_verified_at = COALESCE(email_verified_at, $2) WHERE id=$3
+			RETURNING `+userColumns,
+			passwordHash, time.Now(), userID,
+		)
+	})
+	if errors.Is(err, ErrInvalidToken) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to reset password: %w", err))
+	}
+
+	return &u, nil
+}
+
+// useToken marks a token as used and returns its user, or fails with
+// ErrInvalidToken when the token cannot be used for purpose.
+func useToken(ctx context.Context, tx *sqlx.Tx, purpose, tokenHash string) (int64, error) {
+	var userID int64
+	err := tx.GetContext(ctx, &userID,
+		`UPDATE user_tokens SET used_at=$1
+		WHERE token_hash=$2 AND purpose=$3 AND used_at IS NULL AND expires_at > $1
+		RETURNING user_id`,
+		time.Now(), tokenHash, purpose,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to use %s token: %w", purpose, err)
+	}
+	return userID, nil
+}
@@ -0,0 +1,61 @@
+package storer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+)
+
+func (ps *PySQLStorer) CreateWarehouse(ctx context.Context, w *Warehouse) (*Warehouse, error) {
+	defer metrics.ObserveQuery("CreateWarehouse")()
+
+	err := ps.db.QueryRowxContext(ctx,
+		`INSERT INTO warehouses (code, name, latitude, longitude, priority)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		w.Code, w.Name, w.Latitude, w.Longitude, w.Priority,
+	).Scan(&w.ID, &w.CreatedAt)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to insert warehouse %s: %w", w.Code, err))
+	}
+
+	return w, nil
+}
+
+func (ps *PySQLStorer) ListWarehouses(ctx context.Context) ([]Warehouse, error) {
+	defer metrics.ObserveQuery("ListWarehouses")()
+
+	warehouses := []Warehouse{}
+	err := ps.db.SelectContext(ctx, &warehouses, "SELECT * FROM warehouses ORDER BY priority, id")
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list warehouses: %w", err))
+	}
+
+	return warehouses, nil
+}
+
+// ListProductStock returns how much of a product each warehouse holds. The
+// quantities add up to the product's count_in_stock.
+func (ps *PySQLStorer) ListProductStock(ctx context.Context, productID int64) ([]WarehouseStock, error) {
+	defer metrics.ObserveQuery("ListProductStock")()
+
+	if _, err := ps.GetProduct(ctx, productID); err != nil {
+		return nil, err
+	}
+
+	stock := []WarehouseStock{}
+	err := ps.db.SelectContext(ctx, &stock,
+		`SELECT ws.warehouse_id, w.code AS warehouse_code, ws.product_id, ws.quantity
+		FROM warehouse_stock ws
+		JOIN warehouses w ON w.id = ws.warehouse_id
+		WHERE ws.product_id=$1
+		ORDER BY w.priority, w.id`,
+		productID,
+	)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list stock for product %d: %w", productID, err))
+	}
+
+	return stock, nil
+}
@@ -0,0 +1,361 @@
+package storer
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/outbox"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/webhook"
+	"github.com/jmoiron/sqlx"
+)
+
+func (ps *PySQLStorer) CreateWebhookSubscription(ctx context.Context, s *WebhookSubscription) (*WebhookSubscription, error) {
+	defer metrics.ObserveQuery("CreateWebhookSubscription")()
+
+	s.CreatedAt = time.Now()
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.QueryRowxContext(ctx,
+			`INSERT INTO webhook_subscriptions (url, secret, description, active, created_at)
+			VALUES ($1, $2, $3, $4, $5)
+			RETURNING id`,
+			s.URL, s.Secret, s.Description, s.Active, s.CreatedAt,
+		).Scan(&s.ID)
+		if err != nil {
+			return fmt.Errorf("failed to insert webhook subscription: %w", err)
+		}
+		return insertSubscriptionEvents(ctx, tx, s)
+	})
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to create webhook subscription for %s: %w", s.URL, err))
+	}
+
+	return s, nil
+}
+
+func (ps *PySQLStorer) GetWebhookSubscription(ctx context.Context, id int64) (*WebhookSubscription, error) {
+	defer metrics.ObserveQuery("GetWebhookSubscription")()
+
+	var s WebhookSubscription
+	err := ps.db.GetContext(ctx, &s, "SELECT * FROM webhook_subscriptions WHERE id=$1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("webhook subscription %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get webhook subscription with id %d: %w", id, err))
+	}
+
+	subs := []WebhookSubscription{s}
+	if err := loadSubscriptionEvents(ctx, ps.db, subs); err != nil {
+		return nil, logError(ctx, err)
+	}
+
+	return &subs[0], nil
+}
+
+func (ps *PySQLStorer) ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	defer metrics.ObserveQuery("ListWebhookSubscriptions")()
+
+	subs := []WebhookSubscription{}
+	err := ps.db.SelectContext(ctx, &subs, "SELECT * FROM webhook_subscriptions ORDER BY id DESC")
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list webhook subscriptions: %w", err))
+	}
+
+	if err := loadSubscriptionEvents(ctx, ps.db, subs); err != nil {
+		return nil, logError(ctx, err)
+	}
+
+	return subs, nil
+}
+
+// UpdateWebhookSubscription replaces a subscription's settings and event
+// types. Deliveries already queued are sent to the new URL.
+func (ps *PySQLStorer) UpdateWebhookSubscription(ctx context.Context, s *WebhookSubscription) (*WebhookSubscription, error) {
+	defer metrics.ObserveQuery("UpdateWebhookSubscription")()
+
+	now := time.Now()
+	s.UpdatedAt = &now
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		err := tx.QueryRowxContext(ctx,
+			`UPDATE webhook_subscriptions SET url=$1, secret=$2, description=$3, active=$4, updated_at=$5
+			WHERE id=$6
+			RETURNING created_at`,
+			s.URL, s.Secret, s.Description, s.Active, s.UpdatedAt, s.ID,
+		).Scan(&s.CreatedAt)
+		if errors.Is(err, sql.ErrNoRows) {
+			return fmt.Errorf("webhook subscription %d: %w", s.ID, ErrNotFound)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to update webhook subscription: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, "DELETE FROM webhook_subscription_events WHERE subscription_id=$1", s.ID)
+		if err != nil {
+			return fmt.Errorf("failed to clear event types: %w", err)
+		}
+		return insertSubscriptionEvents(ctx, tx, s)
+	})
+	if errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to update webhook subscription %d: %w", s.ID, err))
+	}
+
+	return s, nil
+}
+
+// DeleteWebhookSubscription removes a subscription along with its
+// deliveries.
+func (ps *PySQLStorer) DeleteWebhookSubscription(ctx context.Context, id int64) error {
+	defer metrics.ObserveQuery("DeleteWebhookSubscription")()
+
+	res, err := ps.db.ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id=$1", id)
+	if err != nil {
+		return logError(ctx, fmt.Errorf("failed to delete webhook subscription with id %d: %w", id, err))
+	}
+	return expectAffected(res, "webhook subscription", id)
+}
+
+func insertSubscriptionEvents(ctx context.Context, tx *sqlx.Tx, s *WebhookSubscription) error {
+	for _, t := range s.EventTypes {
+		_, err := tx.ExecContext(ctx,
+			"INSERT INTO webhook_subscription_events (subscription_id, event_type) VALUES ($1, $2) ON CONFLICT DO NOTHING",
+			s.ID, t,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to subscribe %d to %s: %w", s.ID, t, err)
+		}
+	}
+	return nil
+}
+
+func loadSubscriptionEvents(ctx context.Context, q sqlx.QueryerContext, subs []WebhookSubscription) error {
+	if len(subs) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(subs))
+	byID := make(map[int64]*WebhookSubscription, len(subs))
+	for i := range subs {
+		ids[i] = subs[i].ID
+		byID[subs[i].ID] = &subs[i]
+		subs[i].EventTypes = []string{}
+	}
+
+	var events []struct {
+		SubscriptionID int64  `db:"subscription_id"`
+		EventType      string `db:"event_type"`
+	}
+	err := sqlx.SelectContext(ctx, q, &events,
+		"SELECT subscription_id, event_type FROM webhook_subscription_events WHERE subscription_id = ANY($1) ORDER BY id", ids)
+	if err != nil {
+		return fmt.Errorf("failed to get subscription event types: %w", err)
+	}
+
+	for _, e := range events {
+		s := byID[e.SubscriptionID]
+		s.EventTypes = append(s.EventTypes, e.EventType)
+	}
+	return nil
+}
+
+// EnqueueWebhookDeliveries queues e for every active subscription to its
+// type. An event is queued at most once per subscription, so the outbox may
+// hand it over again.
+func (ps *PySQLStorer) EnqueueWebhookDeliveries(ctx context.Context, e outbox.Event) (int, error) {
+	defer metrics.ObserveQuery("EnqueueWebhookDeliveries")()
+
+	b, err := json.Marshal(e)
+	if err != nil {
+		return 0, logError(ctx, fmt.Errorf("failed to encode event %d: %w", e.ID, err))
+	}
+
+	res, err := ps.db.ExecContext(ctx,
+		`INSERT INTO webhook_deliveries (subscription_id, event_id, event_type, payload, next_attempt_at, created_at)
+		SELECT s.id, $1, $2, $3, $4, $4 FROM webhook_subscriptions s
+		JOIN webhook_subscription_events se ON se.subscription_id = s.id
+		WHERE s.active AND se.event_type = $2
+		ON CONFLICT (subscription_id, event_id) DO NOTHING`,
+		e.ID, e.Type, b, time.Now(),
+	)
+	if err != nil {
+		return 0, logError(ctx, fmt.Errorf("failed to queue webhook deliveries of event %d: %w", e.ID, err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, logError(ctx, fmt.Errorf("failed to count webhook deliveries of event %d: %w", e.ID, err))
+	}
+
+	return int(n), nil
+}
+
+// DeliverWebhooks sends up to limit due deliveries of active subscriptions,
+// oldest first. Claimed deliveries are leased for webhook.LeaseTime and sent
+// after the claim commits, so a slow subscriber holds no locks and
+// dispatchers running side by side never send the same delivery at the same
+// time. A failed delivery is retried with webhook.Backoff until it has been
+// tried maxAttempts times, when it is dead.
+func (ps *PySQLStorer) DeliverWebhooks(ctx context.Context, limit, maxAttempts int, send func(context.Context, webhook.Delivery) webhook.Attempt) (int, error) {
+	defer metrics.ObserveQuery("DeliverWebhooks")()
+
+	var deliveries []struct {
+		WebhookDelivery
+		URL    string `db:"url"`
+		Secret string `db:"secret"`
+	}
+	err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+		now := time.Now()
+		err := tx.SelectContext(ctx, &deliveries,
+			`SELECT d.*, s.url, s.secret FROM webhook_deliveries d
+			JOIN webhook_subscriptions s ON s.id = d.subscription_id
+			WHERE d.status = 'pending' AND d.next_attempt_at <= $1 AND s.active
+			ORDER BY d.next_attempt_at, d.id
+			LIMIT $2
+			FOR UPDATE OF d SKIP LOCKED`,
+			now, limit,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to claim webhook deliveries: %w", err)
+		}
+		if len(deliveries) == 0 {
+			return nil
+		}
+
+		ids := make([]int64, len(deliveries))
+		for i, d := range deliveries {
+			ids[i] = d.ID
+		}
+		_, err = tx.ExecContext(ctx,
+			"UPDATE webhook_deliveries SET next_attempt_at=$1 WHERE id = ANY($2)", now.Add(webhook.LeaseTime), ids)
+		if err != nil {
+			return fmt.Errorf("failed to lease webhook deliveries: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, logError(ctx, fmt.Errorf("failed to deliver webhooks: %w", err))
+	}
+
+	for _, d := range deliveries {
+		a := send(ctx, webhook.Delivery{
+			ID:             d.ID,
+			SubscriptionID: d.SubscriptionID,
+			URL:            d.URL,
+			Secret:         d.Secret,
+			EventID:        d.EventID,
+			EventType:      d.EventType,
+			Payload:        d.Payload,
+			Attempts:       d.Attempts,
+		})
+		err := ps.execTx(ctx, func(tx *sqlx.Tx) error {
+			return recordWebhookAttempt(ctx, tx, &d.WebhookDelivery, a, maxAttempts)
+		})
+		if err != nil {
+			return len(deliveries), logError(ctx, err)
+		}
+	}
+
+	return len(deliveries), nil
+}
+
+func recordWebhookAttempt(ctx context.Context, tx *sqlx.Tx, d *WebhookDelivery, a webhook.Attempt, maxAttempts int) error {
+	now := time.Now()
+	_, err := tx.ExecContext(ctx,
+		`INSERT INTO webhook_delivery_attempts (delivery_id, status_code, error, duration_ms, created_at)
+		VALUES ($1, $2, $3, $4, $5)`,
+		d.ID, a.StatusCode, a.Error, a.Duration.Milliseconds(), now,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to log attempt of webhook delivery %d: %w", d.ID, err)
+	}
+
+	attempts := d.Attempts + 1
+	var deliveredAt *time.Time
+	status, next := webhook.DeliveryPending, now.Add(webhook.Backoff(attempts))
+	switch {
+	case a.OK():
+		status, deliveredAt = webhook.DeliverySucceeded, &now
+	case attempts >= maxAttempts:
+		status = webhook.DeliveryDead
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`UPDATE webhook_deliveries SET status=$1, attempts=$2, last_status_code=$3, last_error=$4,
+		next_attempt_at=$5, delivered_at=$6, updated_at=$7
+		WHERE id=$8`,
+		status, attempts, a.StatusCode, a.Error, next, deliveredAt, now, d.ID,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save outcome of webhook delivery %d: %w", d.ID, err)
+	}
+	return nil
+}
+
+func (ps *PySQLStorer) ListWebhookDeliveries(ctx context.Context, f WebhookDeliveryFilter) ([]WebhookDelivery, error) {
+	defer metrics.ObserveQuery("ListWebhookDeliveries")()
+
+	query := "SELECT * FROM webhook_deliveries WHERE TRUE"
+	var args []any
+	if f.SubscriptionID != 0 {
+		args = append(args, f.SubscriptionID)
+		query += fmt.Sprintf(" AND subscription_id = $%d", len(args))
+	}
+	if f.Status != "" {
+		args = append(args, f.Status)
+		query += fmt.Sprintf(" AND status = $%d", len(args))
+	}
+	query += " ORDER BY id DESC LIMIT 100"
+
+	deliveries := []WebhookDelivery{}
+	if err := ps.db.SelectContext(ctx, &deliveries, query, args...); err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to list webhook deliveries: %w", err))
+	}
+
+	return deliveries, nil
+}
+
+// GetWebhookDelivery returns a delivery with the log of its attempts.
+func (ps *PySQLStorer) GetWebhookDelivery(ctx context.Context, id int64) (*WebhookDelivery, error) {
+	defer metrics.ObserveQuery("GetWebhookDelivery")()
+
+	var d WebhookDelivery
+	err := ps.db.GetContext(ctx, &d, "SELECT * FROM webhook_deliveries WHERE id=$1", id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("webhook delivery %d: %w", id, ErrNotFound)
+	}
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get webhook delivery with id %d: %w", id, err))
+	}
+
+	d.AttemptLog = []WebhookAttempt{}
+	err = ps.db.SelectContext(ctx, &d.AttemptLog,
+		"SELECT * FROM webhook_delivery_attempts WHERE delivery_id=$1 ORDER BY id", id)
+	if err != nil {
+		return nil, logError(ctx, fmt.Errorf("failed to get attempts of webhook delivery %d: %w", id, err))
+	}
+
+	return &d, nil
+}
+
+// RedeliverWebhook queues a delivery to be sent again straight away with a
+// fresh set of attempts, whatever its status. Earlier attempts stay in its
+// log.
+func (ps *PySQLStorer) RedeliverWebhook(ctx context.Context, id int64) error {
+	defer metrics.ObserveQuery("RedeliverWebhook")()
+
+	now := time.Now()
+	res, err := ps.db.ExecContext(ctx,
+		"UPDATE webhook_deliveries SET status=$1, attempts=0, next_attempt_at=$2, updated_at=$2 WHERE id=$3",
+		webhook.DeliveryPending, now, id,
+	)
+	if err != nil {
+		return logError(ctx, fmt.Errorf("failed to redeliver webhook delivery with id %d: %w", id, err))
+	}
+	return expectAffected(res, "webhook delivery", id)
+}
@@ -0,0 +1,93 @@
+package tax
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+)
+
+func LoadConfig() *Config {
+	return &Config{RatesFile: os.Getenv("TAX_RATES_FILE")}
+}
+
+// LoadTable reads the rates table named by cfg, or returns an empty table
+// when there is none.
+func LoadTable(cfg *Config) (*Table, error) {
+	if cfg.RatesFile == "" {
+		return &Table{}, nil
+	}
+
+	b, err := os.ReadFile(cfg.RatesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read tax rates: %w", err)
+	}
+
+	var t Table
+	if err := json.Unmarshal(b, &t); err != nil {
+		return nil, fmt.Errorf("failed to parse tax rates %s: %w", cfg.RatesFile, err)
+	}
+	for _, r := range t.Rates {
+		if r.Country == "" || r.Rate < 0 {
+			return nil, fmt.Errorf("invalid tax rate %+v: country is required and rate cannot be negative", r)
+		}
+	}
+	return &t, nil
+}
+
+func (t *Table) Calculate(_ context.Context, req Request) (*Result, error) {
+	res := &Result{Inclusive: t.Inclusive, Lines: make([]LineTax, len(req.Lines))}
+
+	for i, l := range req.Lines {
+		rate := t.rate(req.Address, l.Category)
+		gross := l.UnitPrice * float64(l.Quantity)
+
+		var amount float64
+		if t.Inclusive {
+			amount = gross - gross/(1+rate)
+		} else {
+			amount = gross * rate
+		}
+
+		res.Lines[i] = LineTax{Rate: rate, Amount: round(amount)}
+		res.Total += res.Lines[i].Amount
+	}
+
+	res.Total = round(res.Total)
+	return res, nil
+}
+
+// rate finds the most specific rate for an address and category: a region
+// beats the whole country, and a category beats the standard rate.
+func (t *Table) rate(a Address, category string) float64 {
+	best, bestScore := 0.0, -1
+	for _, r := range t.Rates {
+		if !strings.EqualFold(r.Country, a.Country) {
+			continue
+		}
+		if r.Region != "" && !strings.EqualFold(r.Region, a.Region) {
+			continue
+		}
+		if r.Category != "" && r.Category != category {
+			continue
+		}
+
+		score := 0
+		if r.Region != "" {
+			score += 2
+		}
+		if r.Category != "" {
+			score++
+		}
+		if score > bestScore {
+			best, bestScore = r.Rate, score
+		}
+	}
+	return best
+}
+
+func round(v float64) float64 {
+	return math.Round(v*100) / 100
+}
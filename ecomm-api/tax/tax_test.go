@@ -0,0 +1,97 @@
+package tax
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTableCalculate(t *testing.T) {
+	rates := []Rate{
+		{Country: "US", Region: "CA", Rate: 0.0725},
+		{Country: "US", Region: "CA", Category: "food", Rate: 0},
+		{Country: "DE", Rate: 0.19},
+		{Country: "DE", Category: "books", Rate: 0.07},
+	}
+	lines := []Line{
+		{ProductID: 1, Category: "", UnitPrice: 100, Quantity: 2},
+		{ProductID: 2, Category: "food", UnitPrice: 10, Quantity: 1},
+		{ProductID: 3, Category: "books", UnitPrice: 10.70, Quantity: 1},
+	}
+
+	tsc := []struct {
+		name      string
+		inclusive bool
+		address   Address
+		want      *Result
+	}{
+		{
+			name:    "exclusive regional rate with a zero-rated category",
+			address: Address{Country: "us", Region: "ca"},
+			want: &Result{
+				Lines: []LineTax{{Rate: 0.0725, Amount: 14.5}, {Rate: 0, Amount: 0}, {Rate: 0.0725, Amount: 0.78}},
+				Total: 15.28,
+			},
+		},
+		{
+			name:      "inclusive country rate with a reduced category",
+			inclusive: true,
+			address:   Address{Country: "DE", Region: "BE"},
+			want: &Result{
+				Inclusive: true,
+				Lines:     []LineTax{{Rate: 0.19, Amount: 31.93}, {Rate: 0.19, Amount: 1.6}, {Rate: 0.07, Amount: 0.7}},
+				Total:     34.23,
+			},
+		},
+		{
+			name:    "no rate for the address",
+			address: Address{Country: "US", Region: "OR"},
+			want: &Result{
+				Lines: []LineTax{{}, {}, {}},
+			},
+		},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			table := &Table{Inclusive: tc.inclusive, Rates: rates}
+			got, err := table.Calculate(context.Background(), Request{Address: tc.address, Lines: lines})
+			require.NoError(t, err)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestLoadTable(t *testing.T) {
+	dir := t.TempDir()
+
+	tsc := []struct {
+		name    string
+		content string
+		err     bool
+	}{
+		{name: "valid", content: `{"inclusive": true, "rates": [{"country": "DE", "rate": 0.19}]}`},
+		{name: "missing country", content: `{"rates": [{"rate": 0.19}]}`, err: true},
+		{name: "negative rate", content: `{"rates": [{"country": "DE", "rate": -1}]}`, err: true},
+		{name: "not json", content: `rates`, err: true},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(dir, tc.name+".json")
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0o644))
+
+			table, err := LoadTable(&Config{RatesFile: path})
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.True(t, table.Inclusive)
+			require.Len(t, table.Rates, 1)
+		})
+	}
+}
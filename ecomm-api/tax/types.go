@@ -0,0 +1,60 @@
+package tax
+
+import "context"
+
+type Config struct {
+	// RatesFile is a JSON Table. Without one no tax is charged.
+	RatesFile string
+}
+
+type Address struct {
+	Country    string
+	Region     string
+	PostalCode string
+}
+
+type Line struct {
+	ProductID int64
+	Category  string
+	UnitPrice float64
+	Quantity  int64
+}
+
+// LineTax is the tax on one line, in the same order as Request.Lines.
+type LineTax struct {
+	Rate   float64
+	Amount float64
+}
+
+type Request struct {
+	Address Address
+	Lines   []Line
+}
+
+type Result struct {
+	// Inclusive means prices already include the tax, so it is part of the
+	// subtotal rather than added on top.
+	Inclusive bool
+	Lines     []LineTax
+	Total     float64
+}
+
+type Calculator interface {
+	Calculate(ctx context.Context, req Request) (*Result, error)
+}
+
+// Rate applies to an address and product tax category. Empty Region and
+// Category match any region and category.
+type Rate struct {
+	Country  string  `json:"country"`
+	Region   string  `json:"region"`
+	Category string  `json:"category"`
+	Rate     float64 `json:"rate"`
+}
+
+// Table is the default Calculator: a list of rates looked up by country,
+// region and tax category.
+type Table struct {
+	Inclusive bool   `json:"inclusive"`
+	Rates     []Rate `json:"rates"`
+}
@@ -0,0 +1,8 @@
+package tracing
+
+type Config struct {
+	Exporter    string
+	File        string
+	ServiceName string
+	SampleRatio float64
+}
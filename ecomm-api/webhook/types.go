@@ -0,0 +1,76 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/outbox"
+)
+
+// Headers of every delivery. The signature has the form
+// "t=<unix seconds>,v1=<hex HMAC-SHA256 of "<t>.<body>">" and is made with
+// the subscription's secret.
+const (
+	SignatureHeader = "Webhook-Signature"
+	IDHeader        = "Webhook-ID"
+	EventHeader     = "Webhook-Event"
+)
+
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	// DeliveryDead is a delivery that failed MaxAttempts times. It is only
+	// sent again when redelivered by hand.
+	DeliveryDead = "dead"
+)
+
+// LeaseTime is how long a dispatcher has to send the deliveries it claimed
+// before another dispatcher may claim them again. It outlasts a batch of
+// sends to subscribers that all time out.
+const LeaseTime = 15 * time.Minute
+
+type Config struct {
+	MaxAttempts  int
+	Timeout      time.Duration
+	PollInterval time.Duration
+	BatchSize    int
+	// AllowPrivateHosts lets deliveries go to loopback and private network
+	// addresses, for local development only.
+	AllowPrivateHosts bool
+}
+
+// Delivery is one event on its way to one subscription.
+type Delivery struct {
+	ID             int64
+	SubscriptionID int64
+	URL            string
+	Secret         string
+	EventID        int64
+	EventType      string
+	// Payload is the outbox.Event, as JSON.
+	Payload  json.RawMessage
+	Attempts int
+}
+
+// Attempt is the outcome of sending a delivery once.
+type Attempt struct {
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+}
+
+// OK reports whether the subscriber accepted the delivery.
+func (a Attempt) OK() bool {
+	return a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+type Store interface {
+	// EnqueueWebhookDeliveries creates a delivery of e for every active
+	// subscription to its type, once however often it is called.
+	EnqueueWebhookDeliveries(ctx context.Context, e outbox.Event) (int, error)
+	// DeliverWebhooks calls send for up to limit deliveries that are due
+	// and records each attempt, giving up on a delivery after maxAttempts.
+	// It returns how many deliveries it tried.
+	DeliverWebhooks(ctx context.Context, limit, maxAttempts int, send func(context.Context, Delivery) Attempt) (int, error)
+}
@@ -0,0 +1,289 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/metrics"
+	"github.com/EmanuelAcosta1695/ecomm/ecomm-api/outbox"
+)
+
+var (
+	ErrInvalidSignature = errors.New("invalid webhook signature")
+	// ErrPrivateHost is a subscriber address on this host or a private
+	// network, where deliveries could reach internal services.
+	ErrPrivateHost = errors.New("webhook host is not public")
+)
+
+func LoadConfig() (*Config, error) {
+	cfg := &Config{
+		MaxAttempts:  8,
+		Timeout:      10 * time.Second,
+		PollInterval: time.Second,
+		BatchSize:    50,
+	}
+
+	if v := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS %q: must be a positive integer", v)
+		}
+		cfg.MaxAttempts = n
+	}
+	if v := os.Getenv("WEBHOOK_BATCH_SIZE"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid WEBHOOK_BATCH_SIZE %q: must be a positive integer", v)
+		}
+		cfg.BatchSize = n
+	}
+	if v := os.Getenv("WEBHOOK_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_TIMEOUT %q: must be a positive duration", v)
+		}
+		cfg.Timeout = d
+	}
+	if v := os.Getenv("WEBHOOK_POLL_INTERVAL"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("invalid WEBHOOK_POLL_INTERVAL %q: must be a positive duration", v)
+		}
+		cfg.PollInterval = d
+	}
+	if v := os.Getenv("WEBHOOK_ALLOW_PRIVATE_HOSTS"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WEBHOOK_ALLOW_PRIVATE_HOSTS %q: must be a boolean", v)
+		}
+		cfg.AllowPrivateHosts = b
+	}
+
+	return cfg, nil
+}
+
+// CheckHost rejects a subscriber host that names this host or is a
+// loopback, private, link-local or unspecified address. Names that resolve
+// to such addresses are refused when the dispatcher dials them.
+func CheckHost(host string) error {
+	name := strings.TrimSuffix(strings.ToLower(host), ".")
+	if name == "localhost" || strings.HasSuffix(name, ".localhost") {
+		return fmt.Errorf("%s: %w", host, ErrPrivateHost)
+	}
+	if ip, err := netip.ParseAddr(name); err == nil && !publicAddr(ip) {
+		return fmt.Errorf("%s: %w", host, ErrPrivateHost)
+	}
+	return nil
+}
+
+func publicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	return !ip.IsLoopback() && !ip.IsPrivate() && !ip.IsLinkLocalUnicast() &&
+		!ip.IsLinkLocalMulticast() && !ip.IsInterfaceLocalMulticast() &&
+		!ip.IsMulticast() && !ip.IsUnspecified()
+}
+
+// dialPublic is a net.Dialer Control that refuses to connect to an address
+// CheckHost would reject, whatever name it was resolved from.
+func dialPublic(_, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("unexpected address %q: %w", address, ErrPrivateHost)
+	}
+	if !publicAddr(ap.Addr()) {
+		return fmt.Errorf("%s: %w", ap.Addr(), ErrPrivateHost)
+	}
+	return nil
+}
+
+// NewSecret returns a random signing secret for a subscription.
+func NewSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// Sign returns the SignatureHeader value for body sent at t.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + signature(secret, ts, body)
+}
+
+// Verify checks a SignatureHeader value the way subscribers should: the
+// signature must match and be no older than tolerance.
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = v
+		case "v1":
+			sig = v
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || sig == "" {
+		return fmt.Errorf("malformed %s header: %w", SignatureHeader, ErrInvalidSignature)
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > tolerance || d < -tolerance {
+		return fmt.Errorf("signature timestamp %d outside tolerance: %w", sec, ErrInvalidSignature)
+	}
+	if !hmac.Equal([]byte(sig), []byte(signature(secret, ts, body))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func signature(secret, ts string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Backoff is how long to wait before sending a delivery again after its
+// attempt-th failure: doubling from ten seconds, up to an hour.
+func Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	if attempt > 10 {
+		return time.Hour
+	}
+	return min((10*time.Second)<<(attempt-1), time.Hour)
+}
+
+// Enqueuer is the outbox.Publisher that turns events into deliveries for
+// the subscriptions that want them. Dispatcher sends them.
+type Enqueuer struct {
+	Store Store
+}
+
+func (q *Enqueuer) Publish(ctx context.Context, e outbox.Event) error {
+	_, err := q.Store.EnqueueWebhookDeliveries(ctx, e)
+	return err
+}
+
+// Dispatcher sends due deliveries to their subscribers.
+type Dispatcher struct {
+	Store       Store
+	Client      *http.Client
+	MaxAttempts int
+	BatchSize   int
+	// Interval is how long to wait before looking again once nothing is
+	// due.
+	Interval time.Duration
+}
+
+func NewDispatcher(st Store, cfg *Config) *Dispatcher {
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivateHosts {
+		dialer.Control = dialPublic
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	// Deliveries go straight to the subscriber, so every address dialed is
+	// checked.
+	transport.Proxy = nil
+
+	return &Dispatcher{
+		Store: st,
+		Client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: transport,
+			// A redirect is a failed delivery: the signed payload goes
+			// only to the subscribed URL.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		MaxAttempts: cfg.MaxAttempts,
+		BatchSize:   cfg.BatchSize,
+		Interval:    cfg.PollInterval,
+	}
+}
+
+// Run sends deliveries until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	for {
+		n, err := d.DispatchOnce(ctx)
+		if err == nil && n >= d.BatchSize {
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(d.Interval):
+		}
+	}
+}
+
+// DispatchOnce sends one batch of due deliveries and returns how many it
+// tried.
+func (d *Dispatcher) DispatchOnce(ctx context.Context) (int, error) {
+	return d.Store.DeliverWebhooks(ctx, d.BatchSize, d.MaxAttempts, d.Send)
+}
+
+// Send POSTs a delivery to its subscriber, signed with the subscription's
+// secret.
+func (d *Dispatcher) Send(ctx context.Context, dl Delivery) Attempt {
+	start := time.Now()
+	a := d.send(ctx, dl)
+	a.Duration = time.Since(start)
+
+	result := "failed"
+	if a.OK() {
+		result = "succeeded"
+	} else {
+		slog.Warn("webhook delivery failed", "delivery_id", dl.ID, "subscription_id", dl.SubscriptionID,
+			"status", a.StatusCode, "error", a.Error)
+	}
+	metrics.WebhookDeliveries.WithLabelValues(result).Inc()
+	return a
+}
+
+func (d *Dispatcher) send(ctx context.Context, dl Delivery) Attempt {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, dl.URL, bytes.NewReader(dl.Payload))
+	if err != nil {
+		return Attempt{Error: fmt.Sprintf("failed to build request: %v", err)}
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(IDHeader, strconv.FormatInt(dl.ID, 10))
+	req.Header.Set(EventHeader, dl.EventType)
+	req.Header.Set(SignatureHeader, Sign(dl.Secret, time.Now(), dl.Payload))
+
+	res, err := d.Client.Do(req)
+	if err != nil {
+		return Attempt{Error: err.Error()}
+	}
+	defer res.Body.Close()
+	// Drain a little of the body so the connection can be reused.
+	io.Copy(io.Discard, io.LimitReader(res.Body, 4<<10))
+
+	a := Attempt{StatusCode: res.StatusCode}
+	if !a.OK() {
+		a.Error = "subscriber returned " + res.Status
+	}
+	return a
+}
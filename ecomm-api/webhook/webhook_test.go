@@ -0,0 +1,155 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"id":7,"type":"order.created"}`)
+	now := time.Date(2025, 11, 3, 9, 0, 0, 0, time.UTC)
+
+	tsc := []struct {
+		name   string
+		header string
+		body   []byte
+		err    bool
+	}{
+		{name: "valid", header: Sign("whsec_test", now, body), body: body},
+		{name: "wrong secret", header: Sign("whsec_other", now, body), body: body, err: true},
+		{name: "tampered body", header: Sign("whsec_test", now, body), body: []byte(`{"id":8}`), err: true},
+		{name: "too old", header: Sign("whsec_test", now.Add(-10*time.Minute), body), body: body, err: true},
+		{name: "malformed", header: "v1=abc", body: body, err: true},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			err := Verify("whsec_test", tc.header, tc.body, now, 5*time.Minute)
+			if tc.err {
+				require.ErrorIs(t, err, ErrInvalidSignature)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	require.Equal(t, 10*time.Second, Backoff(1))
+	require.Equal(t, 20*time.Second, Backoff(2))
+	require.Equal(t, 80*time.Second, Backoff(4))
+	require.Equal(t, time.Hour, Backoff(10))
+	require.Equal(t, time.Hour, Backoff(100))
+}
+
+func TestSend(t *testing.T) {
+	tsc := []struct {
+		name   string
+		status int
+		ok     bool
+	}{
+		{name: "accepted", status: http.StatusNoContent, ok: true},
+		{name: "server error", status: http.StatusInternalServerError},
+		{name: "redirect", status: http.StatusFound},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.name, func(t *testing.T) {
+			d := Delivery{
+				ID:        12,
+				Secret:    "whsec_test",
+				EventID:   7,
+				EventType: "order.created",
+				Payload:   json.RawMessage(`{"id":7,"type":"order.created"}`),
+			}
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, err := io.ReadAll(r.Body)
+				require.NoError(t, err)
+				require.JSONEq(t, string(d.Payload), string(body))
+				require.Equal(t, "12", r.Header.Get(IDHeader))
+				require.Equal(t, "order.created", r.Header.Get(EventHeader))
+				require.NoError(t, Verify(d.Secret, r.Header.Get(SignatureHeader), body, time.Now(), time.Minute))
+				if tc.status == http.StatusFound {
+					w.Header().Set("Location", "/elsewhere")
+				}
+				w.WriteHeader(tc.status)
+			}))
+			defer srv.Close()
+			d.URL = srv.URL
+
+			disp := NewDispatcher(nil, &Config{Timeout: time.Second, AllowPrivateHosts: true})
+			a := disp.Send(context.Background(), d)
+			require.Equal(t, tc.ok, a.OK())
+			require.Equal(t, tc.status, a.StatusCode)
+			if !tc.ok {
+				require.NotEmpty(t, a.Error)
+			}
+		})
+	}
+}
+
+func TestSendUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	disp := &Dispatcher{Client: &http.Client{Timeout: time.Second}}
+	a := disp.Send(context.Background(), Delivery{ID: 1, URL: url, Secret: "whsec_test", Payload: json.RawMessage(`{}`)})
+	require.False(t, a.OK())
+	require.Zero(t, a.StatusCode)
+	require.NotEmpty(t, a.Error)
+}
+
+func TestSendPrivateHost(t *testing.T) {
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+
+	disp := NewDispatcher(nil, &Config{Timeout: time.Second})
+	a := disp.Send(context.Background(), Delivery{ID: 1, URL: srv.URL, Secret: "whsec_test", Payload: json.RawMessage(`{}`)})
+	require.False(t, a.OK())
+	require.Zero(t, a.StatusCode)
+	require.Contains(t, a.Error, ErrPrivateHost.Error())
+	require.False(t, called)
+}
+
+func TestCheckHost(t *testing.T) {
+	tsc := []struct {
+		host string
+		ok   bool
+	}{
+		{host: "partner.example", ok: true},
+		{host: "93.184.216.34", ok: true},
+		{host: "2606:2800:220:1::", ok: true},
+		{host: "localhost"},
+		{host: "api.localhost."},
+		{host: "127.0.0.1"},
+		{host: "10.0.0.8"},
+		{host: "192.168.1.1"},
+		{host: "169.254.169.254"},
+		{host: "0.0.0.0"},
+		{host: "::1"},
+		{host: "fd00::1"},
+		{host: "::ffff:127.0.0.1"},
+	}
+
+	for _, tc := range tsc {
+		t.Run(tc.host, func(t *testing.T) {
+			err := CheckHost(tc.host)
+			if tc.ok {
+				require.NoError(t, err)
+			} else {
+				require.ErrorIs(t, err, ErrPrivateHost)
+			}
+		})
+	}
+}